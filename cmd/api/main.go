@@ -16,6 +16,7 @@ import (
 	"github.com/fhuszti/medias-ms-go/internal/handler/api"
 	"github.com/fhuszti/medias-ms-go/internal/logger"
 	cMiddleware "github.com/fhuszti/medias-ms-go/internal/middleware"
+	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	"github.com/fhuszti/medias-ms-go/internal/renderer"
 	"github.com/fhuszti/medias-ms-go/internal/repository/mariadb"
@@ -43,9 +44,10 @@ func main() {
 	r := initRouter(ctx, cfg.JWTPublicKey)
 
 	strg := initStorage(ctx, cfg)
-	initBuckets(ctx, strg, cfg.Buckets)
+	initBuckets(ctx, strg, cfg.Buckets, cfg.BucketsSettings)
 
 	mediaRepo := mariadb.NewMediaRepository(database.DB)
+	versionRepo := mariadb.NewMediaVersionRepository(database.DB)
 	var ca port.Cache
 	var dispatcher port.TaskDispatcher
 	if cfg.RedisAddr != "" {
@@ -61,19 +63,60 @@ func main() {
 	uploadLinkGeneratorSvc := mediaSvc.NewUploadLinkGenerator(mediaRepo, strg, msuuid.NewUUID)
 	r.Post("/medias/generate_upload_link", api.GenerateUploadLinkHandler(uploadLinkGeneratorSvc))
 
-	uploadFinaliserSvc := mediaSvc.NewUploadFinaliser(mediaRepo, strg, dispatcher)
+	uploadFinaliserSvc := mediaSvc.NewUploadFinaliser(mediaRepo, strg, dispatcher, cfg.BucketsSettings)
 	r.With(cMiddleware.WithMediaID()).
 		Post("/medias/finalise_upload/{id}", api.FinaliseUploadHandler(uploadFinaliserSvc, cfg.Buckets))
 
-	getMediaSvc := mediaSvc.NewMediaGetter(mediaRepo, strg)
+	getMediaSvc := mediaSvc.NewMediaGetter(mediaRepo, strg, cfg.BucketsSettings)
 	rendererSvc := renderer.NewHTTPRenderer(ca)
 	r.With(cMiddleware.WithMediaID()).
 		Get("/medias/{id}", api.GetMediaHandler(rendererSvc, getMediaSvc))
 
-	deleteMediaSvc := mediaSvc.NewMediaDeleter(mediaRepo, ca, strg)
+	mediaContentSvc := mediaSvc.NewMediaContentGetter(mediaRepo, strg, ca, cfg.BucketsSettings)
+	mediaContentHandler := api.GetMediaContentHandler(mediaContentSvc, cfg.ContentCacheControl)
+	for _, pattern := range []string{"/medias/{id}/content", "/medias/{id}/variants/{name}/content"} {
+		r.With(cMiddleware.WithMediaID()).Get(pattern, mediaContentHandler)
+		r.With(cMiddleware.WithMediaID()).Head(pattern, mediaContentHandler)
+	}
+
+	downloadMediaSvc := mediaSvc.NewMediaDownloader(mediaRepo, strg, cfg.BucketsSettings)
+	r.With(cMiddleware.WithMediaID()).
+		Get("/medias/{id}/download", api.DownloadMediaHandler(downloadMediaSvc, mediaContentHandler))
+
+	deleteMediaSvc := mediaSvc.NewMediaDeleter(mediaRepo, versionRepo, ca, strg)
 	r.With(cMiddleware.WithMediaID()).
 		Delete("/medias/{id}", api.DeleteMediaHandler(deleteMediaSvc))
 
+	restoreMediaSvc := mediaSvc.NewMediaRestorer(mediaRepo, versionRepo, ca, strg)
+	r.With(cMiddleware.WithMediaID()).
+		Post("/medias/{id}/restore", api.RestoreMediaHandler(restoreMediaSvc))
+
+	versionUploadLinkSvc := mediaSvc.NewVersionUploadLinkGenerator(mediaRepo, versionRepo, strg)
+	r.With(cMiddleware.WithMediaID()).
+		Post("/medias/{id}/versions", api.GenerateVersionUploadLinkHandler(versionUploadLinkSvc))
+
+	versionFinaliserSvc := mediaSvc.NewVersionFinaliser(mediaRepo, versionRepo, strg, dispatcher, ca, cfg.BucketsSettings)
+	r.With(cMiddleware.WithMediaID()).
+		Post("/medias/{id}/versions/finalise", api.FinaliseVersionHandler(versionFinaliserSvc))
+
+	versionListerSvc := mediaSvc.NewVersionLister(mediaRepo, versionRepo)
+	r.With(cMiddleware.WithMediaID()).
+		Get("/medias/{id}/versions", api.ListVersionsHandler(versionListerSvc))
+
+	versionRollbackerSvc := mediaSvc.NewVersionRollbacker(mediaRepo, versionRepo, strg, dispatcher, ca)
+	r.With(cMiddleware.WithMediaID()).
+		Post("/medias/{id}/rollback", api.RollbackVersionHandler(versionRollbackerSvc))
+
+	pagesExtractorSvc := mediaSvc.NewPDFPagesExtractor(mediaRepo, dispatcher, msuuid.NewUUID)
+	r.With(cMiddleware.WithMediaID()).
+		Post("/medias/{id}/pages", api.ExtractPagesHandler(pagesExtractorSvc))
+
+	pdfMergerSvc := mediaSvc.NewPDFMerger(mediaRepo, dispatcher, msuuid.NewUUID)
+	r.Post("/medias/merge", api.MergePDFsHandler(pdfMergerSvc))
+
+	mediaSearcherSvc := mediaSvc.NewMediaSearcher(mediaRepo)
+	r.Get("/medias/search", api.SearchMediasHandler(mediaSearcherSvc, cfg.Buckets))
+
 	listenRouter(ctx, r, cfg, database)
 }
 
@@ -118,9 +161,9 @@ func initStorage(ctx context.Context, cfg *config.Settings) port.Storage {
 	return strg
 }
 
-func initBuckets(ctx context.Context, strg port.Storage, buckets []string) {
+func initBuckets(ctx context.Context, strg port.Storage, buckets []string, settings model.BucketsSettings) {
 	for _, b := range buckets {
-		if err := strg.InitBucket(b); err != nil {
+		if err := strg.InitBucket(b, settings.Get(b).IsPublic()); err != nil {
 			logger.Errorf(ctx, "❌  Failed to initialize bucket %q: %v", b, err)
 			os.Exit(1)
 		}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
@@ -20,6 +21,15 @@ import (
 	"github.com/hibiken/asynq"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+)
+
+// The purges are scheduled on the wall clock, so every replica of the worker enqueues them at the
+// same time and all but one copy are dropped as duplicates.
+const (
+	purgeTrashCronSpec = "@hourly"
+	// expired files of public buckets stay readable until they are purged
+	purgeExpiredCronSpec = "* * * * *"
 )
 
 func main() {
@@ -43,14 +53,19 @@ func main() {
 	}()
 
 	strg := initStorage(cfg)
-	initBuckets(strg, cfg.Buckets)
+	initBuckets(strg, cfg.Buckets, cfg.BucketsSettings)
 
 	repo := mariadb.NewMediaRepository(database.DB)
-	fo := optimiser.NewFileOptimiser(optimiser.NewWebPEncoder(), optimiser.NewPDFOptimizer())
+	versionRepo := mariadb.NewMediaVersionRepository(database.DB)
+	fo := optimiser.NewFileOptimiser(initWebPEncoder(cfg), optimiser.NewPDFOptimizer())
 	dispatcher := task.NewDispatcher(cfg.RedisAddr, cfg.RedisPassword)
 	ca := cache.NewCache(cfg.RedisAddr, cfg.RedisPassword)
-	optimiseSvc := mediaSvc.NewMediaOptimiser(repo, fo, strg, dispatcher, ca)
-	resizeSvc := mediaSvc.NewImageResizer(repo, fo, strg, ca)
+	optimiseSvc := mediaSvc.NewMediaOptimiser(repo, versionRepo, fo, strg, dispatcher, ca, cfg.BucketsSettings, cfg.APIBaseURL)
+	resizeSvc := mediaSvc.NewImageResizer(repo, versionRepo, fo, strg, dispatcher, ca, cfg.BucketsSettings)
+	deriveSvc := mediaSvc.NewPDFDeriver(repo, strg, dispatcher, cfg.BucketsSettings)
+	deleteSvc := mediaSvc.NewMediaDeleter(repo, versionRepo, ca, strg)
+	purgeTrashSvc := mediaSvc.NewTrashPurger(repo, deleteSvc, cfg.BucketsSettings)
+	purgeExpiredSvc := mediaSvc.NewExpiredPurger(repo, deleteSvc)
 
 	mux := asynq.NewServeMux()
 	mux.HandleFunc(task.TypeOptimiseMedia, func(ctx context.Context, t *asynq.Task) error {
@@ -67,8 +82,23 @@ func main() {
 		}
 		return workerHandler.ResizeImageHandler(ctx, p, cfg.ImagesSizes, resizeSvc)
 	})
+	mux.HandleFunc(task.TypeDerivePDF, func(ctx context.Context, t *asynq.Task) error {
+		p, err := task.ParseDerivePDFPayload(t)
+		if err != nil {
+			return err
+		}
+		return workerHandler.DerivePDFHandler(ctx, p, deriveSvc)
+	})
+	mux.HandleFunc(task.TypePurgeTrash, func(ctx context.Context, t *asynq.Task) error {
+		return workerHandler.PurgeTrashHandler(ctx, purgeTrashSvc)
+	})
+	mux.HandleFunc(task.TypePurgeExpired, func(ctx context.Context, t *asynq.Task) error {
+		return workerHandler.PurgeExpiredHandler(ctx, purgeExpiredSvc)
+	})
+
+	scheduler := initScheduler(cfg)
 
-	runWorker(ctx, mux, cfg, database)
+	runWorker(ctx, mux, scheduler, cfg, database)
 }
 
 func initDb(cfg *config.Settings) *db.Database {
@@ -98,16 +128,50 @@ func initStorage(cfg *config.Settings) port.Storage {
 	return strg
 }
 
-func initBuckets(strg port.Storage, buckets []string) {
+func initWebPEncoder(cfg *config.Settings) optimiser.WebPEncoder {
+	enc := optimiser.NewWebPEncoder()
+	if cfg.WebPQualityMode == config.WebPQualitySearch {
+		logger.Infof(context.Background(), "WebP quality search enabled, with a minimum SSIM of %v", cfg.WebPMinSSIM)
+		return optimiser.NewQualitySearchEncoder(enc, cfg.WebPMinSSIM)
+	}
+	return enc
+}
+
+func initBuckets(strg port.Storage, buckets []string, settings model.BucketsSettings) {
 	for _, b := range buckets {
-		if err := strg.InitBucket(b); err != nil {
+		if err := strg.InitBucket(b, settings.Get(b).IsPublic()); err != nil {
 			logger.Errorf(context.Background(), "❌  Failed to initialize bucket %q: %v", b, err)
 			os.Exit(1)
 		}
 	}
 }
 
-func runWorker(ctx context.Context, mux *asynq.ServeMux, cfg *config.Settings, database *db.Database) {
+func initScheduler(cfg *config.Settings) *asynq.Scheduler {
+	scheduler := asynq.NewScheduler(asynq.RedisClientOpt{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPassword,
+	}, &asynq.SchedulerOpts{
+		EnqueueErrorHandler: func(t *asynq.Task, _ []asynq.Option, err error) {
+			if errors.Is(err, asynq.ErrDuplicateTask) {
+				return
+			}
+			logger.Errorf(context.Background(), "❌  Failed to enqueue the scheduled task %q: %v", t.Type(), err)
+		},
+	})
+
+	if _, err := scheduler.Register(purgeTrashCronSpec, task.NewPurgeTrashTask(), asynq.Unique(time.Hour)); err != nil {
+		logger.Errorf(context.Background(), "❌  Failed to schedule the trash purge: %v", err)
+		os.Exit(1)
+	}
+	if _, err := scheduler.Register(purgeExpiredCronSpec, task.NewPurgeExpiredTask(), asynq.Unique(time.Minute)); err != nil {
+		logger.Errorf(context.Background(), "❌  Failed to schedule the expired medias purge: %v", err)
+		os.Exit(1)
+	}
+
+	return scheduler
+}
+
+func runWorker(ctx context.Context, mux *asynq.ServeMux, scheduler *asynq.Scheduler, cfg *config.Settings, database *db.Database) {
 	srv := asynq.NewServer(asynq.RedisClientOpt{
 		Addr:     cfg.RedisAddr,
 		Password: cfg.RedisPassword,
@@ -120,6 +184,10 @@ func runWorker(ctx context.Context, mux *asynq.ServeMux, cfg *config.Settings, d
 			os.Exit(1)
 		}
 	}()
+	if err := scheduler.Start(); err != nil {
+		logger.Errorf(ctx, "❌  Scheduler failed: %v", err)
+		os.Exit(1)
+	}
 	logger.Info(ctx, "🚀 Worker started")
 
 	// Wait for interrupt signal
@@ -131,6 +199,7 @@ func runWorker(ctx context.Context, mux *asynq.ServeMux, cfg *config.Settings, d
 	// Give Asynq up to 30 sec to finish tasks
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	scheduler.Shutdown() // stop enqueuing periodic tasks
 	srv.Shutdown()       // stop accepting new tasks, finish in-flight
 	<-shutdownCtx.Done() // either timeout or done
 
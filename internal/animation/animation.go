@@ -0,0 +1,98 @@
+// Package animation decodes animated GIFs and WebPs into full frames, and encodes frames back
+// into an animated WebP. Still WebP frames are encoded by the caller, so any WebP encoder fits.
+package animation
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"time"
+)
+
+// MaxPixels bounds the pixels of all the frames of an animation together, as every frame is
+// decoded to the full canvas.
+const MaxPixels = 1 << 27
+
+var (
+	// ErrUnsupportedFormat is returned for files that are neither GIF nor WebP.
+	ErrUnsupportedFormat = errors.New("animation: unsupported format")
+	// ErrTooLarge is returned for animations with more than MaxPixels.
+	ErrTooLarge = errors.New("animation: too many pixels to decode")
+)
+
+// Animation is a sequence of frames, each composited to the full canvas so it can be shown,
+// scaled or encoded on its own.
+type Animation struct {
+	Frames []*image.RGBA
+	// Durations holds how long each frame is shown.
+	Durations []time.Duration
+	// LoopCount is the number of times the animation plays, 0 for forever.
+	LoopCount int
+}
+
+// Info describes an animation without its frames.
+type Info struct {
+	FrameCount int
+	Duration   time.Duration
+	// LoopCount is the number of times the animation plays, 0 for forever.
+	LoopCount int
+}
+
+// Probe tells whether the GIF or WebP file is animated, i.e. has more than one frame, and
+// describes the animation if so. Files in other formats are not animated.
+func Probe(data []byte) (Info, bool, error) {
+	var (
+		info Info
+		err  error
+	)
+	switch {
+	case isGIF(data):
+		info, err = probeGIF(data)
+	case isWebP(data):
+		info, err = probeWebP(data)
+	default:
+		return Info{}, false, nil
+	}
+	if err != nil {
+		return Info{}, false, err
+	}
+	return info, info.FrameCount > 1, nil
+}
+
+// Decode decodes every frame of the GIF or WebP animation.
+func Decode(data []byte) (*Animation, error) {
+	switch {
+	case isGIF(data):
+		return decodeGIF(data)
+	case isWebP(data):
+		return decodeWebP(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// checkSize makes sure frameCount frames of the given bounds fit within MaxPixels.
+func checkSize(bounds image.Rectangle, frameCount int) error {
+	if bounds.Empty() {
+		return errors.New("animation: empty canvas")
+	}
+	if int64(bounds.Dx())*int64(bounds.Dy())*int64(frameCount) > MaxPixels {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// cloneRGBA returns a copy of the image.
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	c := image.NewRGBA(img.Bounds())
+	copy(c.Pix, img.Pix)
+	return c
+}
@@ -0,0 +1,209 @@
+package animation
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/chai2010/webp"
+)
+
+var palette = color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+
+// paletted returns a frame of the given bounds filled with the colour at index i of the palette.
+func paletted(r image.Rectangle, i uint8) *image.Paletted {
+	img := image.NewPaletted(r, palette)
+	for p := range img.Pix {
+		img.Pix[p] = i
+	}
+	return img
+}
+
+// testGIF returns a 4x4 GIF: red, then a blue square over its top left corner, cleared after
+// being shown, then nothing more.
+func testGIF(t *testing.T) []byte {
+	t.Helper()
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			paletted(image.Rect(0, 0, 4, 4), 1),
+			paletted(image.Rect(0, 0, 2, 2), 2),
+			paletted(image.Rect(3, 3, 4, 4), 1),
+		},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		LoopCount: 2,
+		Config:    image.Config{ColorModel: palette, Width: 4, Height: 4},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encode GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeLossless(w io.Writer, img image.Image) error {
+	return webp.Encode(w, img, &webp.Options{Lossless: true})
+}
+
+func TestProbe_GIF(t *testing.T) {
+	info, animated, err := Probe(testGIF(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Info{FrameCount: 3, Duration: 600 * time.Millisecond, LoopCount: 3}
+	if !animated || info != want {
+		t.Errorf("Probe = %+v, %v; want %+v, true", info, animated, want)
+	}
+}
+
+func TestProbe_NotAnimated(t *testing.T) {
+	var still bytes.Buffer
+	if err := gif.Encode(&still, paletted(image.Rect(0, 0, 4, 4), 1), nil); err != nil {
+		t.Fatalf("encode GIF: %v", err)
+	}
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("encode PNG: %v", err)
+	}
+	var webpData bytes.Buffer
+	if err := encodeLossless(&webpData, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("encode WebP: %v", err)
+	}
+
+	for name, data := range map[string][]byte{"gif": still.Bytes(), "png": pngData.Bytes(), "webp": webpData.Bytes()} {
+		if _, animated, err := Probe(data); err != nil || animated {
+			t.Errorf("%s: Probe = %v, %v; want a still image", name, animated, err)
+		}
+	}
+}
+
+func TestDecode_GIF(t *testing.T) {
+	anim, err := Decode(testGIF(t))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(anim.Frames) != 3 || anim.LoopCount != 3 {
+		t.Fatalf("got %d frames looping %d times", len(anim.Frames), anim.LoopCount)
+	}
+	if anim.Durations[1] != 200*time.Millisecond {
+		t.Errorf("Durations = %v", anim.Durations)
+	}
+
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	if got := anim.Frames[1].RGBAAt(0, 0); got != blue {
+		t.Errorf("frame 1 at 0,0 = %v; want the square over the first frame", got)
+	}
+	if got := anim.Frames[1].RGBAAt(3, 3); got != red {
+		t.Errorf("frame 1 at 3,3 = %v; want the first frame underneath", got)
+	}
+	if got := anim.Frames[2].RGBAAt(0, 0); got != (color.RGBA{}) {
+		t.Errorf("frame 2 at 0,0 = %v; want the square cleared", got)
+	}
+}
+
+func TestDecode_TooLarge(t *testing.T) {
+	g := &gif.GIF{
+		Image:  []*image.Paletted{paletted(image.Rect(0, 0, 1, 1), 1), paletted(image.Rect(0, 0, 1, 1), 2)},
+		Delay:  []int{0, 0},
+		Config: image.Config{ColorModel: palette, Width: 65535, Height: 65535},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encode GIF: %v", err)
+	}
+	if _, err := Decode(buf.Bytes()); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestDecode_UnsupportedFormat(t *testing.T) {
+	if _, err := Decode([]byte("not an image")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestEncodeWebP_RoundTrip(t *testing.T) {
+	src, err := Decode(testGIF(t))
+	if err != nil {
+		t.Fatalf("decode GIF: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, src, encodeLossless); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, animated, err := Probe(buf.Bytes())
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	want := Info{FrameCount: 3, Duration: 600 * time.Millisecond, LoopCount: 3}
+	if !animated || info != want {
+		t.Errorf("Probe = %+v, %v; want %+v, true", info, animated, want)
+	}
+
+	got, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode WebP: %v", err)
+	}
+	if len(got.Frames) != len(src.Frames) {
+		t.Fatalf("got %d frames; want %d", len(got.Frames), len(src.Frames))
+	}
+	for i := range src.Frames {
+		if !bytes.Equal(got.Frames[i].Pix, src.Frames[i].Pix) {
+			t.Errorf("frame %d differs after a lossless round trip", i)
+		}
+	}
+}
+
+func TestEncodeWebP_LossyWithAlpha(t *testing.T) {
+	src, err := Decode(testGIF(t))
+	if err != nil {
+		t.Fatalf("decode GIF: %v", err)
+	}
+
+	var buf bytes.Buffer
+	lossy := func(w io.Writer, img image.Image) error { return webp.Encode(w, img, &webp.Options{Quality: 90}) }
+	if err := EncodeWebP(&buf, src, lossy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode WebP: %v", err)
+	}
+	if len(got.Frames) != 3 {
+		t.Fatalf("got %d frames; want 3", len(got.Frames))
+	}
+	if a := got.Frames[2].RGBAAt(0, 0).A; a != 0 {
+		t.Errorf("alpha of the cleared square = %d; want it transparent", a)
+	}
+}
+
+func TestEncodeWebP_Errors(t *testing.T) {
+	frames := []*image.RGBA{image.NewRGBA(image.Rect(0, 0, 2, 2)), image.NewRGBA(image.Rect(0, 0, 3, 3))}
+	tests := map[string]struct {
+		anim   *Animation
+		encode func(io.Writer, image.Image) error
+	}{
+		"no frame":      {&Animation{}, encodeLossless},
+		"mismatch":      {&Animation{Frames: frames}, encodeLossless},
+		"encoder error": {&Animation{Frames: frames[:1]}, func(io.Writer, image.Image) error { return errors.New("boom") }},
+		"not a WebP":    {&Animation{Frames: frames[:1]}, func(w io.Writer, _ image.Image) error { _, err := w.Write([]byte("nope")); return err }},
+		"no bitstream": {&Animation{Frames: frames[:1]}, func(w io.Writer, _ image.Image) error {
+			_, err := w.Write([]byte("RIFF\x04\x00\x00\x00WEBP"))
+			return err
+		}},
+	}
+	for name, tc := range tests {
+		if err := EncodeWebP(io.Discard, tc.anim, tc.encode); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package animation
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"time"
+)
+
+// gifDelayUnit is the unit of the frame delays of GIFs.
+const gifDelayUnit = 10 * time.Millisecond
+
+func probeGIF(data []byte) (Info, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return Info{}, fmt.Errorf("animation: failed to decode GIF: %w", err)
+	}
+	info := Info{FrameCount: len(g.Image), LoopCount: gifLoopCount(g.LoopCount)}
+	for _, d := range g.Delay {
+		info.Duration += time.Duration(d) * gifDelayUnit
+	}
+	return info, nil
+}
+
+// decodeGIF draws the frames of the GIF one over the other, disposing of them as they ask.
+func decodeGIF(data []byte) (*Animation, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("animation: failed to decode GIF: %w", err)
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if err := checkSize(bounds, len(g.Image)); err != nil {
+		return nil, err
+	}
+
+	anim := &Animation{LoopCount: gifLoopCount(g.LoopCount)}
+	canvas := image.NewRGBA(bounds)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		anim.Frames = append(anim.Frames, cloneRGBA(canvas))
+		anim.Durations = append(anim.Durations, time.Duration(g.Delay[i])*gifDelayUnit)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+// gifLoopCount converts the loop count of a GIF, the number of times it is repeated after
+// being played once or -1 for none, into the number of times it plays.
+func gifLoopCount(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount < 0:
+		return 1
+	default:
+		return loopCount + 1
+	}
+}
@@ -0,0 +1,307 @@
+package animation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+
+	"golang.org/x/image/webp"
+)
+
+// Flags of the VP8X chunk and of the ANMF chunks, see
+// https://developers.google.com/speed/webp/docs/riff_container.
+const (
+	vp8xAnimation = 1 << 1
+	vp8xAlpha     = 1 << 4
+
+	anmfDispose = 1 << 0
+	anmfNoBlend = 1 << 1
+)
+
+// maxFrameDuration is the longest duration a WebP frame can have.
+const maxFrameDuration = (1<<24 - 1) * time.Millisecond
+
+// maxLoopCount is the most times a WebP animation can play, short of forever.
+const maxLoopCount = 1<<16 - 1
+
+var errInvalidWebP = errors.New("animation: invalid WebP")
+
+// chunk is a chunk of a RIFF container, without its padding.
+type chunk struct {
+	fourCC string
+	data   []byte
+}
+
+func probeWebP(data []byte) (Info, error) {
+	chunks, err := readFile(data)
+	if err != nil {
+		return Info{}, err
+	}
+	if !isAnimatedWebP(chunks) {
+		return Info{FrameCount: 1}, nil
+	}
+
+	var info Info
+	for _, c := range chunks {
+		switch {
+		case c.fourCC == "ANIM" && len(c.data) >= 6:
+			info.LoopCount = int(binary.LittleEndian.Uint16(c.data[4:6]))
+		case c.fourCC == "ANMF" && len(c.data) >= 16:
+			info.FrameCount++
+			info.Duration += time.Duration(uint24(c.data[12:15])) * time.Millisecond
+		}
+	}
+	return info, nil
+}
+
+// decodeWebP decodes the frames of an animated WebP, each drawn over the previous ones as they
+// ask. A still WebP decodes to a single frame.
+func decodeWebP(data []byte) (*Animation, error) {
+	chunks, err := readFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if !isAnimatedWebP(chunks) {
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("animation: failed to decode WebP: %w", err)
+		}
+		frame := image.NewRGBA(img.Bounds())
+		draw.Draw(frame, frame.Bounds(), img, img.Bounds().Min, draw.Src)
+		return &Animation{Frames: []*image.RGBA{frame}, Durations: []time.Duration{0}}, nil
+	}
+
+	vp8x := chunks[0].data
+	bounds := image.Rect(0, 0, int(uint24(vp8x[4:7]))+1, int(uint24(vp8x[7:10]))+1)
+	frameCount := 0
+	for _, c := range chunks {
+		if c.fourCC == "ANMF" {
+			frameCount++
+		}
+	}
+	if err := checkSize(bounds, frameCount); err != nil {
+		return nil, err
+	}
+
+	canvas := image.NewRGBA(bounds)
+	anim := &Animation{}
+	for _, c := range chunks {
+		switch c.fourCC {
+		case "ANIM":
+			if len(c.data) < 6 {
+				return nil, errInvalidWebP
+			}
+			anim.LoopCount = int(binary.LittleEndian.Uint16(c.data[4:6]))
+		case "ANMF":
+			if len(c.data) < 16 {
+				return nil, errInvalidWebP
+			}
+			x, y := 2*int(uint24(c.data[0:3])), 2*int(uint24(c.data[3:6]))
+			width, height := int(uint24(c.data[6:9]))+1, int(uint24(c.data[9:12]))+1
+			flags := c.data[15]
+
+			frameChunks, err := readChunks(c.data[16:])
+			if err != nil {
+				return nil, err
+			}
+			img, err := webp.Decode(bytes.NewReader(stillWebP(frameChunks, width, height)))
+			if err != nil {
+				return nil, fmt.Errorf("animation: failed to decode WebP frame %d: %w", len(anim.Frames), err)
+			}
+
+			area := image.Rect(x, y, x+width, y+height)
+			op := draw.Over
+			if flags&anmfNoBlend != 0 {
+				op = draw.Src
+			}
+			draw.Draw(canvas, area, img, img.Bounds().Min, op)
+			anim.Frames = append(anim.Frames, cloneRGBA(canvas))
+			anim.Durations = append(anim.Durations, time.Duration(uint24(c.data[12:15]))*time.Millisecond)
+
+			if flags&anmfDispose != 0 {
+				draw.Draw(canvas, area, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if len(anim.Frames) == 0 {
+		return nil, errInvalidWebP
+	}
+	return anim, nil
+}
+
+// EncodeWebP writes the animation as an animated WebP, each of its frames encoded as a still
+// WebP by encodeFrame. The frames must all have the size of the first one.
+func EncodeWebP(w io.Writer, anim *Animation, encodeFrame func(w io.Writer, img image.Image) error) error {
+	if len(anim.Frames) == 0 {
+		return errors.New("animation: no frame to encode")
+	}
+	size := anim.Frames[0].Bounds().Size()
+
+	var frames bytes.Buffer
+	alpha := false
+	for i, frame := range anim.Frames {
+		if frame.Bounds().Size() != size {
+			return fmt.Errorf("animation: frame %d is %v, unlike the first one", i, frame.Bounds().Size())
+		}
+		var still bytes.Buffer
+		if err := encodeFrame(&still, frame); err != nil {
+			return fmt.Errorf("animation: failed to encode frame %d: %w", i, err)
+		}
+		chunks, err := readFile(still.Bytes())
+		if err != nil {
+			return fmt.Errorf("animation: failed to read frame %d: %w", i, err)
+		}
+
+		var duration time.Duration
+		if i < len(anim.Durations) {
+			duration = min(max(anim.Durations[i], 0), maxFrameDuration)
+		}
+		var payload bytes.Buffer
+		payload.Write(putUint24(0))
+		payload.Write(putUint24(0))
+		payload.Write(putUint24(uint32(size.X - 1)))
+		payload.Write(putUint24(uint32(size.Y - 1)))
+		payload.Write(putUint24(uint32(duration.Milliseconds())))
+		payload.WriteByte(anmfNoBlend)
+
+		bitstream := false
+		for _, c := range chunks {
+			switch c.fourCC {
+			case "ALPH":
+				alpha = true
+			case "VP8 ":
+				bitstream = true
+			case "VP8L":
+				bitstream = true
+				alpha = alpha || vp8lHasAlpha(c.data)
+			default:
+				// the VP8X chunk of the still image, and its metadata
+				continue
+			}
+			writeChunk(&payload, c.fourCC, c.data)
+		}
+		if !bitstream {
+			return fmt.Errorf("animation: frame %d is not a WebP image", i)
+		}
+		writeChunk(&frames, "ANMF", payload.Bytes())
+	}
+
+	var flags byte = vp8xAnimation
+	if alpha {
+		flags |= vp8xAlpha
+	}
+	// a transparent background, then the loop count
+	animChunk := make([]byte, 6)
+	binary.LittleEndian.PutUint16(animChunk[4:6], uint16(min(max(anim.LoopCount, 0), maxLoopCount)))
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	writeChunk(&body, "VP8X", vp8xPayload(flags, size.X, size.Y))
+	writeChunk(&body, "ANIM", animChunk)
+	body.Write(frames.Bytes())
+	return writeRIFF(w, body.Bytes())
+}
+
+// isAnimatedWebP tells whether the chunks of a WebP start with a VP8X chunk flagging an animation.
+func isAnimatedWebP(chunks []chunk) bool {
+	return len(chunks) > 0 && chunks[0].fourCC == "VP8X" && len(chunks[0].data) >= 10 && chunks[0].data[0]&vp8xAnimation != 0
+}
+
+// stillWebP wraps the chunks of an animation frame into a still WebP of the given size.
+func stillWebP(frameChunks []chunk, width, height int) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, c := range frameChunks {
+		if c.fourCC == "ALPH" {
+			writeChunk(&body, "VP8X", vp8xPayload(vp8xAlpha, width, height))
+			break
+		}
+	}
+	for _, c := range frameChunks {
+		if c.fourCC == "ALPH" || c.fourCC == "VP8 " || c.fourCC == "VP8L" {
+			writeChunk(&body, c.fourCC, c.data)
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = writeRIFF(&buf, body.Bytes())
+	return buf.Bytes()
+}
+
+// readFile returns the chunks of a WebP file.
+func readFile(data []byte) ([]chunk, error) {
+	if !isWebP(data) {
+		return nil, errInvalidWebP
+	}
+	size := uint64(binary.LittleEndian.Uint32(data[4:8]))
+	if size < 4 || 8+size > uint64(len(data)) {
+		return nil, errInvalidWebP
+	}
+	return readChunks(data[12 : 8+size])
+}
+
+// readChunks returns the chunks following one another in data.
+func readChunks(data []byte) ([]chunk, error) {
+	var chunks []chunk
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errInvalidWebP
+		}
+		size := uint64(binary.LittleEndian.Uint32(data[4:8]))
+		if 8+size > uint64(len(data)) {
+			return nil, errInvalidWebP
+		}
+		chunks = append(chunks, chunk{fourCC: string(data[:4]), data: data[8 : 8+size]})
+		next := min(8+size+size&1, uint64(len(data)))
+		data = data[next:]
+	}
+	return chunks, nil
+}
+
+// writeChunk writes a chunk to the buffer, padded to an even size.
+func writeChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	buf.WriteString(fourCC)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// writeRIFF writes the body of a WebP, starting with "WEBP", in its RIFF header.
+func writeRIFF(w io.Writer, body []byte) error {
+	header := make([]byte, 8)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(body)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func vp8xPayload(flags byte, width, height int) []byte {
+	payload := make([]byte, 10)
+	payload[0] = flags
+	copy(payload[4:7], putUint24(uint32(width-1)))
+	copy(payload[7:10], putUint24(uint32(height-1)))
+	return payload
+}
+
+// vp8lHasAlpha reads the alpha hint of a lossless bitstream, which follows its dimensions.
+func vp8lHasAlpha(data []byte) bool {
+	return len(data) >= 5 && binary.LittleEndian.Uint32(data[1:5])>>28&1 == 1
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(v uint32) []byte {
+	return []byte{byte(v), byte(v >> 8), byte(v >> 16)}
+}
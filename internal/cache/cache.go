@@ -98,6 +98,28 @@ func (c *Cache) DeleteEtagMediaDetails(ctx context.Context, id uuid.UUID) error
 	return nil
 }
 
+func (c *Cache) GetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string) ([]byte, error) {
+	logger.Debugf(ctx, "getting watermarked PDF in cache for media #%s and user #%s...", id, userID)
+
+	val, err := c.client.Get(ctx, getWatermarkCacheKey(id, userID, etag)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil // cache miss
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis get failed: %w", err)
+	}
+	return val, nil
+}
+
+func (c *Cache) SetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string, data []byte, validUntil time.Time) {
+	logger.Debugf(ctx, "caching watermarked PDF for media #%s and user #%s, valid until %s...", id, userID, validUntil.Format(time.RFC1123))
+	exp := time.Until(validUntil)
+
+	if err := c.client.Set(ctx, getWatermarkCacheKey(id, userID, etag), data, exp).Err(); err != nil {
+		logger.Warnf(ctx, "redis set failed: %v", err)
+	}
+}
+
 func getCacheKey(id string, isEtag bool) string {
 	key := "media:" + id
 	if isEtag {
@@ -105,3 +127,9 @@ func getCacheKey(id string, isEtag bool) string {
 	}
 	return key
 }
+
+// getWatermarkCacheKey includes the ETag of the file, so a new version is never served from a
+// copy of the previous one.
+func getWatermarkCacheKey(id, userID uuid.UUID, etag string) string {
+	return "watermarked:media:" + id.String() + ":" + userID.String() + ":" + etag
+}
@@ -222,3 +222,34 @@ func TestGetEtagMediaDetails(t *testing.T) {
 		t.Errorf("expected redis get failed error, got %v", err)
 	}
 }
+
+func TestGetSetWatermarkedPDF(t *testing.T) {
+	c, mr := makeTestCache(t)
+	ctx := context.Background()
+	id := msuuid.NewUUID()
+	userID := msuuid.NewUUID()
+
+	if got, err := c.GetWatermarkedPDF(ctx, id, userID, "abc"); err != nil || got != nil {
+		t.Fatalf("GetWatermarkedPDF miss = %v, %v; want nil, nil", got, err)
+	}
+
+	c.SetWatermarkedPDF(ctx, id, userID, "abc", []byte("%PDF-stamped"), time.Now().Add(10*time.Minute))
+	if ttl := mr.TTL(getWatermarkCacheKey(id, userID, "abc")); ttl < 9*time.Minute || ttl > 10*time.Minute+time.Second {
+		t.Errorf("redis TTL = %v; want ~10m", ttl)
+	}
+	got, err := c.GetWatermarkedPDF(ctx, id, userID, "abc")
+	if err != nil {
+		t.Fatalf("GetWatermarkedPDF hit: %v", err)
+	}
+	if string(got) != "%PDF-stamped" {
+		t.Errorf("GetWatermarkedPDF = %q; want the stamped copy", got)
+	}
+
+	// another user, or another version of the file, has its own copy
+	if got, _ := c.GetWatermarkedPDF(ctx, id, msuuid.NewUUID(), "abc"); got != nil {
+		t.Errorf("GetWatermarkedPDF for another user = %q; want nil", got)
+	}
+	if got, _ := c.GetWatermarkedPDF(ctx, id, userID, "def"); got != nil {
+		t.Errorf("GetWatermarkedPDF for another ETag = %q; want nil", got)
+	}
+}
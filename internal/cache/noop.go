@@ -36,3 +36,10 @@ func (n *NoopCache) DeleteMediaDetails(ctx context.Context, id uuid.UUID) error
 func (n *NoopCache) DeleteEtagMediaDetails(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
+
+func (n *NoopCache) GetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string) ([]byte, error) {
+	return nil, nil
+}
+
+func (n *NoopCache) SetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string, data []byte, validUntil time.Time) {
+}
@@ -3,28 +3,56 @@ package config
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 )
 
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// WebP quality modes: a fixed quality, or a search for the lowest quality keeping a minimum SSIM.
+const (
+	WebPQualityFixed  = "fixed"
+	WebPQualitySearch = "search"
+)
+
+const defaultWebPMinSSIM = 0.97
+
+// Defaults of the overlay of a bucket: half transparent, a fifth of the width of the variants.
+const (
+	defaultOverlayOpacity = 0.5
+	defaultOverlayScale   = 0.2
+)
+
+// defaultContentCacheControl makes caches revalidate streamed files, as they can change in place.
+const defaultContentCacheControl = "no-cache"
+
 type Settings struct {
-	MariaDBDSN     string
-	ServerPort     int
-	MinioAccessKey string
-	MinioSecretKey string
-	MinioEndpoint  string
-	MinioUseSSL    bool
-	Buckets        []string
-	ImagesSizes    []int
-	RedisAddr      string
-	RedisPassword  string
-	JWTPublicKey   string
+	MariaDBDSN          string
+	ServerPort          int
+	MinioAccessKey      string
+	MinioSecretKey      string
+	MinioEndpoint       string
+	MinioUseSSL         bool
+	Buckets             []string
+	BucketsSettings     model.BucketsSettings
+	ImagesSizes         []int
+	WebPQualityMode     string
+	WebPMinSSIM         float64
+	ContentCacheControl string
+	APIBaseURL          string
+	RedisAddr           string
+	RedisPassword       string
+	JWTPublicKey        string
 }
 
 func Load() (*Settings, error) {
@@ -76,18 +104,39 @@ func Load() (*Settings, error) {
 		return nil, fmt.Errorf("could not read file from JWT_PUBLIC_KEY_PATH: %w", err)
 	}
 
+	webpQualityMode, webpMinSSIM, err := getWebPQuality()
+	if err != nil {
+		return nil, err
+	}
+
+	apiBaseURL, err := getAPIBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := getBuckets()
+	bucketsSettings, err := getBucketsSettings(buckets)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Settings{
-		MariaDBDSN:     mariaDBDSN,
-		ServerPort:     viper.GetInt("SERVER_PORT"),
-		MinioAccessKey: viper.GetString("MINIO_ACCESS_KEY"),
-		MinioSecretKey: viper.GetString("MINIO_SECRET_KEY"),
-		MinioEndpoint:  viper.GetString("MINIO_ENDPOINT"),
-		MinioUseSSL:    viper.GetBool("MINIO_USE_SSL"),
-		Buckets:        getBuckets(),
-		ImagesSizes:    getImagesSizes(),
-		RedisAddr:      viper.GetString("REDIS_ADDR"),
-		RedisPassword:  viper.GetString("REDIS_PASSWORD"),
-		JWTPublicKey:   jwtPem,
+		MariaDBDSN:          mariaDBDSN,
+		ServerPort:          viper.GetInt("SERVER_PORT"),
+		MinioAccessKey:      viper.GetString("MINIO_ACCESS_KEY"),
+		MinioSecretKey:      viper.GetString("MINIO_SECRET_KEY"),
+		MinioEndpoint:       viper.GetString("MINIO_ENDPOINT"),
+		MinioUseSSL:         viper.GetBool("MINIO_USE_SSL"),
+		Buckets:             buckets,
+		BucketsSettings:     bucketsSettings,
+		ImagesSizes:         getImagesSizes(),
+		WebPQualityMode:     webpQualityMode,
+		WebPMinSSIM:         webpMinSSIM,
+		ContentCacheControl: getContentCacheControl(),
+		APIBaseURL:          apiBaseURL,
+		RedisAddr:           viper.GetString("REDIS_ADDR"),
+		RedisPassword:       viper.GetString("REDIS_PASSWORD"),
+		JWTPublicKey:        jwtPem,
 	}, nil
 }
 
@@ -115,6 +164,51 @@ func getMariaDBDSN() (string, error) {
 	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=true&loc=Local", user, password, host, port, database), nil
 }
 
+func getWebPQuality() (string, float64, error) {
+	mode := WebPQualityFixed
+	if viper.IsSet("WEBP_QUALITY_MODE") {
+		mode = strings.ToLower(strings.TrimSpace(viper.GetString("WEBP_QUALITY_MODE")))
+	}
+	if mode != WebPQualityFixed && mode != WebPQualitySearch {
+		return "", 0, fmt.Errorf("WEBP_QUALITY_MODE must be %q or %q", WebPQualityFixed, WebPQualitySearch)
+	}
+
+	minSSIM := defaultWebPMinSSIM
+	if viper.IsSet("WEBP_MIN_SSIM") {
+		v, err := strconv.ParseFloat(viper.GetString("WEBP_MIN_SSIM"), 64)
+		if err != nil {
+			return "", 0, fmt.Errorf("WEBP_MIN_SSIM is not a valid number: %w", err)
+		}
+		if v <= 0 || v > 1 {
+			return "", 0, fmt.Errorf("WEBP_MIN_SSIM must be greater than 0 and at most 1")
+		}
+		minSSIM = v
+	}
+
+	return mode, minSSIM, nil
+}
+
+func getContentCacheControl() string {
+	if v := strings.TrimSpace(viper.GetString("CONTENT_CACHE_CONTROL")); v != "" {
+		return v
+	}
+	return defaultContentCacheControl
+}
+
+// getAPIBaseURL reads the URL the API is reached at, which documents link to medias through.
+// Without it, the links are relative to the host serving the document.
+func getAPIBaseURL() (string, error) {
+	baseURL := strings.TrimRight(strings.TrimSpace(viper.GetString("API_BASE_URL")), "/")
+	if baseURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("API_BASE_URL must be an absolute URL")
+	}
+	return baseURL, nil
+}
+
 func getBuckets() []string {
 	bucketsSet := make(map[string]struct{})
 	result := make([]string, 0)
@@ -139,6 +233,224 @@ func getBuckets() []string {
 	return result
 }
 
+// getBucketsSettings reads the options of every bucket. Each option has a global
+// default (e.g. TRASH_RETENTION) that can be overridden for a single bucket by
+// prefixing it with BUCKET_<NAME>_ (e.g. BUCKET_IMAGES_TRASH_RETENTION).
+func getBucketsSettings(buckets []string) (model.BucketsSettings, error) {
+	settings := make(model.BucketsSettings, len(buckets))
+	for _, bucket := range buckets {
+		retention, err := getBucketDuration(bucket, "TRASH_RETENTION", defaultTrashRetention)
+		if err != nil {
+			return nil, err
+		}
+
+		keepOriginals, err := getBucketBool(bucket, "KEEP_ORIGINALS")
+		if err != nil {
+			return nil, err
+		}
+
+		fallbackVariants, err := getBucketBool(bucket, "FALLBACK_VARIANTS")
+		if err != nil {
+			return nil, err
+		}
+
+		svgRasterVariants, err := getBucketSVGRasterVariants(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		contentAddressedKeys, err := getBucketBool(bucket, "CONTENT_ADDRESSED_KEYS")
+		if err != nil {
+			return nil, err
+		}
+
+		rejectUnsafePDFs, err := getBucketBool(bucket, "REJECT_UNSAFE_PDFS")
+		if err != nil {
+			return nil, err
+		}
+
+		watermarkPDFs, err := getBucketBool(bucket, "WATERMARK_PDFS")
+		if err != nil {
+			return nil, err
+		}
+
+		pdfProfile, err := getBucketPDFProfile(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		overlay, err := getBucketOverlay(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		visibility, publicBaseURL, err := getBucketVisibility(bucket)
+		if err != nil {
+			return nil, err
+		}
+
+		if watermarkPDFs && visibility == model.BucketVisibilityPublic {
+			return nil, fmt.Errorf("bucket %q cannot both be public and watermark its PDFs", bucket)
+		}
+
+		objectMetadata, err := getBucketPairs(bucket, "OBJECT_METADATA")
+		if err != nil {
+			return nil, err
+		}
+
+		objectTags, err := getBucketPairs(bucket, "OBJECT_TAGS")
+		if err != nil {
+			return nil, err
+		}
+
+		settings[bucket] = model.BucketSettings{
+			TrashRetention:       retention,
+			KeepOriginals:        keepOriginals,
+			FallbackVariants:     fallbackVariants,
+			SVGRasterVariants:    svgRasterVariants,
+			ContentAddressedKeys: contentAddressedKeys,
+			PDFProfile:           pdfProfile,
+			RejectUnsafePDFs:     rejectUnsafePDFs,
+			WatermarkPDFs:        watermarkPDFs,
+			Overlay:              overlay,
+			Visibility:           visibility,
+			PublicBaseURL:        publicBaseURL,
+			CacheControl:         strings.TrimSpace(getBucketString(bucket, "OBJECT_CACHE_CONTROL")),
+			ObjectMetadata:       objectMetadata,
+			ObjectTags:           objectTags,
+		}
+	}
+	return settings, nil
+}
+
+// getBucketVisibility reads whether the bucket is public, and the base URL its files are then
+// served from. The staging bucket always stays private, as it holds unvalidated uploads.
+func getBucketVisibility(bucket string) (string, string, error) {
+	if bucket == "staging" {
+		return model.BucketVisibilityPrivate, "", nil
+	}
+
+	visibility := strings.ToLower(strings.TrimSpace(getBucketString(bucket, "VISIBILITY")))
+	switch visibility {
+	case "", model.BucketVisibilityPrivate:
+		return model.BucketVisibilityPrivate, "", nil
+	case model.BucketVisibilityPublic:
+	default:
+		return "", "", fmt.Errorf("visibility of bucket %q must be %q or %q", bucket, model.BucketVisibilityPrivate, model.BucketVisibilityPublic)
+	}
+
+	baseURL := strings.TrimRight(strings.TrimSpace(getBucketString(bucket, "PUBLIC_BASE_URL")), "/")
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", "", fmt.Errorf("public bucket %q requires an absolute PUBLIC_BASE_URL", bucket)
+	}
+	// buckets sharing the global base URL are told apart by their name, as in path-style URLs
+	if !viper.IsSet(bucketKey(bucket, "PUBLIC_BASE_URL")) {
+		baseURL += "/" + url.PathEscape(bucket)
+	}
+	return visibility, baseURL, nil
+}
+
+// getBucketPDFProfile reads the comma-separated scrubbing steps applied to the PDFs of the bucket,
+// e.g. "strip_metadata,remove_annotations".
+func getBucketPDFProfile(bucket string) (model.PDFProfile, error) {
+	var profile model.PDFProfile
+	for _, step := range strings.Split(getBucketString(bucket, "PDF_PROFILE"), ",") {
+		switch strings.ToLower(strings.TrimSpace(step)) {
+		case "":
+		case "strip_metadata":
+			profile.StripMetadata = true
+		case "remove_annotations":
+			profile.RemoveAnnotations = true
+		case "remove_forms":
+			profile.RemoveForms = true
+		case "flatten":
+			profile.Flatten = true
+		default:
+			return model.PDFProfile{}, fmt.Errorf("PDF profile of bucket %q: unknown step %q", bucket, strings.TrimSpace(step))
+		}
+	}
+	return profile, nil
+}
+
+// getBucketSVGRasterVariants reads the format of the variants drawn from the SVGs of the bucket,
+// "png" or "webp", as a MIME type. It is empty when SVGs get no variants.
+func getBucketSVGRasterVariants(bucket string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(getBucketString(bucket, "SVG_RASTER_VARIANTS"))); format {
+	case "":
+		return "", nil
+	case "png", "webp":
+		return "image/" + format, nil
+	default:
+		return "", fmt.Errorf("SVG raster variants of bucket %q must be \"png\" or \"webp\", got %q", bucket, format)
+	}
+}
+
+// getBucketOverlay reads the overlay drawn over the variants of the images of the bucket, if
+// OVERLAY_MEDIA_ID is set. The overlay defaults to the bottom right corner.
+func getBucketOverlay(bucket string) (*model.ImageOverlay, error) {
+	rawID := strings.TrimSpace(getBucketString(bucket, "OVERLAY_MEDIA_ID"))
+	if rawID == "" {
+		return nil, nil
+	}
+	var mediaID msuuid.UUID
+	if err := mediaID.UnmarshalText([]byte(rawID)); err != nil {
+		return nil, fmt.Errorf("overlay of bucket %q: invalid media ID %q", bucket, rawID)
+	}
+
+	overlay := &model.ImageOverlay{MediaID: mediaID, Gravity: model.GravitySouthEast, Opacity: defaultOverlayOpacity, Scale: defaultOverlayScale}
+	if gravity := strings.ToLower(strings.TrimSpace(getBucketString(bucket, "OVERLAY_GRAVITY"))); gravity != "" {
+		switch gravity {
+		case model.GravityCenter, model.GravityNorth, model.GravitySouth, model.GravityEast, model.GravityWest,
+			model.GravityNorthEast, model.GravityNorthWest, model.GravitySouthEast, model.GravitySouthWest:
+			overlay.Gravity = gravity
+		default:
+			return nil, fmt.Errorf("overlay of bucket %q: unknown gravity %q", bucket, gravity)
+		}
+	}
+	for option, value := range map[string]*float64{"OVERLAY_OPACITY": &overlay.Opacity, "OVERLAY_SCALE": &overlay.Scale} {
+		raw := strings.TrimSpace(getBucketString(bucket, option))
+		if raw == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return nil, fmt.Errorf("overlay of bucket %q: %s must be a number between 0 and 1, got %q", bucket, option, raw)
+		}
+		*value = f
+	}
+	return overlay, nil
+}
+
+// bucketKey returns the env variable overriding the given option for a bucket.
+func bucketKey(bucket, option string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, bucket)
+	return "BUCKET_" + strings.ToUpper(name) + "_" + option
+}
+
+func getBucketDuration(bucket, option string, def time.Duration) (time.Duration, error) {
+	key := option
+	if viper.IsSet(bucketKey(bucket, option)) {
+		key = bucketKey(bucket, option)
+	} else if !viper.IsSet(option) {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(viper.GetString(key))
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a valid duration: %w", key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative", key)
+	}
+	return d, nil
+}
+
 func getImagesSizes() []int {
 	ctx := context.Background()
 	sizes := make([]int, 0)
@@ -171,3 +483,51 @@ func getJWTPem() (string, error) {
 
 	return jwtPem, nil
 }
+
+func getBucketString(bucket, option string) string {
+	if viper.IsSet(bucketKey(bucket, option)) {
+		return viper.GetString(bucketKey(bucket, option))
+	}
+	return viper.GetString(option)
+}
+
+func getBucketBool(bucket, option string) (bool, error) {
+	key := option
+	if viper.IsSet(bucketKey(bucket, option)) {
+		key = bucketKey(bucket, option)
+	} else if !viper.IsSet(option) {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(viper.GetString(key))
+	if err != nil {
+		return false, fmt.Errorf("%s is not a valid boolean: %w", key, err)
+	}
+	return b, nil
+}
+
+// getBucketPairs reads a comma-separated list of key=value pairs, e.g. "team=blog,tier=hot".
+func getBucketPairs(bucket, option string) (map[string]string, error) {
+	key := option
+	if viper.IsSet(bucketKey(bucket, option)) {
+		key = bucketKey(bucket, option)
+	}
+
+	var pairs map[string]string
+	for _, pair := range strings.Split(viper.GetString(key), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s must be a list of key=value pairs, got %q", key, pair)
+		}
+		if pairs == nil {
+			pairs = make(map[string]string)
+		}
+		pairs[k] = strings.TrimSpace(v)
+	}
+	return pairs, nil
+}
@@ -4,6 +4,11 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
 )
 
 func TestLoad_Success(t *testing.T) {
@@ -160,3 +165,442 @@ func TestLoad_MissingRequiredVars(t *testing.T) {
 		})
 	}
 }
+
+func setupRequiredEnv(t *testing.T) {
+	t.Helper()
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("could not get working directory: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("could not chdir to temp dir: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(origDir); err != nil {
+			t.Fatalf("could not chdir back to original dir: %v", err)
+		}
+	})
+
+	reqs := map[string]string{
+		"MARIADB_USER":          "user",
+		"MARIADB_PASS":          "pass",
+		"MARIADB_HOST":          "localhost",
+		"MARIADB_INTERNAL_PORT": "3306",
+		"MARIADB_NAME":          "db",
+		"SERVER_PORT":           "8080",
+		"MINIO_ACCESS_KEY":      "access",
+		"MINIO_SECRET_KEY":      "secret",
+		"MINIO_ENDPOINT":        "localhost:9000",
+		"MINIO_USE_SSL":         "true",
+		"BUCKETS":               "images,docs",
+		"IMAGES_SIZES":          "100,500,1000",
+		"JWT_PUBLIC_KEY_PATH":   "",
+	}
+	for k, v := range reqs {
+		t.Setenv(k, v)
+	}
+}
+
+func TestLoad_BucketsSettings(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("TRASH_RETENTION", "24h")
+	t.Setenv("BUCKET_DOCS_TRASH_RETENTION", "1h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := map[string]time.Duration{
+		"images":  24 * time.Hour,
+		"docs":    time.Hour,
+		"staging": 24 * time.Hour,
+	}
+	for bucket, retention := range want {
+		if got := cfg.BucketsSettings.Get(bucket).TrashRetention; got != retention {
+			t.Errorf("TrashRetention[%s]: expected %v, got %v", bucket, retention, got)
+		}
+	}
+}
+
+func TestLoad_BucketsSettingsDefaults(t *testing.T) {
+	setupRequiredEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := cfg.BucketsSettings.Get("images").TrashRetention; got != defaultTrashRetention {
+		t.Errorf("TrashRetention: expected %v, got %v", defaultTrashRetention, got)
+	}
+}
+
+func TestLoad_BucketsBoolSettings(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("KEEP_ORIGINALS", "true")
+	t.Setenv("BUCKET_DOCS_KEEP_ORIGINALS", "false")
+	t.Setenv("BUCKET_IMAGES_FALLBACK_VARIANTS", "true")
+	t.Setenv("CONTENT_ADDRESSED_KEYS", "true")
+	t.Setenv("BUCKET_STAGING_CONTENT_ADDRESSED_KEYS", "false")
+	t.Setenv("BUCKET_DOCS_REJECT_UNSAFE_PDFS", "true")
+	t.Setenv("BUCKET_DOCS_WATERMARK_PDFS", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := map[string]bool{
+		"images":  true,
+		"docs":    false,
+		"staging": true,
+	}
+	for bucket, keep := range want {
+		if got := cfg.BucketsSettings.Get(bucket).KeepOriginals; got != keep {
+			t.Errorf("KeepOriginals[%s]: expected %v, got %v", bucket, keep, got)
+		}
+	}
+	if !cfg.BucketsSettings.Get("images").FallbackVariants || cfg.BucketsSettings.Get("docs").FallbackVariants {
+		t.Error("FallbackVariants: expected only images to have fallback variants")
+	}
+	if !cfg.BucketsSettings.Get("docs").ContentAddressedKeys || cfg.BucketsSettings.Get("staging").ContentAddressedKeys {
+		t.Error("ContentAddressedKeys: expected every bucket but staging to use content-addressed keys")
+	}
+	if !cfg.BucketsSettings.Get("docs").RejectUnsafePDFs || cfg.BucketsSettings.Get("images").RejectUnsafePDFs {
+		t.Error("RejectUnsafePDFs: expected only docs to reject unsafe PDFs")
+	}
+	if !cfg.BucketsSettings.Get("docs").WatermarkPDFs || cfg.BucketsSettings.Get("images").WatermarkPDFs {
+		t.Error("WatermarkPDFs: expected only docs to watermark PDFs")
+	}
+}
+
+func TestLoad_BucketsPDFProfile(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("PDF_PROFILE", "strip_metadata")
+	t.Setenv("BUCKET_DOCS_PDF_PROFILE", " Strip_Metadata, remove_annotations,remove_forms , flatten")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := map[string]model.PDFProfile{
+		"images": {StripMetadata: true},
+		"docs":   {StripMetadata: true, RemoveAnnotations: true, RemoveForms: true, Flatten: true},
+	}
+	for bucket, profile := range want {
+		if got := cfg.BucketsSettings.Get(bucket).PDFProfile; got != profile {
+			t.Errorf("PDFProfile[%s]: expected %+v, got %+v", bucket, profile, got)
+		}
+	}
+}
+
+func TestLoad_BucketsSVGRasterVariants(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("BUCKET_DOCS_SVG_RASTER_VARIANTS", "png")
+	t.Setenv("BUCKET_IMAGES_SVG_RASTER_VARIANTS", " WebP")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	want := map[string]string{"images": "image/webp", "docs": "image/png", "staging": ""}
+	for bucket, format := range want {
+		if got := cfg.BucketsSettings.Get(bucket).SVGRasterVariants; got != format {
+			t.Errorf("SVGRasterVariants[%s]: expected %q, got %q", bucket, format, got)
+		}
+	}
+
+	t.Setenv("SVG_RASTER_VARIANTS", "gif")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestLoad_InvalidPDFProfile(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("BUCKET_DOCS_PDF_PROFILE", "strip_metadata,redact")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for unknown PDF profile step, got nil")
+	}
+}
+
+func TestLoad_BucketsOverlay(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("BUCKET_IMAGES_OVERLAY_MEDIA_ID", "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")
+	t.Setenv("BUCKET_IMAGES_OVERLAY_GRAVITY", " NorthWest")
+	t.Setenv("OVERLAY_OPACITY", "0.3")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got := cfg.BucketsSettings.Get("docs").Overlay; got != nil {
+		t.Errorf("expected no overlay for docs, got %+v", got)
+	}
+	got := cfg.BucketsSettings.Get("images").Overlay
+	if got == nil {
+		t.Fatal("expected an overlay for images")
+	}
+	want := model.ImageOverlay{
+		MediaID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")),
+		Gravity: model.GravityNorthWest,
+		Opacity: 0.3,
+		Scale:   defaultOverlayScale,
+	}
+	if *got != want {
+		t.Errorf("expected overlay %+v, got %+v", want, *got)
+	}
+}
+
+func TestLoad_InvalidOverlay(t *testing.T) {
+	for option, value := range map[string]string{
+		"OVERLAY_MEDIA_ID": "logo",
+		"OVERLAY_GRAVITY":  "top",
+		"OVERLAY_OPACITY":  "1.5",
+		"OVERLAY_SCALE":    "0",
+	} {
+		t.Run(option, func(t *testing.T) {
+			setupRequiredEnv(t)
+			t.Setenv("BUCKET_IMAGES_OVERLAY_MEDIA_ID", "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")
+			t.Setenv("BUCKET_IMAGES_"+option, value)
+
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%q, got nil", option, value)
+			}
+		})
+	}
+}
+
+func TestLoad_InvalidKeepOriginals(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("BUCKET_IMAGES_KEEP_ORIGINALS", "sometimes")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid boolean, got nil")
+	}
+}
+
+func TestLoad_InvalidTrashRetention(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("BUCKET_IMAGES_TRASH_RETENTION", "forever")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid duration, got nil")
+	}
+}
+
+func TestLoad_WebPQualityDefaults(t *testing.T) {
+	setupRequiredEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.WebPQualityMode != WebPQualityFixed {
+		t.Errorf("WebPQualityMode: expected %q, got %q", WebPQualityFixed, cfg.WebPQualityMode)
+	}
+	if cfg.WebPMinSSIM != defaultWebPMinSSIM {
+		t.Errorf("WebPMinSSIM: expected %v, got %v", defaultWebPMinSSIM, cfg.WebPMinSSIM)
+	}
+}
+
+func TestLoad_WebPQualitySearch(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("WEBP_QUALITY_MODE", "search")
+	t.Setenv("WEBP_MIN_SSIM", "0.9")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.WebPQualityMode != WebPQualitySearch {
+		t.Errorf("WebPQualityMode: expected %q, got %q", WebPQualitySearch, cfg.WebPQualityMode)
+	}
+	if cfg.WebPMinSSIM != 0.9 {
+		t.Errorf("WebPMinSSIM: expected 0.9, got %v", cfg.WebPMinSSIM)
+	}
+}
+
+func TestLoad_InvalidWebPQuality(t *testing.T) {
+	cases := map[string]map[string]string{
+		"unknown mode":   {"WEBP_QUALITY_MODE": "best"},
+		"not a number":   {"WEBP_MIN_SSIM": "high"},
+		"out of range":   {"WEBP_MIN_SSIM": "1.5"},
+		"zero threshold": {"WEBP_MIN_SSIM": "0"},
+	}
+
+	for name, env := range cases {
+		t.Run(name, func(t *testing.T) {
+			setupRequiredEnv(t)
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_ContentCacheControl(t *testing.T) {
+	setupRequiredEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ContentCacheControl != defaultContentCacheControl {
+		t.Errorf("ContentCacheControl: expected %q, got %q", defaultContentCacheControl, cfg.ContentCacheControl)
+	}
+
+	t.Setenv("CONTENT_CACHE_CONTROL", "private, max-age=600")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.ContentCacheControl != "private, max-age=600" {
+		t.Errorf("ContentCacheControl: expected %q, got %q", "private, max-age=600", cfg.ContentCacheControl)
+	}
+}
+
+func TestLoad_APIBaseURL(t *testing.T) {
+	setupRequiredEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.APIBaseURL != "" {
+		t.Errorf("APIBaseURL: expected none, got %q", cfg.APIBaseURL)
+	}
+
+	t.Setenv("API_BASE_URL", " https://api.example.com/ ")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cfg.APIBaseURL != "https://api.example.com" {
+		t.Errorf("APIBaseURL: expected %q, got %q", "https://api.example.com", cfg.APIBaseURL)
+	}
+
+	t.Setenv("API_BASE_URL", "api.example.com")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected an error for a relative URL")
+	}
+}
+
+func TestLoad_BucketsVisibility(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("VISIBILITY", "public")
+	t.Setenv("PUBLIC_BASE_URL", "https://cdn.example.com/")
+	t.Setenv("BUCKET_DOCS_VISIBILITY", "private")
+	t.Setenv("BUCKET_IMAGES_PUBLIC_BASE_URL", "https://img.example.com/images")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	images := cfg.BucketsSettings.Get("images")
+	if !images.IsPublic() || images.PublicBaseURL != "https://img.example.com/images" {
+		t.Errorf("images: expected public at the bucket base URL, got %+v", images)
+	}
+	if docs := cfg.BucketsSettings.Get("docs"); docs.IsPublic() || docs.PublicBaseURL != "" {
+		t.Errorf("docs: expected private, got %+v", docs)
+	}
+	if cfg.BucketsSettings.Get("staging").IsPublic() {
+		t.Error("staging: expected to always be private")
+	}
+}
+
+func TestLoad_PublicBucketsSharingBaseURL(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("VISIBILITY", "public")
+	t.Setenv("PUBLIC_BASE_URL", "https://cdn.example.com/")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	images, docs := cfg.BucketsSettings.Get("images"), cfg.BucketsSettings.Get("docs")
+	if images.PublicBaseURL != "https://cdn.example.com/images" {
+		t.Errorf("images: PublicBaseURL = %q", images.PublicBaseURL)
+	}
+	if docs.PublicBaseURL != "https://cdn.example.com/docs" {
+		t.Errorf("docs: PublicBaseURL = %q", docs.PublicBaseURL)
+	}
+}
+
+func TestLoad_InvalidVisibility(t *testing.T) {
+	cases := map[string]map[string]string{
+		"unknown visibility": {"VISIBILITY": "shared"},
+		"missing base URL":   {"BUCKET_IMAGES_VISIBILITY": "public"},
+		"relative base URL":  {"VISIBILITY": "public", "PUBLIC_BASE_URL": "cdn.example.com"},
+	}
+
+	for name, env := range cases {
+		t.Run(name, func(t *testing.T) {
+			setupRequiredEnv(t)
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestLoad_BucketsObjectDefaults(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("OBJECT_CACHE_CONTROL", "public, max-age=3600")
+	t.Setenv("BUCKET_DOCS_OBJECT_CACHE_CONTROL", "private, no-cache")
+	t.Setenv("OBJECT_METADATA", "service=medias, team = blog")
+	t.Setenv("BUCKET_IMAGES_OBJECT_TAGS", "tier=hot,")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	images := cfg.BucketsSettings.Get("images")
+	if images.CacheControl != "public, max-age=3600" {
+		t.Errorf("images: CacheControl = %q", images.CacheControl)
+	}
+	if want := map[string]string{"service": "medias", "team": "blog"}; !reflect.DeepEqual(images.ObjectMetadata, want) {
+		t.Errorf("images: ObjectMetadata = %v; want %v", images.ObjectMetadata, want)
+	}
+	if want := map[string]string{"tier": "hot"}; !reflect.DeepEqual(images.ObjectTags, want) {
+		t.Errorf("images: ObjectTags = %v; want %v", images.ObjectTags, want)
+	}
+	docs := cfg.BucketsSettings.Get("docs")
+	if docs.CacheControl != "private, no-cache" || docs.ObjectTags != nil {
+		t.Errorf("docs: expected its own Cache-Control and no tags, got %+v", docs)
+	}
+}
+
+func TestLoad_PublicWatermarkedBucket(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("BUCKET_DOCS_VISIBILITY", "public")
+	t.Setenv("BUCKET_DOCS_PUBLIC_BASE_URL", "https://cdn.example.com/docs")
+	t.Setenv("BUCKET_DOCS_WATERMARK_PDFS", "true")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for a public bucket watermarking its PDFs, got nil")
+	}
+}
+
+func TestLoad_InvalidObjectTags(t *testing.T) {
+	setupRequiredEnv(t)
+	t.Setenv("OBJECT_TAGS", "hot")
+
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid pairs, got nil")
+	}
+}
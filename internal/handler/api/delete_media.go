@@ -25,6 +25,10 @@ func DeleteMediaHandler(svc port.MediaDeleter) http.HandlerFunc {
 				WriteError(w, http.StatusNotFound, "Media not found", nil)
 				return
 			}
+			if errors.Is(err, media.ErrMediaReferenced) {
+				WriteError(w, http.StatusConflict, "Media is linked to by other medias", err)
+				return
+			}
 			WriteError(w, http.StatusInternalServerError, "Failed to delete media", err)
 			return
 		}
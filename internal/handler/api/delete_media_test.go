@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -38,6 +39,13 @@ func TestDeleteMediaHandler(t *testing.T) {
 			wantStatus:     http.StatusNotFound,
 			wantBodySubstr: "Media not found",
 		},
+		{
+			name:           "referenced",
+			ctxID:          &validID,
+			svcErr:         fmt.Errorf("%w: #x", mediaUC.ErrMediaReferenced),
+			wantStatus:     http.StatusConflict,
+			wantBodySubstr: "Media is linked to by other medias",
+		},
 		{
 			name:           "service error",
 			ctxID:          &validID,
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// DownloadMediaHandler redirects to the file of a media, in the format preferred by the client.
+// The optional width query parameter picks the best-fitting size, and variant a named variant.
+// Watermarked files cannot be linked to, so they are streamed by the content handler instead.
+func DownloadMediaHandler(svc port.MediaDownloader, content http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		query := r.URL.Query()
+		var width int
+		if raw := query.Get("width"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 {
+				WriteError(w, http.StatusBadRequest, "Width must be a positive integer", nil)
+				return
+			}
+			width = parsed
+		}
+
+		in := port.DownloadMediaInput{
+			ID:             id,
+			Accept:         r.Header.Get("Accept"),
+			Width:          width,
+			Variant:        query.Get("variant"),
+			AcceptEncoding: r.Header.Get("Accept-Encoding"),
+		}
+		if userID, ok := api_context.AuthUserIDFromContext(r.Context()); ok {
+			in.UserID = &userID
+		}
+		out, err := svc.DownloadMedia(r.Context(), in)
+		if err != nil {
+			switch {
+			case errors.Is(err, media.ErrObjectNotFound):
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+			case errors.Is(err, media.ErrVariantNotFound):
+				WriteError(w, http.StatusNotFound, "Variant not found", nil)
+			case errors.Is(err, media.ErrNotCompleted):
+				WriteError(w, http.StatusConflict, "Media is not completed", nil)
+			case errors.Is(err, media.ErrMediaExpired):
+				WriteError(w, http.StatusGone, "Media has expired", nil)
+			default:
+				WriteError(w, http.StatusInternalServerError, "Could not download media", err)
+			}
+			return
+		}
+
+		if out.Watermarked {
+			content(w, r)
+			return
+		}
+
+		// the target depends on the Accept headers and the link expires
+		w.Header().Set("Vary", "Accept, Accept-Encoding")
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, out.URL, http.StatusFound)
+		logger.Infof(r.Context(), "✅  Redirected to the %s file of media #%s", out.MimeType, id)
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestDownloadMediaHandler(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name           string
+		ctxID          *msuuid.UUID
+		query          string
+		svcErr         error
+		wantStatus     int
+		wantBodySubstr string
+	}{
+		{
+			name:           "missing id",
+			ctxID:          nil,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "ID is required",
+		},
+		{
+			name:           "not found",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrObjectNotFound,
+			wantStatus:     http.StatusNotFound,
+			wantBodySubstr: "Media not found",
+		},
+		{
+			name:           "invalid width",
+			ctxID:          &validID,
+			query:          "?width=-3",
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "Width must be a positive integer",
+		},
+		{
+			name:           "unknown variant",
+			ctxID:          &validID,
+			query:          "?variant=42",
+			svcErr:         mediaUC.ErrVariantNotFound,
+			wantStatus:     http.StatusNotFound,
+			wantBodySubstr: "Variant not found",
+		},
+		{
+			name:           "not completed",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrNotCompleted,
+			wantStatus:     http.StatusConflict,
+			wantBodySubstr: "Media is not completed",
+		},
+		{
+			name:           "expired",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrMediaExpired,
+			wantStatus:     http.StatusGone,
+			wantBodySubstr: "Media has expired",
+		},
+		{
+			name:           "service error",
+			ctxID:          &validID,
+			svcErr:         errors.New("boom"),
+			wantStatus:     http.StatusInternalServerError,
+			wantBodySubstr: "Could not download media",
+		},
+		{
+			name:       "happy path",
+			ctxID:      &validID,
+			wantStatus: http.StatusFound,
+		},
+		{
+			name:       "happy path with width and variant",
+			ctxID:      &validID,
+			query:      "?width=250&variant=300-jpeg",
+			wantStatus: http.StatusFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.MediaDownloader{
+				Out: &port.DownloadMediaOutput{URL: "https://example.com/foo_300.jpg", MimeType: "image/jpeg"},
+				Err: tc.svcErr,
+			}
+			h := DownloadMediaHandler(mockSvc, func(w http.ResponseWriter, r *http.Request) {
+				t.Error("content should not be streamed")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/medias/"+validID.String()+"/download"+tc.query, nil)
+			req.Header.Set("Accept", "image/jpeg,image/*;q=0.5")
+			req.Header.Set("Accept-Encoding", "gzip, br")
+			if tc.ctxID != nil {
+				req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, *tc.ctxID))
+			}
+
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			if !contains(rec.Body.String(), tc.wantBodySubstr) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBodySubstr)
+			}
+			if tc.ctxID == nil || tc.wantStatus == http.StatusBadRequest {
+				if mockSvc.Called {
+					t.Error("service should not be called")
+				}
+				return
+			}
+			if mockSvc.In.ID != validID || mockSvc.In.Accept != "image/jpeg,image/*;q=0.5" || mockSvc.In.AcceptEncoding != "gzip, br" {
+				t.Errorf("service got %+v", mockSvc.In)
+			}
+			if tc.query != "" && tc.wantStatus == http.StatusFound && (mockSvc.In.Width != 250 || mockSvc.In.Variant != "300-jpeg") {
+				t.Errorf("service got width %d and variant %q; want 250 and 300-jpeg", mockSvc.In.Width, mockSvc.In.Variant)
+			}
+			if tc.wantStatus == http.StatusFound {
+				if loc := rec.Header().Get("Location"); loc != "https://example.com/foo_300.jpg" {
+					t.Errorf("Location = %q; want the presigned URL", loc)
+				}
+				if vary := rec.Header().Get("Vary"); vary != "Accept, Accept-Encoding" {
+					t.Errorf("Vary = %q; want Accept, Accept-Encoding", vary)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadMediaHandler_Watermarked(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	mockSvc := &mock.MediaDownloader{Out: &port.DownloadMediaOutput{MimeType: "application/pdf", Watermarked: true}}
+	streamed := false
+	h := DownloadMediaHandler(mockSvc, func(w http.ResponseWriter, r *http.Request) {
+		streamed = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/medias/"+validID.String()+"/download", nil)
+	req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, validID))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if !streamed {
+		t.Fatal("expected the watermarked file to be streamed")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d; want 200", rec.Code)
+	}
+	if loc := rec.Header().Get("Location"); loc != "" {
+		t.Errorf("Location = %q; want no redirect", loc)
+	}
+}
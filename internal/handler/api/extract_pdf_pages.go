@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	"github.com/fhuszti/medias-ms-go/internal/validation"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type ExtractPagesRequest struct {
+	Pages string `json:"pages" validate:"required,max=200"`
+	Name  string `json:"name" validate:"omitempty,max=80"`
+}
+
+// ExtractPagesHandler creates a new media out of some pages of a PDF. The file is built by the
+// worker, so the media is pending when the handler responds.
+func ExtractPagesHandler(svc port.PDFPagesExtractor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		var req ExtractPagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid request", fmt.Errorf("invalid JSON: %w", err))
+			return
+		}
+
+		if errs := validation.ValidateStruct(req); errs != nil {
+			errsJSON, err := validation.ErrorsToJson(errs)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, "Validation error (could not encode details)", fmt.Errorf("encoding validation errors: %w", err))
+				return
+			}
+			RespondRawJSON(w, http.StatusBadRequest, []byte(errsJSON))
+			logger.Warnf(r.Context(), "❌  Validation failed: %s", errsJSON)
+			return
+		}
+
+		in := port.ExtractPagesInput{ID: id, Pages: req.Pages, Name: req.Name}
+		if userID, ok := api_context.AuthUserIDFromContext(r.Context()); ok {
+			in.OwnerID = &userID
+		}
+		out, err := svc.ExtractPages(r.Context(), in)
+		if err != nil {
+			writeDerivationError(w, err, fmt.Sprintf("Could not extract pages of media #%s", id))
+			return
+		}
+
+		RespondJSON(w, http.StatusAccepted, out)
+		logger.Infof(r.Context(), "✅  Successfully requested pages %q of media #%s as media #%s", req.Pages, id, out.ID)
+	}
+}
+
+// writeDerivationError responds to the errors of the usecases making a media out of PDFs.
+func writeDerivationError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, media.ErrObjectNotFound):
+		WriteError(w, http.StatusNotFound, "Media not found", nil)
+	case errors.Is(err, media.ErrNotCompleted):
+		WriteError(w, http.StatusConflict, "Media is not completed", nil)
+	case errors.Is(err, media.ErrMediaExpired):
+		WriteError(w, http.StatusGone, "Media has expired", nil)
+	case errors.Is(err, media.ErrNotPDF):
+		WriteError(w, http.StatusUnprocessableEntity, "Media is not a PDF", err)
+	case errors.Is(err, media.ErrMixedBuckets):
+		WriteError(w, http.StatusUnprocessableEntity, "PDFs must all be in the same bucket", err)
+	case errors.Is(err, media.ErrInvalidPageRange):
+		WriteError(w, http.StatusBadRequest, err.Error(), nil)
+	default:
+		WriteError(w, http.StatusInternalServerError, msg, err)
+	}
+}
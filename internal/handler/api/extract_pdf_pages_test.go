@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestExtractPagesHandler(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(guuid.MustParse("bbbbbbbb-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name         string
+		ctxID        bool
+		body         string
+		svcErr       error
+		wantStatus   int
+		wantErrorMap map[string]string
+		wantBody     string
+	}{
+		{name: "missing ID", body: `{"pages":"1"}`, wantStatus: http.StatusBadRequest, wantBody: "ID is required"},
+		{name: "invalid JSON", ctxID: true, body: `{"pages":`, wantStatus: http.StatusBadRequest, wantBody: "Invalid request"},
+		{name: "validation error: empty pages", ctxID: true, body: `{"pages":""}`, wantStatus: http.StatusBadRequest, wantErrorMap: map[string]string{"pages": "required"}},
+		{name: "validation error: name too long", ctxID: true, body: fmt.Sprintf(`{"pages":"1","name":"%s"}`, strings.Repeat("a", 81)), wantStatus: http.StatusBadRequest, wantErrorMap: map[string]string{"name": "max"}},
+		{name: "invalid page range", ctxID: true, body: `{"pages":"5"}`, svcErr: fmt.Errorf("%w: %q", mediaUC.ErrInvalidPageRange, "5"), wantStatus: http.StatusBadRequest, wantBody: "invalid page range"},
+		{name: "not found", ctxID: true, body: `{"pages":"1"}`, svcErr: mediaUC.ErrObjectNotFound, wantStatus: http.StatusNotFound, wantBody: "Media not found"},
+		{name: "not completed", ctxID: true, body: `{"pages":"1"}`, svcErr: mediaUC.ErrNotCompleted, wantStatus: http.StatusConflict, wantBody: "Media is not completed"},
+		{name: "expired", ctxID: true, body: `{"pages":"1"}`, svcErr: mediaUC.ErrMediaExpired, wantStatus: http.StatusGone, wantBody: "Media has expired"},
+		{name: "not a PDF", ctxID: true, body: `{"pages":"1"}`, svcErr: mediaUC.ErrNotPDF, wantStatus: http.StatusUnprocessableEntity, wantBody: "Media is not a PDF"},
+		{name: "service error", ctxID: true, body: `{"pages":"1"}`, svcErr: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantBody: "Could not extract pages of media #" + validID.String()},
+		{name: "happy path", ctxID: true, body: `{"pages":"1-2","name":"summary.pdf"}`, wantStatus: http.StatusAccepted},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.PDFPagesExtractor{Out: port.DerivedMediaOutput{ID: newID}, Err: tc.svcErr}
+			h := ExtractPagesHandler(mockSvc)
+
+			req := httptest.NewRequest(http.MethodPost, "/medias/"+validID.String()+"/pages", strings.NewReader(tc.body))
+			if tc.ctxID {
+				req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, validID))
+			}
+			rec := httptest.NewRecorder()
+
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d (body=%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+
+			switch {
+			case tc.wantErrorMap != nil:
+				var errs map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+					t.Fatalf("error JSON: %v; body=%q", err, rec.Body.String())
+				}
+				for k, want := range tc.wantErrorMap {
+					if got := errs[k]; got != want {
+						t.Errorf("errs[%q] = %q; want %q", k, got, want)
+					}
+				}
+			case tc.wantBody != "":
+				if !contains(rec.Body.String(), tc.wantBody) {
+					t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBody)
+				}
+			default:
+				var out port.DerivedMediaOutput
+				if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+					t.Fatalf("JSON decode = %v (body=%q)", err, rec.Body.String())
+				}
+				if out.ID != newID {
+					t.Errorf("ID = %v; want %v", out.ID, newID)
+				}
+				want := port.ExtractPagesInput{ID: validID, Pages: "1-2", Name: "summary.pdf"}
+				if mockSvc.In.ID != want.ID || mockSvc.In.Pages != want.Pages || mockSvc.In.Name != want.Name {
+					t.Errorf("service got %+v; want %+v", mockSvc.In, want)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/api_context"
 	"github.com/fhuszti/medias-ms-go/internal/port"
@@ -15,7 +16,8 @@ import (
 )
 
 type FinaliseUploadRequest struct {
-	DestBucket string `json:"dest_bucket" validate:"required"`
+	DestBucket string     `json:"dest_bucket" validate:"required"`
+	ExpiresAt  *time.Time `json:"expires_at" validate:"omitempty,gt"`
 }
 
 func FinaliseUploadHandler(svc port.UploadFinaliser, allowedBuckets []string) http.HandlerFunc {
@@ -56,12 +58,17 @@ func FinaliseUploadHandler(svc port.UploadFinaliser, allowedBuckets []string) ht
 		input := port.FinaliseUploadInput{
 			ID:         id,
 			DestBucket: req.DestBucket,
+			ExpiresAt:  req.ExpiresAt,
 		}
 		if err := svc.FinaliseUpload(r.Context(), input); err != nil {
 			if errors.Is(err, media.ErrObjectNotFound) {
 				WriteError(w, http.StatusNotFound, "Media not found", nil)
 				return
 			}
+			if errors.Is(err, media.ErrUnsafePDF) {
+				WriteError(w, http.StatusUnprocessableEntity, "PDF rejected: it contains JavaScript or an executable attachment", err)
+				return
+			}
 			WriteError(w, http.StatusInternalServerError, fmt.Sprintf("could not finalise upload of media #%s", input.ID), err)
 			return
 		}
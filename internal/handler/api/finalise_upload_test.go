@@ -5,13 +5,16 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/api_context"
 	"github.com/fhuszti/medias-ms-go/internal/mock"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 	guuid "github.com/google/uuid"
 )
@@ -69,6 +72,15 @@ func TestFinaliseUploadHandler(t *testing.T) {
 			wantContentType: "application/json",
 			wantBodyContain: "could not finalise upload of media #" + validID.String(),
 		},
+		{
+			name:            "unsafe PDF",
+			ctxID:           true,
+			body:            `{"dest_bucket":"bucket1"}`,
+			svcErr:          fmt.Errorf("move file failed: %w", mediaUC.ErrUnsafePDF),
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: "application/json",
+			wantBodyContain: "PDF rejected",
+		},
 		{
 			name:            "happy path",
 			ctxID:           true,
@@ -147,3 +159,24 @@ func TestFinaliseUploadHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestFinaliseUploadHandler_ExpiresAt(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	mockSvc := &mock.UploadFinaliser{}
+	h := FinaliseUploadHandler(mockSvc, []string{"bucket1"})
+
+	body := `{"dest_bucket":"bucket1","expires_at":"` + expiresAt.Format(time.RFC3339) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/any", bytes.NewBufferString(body))
+	req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, validID))
+	rec := httptest.NewRecorder()
+
+	h(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusNoContent)
+	}
+	if mockSvc.In.ExpiresAt == nil || !mockSvc.In.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("service got ExpiresAt = %v; want %v", mockSvc.In.ExpiresAt, expiresAt)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// FinaliseVersionHandler makes the uploaded new version of a media the current one.
+func FinaliseVersionHandler(svc port.VersionFinaliser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		if err := svc.FinaliseVersion(r.Context(), id); err != nil {
+			switch {
+			case errors.Is(err, media.ErrObjectNotFound):
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+			case errors.Is(err, media.ErrNotCompleted):
+				WriteError(w, http.StatusConflict, "Media is not completed", nil)
+			case errors.Is(err, media.ErrNoVersionUpload):
+				WriteError(w, http.StatusConflict, "No new version was uploaded", nil)
+			case errors.Is(err, media.ErrUnsafePDF):
+				WriteError(w, http.StatusUnprocessableEntity, "PDF rejected: it contains JavaScript or an executable attachment", err)
+			default:
+				WriteError(w, http.StatusInternalServerError, fmt.Sprintf("could not finalise new version of media #%s", id), err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		logger.Infof(r.Context(), "✅  Successfully finalised new version of media #%s", id)
+	}
+}
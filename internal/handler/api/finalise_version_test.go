@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestFinaliseVersionHandler(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name           string
+		ctxID          *msuuid.UUID
+		svcErr         error
+		wantStatus     int
+		wantBodySubstr string
+	}{
+		{
+			name:           "missing id",
+			ctxID:          nil,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "ID is required",
+		},
+		{
+			name:           "not found",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrObjectNotFound,
+			wantStatus:     http.StatusNotFound,
+			wantBodySubstr: "Media not found",
+		},
+		{
+			name:           "not completed",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrNotCompleted,
+			wantStatus:     http.StatusConflict,
+			wantBodySubstr: "Media is not completed",
+		},
+		{
+			name:           "nothing uploaded",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrNoVersionUpload,
+			wantStatus:     http.StatusConflict,
+			wantBodySubstr: "No new version was uploaded",
+		},
+		{
+			name:           "unsafe PDF",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrUnsafePDF,
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantBodySubstr: "PDF rejected",
+		},
+		{
+			name:           "service error",
+			ctxID:          &validID,
+			svcErr:         errors.New("boom"),
+			wantStatus:     http.StatusInternalServerError,
+			wantBodySubstr: "could not finalise new version of media #" + validID.String(),
+		},
+		{
+			name:       "happy path",
+			ctxID:      &validID,
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.VersionFinaliser{Err: tc.svcErr}
+			h := FinaliseVersionHandler(mockSvc)
+
+			req := httptest.NewRequest(http.MethodPost, "/medias/"+validID.String()+"/versions/finalise", nil)
+			if tc.ctxID != nil {
+				req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, *tc.ctxID))
+			}
+
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			if tc.ctxID != nil && mockSvc.ID != validID {
+				t.Errorf("service got ID = %s; want %s", mockSvc.ID, validID)
+			}
+			if !contains(rec.Body.String(), tc.wantBodySubstr) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBodySubstr)
+			}
+		})
+	}
+}
@@ -19,18 +19,28 @@ func GetMediaHandler(renderer port.HTTPRenderer, svc port.MediaGetter) http.Hand
 			return
 		}
 
-		raw, etag, err := renderer.RenderGetMedia(r.Context(), svc, id)
+		in := port.GetMediaInput{ID: id}
+		if userID, ok := api_context.AuthUserIDFromContext(r.Context()); ok {
+			in.UserID = &userID
+		}
+		raw, etag, err := renderer.RenderGetMedia(r.Context(), svc, in)
 		if err != nil {
 			if errors.Is(err, media.ErrObjectNotFound) {
 				WriteError(w, http.StatusNotFound, "Media not found", nil)
 				return
 			}
+			if errors.Is(err, media.ErrMediaExpired) {
+				WriteError(w, http.StatusGone, "Media has expired", nil)
+				return
+			}
 			WriteError(w, http.StatusInternalServerError, "Could not get media details", err)
 			return
 		}
 
 		w.Header().Set("ETag", etag)
 		w.Header().Set("Cache-Control", "public, max-age=300")
+		// owners are given the clean variants of their images in buckets with an overlay
+		w.Header().Set("Vary", "Authorization")
 		if match := r.Header.Get("If-None-Match"); match == etag {
 			w.WriteHeader(http.StatusNotModified)
 			logger.Infof(r.Context(), "✅  Returning cached media #%s", id)
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// GetMediaContentHandler streams the file of a media, or the variant named in the path,
+// through the API. Text files are sent compressed to the clients accepting it. Range,
+// If-Range and conditional requests are answered from the ETag and Last-Modified of the
+// stored file, and HEAD requests get the headers only.
+// Watermarked files are stamped for the authenticated user, and kept out of shared caches.
+func GetMediaContentHandler(svc port.MediaContentGetter, cacheControl string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		variant := chi.URLParam(r, "name")
+		in := port.GetMediaContentInput{
+			ID:             id,
+			Variant:        variant,
+			AcceptEncoding: r.Header.Get("Accept-Encoding"),
+		}
+		if userID, ok := api_context.AuthUserIDFromContext(r.Context()); ok {
+			in.UserID = &userID
+		}
+		out, err := svc.GetMediaContent(r.Context(), in)
+		if err != nil {
+			switch {
+			case errors.Is(err, media.ErrObjectNotFound):
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+			case errors.Is(err, media.ErrVariantNotFound):
+				WriteError(w, http.StatusNotFound, "Variant not found", nil)
+			case errors.Is(err, media.ErrNotCompleted):
+				WriteError(w, http.StatusConflict, "Media is not completed", nil)
+			case errors.Is(err, media.ErrMediaExpired):
+				WriteError(w, http.StatusGone, "Media has expired", nil)
+			case errors.Is(err, media.ErrWatermarkNeedsUser):
+				WriteError(w, http.StatusUnauthorized, "Authentication is required to download this media", nil)
+			default:
+				WriteError(w, http.StatusInternalServerError, "Could not stream media", err)
+			}
+			return
+		}
+		defer func() {
+			if cerr := out.Content.Close(); cerr != nil {
+				logger.Warnf(r.Context(), "error closing content of media #%s: %v", id, cerr)
+			}
+		}()
+
+		w.Header().Set("Content-Type", out.MimeType)
+		if out.Watermarked {
+			w.Header().Set("Cache-Control", "private, no-store")
+		} else {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		if out.ETag != "" {
+			w.Header().Set("ETag", quoteETag(out.ETag))
+		}
+		if out.ContentDisposition != "" {
+			w.Header().Set("Content-Disposition", out.ContentDisposition)
+		}
+		if out.ContentEncoding != "" {
+			w.Header().Set("Content-Encoding", out.ContentEncoding)
+		}
+		if variant == "" {
+			// the main file of text medias depends on the Accept-Encoding header
+			w.Header().Set("Vary", "Accept-Encoding")
+		} else {
+			// owners stream the clean variants of their images in buckets with an overlay
+			w.Header().Set("Vary", "Authorization")
+		}
+
+		http.ServeContent(w, r, "", out.LastModified, out.Content)
+	}
+}
+
+// quoteETag turns the ETag of the storage into a strong HTTP entity tag.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/go-chi/chi/v5"
+	guuid "github.com/google/uuid"
+)
+
+type closingReader struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (c *closingReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func newContentRequest(method, variant string, id *msuuid.UUID, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "/medias/x/content", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rctx := chi.NewRouteContext()
+	if variant != "" {
+		rctx.URLParams.Add("name", variant)
+	}
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	if id != nil {
+		ctx = context.WithValue(ctx, api_context.IDKey, *id)
+	}
+	return req.WithContext(ctx)
+}
+
+func TestGetMediaContentHandler_Errors(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name           string
+		ctxID          *msuuid.UUID
+		svcErr         error
+		wantStatus     int
+		wantBodySubstr string
+	}{
+		{"missing id", nil, nil, http.StatusBadRequest, "ID is required"},
+		{"not found", &validID, mediaUC.ErrObjectNotFound, http.StatusNotFound, "Media not found"},
+		{"unknown variant", &validID, mediaUC.ErrVariantNotFound, http.StatusNotFound, "Variant not found"},
+		{"not completed", &validID, mediaUC.ErrNotCompleted, http.StatusConflict, "Media is not completed"},
+		{"expired", &validID, mediaUC.ErrMediaExpired, http.StatusGone, "Media has expired"},
+		{"watermark without user", &validID, mediaUC.ErrWatermarkNeedsUser, http.StatusUnauthorized, "Authentication is required"},
+		{"service error", &validID, errors.New("boom"), http.StatusInternalServerError, "Could not stream media"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.MediaContentGetter{Err: tc.svcErr}
+			h := GetMediaContentHandler(mockSvc, "no-cache")
+
+			rec := httptest.NewRecorder()
+			h(rec, newContentRequest(http.MethodGet, "", tc.ctxID, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			if !contains(rec.Body.String(), tc.wantBodySubstr) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBodySubstr)
+			}
+		})
+	}
+}
+
+func TestGetMediaContentHandler_Serve(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	modified := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		method           string
+		variant          string
+		headers          map[string]string
+		wantStatus       int
+		wantBody         string
+		wantContentRange string
+		wantLength       string
+	}{
+		{
+			name:       "full content",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+			wantLength: "10",
+		},
+		{
+			name:             "range",
+			method:           http.MethodGet,
+			variant:          "300",
+			headers:          map[string]string{"Range": "bytes=2-5"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "2345",
+			wantContentRange: "bytes 2-5/10",
+			wantLength:       "4",
+		},
+		{
+			name:             "suffix range",
+			method:           http.MethodGet,
+			headers:          map[string]string{"Range": "bytes=-3"},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "789",
+			wantContentRange: "bytes 7-9/10",
+			wantLength:       "3",
+		},
+		{
+			name:             "if-range matching etag",
+			method:           http.MethodGet,
+			headers:          map[string]string{"Range": "bytes=0-1", "If-Range": `"abc"`},
+			wantStatus:       http.StatusPartialContent,
+			wantBody:         "01",
+			wantContentRange: "bytes 0-1/10",
+			wantLength:       "2",
+		},
+		{
+			name:       "if-range stale etag",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Range": "bytes=0-1", "If-Range": `"old"`},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789",
+			wantLength: "10",
+		},
+		{
+			name:             "unsatisfiable range",
+			method:           http.MethodGet,
+			headers:          map[string]string{"Range": "bytes=20-30"},
+			wantStatus:       http.StatusRequestedRangeNotSatisfiable,
+			wantContentRange: "bytes */10",
+		},
+		{
+			name:       "not modified",
+			method:     http.MethodGet,
+			headers:    map[string]string{"If-None-Match": `"abc"`},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "head",
+			method:     http.MethodHead,
+			wantStatus: http.StatusOK,
+			wantLength: "10",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			content := &closingReader{Reader: bytes.NewReader([]byte("0123456789"))}
+			mockSvc := &mock.MediaContentGetter{Out: &port.GetMediaContentOutput{
+				Content:            content,
+				MimeType:           "image/webp",
+				SizeBytes:          10,
+				ETag:               "abc",
+				LastModified:       modified,
+				ContentDisposition: `inline; filename="foo.webp"`,
+			}}
+			h := GetMediaContentHandler(mockSvc, "private, max-age=60")
+
+			rec := httptest.NewRecorder()
+			h(rec, newContentRequest(tc.method, tc.variant, &validID, tc.headers))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if string(body) != tc.wantBody && tc.wantStatus != http.StatusRequestedRangeNotSatisfiable {
+				t.Errorf("body = %q; want %q", body, tc.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tc.wantContentRange {
+				t.Errorf("Content-Range = %q; want %q", got, tc.wantContentRange)
+			}
+			if tc.wantLength != "" && rec.Header().Get("Content-Length") != tc.wantLength {
+				t.Errorf("Content-Length = %q; want %q", rec.Header().Get("Content-Length"), tc.wantLength)
+			}
+			// error responses drop the caching headers
+			if tc.wantStatus != http.StatusRequestedRangeNotSatisfiable &&
+				(rec.Header().Get("ETag") != `"abc"` || rec.Header().Get("Cache-Control") != "private, max-age=60") {
+				t.Errorf("ETag, Cache-Control = %q, %q", rec.Header().Get("ETag"), rec.Header().Get("Cache-Control"))
+			}
+			if tc.wantStatus == http.StatusOK && rec.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+				t.Errorf("Last-Modified = %q", rec.Header().Get("Last-Modified"))
+			}
+			if tc.wantStatus == http.StatusOK && rec.Header().Get("Content-Type") != "image/webp" {
+				t.Errorf("Content-Type = %q; want image/webp", rec.Header().Get("Content-Type"))
+			}
+			if mockSvc.In.ID != validID || mockSvc.In.Variant != tc.variant {
+				t.Errorf("service got %+v", mockSvc.In)
+			}
+			if !content.closed {
+				t.Error("content should be closed")
+			}
+		})
+	}
+}
+
+func TestGetMediaContentHandler_Encoded(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	mockSvc := &mock.MediaContentGetter{Out: &port.GetMediaContentOutput{
+		Content:         &closingReader{Reader: bytes.NewReader([]byte("compressed"))},
+		MimeType:        "text/markdown",
+		SizeBytes:       10,
+		ContentEncoding: "br",
+	}}
+	h := GetMediaContentHandler(mockSvc, "no-cache")
+
+	rec := httptest.NewRecorder()
+	h(rec, newContentRequest(http.MethodGet, "", &validID, map[string]string{"Accept-Encoding": "gzip, br"}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", rec.Code)
+	}
+	if mockSvc.In.AcceptEncoding != "gzip, br" {
+		t.Errorf("service got Accept-Encoding %q", mockSvc.In.AcceptEncoding)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Errorf("Content-Encoding = %q; want br", got)
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Vary = %q; want Accept-Encoding", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/markdown" {
+		t.Errorf("Content-Type = %q; want text/markdown", got)
+	}
+}
+
+func TestGetMediaContentHandler_Watermarked(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	userID := msuuid.UUID(guuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	mockSvc := &mock.MediaContentGetter{Out: &port.GetMediaContentOutput{
+		Content:     &closingReader{Reader: bytes.NewReader([]byte("%PDF-stamped"))},
+		MimeType:    "application/pdf",
+		SizeBytes:   12,
+		Watermarked: true,
+	}}
+	h := GetMediaContentHandler(mockSvc, "public, max-age=60")
+
+	req := newContentRequest(http.MethodGet, "", &validID, nil)
+	req = req.WithContext(context.WithValue(req.Context(), api_context.AuthUserIDKey, userID))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200", rec.Code)
+	}
+	if mockSvc.In.UserID == nil || *mockSvc.In.UserID != userID {
+		t.Errorf("service got user %v; want %s", mockSvc.In.UserID, userID)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private, no-store" {
+		t.Errorf("Cache-Control = %q; want private, no-store", got)
+	}
+	if rec.Body.String() != "%PDF-stamped" {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
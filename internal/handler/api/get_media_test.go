@@ -17,6 +17,7 @@ import (
 	"github.com/fhuszti/medias-ms-go/internal/mock"
 	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 	guuid "github.com/google/uuid"
 )
@@ -110,6 +111,15 @@ func TestGetMediaHandler(t *testing.T) {
 			wantCacheControl: "no-store, max-age=0, must-revalidate",
 			wantBodyContains: "Could not get media details",
 		},
+		{
+			name:             "expired media",
+			ctxID:            &validID,
+			svcOut:           port.GetMediaOutput{},
+			svcErr:           media.ErrMediaExpired,
+			wantStatus:       http.StatusGone,
+			wantContentType:  "application/json",
+			wantBodyContains: "Media has expired",
+		},
 		{
 			name:             "missing ID",
 			ctxID:            nil,
@@ -169,8 +179,8 @@ func TestGetMediaHandler(t *testing.T) {
 				if !renderer.GetMediaCalled {
 					t.Error("renderer was not called")
 				}
-				if renderer.GotMediaID != *tc.ctxID {
-					t.Errorf("renderer got ID = %s; want %s", renderer.GotMediaID, *tc.ctxID)
+				if renderer.GotIn.ID != *tc.ctxID {
+					t.Errorf("renderer got ID = %s; want %s", renderer.GotIn.ID, *tc.ctxID)
 				}
 			case tc.wantBodyContains != "":
 				if !strings.Contains(rec.Body.String(), tc.wantBodyContains) {
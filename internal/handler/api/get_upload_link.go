@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	"github.com/fhuszti/medias-ms-go/internal/validation"
 
@@ -12,7 +14,8 @@ import (
 )
 
 type GenerateUploadLinkRequest struct {
-	Name string `json:"name" validate:"required,max=80"`
+	Name      string     `json:"name" validate:"required,max=80"`
+	ExpiresAt *time.Time `json:"expires_at" validate:"omitempty,gt"`
 }
 
 func GenerateUploadLinkHandler(svc port.UploadLinkGenerator) http.HandlerFunc {
@@ -36,7 +39,10 @@ func GenerateUploadLinkHandler(svc port.UploadLinkGenerator) http.HandlerFunc {
 			return
 		}
 
-		in := port.GenerateUploadLinkInput(req)
+		in := port.GenerateUploadLinkInput{Name: req.Name, ExpiresAt: req.ExpiresAt}
+		if userID, ok := api_context.AuthUserIDFromContext(r.Context()); ok {
+			in.OwnerID = &userID
+		}
 		out, err := svc.GenerateUploadLink(r.Context(), in)
 		if err != nil {
 			WriteError(w, http.StatusInternalServerError, "Could not generate upload link", err)
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
 	"github.com/fhuszti/medias-ms-go/internal/mock"
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
@@ -65,6 +67,15 @@ func TestGenerateUploadLinkHandler(t *testing.T) {
 			wantContentType: "application/json",
 			wantErrorMap:    map[string]string{"name": "max"},
 		},
+		{
+			name:            "validation error: expires_at in the past",
+			body:            `{"name":"ok.png","expires_at":"2000-01-01T00:00:00Z"}`,
+			svcOut:          port.GenerateUploadLinkOutput{},
+			svcErr:          nil,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: "application/json",
+			wantErrorMap:    map[string]string{"expires_at": "gt"},
+		},
 		{
 			name:             "service error",
 			body:             `{"name":"ok.png"}`,
@@ -143,3 +154,21 @@ func TestGenerateUploadLinkHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateUploadLinkHandler_Owner(t *testing.T) {
+	userID := msuuid.UUID(guuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	mockSvc := &mock.UploadLinkGenerator{}
+	h := GenerateUploadLinkHandler(mockSvc)
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{"name":"notes.md"}`))
+	req = req.WithContext(context.WithValue(req.Context(), api_context.AuthUserIDKey, userID))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d; want %d", rec.Code, http.StatusCreated)
+	}
+	if mockSvc.In.Name != "notes.md" || mockSvc.In.OwnerID == nil || *mockSvc.In.OwnerID != userID {
+		t.Errorf("service input = %+v; want the authenticated user as owner", mockSvc.In)
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// GenerateVersionUploadLinkHandler returns a link to upload a new version of a media by ID.
+func GenerateVersionUploadLinkHandler(svc port.VersionUploadLinkGenerator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		out, err := svc.GenerateVersionUploadLink(r.Context(), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, media.ErrObjectNotFound):
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+			case errors.Is(err, media.ErrNotCompleted):
+				WriteError(w, http.StatusConflict, "Media is not completed", nil)
+			default:
+				WriteError(w, http.StatusInternalServerError, "Could not generate upload link", err)
+			}
+			return
+		}
+
+		RespondJSON(w, http.StatusCreated, out)
+		logger.Infof(r.Context(), "✅  Successfully generated version upload link for media #%s", out.ID)
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// ListVersionsHandler returns the previous versions of a media by ID.
+func ListVersionsHandler(svc port.VersionLister) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		out, err := svc.ListVersions(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, media.ErrObjectNotFound) {
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+				return
+			}
+			WriteError(w, http.StatusInternalServerError, "Could not list media versions", err)
+			return
+		}
+
+		RespondJSON(w, http.StatusOK, out)
+		logger.Infof(r.Context(), "✅  Successfully listed versions of media #%s", id)
+	}
+}
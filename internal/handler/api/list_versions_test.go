@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestListVersionsHandler(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name           string
+		ctxID          *msuuid.UUID
+		svcOut         port.ListVersionsOutput
+		svcErr         error
+		wantStatus     int
+		wantBodySubstr string
+	}{
+		{
+			name:           "missing id",
+			ctxID:          nil,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "ID is required",
+		},
+		{
+			name:           "not found",
+			ctxID:          &validID,
+			svcErr:         mediaUC.ErrObjectNotFound,
+			wantStatus:     http.StatusNotFound,
+			wantBodySubstr: "Media not found",
+		},
+		{
+			name:           "service error",
+			ctxID:          &validID,
+			svcErr:         errors.New("boom"),
+			wantStatus:     http.StatusInternalServerError,
+			wantBodySubstr: "Could not list media versions",
+		},
+		{
+			name:  "happy path",
+			ctxID: &validID,
+			svcOut: port.ListVersionsOutput{
+				CurrentVersion: 2,
+				Versions:       []port.VersionOutput{{Version: 1}},
+			},
+			wantStatus:     http.StatusOK,
+			wantBodySubstr: `"current_version":2`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.VersionLister{Out: tc.svcOut, Err: tc.svcErr}
+			h := ListVersionsHandler(mockSvc)
+
+			req := httptest.NewRequest(http.MethodGet, "/medias/"+validID.String()+"/versions", nil)
+			if tc.ctxID != nil {
+				req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, *tc.ctxID))
+			}
+
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			if tc.ctxID != nil && mockSvc.ID != validID {
+				t.Errorf("service got ID = %s; want %s", mockSvc.ID, validID)
+			}
+			if !contains(rec.Body.String(), tc.wantBodySubstr) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBodySubstr)
+			}
+			if tc.wantStatus == http.StatusOK {
+				var out port.ListVersionsOutput
+				if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+					t.Fatalf("invalid JSON body: %v", err)
+				}
+				if len(out.Versions) != 1 || out.Versions[0].Version != 1 {
+					t.Errorf("versions = %+v; want [1]", out.Versions)
+				}
+			}
+		})
+	}
+}
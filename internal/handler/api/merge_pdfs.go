@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/fhuszti/medias-ms-go/internal/validation"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type MergePDFsRequest struct {
+	IDs  []msuuid.UUID `json:"ids" validate:"min=2,max=20"`
+	Name string        `json:"name" validate:"omitempty,max=80"`
+}
+
+// MergePDFsHandler creates a new media out of PDFs, merged in the given order. The file is built
+// by the worker, so the media is pending when the handler responds.
+func MergePDFsHandler(svc port.PDFMerger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req MergePDFsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "Invalid request", fmt.Errorf("invalid JSON: %w", err))
+			return
+		}
+
+		if errs := validation.ValidateStruct(req); errs != nil {
+			errsJSON, err := validation.ErrorsToJson(errs)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, "Validation error (could not encode details)", fmt.Errorf("encoding validation errors: %w", err))
+				return
+			}
+			RespondRawJSON(w, http.StatusBadRequest, []byte(errsJSON))
+			logger.Warnf(r.Context(), "❌  Validation failed: %s", errsJSON)
+			return
+		}
+
+		in := port.MergePDFsInput{IDs: req.IDs, Name: req.Name}
+		if userID, ok := api_context.AuthUserIDFromContext(r.Context()); ok {
+			in.OwnerID = &userID
+		}
+		out, err := svc.MergePDFs(r.Context(), in)
+		if err != nil {
+			writeDerivationError(w, err, "Could not merge PDFs")
+			return
+		}
+
+		RespondJSON(w, http.StatusAccepted, out)
+		logger.Infof(r.Context(), "✅  Successfully requested the merge of %d PDFs as media #%s", len(req.IDs), out.ID)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestMergePDFsHandler(t *testing.T) {
+	id1 := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	id2 := msuuid.UUID(guuid.MustParse("bbbbbbbb-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(guuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	twoIDs := `{"ids":["` + id2.String() + `","` + id1.String() + `"]}`
+	tests := []struct {
+		name         string
+		body         string
+		svcErr       error
+		wantStatus   int
+		wantErrorMap map[string]string
+		wantBody     string
+	}{
+		{name: "invalid JSON", body: `{"ids":`, wantStatus: http.StatusBadRequest, wantBody: "Invalid request"},
+		{name: "invalid ID", body: `{"ids":["nope","` + id1.String() + `"]}`, wantStatus: http.StatusBadRequest, wantBody: "Invalid request"},
+		{name: "validation error: single PDF", body: `{"ids":["` + id1.String() + `"]}`, wantStatus: http.StatusBadRequest, wantErrorMap: map[string]string{"ids": "min"}},
+		{name: "validation error: too many PDFs", body: `{"ids":[` + strings.Repeat(`"`+id1.String()+`",`, 20) + `"` + id2.String() + `"]}`, wantStatus: http.StatusBadRequest, wantErrorMap: map[string]string{"ids": "max"}},
+		{name: "mixed buckets", body: twoIDs, svcErr: mediaUC.ErrMixedBuckets, wantStatus: http.StatusUnprocessableEntity, wantBody: "same bucket"},
+		{name: "not found", body: twoIDs, svcErr: mediaUC.ErrObjectNotFound, wantStatus: http.StatusNotFound, wantBody: "Media not found"},
+		{name: "service error", body: twoIDs, svcErr: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantBody: "Could not merge PDFs"},
+		{name: "happy path", body: twoIDs, wantStatus: http.StatusAccepted},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.PDFMerger{Out: port.DerivedMediaOutput{ID: newID}, Err: tc.svcErr}
+			h := MergePDFsHandler(mockSvc)
+
+			req := httptest.NewRequest(http.MethodPost, "/medias/merge", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d (body=%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+
+			switch {
+			case tc.wantErrorMap != nil:
+				var errs map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &errs); err != nil {
+					t.Fatalf("error JSON: %v; body=%q", err, rec.Body.String())
+				}
+				for k, want := range tc.wantErrorMap {
+					if got := errs[k]; got != want {
+						t.Errorf("errs[%q] = %q; want %q", k, got, want)
+					}
+				}
+			case tc.wantBody != "":
+				if !contains(rec.Body.String(), tc.wantBody) {
+					t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBody)
+				}
+			default:
+				var out port.DerivedMediaOutput
+				if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+					t.Fatalf("JSON decode = %v (body=%q)", err, rec.Body.String())
+				}
+				if out.ID != newID {
+					t.Errorf("ID = %v; want %v", out.ID, newID)
+				}
+				if len(mockSvc.In.IDs) != 2 || mockSvc.In.IDs[0] != id2 || mockSvc.In.IDs[1] != id1 {
+					t.Errorf("service got IDs %v; want [%s %s]", mockSvc.In.IDs, id2, id1)
+				}
+			}
+		})
+	}
+}
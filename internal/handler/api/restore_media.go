@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// RestoreMediaHandler brings a media back from the trash by ID.
+func RestoreMediaHandler(svc port.MediaRestorer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		if err := svc.RestoreMedia(r.Context(), id); err != nil {
+			switch {
+			case errors.Is(err, media.ErrObjectNotFound):
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+			case errors.Is(err, media.ErrMediaNotDeleted):
+				WriteError(w, http.StatusConflict, "Media is not in the trash", nil)
+			default:
+				WriteError(w, http.StatusInternalServerError, "Failed to restore media", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		logger.Infof(r.Context(), "✅  Successfully restored media #%s", id)
+	}
+}
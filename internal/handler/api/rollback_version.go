@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	"github.com/fhuszti/medias-ms-go/internal/validation"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type RollbackVersionRequest struct {
+	Version int `json:"version" validate:"required,gt=0"`
+}
+
+// RollbackVersionHandler makes a previous version of a media the current one again.
+func RollbackVersionHandler(svc port.VersionRollbacker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := api_context.IDFromContext(r.Context())
+		if !ok {
+			WriteError(w, http.StatusBadRequest, "ID is required", nil)
+			return
+		}
+
+		var req RollbackVersionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "invalid request payload", err)
+			return
+		}
+
+		if errs := validation.ValidateStruct(req); errs != nil {
+			errsJSON, err := validation.ErrorsToJson(errs)
+			if err != nil {
+				WriteError(w, http.StatusInternalServerError, "failed to encode validation errors", err)
+				return
+			}
+			RespondRawJSON(w, http.StatusBadRequest, []byte(errsJSON))
+			logger.Warnf(r.Context(), "❌  Validation failed: %s", errsJSON)
+			return
+		}
+
+		input := port.RollbackVersionInput{
+			ID:      id,
+			Version: req.Version,
+		}
+		if err := svc.RollbackVersion(r.Context(), input); err != nil {
+			switch {
+			case errors.Is(err, media.ErrObjectNotFound):
+				WriteError(w, http.StatusNotFound, "Media not found", nil)
+			case errors.Is(err, media.ErrVersionNotFound):
+				WriteError(w, http.StatusNotFound, "Version not found", nil)
+			case errors.Is(err, media.ErrNotCompleted):
+				WriteError(w, http.StatusConflict, "Media is not completed", nil)
+			default:
+				WriteError(w, http.StatusInternalServerError, fmt.Sprintf("could not roll back media #%s", id), err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		logger.Infof(r.Context(), "✅  Successfully rolled back media #%s to version %d", id, req.Version)
+	}
+}
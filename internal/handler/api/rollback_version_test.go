@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/api_context"
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	mediaUC "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestRollbackVersionHandler(t *testing.T) {
+	validID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name           string
+		ctxID          *msuuid.UUID
+		body           string
+		svcErr         error
+		wantStatus     int
+		wantBodySubstr string
+		wantSvcCalled  bool
+	}{
+		{
+			name:           "missing id",
+			ctxID:          nil,
+			body:           `{"version":1}`,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "ID is required",
+		},
+		{
+			name:           "invalid JSON",
+			ctxID:          &validID,
+			body:           `{"version":`,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "invalid request payload",
+		},
+		{
+			name:           "validation error: missing version",
+			ctxID:          &validID,
+			body:           `{}`,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: `"version":"required"`,
+		},
+		{
+			name:           "validation error: negative version",
+			ctxID:          &validID,
+			body:           `{"version":-1}`,
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: `"version":"gt"`,
+		},
+		{
+			name:           "media not found",
+			ctxID:          &validID,
+			body:           `{"version":1}`,
+			svcErr:         mediaUC.ErrObjectNotFound,
+			wantStatus:     http.StatusNotFound,
+			wantBodySubstr: "Media not found",
+			wantSvcCalled:  true,
+		},
+		{
+			name:           "version not found",
+			ctxID:          &validID,
+			body:           `{"version":1}`,
+			svcErr:         mediaUC.ErrVersionNotFound,
+			wantStatus:     http.StatusNotFound,
+			wantBodySubstr: "Version not found",
+			wantSvcCalled:  true,
+		},
+		{
+			name:           "not completed",
+			ctxID:          &validID,
+			body:           `{"version":1}`,
+			svcErr:         mediaUC.ErrNotCompleted,
+			wantStatus:     http.StatusConflict,
+			wantBodySubstr: "Media is not completed",
+			wantSvcCalled:  true,
+		},
+		{
+			name:           "service error",
+			ctxID:          &validID,
+			body:           `{"version":1}`,
+			svcErr:         errors.New("boom"),
+			wantStatus:     http.StatusInternalServerError,
+			wantBodySubstr: "could not roll back media #" + validID.String(),
+			wantSvcCalled:  true,
+		},
+		{
+			name:          "happy path",
+			ctxID:         &validID,
+			body:          `{"version":1}`,
+			wantStatus:    http.StatusNoContent,
+			wantSvcCalled: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.VersionRollbacker{Err: tc.svcErr}
+			h := RollbackVersionHandler(mockSvc)
+
+			req := httptest.NewRequest(http.MethodPost, "/medias/"+validID.String()+"/rollback", strings.NewReader(tc.body))
+			if tc.ctxID != nil {
+				req = req.WithContext(context.WithValue(req.Context(), api_context.IDKey, *tc.ctxID))
+			}
+
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			if tc.wantSvcCalled && (mockSvc.In.ID != validID || mockSvc.In.Version != 1) {
+				t.Errorf("service got input = %+v; want ID %s and version 1", mockSvc.In, validID)
+			}
+			if !contains(rec.Body.String(), tc.wantBodySubstr) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBodySubstr)
+			}
+		})
+	}
+}
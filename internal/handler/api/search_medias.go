@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// MinSearchQueryLength is the number of characters a search query needs at least.
+const MinSearchQueryLength = 3
+
+// SearchMediasHandler returns the medias whose text matches the q query parameter. The optional
+// bucket and owner parameters narrow the search, and limit caps the number of results.
+func SearchMediasHandler(svc port.MediaSearcher, allowedBuckets []string) http.HandlerFunc {
+	allowedSet := make(map[string]struct{}, len(allowedBuckets))
+	for _, b := range allowedBuckets {
+		allowedSet[b] = struct{}{}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		in := port.SearchMediasInput{
+			Query:  query.Get("q"),
+			Bucket: query.Get("bucket"),
+		}
+		if utf8.RuneCountInString(in.Query) < MinSearchQueryLength {
+			WriteError(w, http.StatusBadRequest, fmt.Sprintf("Query must be at least %d characters long", MinSearchQueryLength), nil)
+			return
+		}
+		if in.Bucket != "" {
+			if _, ok := allowedSet[in.Bucket]; !ok {
+				WriteError(w, http.StatusBadRequest, fmt.Sprintf("bucket %q does not exist", in.Bucket), nil)
+				return
+			}
+		}
+		if raw := query.Get("owner"); raw != "" {
+			var ownerID msuuid.UUID
+			if err := ownerID.UnmarshalText([]byte(raw)); err != nil {
+				WriteError(w, http.StatusBadRequest, fmt.Sprintf("Owner %q is not a valid UUID", raw), nil)
+				return
+			}
+			in.OwnerID = &ownerID
+		}
+		if raw := query.Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > media.MaxSearchLimit {
+				WriteError(w, http.StatusBadRequest, fmt.Sprintf("Limit must be an integer between 1 and %d", media.MaxSearchLimit), nil)
+				return
+			}
+			in.Limit = parsed
+		}
+
+		out, err := svc.SearchMedias(r.Context(), in)
+		if err != nil {
+			WriteError(w, http.StatusInternalServerError, "Could not search medias", err)
+			return
+		}
+
+		RespondJSON(w, http.StatusOK, out)
+		logger.Infof(r.Context(), "✅  Found %d medias matching %q", len(out.Results), in.Query)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	guuid "github.com/google/uuid"
+)
+
+func TestSearchMediasHandler(t *testing.T) {
+	ownerID := msuuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	tests := []struct {
+		name           string
+		query          string
+		svcOut         port.SearchMediasOutput
+		svcErr         error
+		wantStatus     int
+		wantIn         *port.SearchMediasInput
+		wantBodySubstr string
+	}{
+		{
+			name:           "missing query",
+			query:          "",
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "Query must be at least 3 characters long",
+		},
+		{
+			name:           "query too short",
+			query:          "q=ab",
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "Query must be at least 3 characters long",
+		},
+		{
+			name:           "unknown bucket",
+			query:          "q=report&bucket=nope",
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: `bucket \"nope\" does not exist`,
+		},
+		{
+			name:           "invalid owner",
+			query:          "q=report&owner=nope",
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "is not a valid UUID",
+		},
+		{
+			name:           "invalid limit",
+			query:          "q=report&limit=0",
+			wantStatus:     http.StatusBadRequest,
+			wantBodySubstr: "Limit must be an integer between 1 and 100",
+		},
+		{
+			name:           "service error",
+			query:          "q=report",
+			svcErr:         errors.New("boom"),
+			wantStatus:     http.StatusInternalServerError,
+			wantBodySubstr: "Could not search medias",
+		},
+		{
+			name:  "happy path",
+			query: "q=annual+report&bucket=docs&owner=" + ownerID.String() + "&limit=5",
+			svcOut: port.SearchMediasOutput{Results: []port.SearchResultOutput{
+				{ID: ownerID, Name: "report.pdf", Snippet: "annual <mark>report</mark>"},
+			}},
+			wantStatus:     http.StatusOK,
+			wantIn:         &port.SearchMediasInput{Query: "annual report", Bucket: "docs", OwnerID: &ownerID, Limit: 5},
+			wantBodySubstr: `"name":"report.pdf"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mockSvc := &mock.MediaSearcher{Out: tc.svcOut, Err: tc.svcErr}
+			h := SearchMediasHandler(mockSvc, []string{"docs", "images"})
+
+			req := httptest.NewRequest(http.MethodGet, "/medias/search?"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			h(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d; want %d", rec.Code, tc.wantStatus)
+			}
+			if !contains(rec.Body.String(), tc.wantBodySubstr) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tc.wantBodySubstr)
+			}
+			if tc.wantIn != nil {
+				got := mockSvc.In
+				if got.Query != tc.wantIn.Query || got.Bucket != tc.wantIn.Bucket || got.Limit != tc.wantIn.Limit ||
+					got.OwnerID == nil || *got.OwnerID != *tc.wantIn.OwnerID {
+					t.Errorf("service input = %+v; want %+v", got, *tc.wantIn)
+				}
+			}
+			if tc.wantStatus == http.StatusOK {
+				var out port.SearchMediasOutput
+				if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+					t.Fatalf("invalid JSON body: %v", err)
+				}
+				if len(out.Results) != 1 || out.Results[0].Snippet != "annual <mark>report</mark>" {
+					t.Errorf("results = %+v; want the service ones", out.Results)
+				}
+			}
+		})
+	}
+}
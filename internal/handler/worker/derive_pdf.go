@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/task"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/fhuszti/medias-ms-go/internal/validation"
+	"github.com/google/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// DerivePDFHandler handles a derive-pdf task.
+// It converts the incoming task payload to the input expected by
+// the PDFDeriver service and delegates the call.
+func DerivePDFHandler(ctx context.Context, p task.DerivePDFPayload, svc port.PDFDeriver) error {
+	if err := validation.ValidateStruct(p); err != nil {
+		logger.Errorf(ctx, "❌  Payload validation failed: %v", err)
+		return err
+	}
+
+	id := uuid.MustParse(p.ID)
+
+	if err := svc.DerivePDF(ctx, msuuid.UUID(id)); err != nil {
+		logger.Errorf(ctx, "❌  Failed to derive media #%s: %v", id, err)
+		return err
+	}
+
+	logger.Infof(ctx, "✅  Successfully derived media #%s", id)
+	return nil
+}
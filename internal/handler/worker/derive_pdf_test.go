@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/task"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestDerivePDFHandler_InvalidID(t *testing.T) {
+	svc := &mock.PDFDeriver{}
+	err := DerivePDFHandler(context.Background(), task.DerivePDFPayload{ID: "invalid"}, svc)
+	if err == nil {
+		t.Fatal("expected error for invalid UUID")
+	}
+	if svc.Called {
+		t.Error("service should not be called on invalid id")
+	}
+}
+
+func TestDerivePDFHandler_ServiceError(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	svcErr := errors.New("svc fail")
+	svc := &mock.PDFDeriver{Err: svcErr}
+
+	err := DerivePDFHandler(context.Background(), task.DerivePDFPayload{ID: id.String()}, svc)
+	if !errors.Is(err, svcErr) {
+		t.Fatalf("got error %v; want %v", err, svcErr)
+	}
+	if !svc.Called {
+		t.Error("service not called")
+	}
+	if svc.ID != id {
+		t.Errorf("service got id %s; want %s", svc.ID, id)
+	}
+}
+
+func TestDerivePDFHandler_Success(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	svc := &mock.PDFDeriver{}
+
+	err := DerivePDFHandler(context.Background(), task.DerivePDFPayload{ID: id.String()}, svc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !svc.Called {
+		t.Error("service not called")
+	}
+	if svc.ID != id {
+		t.Errorf("service got id %s; want %s", svc.ID, id)
+	}
+}
@@ -0,0 +1,20 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// PurgeExpiredHandler handles a purge-expired task by delegating the call to the service.
+func PurgeExpiredHandler(ctx context.Context, svc port.ExpiredPurger) error {
+	if err := svc.PurgeExpired(ctx); err != nil {
+		logger.Errorf(ctx, "❌  Failed to purge expired medias: %v", err)
+		return err
+	}
+
+	logger.Info(ctx, "✅  Successfully purged expired medias")
+	return nil
+}
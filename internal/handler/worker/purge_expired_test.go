@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+)
+
+func TestPurgeExpiredHandler_ServiceError(t *testing.T) {
+	svcErr := errors.New("svc fail")
+	svc := &mock.ExpiredPurger{Err: svcErr}
+
+	if err := PurgeExpiredHandler(context.Background(), svc); !errors.Is(err, svcErr) {
+		t.Fatalf("got error %v; want %v", err, svcErr)
+	}
+	if !svc.Called {
+		t.Error("service not called")
+	}
+}
+
+func TestPurgeExpiredHandler_Success(t *testing.T) {
+	svc := &mock.ExpiredPurger{}
+
+	if err := PurgeExpiredHandler(context.Background(), svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !svc.Called {
+		t.Error("service not called")
+	}
+}
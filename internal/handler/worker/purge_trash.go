@@ -0,0 +1,20 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// PurgeTrashHandler handles a purge-trash task by delegating the call to the service.
+func PurgeTrashHandler(ctx context.Context, svc port.TrashPurger) error {
+	if err := svc.PurgeTrash(ctx); err != nil {
+		logger.Errorf(ctx, "❌  Failed to purge the trash: %v", err)
+		return err
+	}
+
+	logger.Info(ctx, "✅  Successfully purged the trash")
+	return nil
+}
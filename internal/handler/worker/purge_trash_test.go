@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+)
+
+func TestPurgeTrashHandler_ServiceError(t *testing.T) {
+	svcErr := errors.New("svc fail")
+	svc := &mock.TrashPurger{Err: svcErr}
+
+	if err := PurgeTrashHandler(context.Background(), svc); !errors.Is(err, svcErr) {
+		t.Fatalf("got error %v; want %v", err, svcErr)
+	}
+	if !svc.Called {
+		t.Error("service not called")
+	}
+}
+
+func TestPurgeTrashHandler_Success(t *testing.T) {
+	svc := &mock.TrashPurger{}
+
+	if err := PurgeTrashHandler(context.Background(), svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !svc.Called {
+		t.Error("service not called")
+	}
+}
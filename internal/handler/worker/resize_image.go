@@ -21,7 +21,7 @@ func ResizeImageHandler(ctx context.Context, p task.ResizeImagePayload, sizes []
 	}
 
 	id := uuid.MustParse(p.ID)
-	in := port.ResizeImageInput{ID: msuuid.UUID(id), Sizes: sizes}
+	in := port.ResizeImageInput{ID: msuuid.UUID(id), Sizes: sizes, Reconcile: p.Reconcile}
 	if err := svc.ResizeImage(ctx, in); err != nil {
 		logger.Errorf(ctx, "❌  Failed to resize image #%s: %v", id, err)
 		return err
@@ -62,3 +62,15 @@ func TestResizeImageHandler_Success(t *testing.T) {
 		t.Errorf("service got sizes %v; want %v", svc.In.Sizes, sizes)
 	}
 }
+
+func TestResizeImageHandler_Reconcile(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	svc := &mock.ImageResizer{}
+
+	if err := ResizeImageHandler(context.Background(), task.ResizeImagePayload{ID: id.String(), Reconcile: true}, []int{100}, svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !svc.In.Reconcile {
+		t.Error("expected reconcile mode to be passed to the service")
+	}
+}
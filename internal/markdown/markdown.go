@@ -0,0 +1,289 @@
+// Package markdown parses CommonMark documents, with GitHub flavoured extensions: their
+// YAML front matter, their outline, and a sanitized HTML rendering of them.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v3"
+)
+
+// WordsPerMinute is the reading speed the reading time is estimated with.
+const WordsPerMinute = 200
+
+// MediaScheme prefixes the links and images pointing at another media, e.g. ![](media:<id>).
+const MediaScheme = "media:"
+
+// FrontMatter holds the fields of the YAML front matter that are kept as metadata.
+type FrontMatter struct {
+	Title string     `yaml:"title"`
+	Tags  stringList `yaml:"tags"`
+	// Date is kept as written, e.g. 2024-05-01.
+	Date string `yaml:"date"`
+}
+
+// Heading is an entry of the table of contents.
+type Heading struct {
+	Level int
+	Text  string
+	// ID is the anchor of the heading in the HTML rendering.
+	ID string
+}
+
+// MediaLink is what a media reference is rendered to.
+type MediaLink struct {
+	URL string
+	// SrcSet lists the other widths of an image, e.g. "https://.../300.webp 300w, ...".
+	SrcSet string
+}
+
+// Document is a parsed markdown document.
+type Document struct {
+	FrontMatter
+	WordCount int
+	LinkCount int
+	Headings  []Heading
+	// MediaReferences are the IDs of the medias linked to with the MediaScheme, in order of
+	// first appearance.
+	MediaReferences []string
+
+	source []byte
+	root   ast.Node
+}
+
+var md = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+// policy keeps the markup of user generated content, along with the heading anchors.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\w-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	// bluemonday does not check the URLs of a srcset, so only plain http(s) ones are let through
+	p.AllowAttrs("srcset").Matching(srcSetPattern).OnElements("img")
+	return p
+}()
+
+var srcSetPattern = regexp.MustCompile(`^https?://[^\s,]+ \d+w(, https?://[^\s,]+ \d+w)*$`)
+
+// Parse reads the front matter of the document, if any, then parses the markdown that follows it.
+func Parse(src []byte) (*Document, error) {
+	doc := &Document{}
+	body, err := splitFrontMatter(src, &doc.FrontMatter)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.source = body
+	doc.root = md.Parser().Parse(text.NewReader(body))
+
+	err = ast.Walk(doc.root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Heading:
+			id, _ := node.AttributeString("id")
+			idBytes, _ := id.([]byte)
+			doc.Headings = append(doc.Headings, Heading{
+				Level: node.Level,
+				Text:  inlineText(node, body),
+				ID:    string(idBytes),
+			})
+		case *ast.Link:
+			doc.LinkCount++
+			doc.addMediaReference(node.Destination)
+		case *ast.Image:
+			doc.addMediaReference(node.Destination)
+		case *ast.AutoLink:
+			doc.LinkCount++
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("markdown: failed to walk document: %w", err)
+	}
+	doc.WordCount = len(strings.Fields(doc.Text()))
+	return doc, nil
+}
+
+// Text returns the text of the document, without its front matter, markup, code blocks or raw HTML.
+func (d *Document) Text() string {
+	return inlineText(d.root, d.source)
+}
+
+// ReadingTime returns the estimated reading time of the document, in minutes rounded up.
+func (d *Document) ReadingTime() int {
+	return (d.WordCount + WordsPerMinute - 1) / WordsPerMinute
+}
+
+// HTML renders the document, without its front matter, as sanitized HTML: raw HTML, scripts
+// and unsafe links are dropped, so the result can be embedded as is. Media references are
+// replaced with their link in links, keyed by media ID; the ones missing from it are dropped.
+func (d *Document) HTML(links map[string]MediaLink) ([]byte, error) {
+	restore := d.resolveMediaReferences(links)
+	defer restore()
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, d.source, d.root); err != nil {
+		return nil, fmt.Errorf("markdown: failed to render HTML: %w", err)
+	}
+	return policy.SanitizeBytes(buf.Bytes()), nil
+}
+
+func (d *Document) addMediaReference(destination []byte) {
+	id, ok := mediaID(destination)
+	if !ok || slices.Contains(d.MediaReferences, id) {
+		return
+	}
+	d.MediaReferences = append(d.MediaReferences, id)
+}
+
+// resolveMediaReferences points the media references of the tree at their links, and returns
+// a function putting the tree back as parsed.
+func (d *Document) resolveMediaReferences(links map[string]MediaLink) func() {
+	var undo []func()
+	_ = ast.Walk(d.root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		// unresolved references keep their scheme, which the sanitizer strips
+		case *ast.Link:
+			if link, ok := mediaLink(node.Destination, links); ok {
+				dest := node.Destination
+				node.Destination = []byte(link.URL)
+				undo = append(undo, func() { node.Destination = dest })
+			}
+		case *ast.Image:
+			if link, ok := mediaLink(node.Destination, links); ok {
+				dest := node.Destination
+				node.Destination = []byte(link.URL)
+				if link.SrcSet != "" {
+					node.SetAttributeString("srcset", []byte(link.SrcSet))
+				}
+				undo = append(undo, func() {
+					node.Destination = dest
+					node.RemoveAttributes()
+				})
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return func() {
+		for _, fn := range undo {
+			fn()
+		}
+	}
+}
+
+func mediaLink(destination []byte, links map[string]MediaLink) (MediaLink, bool) {
+	id, ok := mediaID(destination)
+	if !ok {
+		return MediaLink{}, false
+	}
+	link, ok := links[id]
+	return link, ok && link.URL != ""
+}
+
+// mediaID returns the ID a destination using the MediaScheme points at.
+func mediaID(destination []byte) (string, bool) {
+	id, ok := strings.CutPrefix(string(destination), MediaScheme)
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// splitFrontMatter decodes the YAML front matter opening the document, delimited by --- lines,
+// and returns the markdown following it.
+func splitFrontMatter(src []byte, fm *FrontMatter) ([]byte, error) {
+	rest, ok := cutLine(src, "---")
+	if !ok {
+		return src, nil
+	}
+
+	var yamlSrc []byte
+	for len(rest) > 0 {
+		line, next, _ := bytes.Cut(rest, []byte("\n"))
+		if delim := strings.TrimRight(string(line), " \t\r"); delim == "---" || delim == "..." {
+			if err := yaml.Unmarshal(yamlSrc, fm); err != nil {
+				return nil, fmt.Errorf("markdown: invalid front matter: %w", err)
+			}
+			return next, nil
+		}
+		yamlSrc = append(yamlSrc, line...)
+		yamlSrc = append(yamlSrc, '\n')
+		rest = next
+	}
+	// never closed, so not front matter after all
+	return src, nil
+}
+
+// cutLine returns what follows the first line of src if that line is the given one.
+func cutLine(src []byte, line string) ([]byte, bool) {
+	first, rest, found := bytes.Cut(src, []byte("\n"))
+	if !found || strings.TrimRight(string(first), " \t\r") != line {
+		return nil, false
+	}
+	return rest, true
+}
+
+// inlineText concatenates the text of a node, blocks being separated by spaces. Code blocks
+// and raw HTML are left out.
+func inlineText(n ast.Node, source []byte) string {
+	var sb strings.Builder
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if c.Type() == ast.TypeBlock {
+			sb.WriteByte(' ')
+		}
+		switch node := c.(type) {
+		case *ast.AutoLink:
+			sb.Write(node.Label(source))
+		case *ast.Text:
+			sb.Write(node.Value(source))
+			if node.SoftLineBreak() || node.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(sb.String())
+}
+
+// stringList decodes either a YAML sequence or a comma-separated string.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = nil
+		for _, s := range strings.Split(value.Value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				*l = append(*l, s)
+			}
+		}
+		return nil
+	}
+	var items []string
+	if err := value.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
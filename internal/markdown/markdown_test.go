@@ -0,0 +1,182 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const article = `---
+title: Release notes
+tags: [go, minio]
+date: 2024-05-01
+---
+# Release notes
+
+Some **bold** words and a [link](https://example.com).
+
+## Install it
+
+Visit https://example.com/docs today.
+
+<script>alert("xss")</script>
+
+[bad](javascript:alert(1))
+`
+
+func TestParse_FrontMatterAndOutline(t *testing.T) {
+	doc, err := Parse([]byte(article))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if doc.Title != "Release notes" || doc.Date != "2024-05-01" {
+		t.Errorf("title, date = %q, %q", doc.Title, doc.Date)
+	}
+	if !reflect.DeepEqual([]string(doc.Tags), []string{"go", "minio"}) {
+		t.Errorf("tags = %v; want go, minio", doc.Tags)
+	}
+	want := []Heading{
+		{Level: 1, Text: "Release notes", ID: "release-notes"},
+		{Level: 2, Text: "Install it", ID: "install-it"},
+	}
+	if !reflect.DeepEqual(doc.Headings, want) {
+		t.Errorf("headings = %+v; want %+v", doc.Headings, want)
+	}
+	if doc.LinkCount != 3 {
+		t.Errorf("links = %d; want 3", doc.LinkCount)
+	}
+	if doc.WordCount != 14 {
+		t.Errorf("words = %d; want 14", doc.WordCount)
+	}
+	if doc.ReadingTime() != 1 {
+		t.Errorf("reading time = %d; want 1", doc.ReadingTime())
+	}
+}
+
+func TestParse_TagsAsString(t *testing.T) {
+	doc, err := Parse([]byte("---\ntags: go, minio\n---\ntext\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual([]string(doc.Tags), []string{"go", "minio"}) {
+		t.Errorf("tags = %v; want go, minio", doc.Tags)
+	}
+}
+
+func TestParse_NoFrontMatter(t *testing.T) {
+	src := "---\nnot closed\n"
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Title != "" || doc.WordCount != 2 {
+		t.Errorf("expected the whole document as markdown, got %+v", doc)
+	}
+}
+
+func TestParse_InvalidFrontMatter(t *testing.T) {
+	if _, err := Parse([]byte("---\ntitle: [oops\n---\ntext\n")); err == nil {
+		t.Fatal("expected an error for invalid YAML")
+	}
+}
+
+func TestDocument_HTMLIsSanitized(t *testing.T) {
+	doc, err := Parse([]byte(article))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html, err := doc.HTML(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := string(html)
+
+	for _, want := range []string{`<h1 id="release-notes">Release notes</h1>`, "<strong>bold</strong>", `href="https://example.com"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML should contain %q:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{"<script", "javascript:", "title: Release notes"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("HTML should not contain %q:\n%s", unwanted, out)
+		}
+	}
+}
+
+func TestDocument_ReadingTimeRoundsUp(t *testing.T) {
+	doc, err := Parse([]byte(strings.Repeat("word ", WordsPerMinute+1)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.ReadingTime() != 2 {
+		t.Errorf("reading time = %d; want 2", doc.ReadingTime())
+	}
+}
+
+const withMedias = `![Diagram](media:0190-aaaa) and [the spec](media:0190-bbbb).
+
+![Again](media:0190-aaaa) ![Gone](media:0190-cccc)
+`
+
+func TestParse_MediaReferences(t *testing.T) {
+	doc, err := Parse([]byte(withMedias))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"0190-aaaa", "0190-bbbb", "0190-cccc"}
+	if !reflect.DeepEqual(doc.MediaReferences, want) {
+		t.Errorf("references = %v; want %v", doc.MediaReferences, want)
+	}
+}
+
+func TestDocument_HTMLResolvesMediaReferences(t *testing.T) {
+	doc, err := Parse([]byte(withMedias))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	links := map[string]MediaLink{
+		"0190-aaaa": {URL: "https://cdn.example.com/a.webp", SrcSet: "https://cdn.example.com/a_300.webp 300w, https://cdn.example.com/a.webp 1200w"},
+		"0190-bbbb": {URL: "https://cdn.example.com/b.pdf"},
+	}
+	html, err := doc.HTML(links)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := string(html)
+
+	for _, want := range []string{
+		`<img src="https://cdn.example.com/a.webp" alt="Diagram" srcset="https://cdn.example.com/a_300.webp 300w, https://cdn.example.com/a.webp 1200w">`,
+		`<a href="https://cdn.example.com/b.pdf" rel="nofollow">the spec</a>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("HTML should contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "media:") {
+		t.Errorf("unresolved references should be dropped:\n%s", out)
+	}
+
+	// the document is left as parsed
+	again, err := doc.HTML(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(again), "cdn.example.com") {
+		t.Errorf("links of a previous rendering leaked:\n%s", again)
+	}
+}
+
+func TestDocument_HTMLDropsUnsafeSrcSet(t *testing.T) {
+	doc, err := Parse([]byte("![x](media:0190-aaaa)"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html, err := doc.HTML(map[string]MediaLink{"0190-aaaa": {URL: "https://cdn.example.com/a.webp", SrcSet: "javascript:alert(1) 300w"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(html), "srcset") {
+		t.Errorf("srcset should be dropped:\n%s", html)
+	}
+}
@@ -0,0 +1,3 @@
+ALTER TABLE medias
+    DROP INDEX idx_medias_status_deleted_at,
+    DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE medias
+    ADD COLUMN deleted_at DATETIME(6) NULL,
+    ADD INDEX idx_medias_status_deleted_at (status, deleted_at);
@@ -0,0 +1,3 @@
+ALTER TABLE medias
+    DROP INDEX idx_medias_expires_at,
+    DROP COLUMN expires_at;
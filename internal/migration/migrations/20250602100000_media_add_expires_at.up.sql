@@ -0,0 +1,3 @@
+ALTER TABLE medias
+    ADD COLUMN expires_at DATETIME(6) NULL,
+    ADD INDEX idx_medias_expires_at (expires_at);
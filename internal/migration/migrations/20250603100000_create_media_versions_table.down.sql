@@ -0,0 +1,4 @@
+DROP TABLE media_versions;
+
+ALTER TABLE medias
+    DROP COLUMN version;
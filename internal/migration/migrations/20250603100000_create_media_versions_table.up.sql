@@ -0,0 +1,18 @@
+ALTER TABLE medias
+    ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE media_versions (
+    media_id     BINARY(16)      NOT NULL,
+    version      INT             NOT NULL,
+    object_key   VARCHAR(100)    NOT NULL,
+    mime_type    VARCHAR(50)     NULL,
+    size_bytes   INT             NULL,
+    optimised    BOOLEAN         NOT NULL DEFAULT FALSE,
+    metadata     JSON            NOT NULL DEFAULT '{}',
+    variants     JSON            NOT NULL DEFAULT '[]',
+    created_at   DATETIME(6)     NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (media_id, version),
+    CONSTRAINT fk_media_versions_media FOREIGN KEY (media_id) REFERENCES medias (id) ON DELETE CASCADE
+) ENGINE=InnoDB
+  DEFAULT CHARSET = utf8mb4
+  COLLATE = utf8mb4_unicode_ci;
@@ -0,0 +1,7 @@
+ALTER TABLE media_versions
+    DROP COLUMN original_size_bytes,
+    DROP COLUMN original_object_key;
+
+ALTER TABLE medias
+    DROP COLUMN original_size_bytes,
+    DROP COLUMN original_object_key;
@@ -0,0 +1,7 @@
+ALTER TABLE medias
+    ADD COLUMN original_object_key VARCHAR(120) NULL AFTER size_bytes,
+    ADD COLUMN original_size_bytes INT NULL AFTER original_object_key;
+
+ALTER TABLE media_versions
+    ADD COLUMN original_object_key VARCHAR(120) NULL AFTER size_bytes,
+    ADD COLUMN original_size_bytes INT NULL AFTER original_object_key;
@@ -0,0 +1,10 @@
+CREATE TABLE media_references (
+    media_id       BINARY(16)      NOT NULL,
+    referenced_id  BINARY(16)      NOT NULL,
+    created_at     DATETIME(6)     NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (media_id, referenced_id),
+    INDEX idx_media_references_referenced (referenced_id),
+    CONSTRAINT fk_media_references_media FOREIGN KEY (media_id) REFERENCES medias (id) ON DELETE CASCADE
+) ENGINE=InnoDB
+  DEFAULT CHARSET = utf8mb4
+  COLLATE = utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+ALTER TABLE medias
+    DROP INDEX idx_medias_owner_id,
+    DROP COLUMN owner_id;
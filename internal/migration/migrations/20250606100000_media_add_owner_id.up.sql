@@ -0,0 +1,3 @@
+ALTER TABLE medias
+    ADD COLUMN owner_id BINARY(16) NULL AFTER bucket,
+    ADD INDEX idx_medias_owner_id (owner_id);
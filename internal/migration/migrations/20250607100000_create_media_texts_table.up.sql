@@ -0,0 +1,10 @@
+CREATE TABLE media_texts (
+    media_id    BINARY(16)      NOT NULL,
+    content     MEDIUMTEXT      NOT NULL,
+    updated_at  DATETIME(6)     NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+    PRIMARY KEY (media_id),
+    FULLTEXT INDEX ft_media_texts_content (content),
+    CONSTRAINT fk_media_texts_media FOREIGN KEY (media_id) REFERENCES medias (id) ON DELETE CASCADE
+) ENGINE=InnoDB
+  DEFAULT CHARSET = utf8mb4
+  COLLATE = utf8mb4_unicode_ci;
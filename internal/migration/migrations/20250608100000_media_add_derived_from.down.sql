@@ -0,0 +1,2 @@
+ALTER TABLE medias
+    DROP COLUMN derived_from;
@@ -0,0 +1,2 @@
+ALTER TABLE medias
+    ADD COLUMN derived_from JSON NULL AFTER version;
@@ -15,11 +15,21 @@ type Cache struct {
 	// etag values
 	EtagMedia string
 
+	// watermarked PDFs
+	WatermarkedOut []byte
+
+	// captured inputs
+	ValidUntil          time.Time
+	WatermarkValidUntil time.Time
+	GotWatermarkUserID  uuid.UUID
+	GotWatermarkEtag    string
+
 	// errors
 	GetMediaErr     error
 	GetEtagMediaErr error
 	DelMediaErr     error
 	DelEtagMediaErr error
+	GetWatermarkErr error
 
 	// call flags
 	GetMediaCalled     bool
@@ -28,6 +38,7 @@ type Cache struct {
 	SetEtagMediaCalled bool
 	DelMediaCalled     bool
 	DelEtagMediaCalled bool
+	SetWatermarkCalled bool
 }
 
 func (c *Cache) GetMediaDetails(ctx context.Context, id uuid.UUID) ([]byte, error) {
@@ -49,6 +60,7 @@ func (c *Cache) GetEtagMediaDetails(ctx context.Context, id uuid.UUID) (string,
 func (c *Cache) SetMediaDetails(ctx context.Context, id uuid.UUID, data []byte, validUntil time.Time) {
 	c.SetMediaCalled = true
 	c.MediaOut = data
+	c.ValidUntil = validUntil
 }
 
 func (c *Cache) SetEtagMediaDetails(ctx context.Context, id uuid.UUID, etag string, validUntil time.Time) {
@@ -65,3 +77,20 @@ func (c *Cache) DeleteEtagMediaDetails(ctx context.Context, id uuid.UUID) error
 	c.DelEtagMediaCalled = true
 	return c.DelEtagMediaErr
 }
+
+func (c *Cache) GetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string) ([]byte, error) {
+	c.GotWatermarkUserID = userID
+	c.GotWatermarkEtag = etag
+	if c.GetWatermarkErr != nil {
+		return nil, c.GetWatermarkErr
+	}
+	return c.WatermarkedOut, nil
+}
+
+func (c *Cache) SetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string, data []byte, validUntil time.Time) {
+	c.SetWatermarkCalled = true
+	c.GotWatermarkUserID = userID
+	c.GotWatermarkEtag = etag
+	c.WatermarkedOut = data
+	c.WatermarkValidUntil = validUntil
+}
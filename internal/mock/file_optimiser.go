@@ -3,6 +3,9 @@ package mock
 import (
 	"bytes"
 	"io"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
 )
 
 // FileOptimiser implements file optimisation operations for tests.
@@ -10,29 +13,90 @@ type FileOptimiser struct {
 	// stored values
 	CompressOut []byte
 	MimeOut     string
+	StrategyOut string
+	QualityOut  int
+	ScoreOut    float64
 	ResizeOut   []byte
+	FallbackOut []byte
+	// FallbackMimeOut defaults to image/jpeg
+	FallbackMimeOut string
+	// EncodeOut is returned for every encoding
+	EncodeOut []byte
+	// PageOut is returned for every page
+	PageOut []byte
 
 	// errors
 	CompressErr error
 	ResizeErr   error
+	FallbackErr error
+	EncodeErr   error
+	PageErr     error
+
+	// received values
+	GotCompressOpts port.CompressOptions
+	GotResizeOpts   []port.ResizeOptions
+	GotPages        []int
 
 	// call flags
 	CompressCalled bool
 	ResizeCalled   bool
+	FallbackCalled bool
+	Encodings      []string
 }
 
-func (m *FileOptimiser) Compress(mimeType string, r io.Reader) (io.ReadCloser, string, error) {
+func (m *FileOptimiser) Compress(mimeType string, r io.Reader, opts port.CompressOptions) (*port.CompressResult, error) {
 	m.CompressCalled = true
+	m.GotCompressOpts = opts
 	if m.CompressErr != nil {
-		return nil, "", m.CompressErr
+		return nil, m.CompressErr
+	}
+	return &port.CompressResult{
+		Reader:   io.NopCloser(bytes.NewReader(m.CompressOut)),
+		MimeType: m.MimeOut,
+		Strategy: m.StrategyOut,
+		Quality:  m.QualityOut,
+		Score:    m.ScoreOut,
+	}, nil
+}
+
+func (m *FileOptimiser) ConvertPage(mimeType string, r io.Reader, page int) (*port.CompressResult, error) {
+	m.GotPages = append(m.GotPages, page)
+	if m.PageErr != nil {
+		return nil, m.PageErr
 	}
-	return io.NopCloser(bytes.NewReader(m.CompressOut)), m.MimeOut, nil
+	return &port.CompressResult{
+		Reader:   io.NopCloser(bytes.NewReader(m.PageOut)),
+		MimeType: "image/webp",
+		Strategy: model.OptimisationLossyWebP,
+	}, nil
 }
 
-func (m *FileOptimiser) Resize(mimeType string, r io.Reader, width, height int) (io.ReadCloser, error) {
+func (m *FileOptimiser) Resize(mimeType string, r io.Reader, width, height int, opts port.ResizeOptions) (io.ReadCloser, error) {
 	m.ResizeCalled = true
+	m.GotResizeOpts = append(m.GotResizeOpts, opts)
 	if m.ResizeErr != nil {
 		return nil, m.ResizeErr
 	}
 	return io.NopCloser(bytes.NewReader(m.ResizeOut)), nil
 }
+
+func (m *FileOptimiser) ResizeFallback(mimeType string, r io.Reader, width, height int, opts port.ResizeOptions) (io.ReadCloser, string, error) {
+	m.FallbackCalled = true
+	m.GotResizeOpts = append(m.GotResizeOpts, opts)
+	if m.FallbackErr != nil {
+		return nil, "", m.FallbackErr
+	}
+	mimeOut := m.FallbackMimeOut
+	if mimeOut == "" {
+		mimeOut = "image/jpeg"
+	}
+	return io.NopCloser(bytes.NewReader(m.FallbackOut)), mimeOut, nil
+}
+
+func (m *FileOptimiser) Encode(encoding string, r io.Reader) (io.ReadCloser, error) {
+	m.Encodings = append(m.Encodings, encoding)
+	if m.EncodeErr != nil {
+		return nil, m.EncodeErr
+	}
+	return io.NopCloser(bytes.NewReader(m.EncodeOut)), nil
+}
@@ -2,6 +2,7 @@ package mock
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/model"
@@ -11,9 +12,17 @@ import (
 // MediaRepo implements repository operations for tests.
 type MediaRepo struct {
 	// stored values
-	MediaOut        *model.Media
+	MediaOut *model.Media
+	// MediasByID is looked up by GetByID before falling back to MediaOut
+	MediasByID      map[uuid.UUID]*model.Media
+	ReferencingOut  []uuid.UUID
+	SearchOut       []model.TextMatch
 	ListOut         []uuid.UUID
 	ListVariantsOut []uuid.UUID
+	ListDeletedOut  []uuid.UUID
+	ListExpiredOut  []uuid.UUID
+	// ListImagesPages is returned one page per call to ListCompletedImagesAfter
+	ListImagesPages [][]uuid.UUID
 
 	// captured inputs
 	GotCreated                             *model.Media
@@ -21,6 +30,16 @@ type MediaRepo struct {
 	GotDeletedID                           uuid.UUID
 	GotListUnoptimisedCompletedBefore      time.Time
 	GotListOptimisedImagesNoVariantsBefore time.Time
+	GotListDeletedBuckets                  []string
+	GotListDeletedBefore                   time.Time
+	GotListExpiredBefore                   time.Time
+	GotListImagesAfter                     []uuid.UUID
+	GotListImagesLimit                     int
+	GotReferencesOf                        uuid.UUID
+	GotReferences                          []uuid.UUID
+	GotTextOf                              uuid.UUID
+	GotText                                string
+	GotSearch                              model.TextSearch
 
 	// errors
 	GetByIDErr                             error
@@ -29,6 +48,13 @@ type MediaRepo struct {
 	DeleteErr                              error
 	ListUnoptimisedCompletedBeforeErr      error
 	ListOptimisedImagesNoVariantsBeforeErr error
+	ListDeletedBeforeErr                   error
+	ListExpiredBeforeErr                   error
+	ListCompletedImagesAfterErr            error
+	ReplaceReferencesErr                   error
+	ListReferencingErr                     error
+	SaveTextErr                            error
+	SearchTextsErr                         error
 
 	// call flags
 	GetByIDCalled                             bool
@@ -37,6 +63,13 @@ type MediaRepo struct {
 	DeleteCalled                              bool
 	ListUnoptimisedCompletedBeforeCalled      bool
 	ListOptimisedImagesNoVariantsBeforeCalled bool
+	ListDeletedBeforeCalled                   bool
+	ListExpiredBeforeCalled                   bool
+	ListCompletedImagesAfterCalled            bool
+	ReplaceReferencesCalled                   bool
+	ListReferencingCalled                     bool
+	SaveTextCalled                            bool
+	SearchTextsCalled                         bool
 }
 
 func (m *MediaRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Media, error) {
@@ -44,6 +77,13 @@ func (m *MediaRepo) GetByID(ctx context.Context, id uuid.UUID) (*model.Media, er
 	if m.GetByIDErr != nil {
 		return nil, m.GetByIDErr
 	}
+	if m.MediasByID != nil {
+		media, ok := m.MediasByID[id]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		return media, nil
+	}
 	return m.MediaOut, nil
 }
 
@@ -82,3 +122,68 @@ func (m *MediaRepo) ListOptimisedImagesNoVariantsBefore(ctx context.Context, bef
 	}
 	return m.ListVariantsOut, nil
 }
+
+func (m *MediaRepo) ListDeletedBefore(ctx context.Context, bucket string, before time.Time) ([]uuid.UUID, error) {
+	m.ListDeletedBeforeCalled = true
+	m.GotListDeletedBuckets = append(m.GotListDeletedBuckets, bucket)
+	m.GotListDeletedBefore = before
+	if m.ListDeletedBeforeErr != nil {
+		return nil, m.ListDeletedBeforeErr
+	}
+	return m.ListDeletedOut, nil
+}
+
+func (m *MediaRepo) ListExpiredBefore(ctx context.Context, before time.Time) ([]uuid.UUID, error) {
+	m.ListExpiredBeforeCalled = true
+	m.GotListExpiredBefore = before
+	if m.ListExpiredBeforeErr != nil {
+		return nil, m.ListExpiredBeforeErr
+	}
+	return m.ListExpiredOut, nil
+}
+
+func (m *MediaRepo) ListCompletedImagesAfter(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	m.ListCompletedImagesAfterCalled = true
+	m.GotListImagesAfter = append(m.GotListImagesAfter, after)
+	m.GotListImagesLimit = limit
+	if m.ListCompletedImagesAfterErr != nil {
+		return nil, m.ListCompletedImagesAfterErr
+	}
+	if len(m.ListImagesPages) == 0 {
+		return nil, nil
+	}
+	page := m.ListImagesPages[0]
+	m.ListImagesPages = m.ListImagesPages[1:]
+	return page, nil
+}
+
+func (m *MediaRepo) ReplaceReferences(ctx context.Context, id uuid.UUID, referencedIDs []uuid.UUID) error {
+	m.ReplaceReferencesCalled = true
+	m.GotReferencesOf = id
+	m.GotReferences = referencedIDs
+	return m.ReplaceReferencesErr
+}
+
+func (m *MediaRepo) ListReferencing(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error) {
+	m.ListReferencingCalled = true
+	if m.ListReferencingErr != nil {
+		return nil, m.ListReferencingErr
+	}
+	return m.ReferencingOut, nil
+}
+
+func (m *MediaRepo) SaveText(ctx context.Context, id uuid.UUID, content string) error {
+	m.SaveTextCalled = true
+	m.GotTextOf = id
+	m.GotText = content
+	return m.SaveTextErr
+}
+
+func (m *MediaRepo) SearchTexts(ctx context.Context, search model.TextSearch) ([]model.TextMatch, error) {
+	m.SearchTextsCalled = true
+	m.GotSearch = search
+	if m.SearchTextsErr != nil {
+		return nil, m.SearchTextsErr
+	}
+	return m.SearchOut, nil
+}
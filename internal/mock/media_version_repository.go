@@ -0,0 +1,61 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// MediaVersionRepo implements version repository operations for tests.
+type MediaVersionRepo struct {
+	// stored values
+	VersionOut *model.MediaVersion
+	ListOut    []model.MediaVersion
+
+	// captured inputs
+	GotCreated        []model.MediaVersion
+	GotGetVersion     int
+	GotDeletedVersion []int
+
+	// errors
+	CreateErr error
+	GetErr    error
+	ListErr   error
+	DeleteErr error
+
+	// call flags
+	CreateCalled bool
+	GetCalled    bool
+	ListCalled   bool
+	DeleteCalled bool
+}
+
+func (m *MediaVersionRepo) Create(ctx context.Context, version *model.MediaVersion) error {
+	m.CreateCalled = true
+	m.GotCreated = append(m.GotCreated, *version)
+	return m.CreateErr
+}
+
+func (m *MediaVersionRepo) Get(ctx context.Context, mediaID uuid.UUID, version int) (*model.MediaVersion, error) {
+	m.GetCalled = true
+	m.GotGetVersion = version
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	return m.VersionOut, nil
+}
+
+func (m *MediaVersionRepo) ListByMediaID(ctx context.Context, mediaID uuid.UUID) ([]model.MediaVersion, error) {
+	m.ListCalled = true
+	if m.ListErr != nil {
+		return nil, m.ListErr
+	}
+	return m.ListOut, nil
+}
+
+func (m *MediaVersionRepo) Delete(ctx context.Context, mediaID uuid.UUID, version int) error {
+	m.DeleteCalled = true
+	m.GotDeletedVersion = append(m.GotDeletedVersion, version)
+	return m.DeleteErr
+}
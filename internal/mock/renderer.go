@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/fhuszti/medias-ms-go/internal/port"
-	"github.com/fhuszti/medias-ms-go/internal/uuid"
 )
 
 // HTTPRenderer implements port.HTTPRenderer for tests.
@@ -16,7 +15,7 @@ type HTTPRenderer struct {
 	EtagMedia string
 
 	// captured inputs
-	GotMediaID uuid.UUID
+	GotIn port.GetMediaInput
 
 	// errors
 	GetMediaErr error
@@ -25,8 +24,8 @@ type HTTPRenderer struct {
 	GetMediaCalled bool
 }
 
-func (m *HTTPRenderer) RenderGetMedia(ctx context.Context, getter port.MediaGetter, id uuid.UUID) ([]byte, string, error) {
+func (m *HTTPRenderer) RenderGetMedia(ctx context.Context, getter port.MediaGetter, in port.GetMediaInput) ([]byte, string, error) {
 	m.GetMediaCalled = true
-	m.GotMediaID = id
+	m.GotIn = in
 	return m.MediaOut, m.EtagMedia, m.GetMediaErr
 }
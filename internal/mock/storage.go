@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"net/url"
 	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/port"
@@ -13,12 +14,24 @@ import (
 type Storage struct {
 	// stored values
 	StatInfoOut port.FileInfo
+	TagsOut     map[string]string
 	GetOut      io.ReadSeeker
+	FilesByKey  map[string][]byte
 	ExistsOut   bool
 
 	// captured inputs
-	ObjectKey string
-	TTL       time.Duration
+	ObjectKey     string
+	TTL           time.Duration
+	ReqParams     url.Values
+	RemovedKeys   []string
+	CopiedKeys    []string
+	SavedKeys     []string
+	SaveOpts      map[string]string
+	SavedContent  []byte
+	Ranges        [][2]int64
+	PublicBuckets []string
+	// TaggedFiles holds the tags last set on each file, by key
+	TaggedFiles map[string]map[string]string
 
 	// errors
 	InitBucketErr           error
@@ -30,12 +43,15 @@ type Storage struct {
 	SaveErr                 error
 	CopyErr                 error
 	FileExistsErr           error
+	GetTagsErr              error
+	SetTagsErr              error
 
 	// call flags
 	InitBucketCalled           bool
 	GenerateDownloadLinkCalled bool
 	GenerateUploadLinkCalled   bool
 	StatCalled                 bool
+	GetRangeCalled             bool
 	RemoveCalled               bool
 	GetCalled                  bool
 	SaveCalled                 bool
@@ -43,15 +59,19 @@ type Storage struct {
 	FileExistsCalled           bool
 }
 
-func (m *Storage) InitBucket(bucket string) error {
+func (m *Storage) InitBucket(bucket string, public bool) error {
 	m.InitBucketCalled = true
+	if public {
+		m.PublicBuckets = append(m.PublicBuckets, bucket)
+	}
 	return m.InitBucketErr
 }
 
-func (m *Storage) GeneratePresignedDownloadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration) (string, error) {
+func (m *Storage) GeneratePresignedDownloadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration, reqParams url.Values) (string, error) {
 	m.GenerateDownloadLinkCalled = true
 	m.ObjectKey = fileKey
 	m.TTL = expiry
+	m.ReqParams = reqParams
 	if m.GenerateDownloadLinkErr != nil {
 		return "", m.GenerateDownloadLinkErr
 	}
@@ -78,6 +98,7 @@ func (m *Storage) StatFile(ctx context.Context, bucket, fileKey string) (port.Fi
 
 func (m *Storage) RemoveFile(ctx context.Context, bucket, fileKey string) error {
 	m.RemoveCalled = true
+	m.RemovedKeys = append(m.RemovedKeys, fileKey)
 	return m.RemoveErr
 }
 
@@ -86,22 +107,73 @@ func (m *Storage) GetFile(ctx context.Context, bucket, fileKey string) (io.ReadS
 	if m.GetErr != nil {
 		return nil, m.GetErr
 	}
+	if content, ok := m.FilesByKey[fileKey]; ok {
+		return noopRSC{bytes.NewReader(content)}, nil
+	}
 	if m.GetOut != nil {
 		return noopRSC{m.GetOut}, nil
 	}
 	return noopRSC{bytes.NewReader([]byte("dummy"))}, nil
 }
 
+func (m *Storage) GetFileRange(ctx context.Context, bucket, fileKey string, offset, length int64) (io.ReadCloser, error) {
+	m.GetRangeCalled = true
+	m.ObjectKey = fileKey
+	m.Ranges = append(m.Ranges, [2]int64{offset, length})
+	if m.GetErr != nil {
+		return nil, m.GetErr
+	}
+	content := []byte("dummy")
+	if m.GetOut != nil {
+		var err error
+		if _, err = m.GetOut.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if content, err = io.ReadAll(m.GetOut); err != nil {
+			return nil, err
+		}
+	}
+	end := min(offset+length, int64(len(content)))
+	return io.NopCloser(bytes.NewReader(content[min(offset, end):end])), nil
+}
+
 func (m *Storage) SaveFile(ctx context.Context, bucket, fileKey string, reader io.Reader, fileSize int64, opts map[string]string) error {
 	m.SaveCalled = true
-	return m.SaveErr
+	m.SavedKeys = append(m.SavedKeys, fileKey)
+	m.SaveOpts = opts
+	if m.SaveErr != nil {
+		return m.SaveErr
+	}
+	// consume the content like a real storage would
+	content, err := io.ReadAll(reader)
+	m.SavedContent = content
+	return err
 }
 
 func (m *Storage) CopyFile(ctx context.Context, bucket, srcKey, destKey string) error {
 	m.CopyCalled = true
+	m.CopiedKeys = append(m.CopiedKeys, destKey)
 	return m.CopyErr
 }
 
+func (m *Storage) GetFileTags(ctx context.Context, bucket, fileKey string) (map[string]string, error) {
+	if m.GetTagsErr != nil {
+		return nil, m.GetTagsErr
+	}
+	return m.TagsOut, nil
+}
+
+func (m *Storage) SetFileTags(ctx context.Context, bucket, fileKey string, tags map[string]string) error {
+	if m.SetTagsErr != nil {
+		return m.SetTagsErr
+	}
+	if m.TaggedFiles == nil {
+		m.TaggedFiles = make(map[string]map[string]string)
+	}
+	m.TaggedFiles[fileKey] = tags
+	return nil
+}
+
 func (m *Storage) FileExists(ctx context.Context, bucket, fileKey string) (bool, error) {
 	m.FileExistsCalled = true
 	if m.FileExistsErr != nil {
@@ -9,16 +9,22 @@ import (
 // Dispatcher implements task dispatching for tests.
 type Dispatcher struct {
 	// captured inputs
-	OptimiseIDs []uuid.UUID
-	ResizeIDs   []uuid.UUID
+	OptimiseIDs  []uuid.UUID
+	ResizeIDs    []uuid.UUID
+	ReconcileIDs []uuid.UUID
+	DeriveIDs    []uuid.UUID
 
 	// errors
-	OptimiseErr error
-	ResizeErr   error
+	OptimiseErr  error
+	ResizeErr    error
+	ReconcileErr error
+	DeriveErr    error
 
 	// call flags
-	OptimiseCalled bool
-	ResizeCalled   bool
+	OptimiseCalled  bool
+	ResizeCalled    bool
+	ReconcileCalled bool
+	DeriveCalled    bool
 }
 
 func (m *Dispatcher) EnqueueOptimiseMedia(ctx context.Context, id uuid.UUID) error {
@@ -32,3 +38,15 @@ func (m *Dispatcher) EnqueueResizeImage(ctx context.Context, id uuid.UUID) error
 	m.ResizeIDs = append(m.ResizeIDs, id)
 	return m.ResizeErr
 }
+
+func (m *Dispatcher) EnqueueReconcileImage(ctx context.Context, id uuid.UUID) error {
+	m.ReconcileCalled = true
+	m.ReconcileIDs = append(m.ReconcileIDs, id)
+	return m.ReconcileErr
+}
+
+func (m *Dispatcher) EnqueueDerivePDF(ctx context.Context, id uuid.UUID) error {
+	m.DeriveCalled = true
+	m.DeriveIDs = append(m.DeriveIDs, id)
+	return m.DeriveErr
+}
@@ -9,27 +9,90 @@ import (
 
 type MediaGetter struct {
 	Out    *port.GetMediaOutput
-	Id     uuid.UUID
+	In     port.GetMediaInput
 	Err    error
 	Called bool
 }
 
-func (m *MediaGetter) GetMedia(ctx context.Context, id uuid.UUID) (*port.GetMediaOutput, error) {
-	m.Id = id
+func (m *MediaGetter) GetMedia(ctx context.Context, in port.GetMediaInput) (*port.GetMediaOutput, error) {
+	m.In = in
+	m.Called = true
+	return m.Out, m.Err
+}
+
+type MediaDownloader struct {
+	Out    *port.DownloadMediaOutput
+	In     port.DownloadMediaInput
+	Err    error
+	Called bool
+}
+
+func (m *MediaDownloader) DownloadMedia(ctx context.Context, in port.DownloadMediaInput) (*port.DownloadMediaOutput, error) {
+	m.In = in
+	m.Called = true
+	return m.Out, m.Err
+}
+
+type MediaContentGetter struct {
+	Out    *port.GetMediaContentOutput
+	In     port.GetMediaContentInput
+	Err    error
+	Called bool
+}
+
+func (m *MediaContentGetter) GetMediaContent(ctx context.Context, in port.GetMediaContentInput) (*port.GetMediaContentOutput, error) {
+	m.In = in
 	m.Called = true
 	return m.Out, m.Err
 }
 
 type MediaDeleter struct {
+	ID        uuid.UUID
+	Err       error
+	PurgedIDs []uuid.UUID
+	PurgeErr  error
+}
+
+func (m *MediaDeleter) DeleteMedia(ctx context.Context, id uuid.UUID) error {
+	m.ID = id
+	return m.Err
+}
+
+func (m *MediaDeleter) PurgeMedia(ctx context.Context, id uuid.UUID) error {
+	m.PurgedIDs = append(m.PurgedIDs, id)
+	return m.PurgeErr
+}
+
+type MediaRestorer struct {
 	ID  uuid.UUID
 	Err error
 }
 
-func (m *MediaDeleter) DeleteMedia(ctx context.Context, id uuid.UUID) error {
+func (m *MediaRestorer) RestoreMedia(ctx context.Context, id uuid.UUID) error {
 	m.ID = id
 	return m.Err
 }
 
+type TrashPurger struct {
+	Called bool
+	Err    error
+}
+
+func (m *TrashPurger) PurgeTrash(ctx context.Context) error {
+	m.Called = true
+	return m.Err
+}
+
+type ExpiredPurger struct {
+	Called bool
+	Err    error
+}
+
+func (m *ExpiredPurger) PurgeExpired(ctx context.Context) error {
+	m.Called = true
+	return m.Err
+}
+
 type UploadLinkGenerator struct {
 	Out port.GenerateUploadLinkOutput
 	Err error
@@ -51,6 +114,48 @@ func (m *UploadFinaliser) FinaliseUpload(ctx context.Context, in port.FinaliseUp
 	return m.Err
 }
 
+type VersionUploadLinkGenerator struct {
+	Out port.GenerateUploadLinkOutput
+	Err error
+	ID  uuid.UUID
+}
+
+func (m *VersionUploadLinkGenerator) GenerateVersionUploadLink(ctx context.Context, id uuid.UUID) (port.GenerateUploadLinkOutput, error) {
+	m.ID = id
+	return m.Out, m.Err
+}
+
+type VersionFinaliser struct {
+	ID  uuid.UUID
+	Err error
+}
+
+func (m *VersionFinaliser) FinaliseVersion(ctx context.Context, id uuid.UUID) error {
+	m.ID = id
+	return m.Err
+}
+
+type VersionLister struct {
+	Out port.ListVersionsOutput
+	Err error
+	ID  uuid.UUID
+}
+
+func (m *VersionLister) ListVersions(ctx context.Context, id uuid.UUID) (port.ListVersionsOutput, error) {
+	m.ID = id
+	return m.Out, m.Err
+}
+
+type VersionRollbacker struct {
+	In  port.RollbackVersionInput
+	Err error
+}
+
+func (m *VersionRollbacker) RollbackVersion(ctx context.Context, in port.RollbackVersionInput) error {
+	m.In = in
+	return m.Err
+}
+
 type MediaOptimiser struct {
 	ID     uuid.UUID
 	Called bool
@@ -74,3 +179,48 @@ func (m *ImageResizer) ResizeImage(ctx context.Context, in port.ResizeImageInput
 	m.In = in
 	return m.Err
 }
+
+type MediaSearcher struct {
+	Out port.SearchMediasOutput
+	Err error
+	In  port.SearchMediasInput
+}
+
+func (m *MediaSearcher) SearchMedias(ctx context.Context, in port.SearchMediasInput) (port.SearchMediasOutput, error) {
+	m.In = in
+	return m.Out, m.Err
+}
+
+type PDFPagesExtractor struct {
+	Out port.DerivedMediaOutput
+	Err error
+	In  port.ExtractPagesInput
+}
+
+func (m *PDFPagesExtractor) ExtractPages(ctx context.Context, in port.ExtractPagesInput) (port.DerivedMediaOutput, error) {
+	m.In = in
+	return m.Out, m.Err
+}
+
+type PDFMerger struct {
+	Out port.DerivedMediaOutput
+	Err error
+	In  port.MergePDFsInput
+}
+
+func (m *PDFMerger) MergePDFs(ctx context.Context, in port.MergePDFsInput) (port.DerivedMediaOutput, error) {
+	m.In = in
+	return m.Out, m.Err
+}
+
+type PDFDeriver struct {
+	ID     uuid.UUID
+	Called bool
+	Err    error
+}
+
+func (m *PDFDeriver) DerivePDF(ctx context.Context, id uuid.UUID) error {
+	m.Called = true
+	m.ID = id
+	return m.Err
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// Bucket visibilities: private buckets are only reached through presigned URLs, while
+// public ones are readable anonymously at stable URLs.
+const (
+	BucketVisibilityPrivate = "private"
+	BucketVisibilityPublic  = "public"
+)
+
+// BucketSettings holds the options that can be tuned for each bucket.
+type BucketSettings struct {
+	// TrashRetention is how long a deleted media stays in the trash before being purged.
+	TrashRetention time.Duration
+	// KeepOriginals keeps the uploaded file under the originals/ prefix when it gets optimised.
+	KeepOriginals bool
+	// FallbackVariants generates a JPEG (or PNG for images with alpha) variant next to each WebP one.
+	FallbackVariants bool
+	// SVGRasterVariants is the format of the variants drawn from the SVGs of the bucket at every
+	// size, "image/png" or "image/webp". SVGs get no variants when it is empty.
+	SVGRasterVariants string
+	// ContentAddressedKeys stores optimised files and variants under a hash of their content,
+	// so that their URLs can be cached forever.
+	ContentAddressedKeys bool
+	// PDFProfile is what the optimisation scrubs from the PDFs of the bucket.
+	PDFProfile PDFProfile
+	// RejectUnsafePDFs refuses the PDFs containing JavaScript or executable attachments.
+	RejectUnsafePDFs bool
+	// WatermarkPDFs stamps every download of a PDF with the requesting user and the time, so
+	// the files are only ever served through the API.
+	WatermarkPDFs bool
+	// Overlay is drawn over the variants of the images of the bucket, except the ones shown to
+	// the owner of an image. It is nil for buckets without an overlay.
+	Overlay *ImageOverlay
+	// Visibility is BucketVisibilityPrivate or BucketVisibilityPublic.
+	Visibility string
+	// PublicBaseURL prefixes the object keys of a public bucket to build their stable URLs,
+	// e.g. the host of a CDN in front of the bucket.
+	PublicBaseURL string
+	// CacheControl is the Cache-Control header of the files saved in the bucket, unless they are immutable.
+	CacheControl string
+	// ObjectMetadata is the user metadata added to every file saved in the bucket.
+	ObjectMetadata map[string]string
+	// ObjectTags are the tags added to every file saved in the bucket, e.g. for lifecycle rules.
+	ObjectTags map[string]string
+}
+
+// PDFProfile lists the privacy scrubbing steps applied to PDFs when optimising them.
+type PDFProfile struct {
+	// StripMetadata removes the document information (author, producer...) and XMP metadata.
+	StripMetadata bool
+	// RemoveAnnotations removes the comments, highlights and other markup annotations, but not
+	// the links nor the form fields.
+	RemoveAnnotations bool
+	// RemoveForms removes the form fields, along with their values.
+	RemoveForms bool
+	// Flatten draws the remaining annotations and form fields into the pages, so they can no
+	// longer be edited.
+	Flatten bool
+}
+
+// IsZero reports whether the profile leaves PDFs untouched, besides their optimisation.
+func (p PDFProfile) IsZero() bool {
+	return p == PDFProfile{}
+}
+
+// Overlay gravities: the side or corner of the image the overlay is placed against.
+const (
+	GravityCenter    = "center"
+	GravityNorth     = "north"
+	GravitySouth     = "south"
+	GravityEast      = "east"
+	GravityWest      = "west"
+	GravityNorthEast = "northeast"
+	GravityNorthWest = "northwest"
+	GravitySouthEast = "southeast"
+	GravitySouthWest = "southwest"
+)
+
+// ImageOverlay is an image, such as a logo, drawn over the variants of the images of a bucket.
+type ImageOverlay struct {
+	// MediaID is the image media drawn as the overlay.
+	MediaID uuid.UUID
+	// Gravity is one of the Gravity* values.
+	Gravity string
+	// Opacity goes from 0, invisible, to 1, opaque.
+	Opacity float64
+	// Scale is the width of the overlay relative to the width of the variant, from 0 to 1.
+	Scale float64
+}
+
+// IsPublic reports whether the files of the bucket can be read anonymously.
+func (s BucketSettings) IsPublic() bool {
+	return s.Visibility == BucketVisibilityPublic
+}
+
+// BucketsSettings maps a bucket name to its settings.
+type BucketsSettings map[string]BucketSettings
+
+// Get returns the settings of the given bucket, or the zero value if the bucket is unknown.
+func (b BucketsSettings) Get(bucket string) BucketSettings {
+	return b[bucket]
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/uuid"
@@ -12,20 +15,89 @@ const (
 	MediaStatusPending   MediaStatus = "pending"
 	MediaStatusCompleted MediaStatus = "completed"
 	MediaStatusFailed    MediaStatus = "failed"
+	MediaStatusDeleted   MediaStatus = "deleted"
 )
 
 type Media struct {
-	ID               uuid.UUID   `json:"id"`
-	ObjectKey        string      `json:"object_key"`
-	Bucket           string      `json:"bucket"`
-	OriginalFilename string      `json:"original_filename"`
-	MimeType         *string     `json:"mime_type,omitempty"`
-	SizeBytes        *int64      `json:"size_bytes,omitempty"`
-	Status           MediaStatus `json:"status"`
-	Optimised        bool        `json:"optimised"`
-	FailureMessage   *string     `json:"failure_message,omitempty"`
-	Metadata         Metadata    `json:"metadata"`
-	Variants         Variants    `json:"variants"`
-	CreatedAt        time.Time   `json:"created_at"`
-	UpdatedAt        time.Time   `json:"updated_at"`
+	ID                uuid.UUID   `json:"id"`
+	ObjectKey         string      `json:"object_key"`
+	Bucket            string      `json:"bucket"`
+	OwnerID           *uuid.UUID  `json:"owner_id,omitempty"`
+	OriginalFilename  string      `json:"original_filename"`
+	MimeType          *string     `json:"mime_type,omitempty"`
+	SizeBytes         *int64      `json:"size_bytes,omitempty"`
+	OriginalObjectKey *string     `json:"original_object_key,omitempty"`
+	OriginalSizeBytes *int64      `json:"original_size_bytes,omitempty"`
+	Status            MediaStatus `json:"status"`
+	Optimised         bool        `json:"optimised"`
+	FailureMessage    *string     `json:"failure_message,omitempty"`
+	Metadata          Metadata    `json:"metadata"`
+	Variants          Variants    `json:"variants"`
+	Version           int         `json:"version"`
+	DerivedFrom       *Derivation `json:"derived_from,omitempty"`
+	ExpiresAt         *time.Time  `json:"expires_at,omitempty"`
+	DeletedAt         *time.Time  `json:"deleted_at,omitempty"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+// Operations deriving a PDF from other medias.
+const (
+	DerivationPages = "pages"
+	DerivationMerge = "merge"
+)
+
+// Derivation records how a media was made out of other medias.
+type Derivation struct {
+	// Operation is DerivationPages or DerivationMerge.
+	Operation string `json:"operation"`
+	// Sources are the medias the file is made of, in order.
+	Sources []uuid.UUID `json:"sources"`
+	// Pages is the page range extracted from the source, e.g. "1-3,7".
+	Pages string `json:"pages,omitempty"`
+}
+
+func (d Derivation) Value() (driver.Value, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("marshal Derivation: %w", err)
+	}
+	return b, nil
+}
+func (d *Derivation) Scan(src interface{}) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("Derivation.Scan: expected []byte, got %T", src)
+	}
+	if err := json.Unmarshal(data, d); err != nil {
+		return fmt.Errorf("unmarshal Derivation: %w", err)
+	}
+	return nil
+}
+
+// TextSearch filters the medias whose text matches a full-text query.
+type TextSearch struct {
+	Query string
+	// Bucket and OwnerID are ignored when empty.
+	Bucket  string
+	OwnerID *uuid.UUID
+	Limit   int
+	// Terms are the words of the query the excerpt of each text is cut around, with ExcerptRadius
+	// characters on each side of the first one found.
+	Terms         []string
+	ExcerptRadius int
+}
+
+// TextMatch is a media whose text matches a full-text search, best matches first.
+type TextMatch struct {
+	MediaID          uuid.UUID
+	Bucket           string
+	OriginalFilename string
+	MimeType         *string
+	// Excerpt is the part of the text around the first of the search terms found, or its start.
+	// TextBefore and TextAfter tell whether the text goes on past it.
+	Excerpt    string
+	TextBefore bool
+	TextAfter  bool
+	Score      float64
 }
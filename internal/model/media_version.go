@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// MediaVersion is a previous file of a media, kept when a new version replaces it.
+type MediaVersion struct {
+	MediaID           uuid.UUID `json:"media_id"`
+	Version           int       `json:"version"`
+	ObjectKey         string    `json:"object_key"`
+	MimeType          *string   `json:"mime_type,omitempty"`
+	SizeBytes         *int64    `json:"size_bytes,omitempty"`
+	OriginalObjectKey *string   `json:"original_object_key,omitempty"`
+	OriginalSizeBytes *int64    `json:"original_size_bytes,omitempty"`
+	Optimised         bool      `json:"optimised"`
+	Metadata          Metadata  `json:"metadata"`
+	Variants          Variants  `json:"variants"`
+	CreatedAt         time.Time `json:"created_at"`
+}
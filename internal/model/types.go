@@ -4,6 +4,11 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/uuid"
 )
 
 type Metadata struct {
@@ -14,16 +19,78 @@ type Metadata struct {
 	// image-specific
 	Width  int `json:"width,omitempty"`
 	Height int `json:"height,omitempty"`
+	// animated GIFs and WebPs only
+	FrameCount int   `json:"frame_count,omitempty"`
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// number of times the animation plays, left out when it loops forever
+	LoopCount int `json:"loop_count,omitempty"`
+	// horizontal resolution of TIFFs and BMPs, when they record it
+	DPI int `json:"dpi,omitempty"`
+	// min-x, min-y, width and height of the viewBox of SVGs, or of their size when they have
+	// none, which Width and Height round
+	ViewBox []float64 `json:"view_box,omitempty"`
 
-	// pdf-specific
-	PageCount int `json:"page_count,omitempty"`
+	// pdf-specific, PageCount is also set for TIFFs
+	PageCount  int    `json:"page_count,omitempty"`
+	PDFVersion string `json:"pdf_version,omitempty"`
+	// from the document information, along with Title
+	Author     string     `json:"author,omitempty"`
+	Subject    string     `json:"subject,omitempty"`
+	Keywords   []string   `json:"keywords,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	// one entry per page, in points
+	PageSizes []PageSize `json:"page_sizes,omitempty"`
+	Encrypted bool       `json:"encrypted,omitempty"`
+	HasForms  bool       `json:"has_forms,omitempty"`
+	// names of the files attached to the document
+	EmbeddedFiles []string `json:"embedded_files,omitempty"`
+	HasJavaScript bool     `json:"has_javascript,omitempty"`
 
 	// markdown-specific
 	WordCount    int64 `json:"word_count,omitempty"`
 	HeadingCount int64 `json:"heading_count,omitempty"`
 	LinkCount    int64 `json:"link_count,omitempty"`
+	// from the front matter
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Date  string   `json:"date,omitempty"`
+	// estimated at 200 words per minute
+	ReadingTimeMinutes int        `json:"reading_time_minutes,omitempty"`
+	TableOfContents    []TOCEntry `json:"table_of_contents,omitempty"`
+	// medias linked to with media:<id>
+	References []uuid.UUID `json:"references,omitempty"`
+
+	// optimisation
+	OptimisationStrategy string  `json:"optimisation_strategy,omitempty"`
+	SavedBytes           int64   `json:"saved_bytes,omitempty"`
+	WebPQuality          int     `json:"webp_quality,omitempty"`
+	QualityScore         float64 `json:"quality_score,omitempty"`
+}
+
+// PageSize is the size of a page of a PDF, in points.
+type PageSize struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// TOCEntry is a heading of a markdown document.
+type TOCEntry struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	// ID is the anchor of the heading in the HTML rendering of the document.
+	ID string `json:"id"`
 }
 
+// Strategies the optimiser can pick for a file.
+const (
+	OptimisationLossyWebP    = "lossy_webp"
+	OptimisationLosslessWebP = "lossless_webp"
+	OptimisationPDF          = "pdf"
+	OptimisationMinifiedSVG  = "minified_svg"
+	OptimisationOriginal     = "original"
+)
+
 func (m Metadata) Value() (driver.Value, error) {
 	b, err := json.Marshal(m)
 	if err != nil {
@@ -51,6 +118,59 @@ type Variant struct {
 	SizeBytes int64  `json:"size_bytes"`
 	Width     int    `json:"width"`
 	Height    int    `json:"height"`
+	// TargetWidth is the configured size the variant was generated for. It differs
+	// from Width when the original image is narrower than that size.
+	TargetWidth int `json:"target_width,omitempty"`
+	// MimeType is empty for variants stored before it was recorded, which are all WebP.
+	MimeType string `json:"mime_type,omitempty"`
+	// Encoding is the Content-Encoding of the variants holding a compressed copy of a text
+	// file, which keep its MIME type. It is empty for the other variants.
+	Encoding string `json:"encoding,omitempty"`
+	// Watermarked is set on the variants carrying the overlay of their bucket, shown to everyone
+	// but the owner of the image.
+	Watermarked bool `json:"watermarked,omitempty"`
+	// Page is the page of a multi-page TIFF the variant holds, counted from 1. The main file
+	// holds the first page, so variants start at the second one.
+	Page int `json:"page,omitempty"`
+}
+
+// Content encodings of the pre-compressed copies of text files.
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// Format returns the MIME type of the variant.
+func (v Variant) Format() string {
+	if v.MimeType == "" {
+		return "image/webp"
+	}
+	return v.MimeType
+}
+
+// Name identifies the variant within its media: the configured width it was generated for,
+// suffixed with the format for non-WebP variants (e.g. "300" or "300-jpeg"), the encoding
+// of a compressed copy (e.g. "br"), "html" for the rendering of a markdown document, or the
+// page of a TIFF (e.g. "page-2").
+func (v Variant) Name() string {
+	if v.Encoding != "" {
+		return v.Encoding
+	}
+	if v.Page > 0 {
+		return "page-" + strconv.Itoa(v.Page)
+	}
+	if v.MimeType == "text/html" {
+		return "html"
+	}
+	width := v.TargetWidth
+	if width == 0 {
+		width = v.Width
+	}
+	name := strconv.Itoa(width)
+	if format := v.Format(); format != "image/webp" {
+		name += "-" + strings.TrimPrefix(format, "image/")
+	}
+	return name
 }
 
 func (v Variant) Value() (driver.Value, error) {
@@ -76,10 +196,14 @@ func (v *Variant) Scan(src interface{}) error {
 }
 
 type VariantOutput struct {
+	Name      string `json:"name"`
 	URL       string `json:"url"`
 	SizeBytes int64  `json:"size_bytes"`
 	Width     int    `json:"width"`
 	Height    int    `json:"height"`
+	MimeType  string `json:"mime_type"`
+	// Watermarked is set on the variants carrying the overlay of their bucket.
+	Watermarked bool `json:"watermarked,omitempty"`
 }
 
 func (v VariantOutput) Value() (driver.Value, error) {
@@ -0,0 +1,115 @@
+package optimiser
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"io"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/animation"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+// animatedGIF returns a 64x32 GIF of three frames: red, green, then blue.
+func animatedGIF(t *testing.T) []byte {
+	t.Helper()
+	palette := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	g := &gif.GIF{LoopCount: -1}
+	for i := range palette {
+		frame := image.NewPaletted(image.Rect(0, 0, 64, 32), palette)
+		for p := range frame.Pix {
+			frame.Pix[p] = uint8(i)
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encode GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompress_AnimatedGIF(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	res, err := opt.Compress("image/gif", bytes.NewReader(animatedGIF(t)), port.CompressOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.MimeType != "image/webp" || res.Strategy != model.OptimisationLosslessWebP {
+		t.Errorf("got %q with %q; want lossless animated WebP", res.MimeType, res.Strategy)
+	}
+
+	out, err := io.ReadAll(res.Reader)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	info, animated, err := animation.Probe(out)
+	if err != nil || !animated {
+		t.Fatalf("output should be animated, got %v", err)
+	}
+	if info.FrameCount != 3 || info.LoopCount != 1 {
+		t.Errorf("info = %+v; want 3 frames played once", info)
+	}
+}
+
+func TestResize_AnimatedGIF(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	rc, err := opt.Resize("image/gif", bytes.NewReader(animatedGIF(t)), 16, 8, port.ResizeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = rc.Close() }()
+	out, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	anim, err := animation.Decode(out)
+	if err != nil {
+		t.Fatalf("output is not an animated WebP: %v", err)
+	}
+	if len(anim.Frames) != 3 {
+		t.Fatalf("got %d frames; want every frame resized", len(anim.Frames))
+	}
+	if size := anim.Frames[0].Bounds().Size(); size != image.Pt(16, 8) {
+		t.Errorf("frames are %v; want 16x8", size)
+	}
+	if c := anim.Frames[2].RGBAAt(8, 4); c.B < 200 || c.R > 50 {
+		t.Errorf("last frame = %v; want blue", c)
+	}
+}
+
+func TestResizeFallback_AnimationPoster(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+	anim, err := animation.Decode(animatedGIF(t))
+	if err != nil {
+		t.Fatalf("decode GIF: %v", err)
+	}
+	var webp bytes.Buffer
+	if err := animation.EncodeWebP(&webp, anim, opt.frameEncoder(lossyQuality)); err != nil {
+		t.Fatalf("encode animated WebP: %v", err)
+	}
+
+	rc, mimeType, err := opt.ResizeFallback("image/webp", bytes.NewReader(webp.Bytes()), 16, 8, port.ResizeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = rc.Close() }()
+	if mimeType != "image/jpeg" {
+		t.Errorf("mime type = %q; want image/jpeg", mimeType)
+	}
+	poster, err := jpeg.Decode(rc)
+	if err != nil {
+		t.Fatalf("output is not a valid JPEG: %v", err)
+	}
+	if r, g, b, _ := poster.At(8, 4).RGBA(); r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
+		t.Errorf("poster = %d,%d,%d; want the red first frame", r>>8, g>>8, b>>8)
+	}
+}
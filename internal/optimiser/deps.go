@@ -5,16 +5,19 @@ import (
 	"io"
 
 	"github.com/chai2010/webp"
+	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 )
 
 type WebPEncoder interface {
 	Encode(img image.Image, quality int, w io.Writer) error
+	EncodeLossless(img image.Image, w io.Writer) error
 	Decode(r io.Reader) (image.Image, string, error)
 }
 
 type PDFOptimizer interface {
-	OptimizeFile(inPath, outPath string) error
+	// OptimizeFile writes the optimised inPath to outPath, scrubbed following the profile.
+	OptimizeFile(inPath, outPath string, profile model.PDFProfile) error
 }
 
 type webPEncoder struct{}
@@ -33,12 +36,19 @@ func (e *webPEncoder) Encode(img image.Image, quality int, w io.Writer) error {
 	return webp.Encode(w, img, opts)
 }
 
+func (e *webPEncoder) EncodeLossless(img image.Image, w io.Writer) error {
+	return webp.Encode(w, img, &webp.Options{Lossless: true})
+}
+
 type pdfOptimizer struct{}
 
 func NewPDFOptimizer() PDFOptimizer {
 	return &pdfOptimizer{}
 }
 
-func (p *pdfOptimizer) OptimizeFile(inPath, outPath string) error {
-	return api.OptimizeFile(inPath, outPath, nil)
+func (p *pdfOptimizer) OptimizeFile(inPath, outPath string, profile model.PDFProfile) error {
+	if profile.IsZero() {
+		return api.OptimizeFile(inPath, outPath, nil)
+	}
+	return scrubPDFFile(inPath, outPath, profile)
 }
@@ -0,0 +1,38 @@
+package optimiser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+)
+
+// Encode compresses the content with the given Content-Encoding, at the best compression
+// level: the copies are made once by the worker and served many times.
+func (fo *FileOptimiser) Encode(encoding string, r io.Reader) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case model.EncodingGzip:
+		gw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, fmt.Errorf("optimiser: failed to create gzip writer: %w", err)
+		}
+		w = gw
+	case model.EncodingBrotli:
+		w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	default:
+		return nil, fmt.Errorf("optimiser: unsupported encoding %q", encoding)
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, fmt.Errorf("optimiser: failed to encode %s: %w", encoding, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("optimiser: failed to encode %s: %w", encoding, err)
+	}
+	return io.NopCloser(&buf), nil
+}
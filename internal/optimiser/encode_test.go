@@ -0,0 +1,57 @@
+package optimiser
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+)
+
+func TestEncode_RoundTrip(t *testing.T) {
+	text := strings.Repeat("# Title\n\nSome *markdown* text.\n", 100)
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		model.EncodingGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		model.EncodingBrotli: func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+	}
+
+	fo := NewFileOptimiser(&fakeWebPEncoder{}, &fakePDFOptimizer{})
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			rc, err := fo.Encode(encoding, strings.NewReader(text))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			encoded, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("failed to read encoded content: %v", err)
+			}
+			if len(encoded) >= len(text) {
+				t.Errorf("encoded size = %d; want less than %d", len(encoded), len(text))
+			}
+
+			r, err := decode(strings.NewReader(string(encoded)))
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			decoded, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			if string(decoded) != text {
+				t.Error("decoded content differs from the original")
+			}
+		})
+	}
+}
+
+func TestEncode_Unsupported(t *testing.T) {
+	fo := NewFileOptimiser(&fakeWebPEncoder{}, &fakePDFOptimizer{})
+	if _, err := fo.Encode("zstd", strings.NewReader("text")); err == nil {
+		t.Fatal("expected an error for an unsupported encoding")
+	}
+}
@@ -1,17 +1,25 @@
 package optimiser
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"image"
-	_ "image/jpeg"
-	_ "image/png"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"os"
 
+	"github.com/fhuszti/medias-ms-go/internal/animation"
+	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/raster"
 	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	_ "golang.org/x/image/bmp"
 	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
@@ -33,14 +41,214 @@ func NewFileOptimiser(webpEnc WebPEncoder, pdfOpt PDFOptimizer) *FileOptimiser {
 	}
 }
 
-// Compress takes an input stream and its MIME type, then returns a byte slice
-// containing the “optimised” version. Behavior:
-//   - Images (JPEG, PNG, WebP): always convert to lossy WebP @ quality=80.
-//   - PDFs (application/pdf): run pdfcpu.Optimize to strip unused objects.
-//   - Everything else (e.g. markdown): read as-is and return raw bytes.
-func (fo *FileOptimiser) Compress(mimeType string, r io.Reader) (io.ReadCloser, string, error) {
+// lossyQuality is the WebP quality used for the lossy candidate.
+const lossyQuality = 80
+
+// variantQuality is the WebP quality of the resized variants.
+const variantQuality = 100
+
+// losslessMaxColours is the number of colours under which an image is considered
+// flat enough for lossless WebP to be worth trying.
+const losslessMaxColours = 256
+
+// Compress takes an input stream and its MIME type, then returns the “optimised” version. Behavior:
+//   - Images (JPEG, PNG, GIF, WebP, TIFF, BMP): try lossy WebP @ quality=80 (or the quality
+//     picked by the encoder, see NewQualitySearchEncoder), lossless WebP for images with
+//     alpha or few colours, and the original, then keep the smallest of them. TIFFs and BMPs
+//     are always converted, as browsers do not display them.
+//     Animated GIFs and WebPs are encoded as animated WebP, at a fixed quality.
+//   - SVGs (image/svg+xml): sanitized and minified.
+//   - PDFs (application/pdf): run pdfcpu.Optimize to strip unused objects, after scrubbing
+//     what the PDF profile of the options asks for.
+//   - Everything else (e.g. markdown): kept as the original.
+func (fo *FileOptimiser) Compress(mimeType string, r io.Reader, opts port.CompressOptions) (*port.CompressResult, error) {
 	logger.Debugf(context.Background(), "compressing  file of type %q...", mimeType)
 
+	switch {
+	case media.IsImage(mimeType):
+		return fo.compressImage(mimeType, r)
+	case media.IsSVG(mimeType):
+		return compressSVG(r)
+	case media.IsPdf(mimeType):
+		return &port.CompressResult{
+			Reader:   fo.compressPDF(r, opts.PDFProfile),
+			MimeType: mimeType,
+			Strategy: model.OptimisationPDF,
+		}, nil
+	default:
+		return &port.CompressResult{
+			Reader:   io.NopCloser(r),
+			MimeType: mimeType,
+			Strategy: model.OptimisationOriginal,
+		}, nil
+	}
+}
+
+// compressImage encodes every candidate in memory and keeps the smallest one.
+// The original wins ties, so a file is never replaced by a larger one.
+func (fo *FileOptimiser) compressImage(mimeType string, r io.Reader) (*port.CompressResult, error) {
+	original, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to read image: %w", err)
+	}
+	if isAnimated(original) {
+		return fo.compressAnimation(mimeType, original)
+	}
+
+	img, _, err := fo.webpEnc.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to decode image: %w", err)
+	}
+	if !media.IsWebImage(mimeType) {
+		// browsers do not display it, so it is converted whatever its size
+		original = nil
+	}
+	return fo.encodeImage(img, mimeType, original)
+}
+
+// ConvertPage converts the page of a multi-page TIFF, counted from 1, to WebP as Compress does
+// for its first page.
+func (fo *FileOptimiser) ConvertPage(mimeType string, r io.Reader, page int) (*port.CompressResult, error) {
+	if !media.IsTIFF(mimeType) {
+		return nil, fmt.Errorf("optimiser: %q has no pages", mimeType)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to read image: %w", err)
+	}
+	pages, err := raster.TIFFPages(data)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to read pages: %w", err)
+	}
+	if page < 1 || page > len(pages) {
+		return nil, fmt.Errorf("optimiser: no page %d in an image of %d pages", page, len(pages))
+	}
+	img, err := raster.DecodeTIFFPage(data, pages[page-1])
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to decode page %d: %w", page, err)
+	}
+	return fo.encodeImage(img, mimeType, nil)
+}
+
+// encodeImage encodes the image as lossy WebP, and as lossless WebP when it suits it, then
+// keeps the smallest of them and of the original, unless there is none.
+func (fo *FileOptimiser) encodeImage(img image.Image, mimeType string, original []byte) (*port.CompressResult, error) {
+	best, bestMime, strategy := original, mimeType, model.OptimisationOriginal
+
+	var report QualityReport
+
+	var lossy bytes.Buffer
+	lossyReport, err := fo.encodeLossy(img, &lossy)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to encode WebP: %w", err)
+	}
+	if best == nil || lossy.Len() < len(best) {
+		best, bestMime, strategy = lossy.Bytes(), "image/webp", model.OptimisationLossyWebP
+		report = lossyReport
+	}
+
+	if suitsLossless(img) {
+		var lossless bytes.Buffer
+		if err := fo.webpEnc.EncodeLossless(img, &lossless); err != nil {
+			return nil, fmt.Errorf("optimiser: failed to encode lossless WebP: %w", err)
+		}
+		if lossless.Len() < len(best) {
+			best, bestMime, strategy = lossless.Bytes(), "image/webp", model.OptimisationLosslessWebP
+			report = QualityReport{}
+		}
+	}
+
+	return &port.CompressResult{
+		Reader:   io.NopCloser(bytes.NewReader(best)),
+		MimeType: bestMime,
+		Strategy: strategy,
+		Quality:  report.Quality,
+		Score:    report.Score,
+	}, nil
+}
+
+// compressAnimation encodes the animation as lossy animated WebP, and as lossless animated WebP
+// when its first frame suits it, then keeps the smallest of them and the original.
+func (fo *FileOptimiser) compressAnimation(mimeType string, original []byte) (*port.CompressResult, error) {
+	anim, err := animation.Decode(original)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to decode animation: %w", err)
+	}
+
+	best, bestMime, strategy, quality := original, mimeType, model.OptimisationOriginal, 0
+
+	var lossy bytes.Buffer
+	if err := animation.EncodeWebP(&lossy, anim, fo.frameEncoder(lossyQuality)); err != nil {
+		return nil, fmt.Errorf("optimiser: failed to encode animated WebP: %w", err)
+	}
+	if lossy.Len() < len(best) {
+		best, bestMime, strategy, quality = lossy.Bytes(), "image/webp", model.OptimisationLossyWebP, lossyQuality
+	}
+
+	if suitsLossless(anim.Frames[0]) {
+		var lossless bytes.Buffer
+		encodeFrame := func(w io.Writer, img image.Image) error { return fo.webpEnc.EncodeLossless(img, w) }
+		if err := animation.EncodeWebP(&lossless, anim, encodeFrame); err != nil {
+			return nil, fmt.Errorf("optimiser: failed to encode lossless animated WebP: %w", err)
+		}
+		if lossless.Len() < len(best) {
+			best, bestMime, strategy, quality = lossless.Bytes(), "image/webp", model.OptimisationLosslessWebP, 0
+		}
+	}
+
+	return &port.CompressResult{
+		Reader:   io.NopCloser(bytes.NewReader(best)),
+		MimeType: bestMime,
+		Strategy: strategy,
+		Quality:  quality,
+	}, nil
+}
+
+// frameEncoder returns a function encoding the frames of an animation as lossy WebP.
+func (fo *FileOptimiser) frameEncoder(quality int) func(w io.Writer, img image.Image) error {
+	return func(w io.Writer, img image.Image) error { return fo.webpEnc.Encode(img, quality, w) }
+}
+
+// isAnimated tells whether the image is an animated GIF or WebP. Images that cannot be read
+// as animations are handled as still ones.
+func isAnimated(data []byte) bool {
+	_, animated, err := animation.Probe(data)
+	return err == nil && animated
+}
+
+// encodeLossy encodes the image as lossy WebP, letting the encoder pick the quality when it can.
+func (fo *FileOptimiser) encodeLossy(img image.Image, w io.Writer) (QualityReport, error) {
+	if qe, ok := fo.webpEnc.(QualityEncoder); ok {
+		return qe.EncodeReport(img, w)
+	}
+	return QualityReport{Quality: lossyQuality}, fo.webpEnc.Encode(img, lossyQuality, w)
+}
+
+// suitsLossless tells whether lossless WebP is likely to beat lossy for the image,
+// which is the case for images with transparency or a small palette.
+func suitsLossless(img image.Image) bool {
+	if _, ok := img.(*image.Paletted); ok {
+		return true
+	}
+	if hasAlpha(img) {
+		return true
+	}
+
+	colours := make(map[color.RGBA64]struct{}, losslessMaxColours)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			colours[color.RGBA64Model.Convert(img.At(x, y)).(color.RGBA64)] = struct{}{}
+			if len(colours) > losslessMaxColours {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compressPDF streams the PDF optimised by pdfcpu. Errors surface when reading.
+func (fo *FileOptimiser) compressPDF(r io.Reader, profile model.PDFProfile) io.ReadCloser {
 	pr, pw := io.Pipe()
 
 	go func() {
@@ -48,88 +256,61 @@ func (fo *FileOptimiser) Compress(mimeType string, r io.Reader) (io.ReadCloser,
 			_ = pw.Close()
 		}(pw)
 
-		switch mimeType {
-		case "image/jpeg", "image/png", "image/webp":
-			img, _, err := fo.webpEnc.Decode(r)
-			if err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to decode image: %w", err))
-				return
-			}
-			// Re-encode as WebP@80 directly into pw
-			if err := fo.webpEnc.Encode(img, 80, pw); err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to encode WebP: %w", err))
-				return
-			}
-
-		case "application/pdf":
-			// Write the incoming PDF to a temp file
-			inFile, err := os.CreateTemp("", "pdf_in_*.pdf")
-			if err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: could not create temp input PDF: %w", err))
-				return
-			}
-			inName := inFile.Name()
-			if _, err := io.Copy(inFile, r); err != nil {
-				_ = inFile.Close()
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to write temp input PDF: %w", err))
-				return
-			}
+		// Write the incoming PDF to a temp file
+		inFile, err := os.CreateTemp("", "pdf_in_*.pdf")
+		if err != nil {
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: could not create temp input PDF: %w", err))
+			return
+		}
+		inName := inFile.Name()
+		if _, err := io.Copy(inFile, r); err != nil {
 			_ = inFile.Close()
-			defer func(name string) {
-				_ = os.Remove(name)
-			}(inName)
-
-			// Create a temp output path
-			outFile, err := os.CreateTemp("", "pdf_out_*.pdf")
-			if err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: could not create temp output PDF: %w", err))
-				return
-			}
-			outName := outFile.Name()
-			_ = outFile.Close()
-			defer func(name string) {
-				_ = os.Remove(name)
-			}(outName)
-
-			// Optimize on disk
-			if err := fo.pdfOpt.OptimizeFile(inName, outName); err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: pdf optimisation failed: %w", err))
-				return
-			}
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to write temp input PDF: %w", err))
+			return
+		}
+		_ = inFile.Close()
+		defer func(name string) {
+			_ = os.Remove(name)
+		}(inName)
 
-			// Stream optimised PDF back into pw
-			optimised, err := os.Open(outName)
-			if err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to open optimised PDF: %w", err))
-				return
-			}
-			defer func(optimised *os.File) {
-				_ = optimised.Close()
-			}(optimised)
+		// Create a temp output path
+		outFile, err := os.CreateTemp("", "pdf_out_*.pdf")
+		if err != nil {
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: could not create temp output PDF: %w", err))
+			return
+		}
+		outName := outFile.Name()
+		_ = outFile.Close()
+		defer func(name string) {
+			_ = os.Remove(name)
+		}(outName)
 
-			if _, err := io.Copy(pw, optimised); err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to stream optimised PDF: %w", err))
-				return
-			}
+		// Optimize on disk
+		if err := fo.pdfOpt.OptimizeFile(inName, outName, profile); err != nil {
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: pdf optimisation failed: %w", err))
+			return
+		}
 
-		default:
-			// All other types: pipe raw bytes directly
-			if _, err := io.Copy(pw, r); err != nil {
-				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to stream raw data: %w", err))
-				return
-			}
+		// Stream optimised PDF back into pw
+		optimised, err := os.Open(outName)
+		if err != nil {
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to open optimised PDF: %w", err))
+			return
 		}
-	}()
+		defer func(optimised *os.File) {
+			_ = optimised.Close()
+		}(optimised)
 
-	newMimeType := mimeType
-	if media.IsImage(mimeType) {
-		newMimeType = "image/webp"
-	}
+		if _, err := io.Copy(pw, optimised); err != nil {
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to stream optimised PDF: %w", err))
+			return
+		}
+	}()
 
-	return pr, newMimeType, nil
+	return pr
 }
 
-func (fo *FileOptimiser) Resize(mimeType string, r io.Reader, width, height int) (io.ReadCloser, error) {
+func (fo *FileOptimiser) Resize(mimeType string, r io.Reader, width, height int, opts port.ResizeOptions) (io.ReadCloser, error) {
 	logger.Debugf(context.Background(), "resizing image of type %q...", mimeType)
 
 	pr, pw := io.Pipe()
@@ -137,23 +318,37 @@ func (fo *FileOptimiser) Resize(mimeType string, r io.Reader, width, height int)
 	go func() {
 		defer func() { _ = pw.Close() }()
 
-		if !media.IsImage(mimeType) {
+		if !media.IsImage(mimeType) && !media.IsSVG(mimeType) {
 			if _, err := io.Copy(pw, r); err != nil {
 				_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to stream raw data: %w", err))
 			}
 			return
 		}
 
-		img, _, err := fo.webpEnc.Decode(r)
+		data, err := io.ReadAll(r)
 		if err != nil {
-			_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to decode image: %w", err))
+			_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to read image: %w", err))
+			return
+		}
+		if isAnimated(data) {
+			if err := fo.resizeAnimation(data, width, height, opts, pw); err != nil {
+				_ = pw.CloseWithError(err)
+			}
 			return
 		}
 
-		dst := image.NewRGBA(image.Rect(0, 0, width, height))
-		draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+		img, err := fo.decodePoster(mimeType, data, width, height)
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
 
-		if err := fo.webpEnc.Encode(dst, 100, pw); err != nil {
+		dst := scale(img, width, height)
+		if err := drawOverlay(opts.Overlay, dst); err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		if err := fo.webpEnc.Encode(dst, variantQuality, pw); err != nil {
 			_ = pw.CloseWithError(fmt.Errorf("optimiser: failed to encode WebP: %w", err))
 			return
 		}
@@ -161,3 +356,91 @@ func (fo *FileOptimiser) Resize(mimeType string, r io.Reader, width, height int)
 
 	return pr, nil
 }
+
+// resizeAnimation resizes every frame of the animation, and writes them as an animated WebP.
+func (fo *FileOptimiser) resizeAnimation(data []byte, width, height int, opts port.ResizeOptions, w io.Writer) error {
+	anim, err := animation.Decode(data)
+	if err != nil {
+		return fmt.Errorf("optimiser: failed to decode animation: %w", err)
+	}
+	for i, frame := range anim.Frames {
+		anim.Frames[i] = scale(frame, width, height)
+	}
+	if err := drawOverlay(opts.Overlay, anim.Frames...); err != nil {
+		return err
+	}
+	if err := animation.EncodeWebP(w, anim, fo.frameEncoder(variantQuality)); err != nil {
+		return fmt.Errorf("optimiser: failed to encode animated WebP: %w", err)
+	}
+	return nil
+}
+
+// fallbackJPEGQuality is the quality of the JPEG fallback variants.
+const fallbackJPEGQuality = 85
+
+func (fo *FileOptimiser) ResizeFallback(mimeType string, r io.Reader, width, height int, opts port.ResizeOptions) (io.ReadCloser, string, error) {
+	logger.Debugf(context.Background(), "resizing image of type %q into a fallback format...", mimeType)
+
+	if !media.IsImage(mimeType) && !media.IsSVG(mimeType) {
+		return nil, "", fmt.Errorf("optimiser: cannot make a fallback image out of %q", mimeType)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("optimiser: failed to read image: %w", err)
+	}
+	img, err := fo.decodePoster(mimeType, data, width, height)
+	if err != nil {
+		return nil, "", err
+	}
+	dst := scale(img, width, height)
+	if err := drawOverlay(opts.Overlay, dst); err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	// drawings are always kept lossless
+	if hasAlpha(img) || media.IsSVG(mimeType) {
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, "", fmt.Errorf("optimiser: failed to encode PNG: %w", err)
+		}
+		return io.NopCloser(&buf), "image/png", nil
+	}
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: fallbackJPEGQuality}); err != nil {
+		return nil, "", fmt.Errorf("optimiser: failed to encode JPEG: %w", err)
+	}
+	return io.NopCloser(&buf), "image/jpeg", nil
+}
+
+// decodePoster decodes the image, or the first frame of an animation. SVGs are drawn at the
+// given dimensions.
+func (fo *FileOptimiser) decodePoster(mimeType string, data []byte, width, height int) (image.Image, error) {
+	if media.IsSVG(mimeType) {
+		return rasterizeSVG(data, width, height)
+	}
+	if isAnimated(data) {
+		anim, err := animation.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("optimiser: failed to decode animation: %w", err)
+		}
+		return anim.Frames[0], nil
+	}
+	img, _, err := fo.webpEnc.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// scale returns the image resized to the given dimensions.
+func scale(img image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// hasAlpha tells whether the image has transparent pixels, when it can tell.
+func hasAlpha(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && !o.Opaque()
+}
@@ -6,24 +6,36 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"image/jpeg"
+	"image/png"
 	"io"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
 )
 
 type fakeWebPEncoder struct {
-	returnDecodeErr error
-	returnEncodeErr error
-	returnBytes     []byte
+	returnDecodeErr   error
+	returnEncodeErr   error
+	returnLosslessErr error
+	returnBytes       []byte
+	returnLossless    []byte
+	returnImage       image.Image
+	losslessCalled    bool
 }
 
 func (f *fakeWebPEncoder) Decode(r io.Reader) (image.Image, string, error) {
 	if f.returnDecodeErr != nil {
 		return nil, "", f.returnDecodeErr
 	}
+	if f.returnImage != nil {
+		return f.returnImage, "png", nil
+	}
 	// Just return a 1x1 image
 	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
 	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 255, A: 255}}, image.Point{}, draw.Src)
@@ -40,11 +52,35 @@ func (f *fakeWebPEncoder) Encode(img image.Image, quality int, w io.Writer) erro
 	return nil
 }
 
+func (f *fakeWebPEncoder) EncodeLossless(img image.Image, w io.Writer) error {
+	f.losslessCalled = true
+	if f.returnLosslessErr != nil {
+		return f.returnLosslessErr
+	}
+	if f.returnLossless != nil {
+		_, _ = w.Write(f.returnLossless)
+	}
+	return nil
+}
+
+// noisyImage returns an opaque image with more colours than lossless WebP is tried for.
+func noisyImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8(i)
+		img.Pix[i+1] = uint8(i >> 8)
+		img.Pix[i+3] = 255
+	}
+	return img
+}
+
 type fakePDFOptimizer struct {
-	returnErr error
+	returnErr  error
+	gotProfile model.PDFProfile
 }
 
-func (f *fakePDFOptimizer) OptimizeFile(inPath, outPath string) error {
+func (f *fakePDFOptimizer) OptimizeFile(inPath, outPath string, profile model.PDFProfile) error {
+	f.gotProfile = profile
 	if f.returnErr != nil {
 		return f.returnErr
 	}
@@ -65,106 +101,188 @@ func (e *errorReader) Read(p []byte) (int, error) {
 	return 0, e.returnErr
 }
 
-func TestCompress_ImagePath_Success(t *testing.T) {
+func TestCompress_ImagePath_LossyWins(t *testing.T) {
 	const expected = "HELLOIMG"
-	wEnc := &fakeWebPEncoder{returnBytes: []byte(expected)}
-	pOpt := &fakePDFOptimizer{}
-	opt := NewFileOptimiser(wEnc, pOpt)
+	wEnc := &fakeWebPEncoder{returnBytes: []byte(expected), returnImage: noisyImage()}
+	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
 
-	outRC, mimeType, err := opt.Compress("image/png", strings.NewReader("ignored"))
+	res, err := opt.Compress("image/png", strings.NewReader("a much larger original image"), port.CompressOptions{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	defer func(outRC io.ReadCloser) {
 		_ = outRC.Close()
-	}(outRC)
+	}(res.Reader)
 
-	out, err := io.ReadAll(outRC)
+	out, err := io.ReadAll(res.Reader)
 	if err != nil {
 		t.Fatalf("failed to read output: %v", err)
 	}
 	if string(out) != expected {
 		t.Errorf("expected %q, got %q", expected, string(out))
 	}
-	if mimeType != "image/webp" {
-		t.Errorf("expected mime type %q, got %q", "image/webp", mimeType)
+	if res.MimeType != "image/webp" {
+		t.Errorf("expected mime type %q, got %q", "image/webp", res.MimeType)
+	}
+	if res.Strategy != model.OptimisationLossyWebP {
+		t.Errorf("expected strategy %q, got %q", model.OptimisationLossyWebP, res.Strategy)
+	}
+	if res.Quality != lossyQuality || res.Score != 0 {
+		t.Errorf("expected fixed quality %d without score, got %d/%v", lossyQuality, res.Quality, res.Score)
+	}
+	if wEnc.losslessCalled {
+		t.Error("lossless should not be tried for a photo-like image")
 	}
 }
 
-func TestCompress_ImageMimeType_Conversion(t *testing.T) {
+func TestCompress_ImagePath_LosslessWins(t *testing.T) {
 	testCases := []struct {
-		inMimeType  string
-		outMimeType string
+		name string
+		img  image.Image
 	}{
-		{"image/png", "image/webp"},
-		{"image/jpeg", "image/webp"},
-		{"image/webp", "image/webp"},
+		{"few colours", nil},
+		{"alpha", image.NewNRGBA(image.Rect(0, 0, 2, 2))},
+		{"paletted", image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White})},
 	}
 
 	for _, tc := range testCases {
-		t.Run(tc.inMimeType, func(t *testing.T) {
-			wEnc := &fakeWebPEncoder{returnBytes: []byte("test")}
-			pOpt := &fakePDFOptimizer{}
-			opt := NewFileOptimiser(wEnc, pOpt)
+		t.Run(tc.name, func(t *testing.T) {
+			wEnc := &fakeWebPEncoder{returnBytes: []byte("lossy-webp"), returnLossless: []byte("lossless"), returnImage: tc.img}
+			opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
 
-			_, mimeType, err := opt.Compress(tc.inMimeType, strings.NewReader("test"))
+			res, err := opt.Compress("image/png", strings.NewReader("a much larger original image"), port.CompressOptions{})
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
-			if mimeType != tc.outMimeType {
-				t.Errorf("expected mime type %q, got %q", tc.outMimeType, mimeType)
+			out, _ := io.ReadAll(res.Reader)
+			if string(out) != "lossless" {
+				t.Errorf("expected lossless output, got %q", out)
+			}
+			if res.Strategy != model.OptimisationLosslessWebP || res.MimeType != "image/webp" {
+				t.Errorf("got strategy %q with mime type %q", res.Strategy, res.MimeType)
 			}
 		})
 	}
 }
 
-func TestCompress_ImagePath_DecodeError(t *testing.T) {
-	wEnc := &fakeWebPEncoder{returnDecodeErr: errors.New("decode failed")}
-	pOpt := &fakePDFOptimizer{}
-	opt := NewFileOptimiser(wEnc, pOpt)
+func TestCompress_ImagePath_OriginalWins(t *testing.T) {
+	const original = "tiny"
+	wEnc := &fakeWebPEncoder{returnBytes: []byte("bigger lossy"), returnLossless: []byte("bigger lossless")}
+	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
 
-	reader, newMime, err := opt.Compress("image/jpeg", strings.NewReader("irrelevant"))
+	res, err := opt.Compress("image/jpeg", strings.NewReader(original), port.CompressOptions{})
 	if err != nil {
-		t.Fatalf("expected no immediate error, got %v", err)
+		t.Fatalf("expected no error, got %v", err)
 	}
-	defer func(reader io.ReadCloser) {
-		_ = reader.Close()
-	}(reader)
+	out, _ := io.ReadAll(res.Reader)
+	if string(out) != original {
+		t.Errorf("expected original bytes, got %q", out)
+	}
+	if res.Strategy != model.OptimisationOriginal {
+		t.Errorf("expected strategy %q, got %q", model.OptimisationOriginal, res.Strategy)
+	}
+	if res.MimeType != "image/jpeg" {
+		t.Errorf("expected original mime type to be kept, got %q", res.MimeType)
+	}
+}
 
-	_, readErr := io.ReadAll(reader)
-	if readErr == nil {
-		t.Fatal("expected decode error on read, got nil")
+func TestCompress_ImagePath_ScansAlwaysConverted(t *testing.T) {
+	for _, mimeType := range []string{"image/tiff", "image/bmp"} {
+		t.Run(mimeType, func(t *testing.T) {
+			wEnc := &fakeWebPEncoder{returnBytes: []byte("bigger lossy"), returnImage: noisyImage()}
+			opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
+
+			res, err := opt.Compress(mimeType, strings.NewReader("tiny"), port.CompressOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			out, _ := io.ReadAll(res.Reader)
+			if string(out) != "bigger lossy" || res.MimeType != "image/webp" || res.Strategy != model.OptimisationLossyWebP {
+				t.Errorf("got %q as %q with %q; want the WebP although it is bigger", out, res.MimeType, res.Strategy)
+			}
+		})
 	}
-	if !strings.Contains(readErr.Error(), "decode failed") {
-		t.Errorf("expected read error to contain 'decode failed', got %q", readErr.Error())
+}
+
+func TestConvertPage(t *testing.T) {
+	var tiffData bytes.Buffer
+	if err := tiff.Encode(&tiffData, noisyImage(), nil); err != nil {
+		t.Fatalf("encode TIFF: %v", err)
+	}
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	res, err := opt.ConvertPage("image/tiff", bytes.NewReader(tiffData.Bytes()), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.MimeType != "image/webp" {
+		t.Errorf("mime type = %q; want image/webp", res.MimeType)
 	}
-	if newMime != "image/webp" {
-		t.Errorf("expected newMimeType 'image/webp' even on decode error, got %q", newMime)
+	img, format, err := image.Decode(res.Reader)
+	if err != nil || format != "webp" {
+		t.Fatalf("output is not a WebP: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 32, 32) {
+		t.Errorf("page is %v; want 32x32", img.Bounds())
+	}
+
+	if _, err := opt.ConvertPage("image/tiff", bytes.NewReader(tiffData.Bytes()), 2); err == nil {
+		t.Error("expected an error for a page past the last one")
+	}
+	if _, err := opt.ConvertPage("image/png", bytes.NewReader(tiffData.Bytes()), 1); err == nil {
+		t.Error("expected an error for an image without pages")
 	}
 }
 
-func TestCompress_ImagePath_EncodeError(t *testing.T) {
-	wEnc := &fakeWebPEncoder{returnEncodeErr: errors.New("encode failed")}
-	pOpt := &fakePDFOptimizer{}
-	opt := NewFileOptimiser(wEnc, pOpt)
+func TestCompress_ImagePath_TieKeepsOriginal(t *testing.T) {
+	wEnc := &fakeWebPEncoder{returnBytes: []byte("same"), returnImage: noisyImage()}
+	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
 
-	reader, newMime, err := opt.Compress("image/webp", strings.NewReader("irrelevant"))
+	res, err := opt.Compress("image/webp", strings.NewReader("SAME"), port.CompressOptions{})
 	if err != nil {
-		t.Fatalf("expected no immediate error, got %v", err)
+		t.Fatalf("expected no error, got %v", err)
 	}
-	defer func(reader io.ReadCloser) {
-		_ = reader.Close()
-	}(reader)
+	if res.Strategy != model.OptimisationOriginal {
+		t.Errorf("expected strategy %q, got %q", model.OptimisationOriginal, res.Strategy)
+	}
+}
 
-	_, readErr := io.ReadAll(reader)
-	if readErr == nil {
-		t.Fatal("expected encode error on read, got nil")
+func TestCompress_ImagePath_DecodeError(t *testing.T) {
+	wEnc := &fakeWebPEncoder{returnDecodeErr: errors.New("decode failed")}
+	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
+
+	_, err := opt.Compress("image/jpeg", strings.NewReader("irrelevant"), port.CompressOptions{})
+	if err == nil || !strings.Contains(err.Error(), "decode failed") {
+		t.Fatalf("expected decode error, got %v", err)
 	}
-	if !strings.Contains(readErr.Error(), "encode failed") {
-		t.Errorf("expected read error to contain 'encode failed', got %q", readErr.Error())
+}
+
+func TestCompress_ImagePath_EncodeError(t *testing.T) {
+	wEnc := &fakeWebPEncoder{returnEncodeErr: errors.New("encode failed")}
+	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
+
+	_, err := opt.Compress("image/webp", strings.NewReader("irrelevant"), port.CompressOptions{})
+	if err == nil || !strings.Contains(err.Error(), "encode failed") {
+		t.Fatalf("expected encode error, got %v", err)
+	}
+}
+
+func TestCompress_ImagePath_LosslessEncodeError(t *testing.T) {
+	wEnc := &fakeWebPEncoder{returnLosslessErr: errors.New("lossless failed")}
+	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
+
+	_, err := opt.Compress("image/png", strings.NewReader("irrelevant"), port.CompressOptions{})
+	if err == nil || !strings.Contains(err.Error(), "lossless failed") {
+		t.Fatalf("expected lossless encode error, got %v", err)
 	}
-	if newMime != "image/webp" {
-		t.Errorf("expected newMimeType 'image/webp' even on encode error, got %q", newMime)
+}
+
+func TestCompress_ImagePath_ReadError(t *testing.T) {
+	opt := NewFileOptimiser(&fakeWebPEncoder{}, &fakePDFOptimizer{})
+
+	_, err := opt.Compress("image/png", &errorReader{returnErr: errors.New("read failed")}, port.CompressOptions{})
+	if err == nil || !strings.Contains(err.Error(), "read failed") {
+		t.Fatalf("expected read error, got %v", err)
 	}
 }
 
@@ -201,23 +319,30 @@ func TestCompress_PDFPath_Success(t *testing.T) {
 		}
 	}(f)
 
-	outRC, mimeType, err := opt.Compress("application/pdf", f)
+	profile := model.PDFProfile{StripMetadata: true}
+	res, err := opt.Compress("application/pdf", f, port.CompressOptions{PDFProfile: profile})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	defer func(outRC io.ReadCloser) {
 		_ = outRC.Close()
-	}(outRC)
+	}(res.Reader)
 
-	out, err := io.ReadAll(outRC)
+	out, err := io.ReadAll(res.Reader)
 	if err != nil {
 		t.Fatalf("failed to read output: %v", err)
 	}
 	if !strings.HasPrefix(string(out), pdfContent) {
 		t.Errorf("expected output to start with %q, got %q", pdfContent, string(out)[:len(pdfContent)])
 	}
-	if mimeType != "application/pdf" {
-		t.Errorf("expected mime type %q, got %q", "application/pdf", mimeType)
+	if res.MimeType != "application/pdf" {
+		t.Errorf("expected mime type %q, got %q", "application/pdf", res.MimeType)
+	}
+	if res.Strategy != model.OptimisationPDF {
+		t.Errorf("expected strategy %q, got %q", model.OptimisationPDF, res.Strategy)
+	}
+	if pOpt.gotProfile != profile {
+		t.Errorf("expected PDF profile %+v, got %+v", profile, pOpt.gotProfile)
 	}
 }
 
@@ -249,23 +374,23 @@ func TestCompress_PDFPath_Failure(t *testing.T) {
 		_ = f.Close()
 	}(f)
 
-	reader, newMime, err := opt.Compress("application/pdf", f)
+	res, err := opt.Compress("application/pdf", f, port.CompressOptions{})
 	if err != nil {
 		t.Fatalf("expected no immediate error, got %v", err)
 	}
 	defer func(reader io.ReadCloser) {
 		_ = reader.Close()
-	}(reader)
+	}(res.Reader)
 
-	_, readErr := io.ReadAll(reader)
+	_, readErr := io.ReadAll(res.Reader)
 	if readErr == nil {
 		t.Fatal("expected PDF optimize error on read, got nil")
 	}
 	if !strings.Contains(readErr.Error(), "pdf failed") {
 		t.Errorf("expected read error to contain 'pdf failed', got %q", readErr.Error())
 	}
-	if newMime != "application/pdf" {
-		t.Errorf("expected newMimeType 'application/pdf' even on failure, got %q", newMime)
+	if res.MimeType != "application/pdf" {
+		t.Errorf("expected newMimeType 'application/pdf' even on failure, got %q", res.MimeType)
 	}
 }
 
@@ -275,23 +400,26 @@ func TestCompress_OtherPath_Success(t *testing.T) {
 	opt := NewFileOptimiser(wEnc, pOpt)
 
 	data := []byte("plain text here")
-	outRC, mimeType, err := opt.Compress("text/plain", bytes.NewReader(data))
+	res, err := opt.Compress("text/plain", bytes.NewReader(data), port.CompressOptions{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 	defer func(outRC io.ReadCloser) {
 		_ = outRC.Close()
-	}(outRC)
+	}(res.Reader)
 
-	out, err := io.ReadAll(outRC)
+	out, err := io.ReadAll(res.Reader)
 	if err != nil {
 		t.Fatalf("failed to read output: %v", err)
 	}
 	if !bytes.Equal(out, data) {
 		t.Errorf("expected output %q, got %q", data, out)
 	}
-	if mimeType != "text/plain" {
-		t.Errorf("expected mime type %q, got %q", "text/plain", mimeType)
+	if res.MimeType != "text/plain" {
+		t.Errorf("expected mime type %q, got %q", "text/plain", res.MimeType)
+	}
+	if res.Strategy != model.OptimisationOriginal {
+		t.Errorf("expected strategy %q, got %q", model.OptimisationOriginal, res.Strategy)
 	}
 }
 
@@ -309,12 +437,12 @@ func TestCompress_PreserveMimeTypes(t *testing.T) {
 			pOpt := &fakePDFOptimizer{}
 			opt := NewFileOptimiser(wEnc, pOpt)
 
-			_, mimeType, err := opt.Compress(tc.mimeType, strings.NewReader("test"))
+			res, err := opt.Compress(tc.mimeType, strings.NewReader("test"), port.CompressOptions{})
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
-			if mimeType != tc.mimeType {
-				t.Errorf("expected mime type to be preserved as %q, got %q", tc.mimeType, mimeType)
+			if res.MimeType != tc.mimeType {
+				t.Errorf("expected mime type to be preserved as %q, got %q", tc.mimeType, res.MimeType)
 			}
 		})
 	}
@@ -326,23 +454,23 @@ func TestCompress_OtherPath_ReadError(t *testing.T) {
 	opt := NewFileOptimiser(wEnc, pOpt)
 
 	errReader := &errorReader{returnErr: errors.New("read failed")}
-	reader, newMime, err := opt.Compress("text/plain", errReader)
+	res, err := opt.Compress("text/plain", errReader, port.CompressOptions{})
 	if err != nil {
 		t.Fatalf("expected no immediate error, got %v", err)
 	}
 	defer func(reader io.ReadCloser) {
 		_ = reader.Close()
-	}(reader)
+	}(res.Reader)
 
-	_, readErr := io.ReadAll(reader)
+	_, readErr := io.ReadAll(res.Reader)
 	if readErr == nil {
 		t.Fatal("expected read error on read, got nil")
 	}
 	if !strings.Contains(readErr.Error(), "read failed") {
 		t.Errorf("expected read error message, got %q", readErr.Error())
 	}
-	if newMime != "text/plain" {
-		t.Errorf("expected newMimeType 'text/plain', got %q", newMime)
+	if res.MimeType != "text/plain" {
+		t.Errorf("expected newMimeType 'text/plain', got %q", res.MimeType)
 	}
 }
 
@@ -352,7 +480,7 @@ func TestResize_Image_Success(t *testing.T) {
 	pOpt := &fakePDFOptimizer{}
 	opt := NewFileOptimiser(wEnc, pOpt)
 
-	outRC, err := opt.Resize("image/png", strings.NewReader("ignored"), 10, 10)
+	outRC, err := opt.Resize("image/png", strings.NewReader("ignored"), 10, 10, port.ResizeOptions{})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -371,7 +499,7 @@ func TestResize_Image_DecodeError(t *testing.T) {
 	wEnc := &fakeWebPEncoder{returnDecodeErr: errors.New("dec fail")}
 	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
 
-	reader, err := opt.Resize("image/webp", strings.NewReader("irrelevant"), 1, 1)
+	reader, err := opt.Resize("image/webp", strings.NewReader("irrelevant"), 1, 1, port.ResizeOptions{})
 	if err != nil {
 		t.Fatalf("expected no immediate error, got %v", err)
 	}
@@ -390,7 +518,7 @@ func TestResize_Image_EncodeError(t *testing.T) {
 	wEnc := &fakeWebPEncoder{returnEncodeErr: errors.New("enc fail")}
 	opt := NewFileOptimiser(wEnc, &fakePDFOptimizer{})
 
-	reader, err := opt.Resize("image/webp", strings.NewReader("irrelevant"), 1, 1)
+	reader, err := opt.Resize("image/webp", strings.NewReader("irrelevant"), 1, 1, port.ResizeOptions{})
 	if err != nil {
 		t.Fatalf("expected no immediate error, got %v", err)
 	}
@@ -408,7 +536,7 @@ func TestResize_Image_EncodeError(t *testing.T) {
 func TestResize_NonImage(t *testing.T) {
 	opt := NewFileOptimiser(&fakeWebPEncoder{returnBytes: []byte("NOP")}, &fakePDFOptimizer{})
 	data := []byte("plain")
-	rc, err := opt.Resize("application/pdf", bytes.NewReader(data), 0, 0)
+	rc, err := opt.Resize("application/pdf", bytes.NewReader(data), 0, 0, port.ResizeOptions{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -422,3 +550,48 @@ func TestResize_NonImage(t *testing.T) {
 		t.Errorf("expected %q, got %q", data, out)
 	}
 }
+
+func TestResizeFallback(t *testing.T) {
+	testCases := []struct {
+		name     string
+		img      image.Image
+		wantMime string
+		decode   func(io.Reader) (image.Image, error)
+	}{
+		{"opaque becomes jpeg", nil, "image/jpeg", jpeg.Decode},
+		{"alpha becomes png", image.NewNRGBA(image.Rect(0, 0, 4, 4)), "image/png", png.Decode},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opt := NewFileOptimiser(&fakeWebPEncoder{returnImage: tc.img}, &fakePDFOptimizer{})
+
+			rc, mimeType, err := opt.ResizeFallback("image/webp", strings.NewReader("ignored"), 3, 2, port.ResizeOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer func() { _ = rc.Close() }()
+			if mimeType != tc.wantMime {
+				t.Errorf("mime type = %q; want %q", mimeType, tc.wantMime)
+			}
+			out, err := tc.decode(rc)
+			if err != nil {
+				t.Fatalf("output is not a valid %s: %v", tc.wantMime, err)
+			}
+			if out.Bounds().Dx() != 3 || out.Bounds().Dy() != 2 {
+				t.Errorf("output is %v; want 3x2", out.Bounds())
+			}
+		})
+	}
+}
+
+func TestResizeFallback_Errors(t *testing.T) {
+	opt := NewFileOptimiser(&fakeWebPEncoder{returnDecodeErr: errors.New("decode failed")}, &fakePDFOptimizer{})
+
+	if _, _, err := opt.ResizeFallback("image/png", strings.NewReader("x"), 1, 1, port.ResizeOptions{}); err == nil || !strings.Contains(err.Error(), "decode failed") {
+		t.Errorf("expected decode error, got %v", err)
+	}
+	if _, _, err := opt.ResizeFallback("application/pdf", strings.NewReader("x"), 1, 1, port.ResizeOptions{}); err == nil {
+		t.Error("expected error for a non image")
+	}
+}
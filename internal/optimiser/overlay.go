@@ -0,0 +1,78 @@
+package optimiser
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"golang.org/x/image/draw"
+)
+
+// overlayMarginRatio is the gap left between the overlay and the edges of the image, relative to
+// the width of the image.
+const overlayMarginRatio = 0.02
+
+// drawOverlay draws the overlay over the frames of an image, scaled to its share of their width
+// and placed against the side or corner given by its gravity. Nothing is drawn without an
+// overlay, or when it would be less than a pixel wide.
+func drawOverlay(overlay *port.Overlay, frames ...*image.RGBA) error {
+	if overlay == nil || len(frames) == 0 {
+		return nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(overlay.Image))
+	if err != nil {
+		return fmt.Errorf("optimiser: failed to decode overlay: %w", err)
+	}
+
+	bounds := frames[0].Bounds()
+	width := int(math.Round(float64(bounds.Dx()) * overlay.Scale))
+	height := int(math.Round(float64(width) * float64(src.Bounds().Dy()) / float64(src.Bounds().Dx())))
+	if width < 1 || height < 1 {
+		return nil
+	}
+
+	area := overlayArea(bounds, image.Pt(width, height), overlay.Gravity)
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(overlay.Opacity * 255))})
+	for _, dst := range frames {
+		draw.CatmullRom.Scale(dst, area, src, src.Bounds(), draw.Over, &draw.Options{SrcMask: mask})
+	}
+	return nil
+}
+
+// overlayArea places an overlay of the given size within the bounds of the image.
+func overlayArea(bounds image.Rectangle, size image.Point, gravity string) image.Rectangle {
+	margin := int(math.Round(float64(bounds.Dx()) * overlayMarginRatio))
+	left := bounds.Min.X + margin
+	right := bounds.Max.X - margin - size.X
+	top := bounds.Min.Y + margin
+	bottom := bounds.Max.Y - margin - size.Y
+	centerX := bounds.Min.X + (bounds.Dx()-size.X)/2
+	centerY := bounds.Min.Y + (bounds.Dy()-size.Y)/2
+
+	var min image.Point
+	switch gravity {
+	case model.GravityNorth:
+		min = image.Pt(centerX, top)
+	case model.GravitySouth:
+		min = image.Pt(centerX, bottom)
+	case model.GravityEast:
+		min = image.Pt(right, centerY)
+	case model.GravityWest:
+		min = image.Pt(left, centerY)
+	case model.GravityNorthEast:
+		min = image.Pt(right, top)
+	case model.GravityNorthWest:
+		min = image.Pt(left, top)
+	case model.GravitySouthWest:
+		min = image.Pt(left, bottom)
+	case model.GravityCenter:
+		min = image.Pt(centerX, centerY)
+	default:
+		min = image.Pt(right, bottom)
+	}
+	return image.Rectangle{Min: min, Max: min.Add(size)}
+}
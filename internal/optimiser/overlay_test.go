@@ -0,0 +1,101 @@
+package optimiser
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+func whiteImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	return img
+}
+
+func blackPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode overlay: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestOverlayArea(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
+	size := image.Pt(20, 10)
+	tests := []struct {
+		gravity string
+		want    image.Point
+	}{
+		{model.GravityCenter, image.Pt(40, 20)},
+		{model.GravityNorth, image.Pt(40, 2)},
+		{model.GravitySouth, image.Pt(40, 38)},
+		{model.GravityEast, image.Pt(78, 20)},
+		{model.GravityWest, image.Pt(2, 20)},
+		{model.GravityNorthEast, image.Pt(78, 2)},
+		{model.GravityNorthWest, image.Pt(2, 2)},
+		{model.GravitySouthEast, image.Pt(78, 38)},
+		{model.GravitySouthWest, image.Pt(2, 38)},
+		{"", image.Pt(78, 38)},
+	}
+	for _, tc := range tests {
+		got := overlayArea(bounds, size, tc.gravity)
+		if want := (image.Rectangle{Min: tc.want, Max: tc.want.Add(size)}); got != want {
+			t.Errorf("overlayArea(%q) = %v; want %v", tc.gravity, got, want)
+		}
+	}
+}
+
+func TestDrawOverlay(t *testing.T) {
+	dst := whiteImage(100, 50)
+	overlay := &port.Overlay{
+		Image:        blackPNG(t, 4, 2),
+		ImageOverlay: model.ImageOverlay{Gravity: model.GravitySouthEast, Opacity: 0.5, Scale: 0.2},
+	}
+
+	if err := drawOverlay(overlay, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the overlay is 20x10, 2px away from the bottom right corner, blended at half opacity
+	r, _, _, _ := dst.At(88, 42).RGBA()
+	if r>>8 < 120 || r>>8 > 135 {
+		t.Errorf("pixel under the overlay = %d; want a half blend of black over white", r>>8)
+	}
+	if got := dst.RGBAAt(10, 10); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel away from the overlay = %v; want it untouched", got)
+	}
+}
+
+func TestDrawOverlay_Nil(t *testing.T) {
+	dst := whiteImage(10, 10)
+	if err := drawOverlay(nil, dst); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := dst.RGBAAt(5, 5); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("pixel = %v; want it untouched", got)
+	}
+}
+
+func TestDrawOverlay_DecodeError(t *testing.T) {
+	overlay := &port.Overlay{Image: []byte("not an image"), ImageOverlay: model.ImageOverlay{Opacity: 1, Scale: 0.5}}
+	if err := drawOverlay(overlay, whiteImage(10, 10)); err == nil {
+		t.Fatal("expected an error for an overlay that is not an image")
+	}
+}
@@ -0,0 +1,274 @@
+package optimiser
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Annotation flags hiding an annotation from the rendered page (PDF 32000-1, 12.5.3).
+const (
+	annotFlagHidden = 1 << 1
+	annotFlagNoView = 1 << 5
+)
+
+// scrubPDFFile applies the profile to inPath, then writes it optimised to outPath.
+func scrubPDFFile(inPath, outPath string, profile model.PDFProfile) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.Cmd = pdfmodel.OPTIMIZE
+	ctx, err := api.ReadAndValidate(in, conf)
+	if err != nil {
+		return err
+	}
+	if err := applyPDFProfile(ctx, profile); err != nil {
+		return err
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return err
+	}
+	return api.WriteContextFile(ctx, outPath)
+}
+
+// applyPDFProfile scrubs the document in place. Objects no longer referenced are left out when
+// it gets written.
+func applyPDFProfile(ctx *pdfmodel.Context, profile model.PDFProfile) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+
+	if profile.StripMetadata {
+		// pdfcpu writes a fresh information dictionary, with only its producer and dates
+		ctx.Info = nil
+		root.Delete("Metadata")
+		root.Delete("PieceInfo")
+	}
+
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		page, _, inherited, err := ctx.PageDict(pageNr, false)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+		if profile.StripMetadata {
+			page.Delete("Metadata")
+			page.Delete("PieceInfo")
+		}
+		if err := scrubPageAnnotations(ctx, pageNr, page, inherited, profile); err != nil {
+			return fmt.Errorf("page %d: %w", pageNr, err)
+		}
+	}
+
+	if profile.RemoveForms || profile.Flatten {
+		root.Delete("AcroForm")
+	}
+	return nil
+}
+
+// scrubPageAnnotations removes the annotations of a page the profile does not keep, and draws
+// those to flatten into its content.
+func scrubPageAnnotations(ctx *pdfmodel.Context, pageNr int, page types.Dict, inherited *pdfmodel.InheritedPageAttrs, profile model.PDFProfile) error {
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil || len(annots) == 0 {
+		return err
+	}
+
+	var kept types.Array
+	var content bytes.Buffer
+	xobjects := types.Dict{}
+	for i, o := range annots {
+		annot, err := ctx.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if annot == nil {
+			continue
+		}
+
+		subtype := ""
+		if n := annot.NameEntry("Subtype"); n != nil {
+			subtype = *n
+		}
+		switch {
+		case subtype == "Link":
+			kept = append(kept, o)
+			continue
+		case subtype == "Widget" && profile.RemoveForms:
+			continue
+		case subtype != "Widget" && profile.RemoveAnnotations:
+			continue
+		case !profile.Flatten:
+			kept = append(kept, o)
+			continue
+		}
+
+		// popups only show the contents of their parent, and hidden annotations are not drawn
+		if subtype == "Popup" {
+			continue
+		}
+		if f := annot.IntEntry("F"); f != nil && *f&(annotFlagHidden|annotFlagNoView) != 0 {
+			continue
+		}
+		name := fmt.Sprintf("Flat%d", i)
+		if ok, err := drawAppearance(ctx, annot, name, &content); err != nil {
+			return err
+		} else if ok {
+			xobjects[name] = appearanceRef(ctx, annot)
+		}
+	}
+
+	if len(kept) == 0 {
+		page.Delete("Annots")
+	} else {
+		page["Annots"] = kept
+	}
+	if content.Len() == 0 {
+		return nil
+	}
+	if err := addXObjects(ctx, page, inherited, xobjects); err != nil {
+		return err
+	}
+	return appendPageContent(ctx, page, content.Bytes())
+}
+
+// appearanceRef returns the normal appearance stream of an annotation, in its current state
+// for those having several (e.g. check boxes).
+func appearanceRef(ctx *pdfmodel.Context, annot types.Dict) types.Object {
+	ap, err := ctx.DereferenceDict(annot["AP"])
+	if err != nil || ap == nil {
+		return nil
+	}
+	n := ap["N"]
+	o, err := ctx.Dereference(n)
+	if err != nil {
+		return nil
+	}
+	states, ok := o.(types.Dict)
+	if !ok {
+		return n
+	}
+	state := annot.NameEntry("AS")
+	if state == nil {
+		return nil
+	}
+	return states[*state]
+}
+
+// drawAppearance writes the operators drawing the appearance of an annotation, as the name form
+// XObject, in its rectangle. Annotations without an appearance are left out.
+func drawAppearance(ctx *pdfmodel.Context, annot types.Dict, name string, w *bytes.Buffer) (bool, error) {
+	ref := appearanceRef(ctx, annot)
+	if ref == nil {
+		return false, nil
+	}
+	sd, _, err := ctx.DereferenceStreamDict(ref)
+	if err != nil || sd == nil {
+		return false, err
+	}
+	rect, err := ctx.RectForArray(annot.ArrayEntry("Rect"))
+	if err != nil || rect == nil {
+		return false, err
+	}
+	bbox, err := ctx.RectForArray(sd.ArrayEntry("BBox"))
+	if err != nil || bbox == nil {
+		return false, err
+	}
+	if sd.NameEntry("Subtype") == nil {
+		sd.Dict["Subtype"] = types.Name("Form")
+	}
+
+	// map the bounding box, transformed by the form matrix, onto the annotation rectangle
+	// (PDF 32000-1, 12.5.5)
+	matrix := [6]float64{1, 0, 0, 1, 0, 0}
+	if a := sd.ArrayEntry("Matrix"); len(a) == 6 {
+		for i, v := range a {
+			f, err := ctx.DereferenceNumber(v)
+			if err != nil {
+				return false, err
+			}
+			matrix[i] = f
+		}
+	}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range [][2]float64{{bbox.LL.X, bbox.LL.Y}, {bbox.UR.X, bbox.LL.Y}, {bbox.LL.X, bbox.UR.Y}, {bbox.UR.X, bbox.UR.Y}} {
+		x := matrix[0]*p[0] + matrix[2]*p[1] + matrix[4]
+		y := matrix[1]*p[0] + matrix[3]*p[1] + matrix[5]
+		minX, minY, maxX, maxY = math.Min(minX, x), math.Min(minY, y), math.Max(maxX, x), math.Max(maxY, y)
+	}
+	if maxX-minX == 0 || maxY-minY == 0 {
+		return false, nil
+	}
+	sx := rect.Width() / (maxX - minX)
+	sy := rect.Height() / (maxY - minY)
+	fmt.Fprintf(w, "q %.4f 0 0 %.4f %.4f %.4f cm /%s Do Q\n", sx, sy, rect.LL.X-minX*sx, rect.LL.Y-minY*sy, name)
+	return true, nil
+}
+
+// addXObjects registers the form XObjects in the resources of the page, giving it its own copy of
+// inherited ones.
+func addXObjects(ctx *pdfmodel.Context, page types.Dict, inherited *pdfmodel.InheritedPageAttrs, xobjects types.Dict) error {
+	res, err := ctx.DereferenceDict(page["Resources"])
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		res = types.Dict{}
+		if inherited != nil && inherited.Resources != nil {
+			res = inherited.Resources.Clone().(types.Dict)
+		}
+		page["Resources"] = res
+	}
+
+	xobj, err := ctx.DereferenceDict(res["XObject"])
+	if err != nil {
+		return err
+	}
+	if xobj == nil {
+		xobj = types.Dict{}
+		res["XObject"] = xobj
+	}
+	for name, ref := range xobjects {
+		xobj[name] = ref
+	}
+	return nil
+}
+
+// appendPageContent draws bb on top of the page, in a graphics state of its own whatever the
+// content leaves behind.
+func appendPageContent(ctx *pdfmodel.Context, page types.Dict, bb []byte) error {
+	var contents types.Array
+	switch o := page["Contents"].(type) {
+	case nil:
+	case types.IndirectRef:
+		arr, err := ctx.DereferenceArray(o)
+		if err == nil && arr != nil {
+			contents = append(contents, arr...)
+		} else {
+			contents = append(contents, o)
+		}
+	case types.Array:
+		contents = append(contents, o...)
+	}
+
+	open, err := ctx.StreamDictIndRef([]byte("q\n"))
+	if err != nil {
+		return err
+	}
+	closing, err := ctx.StreamDictIndRef(append([]byte("\nQ\n"), bb...))
+	if err != nil {
+		return err
+	}
+	page["Contents"] = append(append(types.Array{*open}, contents...), *closing)
+	return nil
+}
@@ -0,0 +1,162 @@
+package optimiser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+func pdfStream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// annotatedPDF returns a one page PDF with document metadata, a form field, a square annotation
+// and a link.
+func annotatedPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [5 0 R] /DA (/Helv 0 Tf 0 g) >> /Metadata 9 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Annots [5 0 R 6 0 R 7 0 R] /Contents 8 0 R >>",
+		"<< /Title (Annual report) /Author (Jane Doe) >>",
+		"<< /Type /Annot /Subtype /Widget /Rect [10 10 110 30] /FT /Tx /T (name) /DA (/Helv 0 Tf 0 g) /AP << /N 10 0 R >> >>",
+		"<< /Type /Annot /Subtype /Square /Rect [200 200 300 300] /Contents (Looks wrong) /AP << /N 11 0 R >> >>",
+		"<< /Type /Annot /Subtype /Link /Rect [0 0 50 50] /A << /S /URI /URI (https://example.com) >> >>",
+		pdfStream("", "0 0 1 rg 0 0 100 100 re f"),
+		pdfStream("/Type /Metadata /Subtype /XML", "<x:xmpmeta xmlns:x=\"adobe:ns:meta/\"></x:xmpmeta>"),
+		pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 100 20]", "0 g 0 0 100 20 re S"),
+		pdfStream("/Type /XObject /Subtype /Form /BBox [0 0 100 100]", "1 0 0 RG 0 0 100 100 re S"),
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// annotationSubtypes lists the subtypes of the annotations of the first page.
+func annotationSubtypes(t *testing.T, ctx *pdfmodel.Context) []string {
+	t.Helper()
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatalf("page: %v", err)
+	}
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		t.Fatalf("annotations: %v", err)
+	}
+	var subtypes []string
+	for _, o := range annots {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			t.Fatalf("annotation: %v", err)
+		}
+		subtypes = append(subtypes, *d.NameEntry("Subtype"))
+	}
+	slices.Sort(subtypes)
+	return subtypes
+}
+
+func TestScrubPDFFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      model.PDFProfile
+		wantAnnots   []string
+		wantMetadata bool
+		wantAcroForm bool
+		wantXObjects int
+	}{
+		{"strip metadata", model.PDFProfile{StripMetadata: true}, []string{"Link", "Square", "Widget"}, false, true, 0},
+		{"remove annotations", model.PDFProfile{RemoveAnnotations: true}, []string{"Link", "Widget"}, true, true, 0},
+		{"remove forms", model.PDFProfile{RemoveForms: true}, []string{"Link", "Square"}, true, false, 0},
+		{"flatten", model.PDFProfile{Flatten: true}, []string{"Link"}, true, false, 2},
+		{"remove annotations and flatten", model.PDFProfile{RemoveAnnotations: true, Flatten: true}, []string{"Link"}, true, false, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			in := filepath.Join(dir, "in.pdf")
+			out := filepath.Join(dir, "out.pdf")
+			if err := os.WriteFile(in, annotatedPDF(), 0o644); err != nil {
+				t.Fatalf("write input: %v", err)
+			}
+
+			if err := scrubPDFFile(in, out, tc.profile); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ctx, err := api.ReadContextFile(out)
+			if err != nil {
+				t.Fatalf("read output: %v", err)
+			}
+			if got := annotationSubtypes(t, ctx); !slices.Equal(got, tc.wantAnnots) {
+				t.Errorf("annotations = %v; want %v", got, tc.wantAnnots)
+			}
+
+			root, err := ctx.Catalog()
+			if err != nil {
+				t.Fatalf("catalog: %v", err)
+			}
+			if _, ok := root.Find("Metadata"); ok != tc.wantMetadata {
+				t.Errorf("XMP metadata kept = %v; want %v", ok, tc.wantMetadata)
+			}
+			if _, ok := root.Find("AcroForm"); ok != tc.wantAcroForm {
+				t.Errorf("AcroForm kept = %v; want %v", ok, tc.wantAcroForm)
+			}
+			if ctx.Title != "" && !tc.wantMetadata {
+				t.Errorf("expected the title to be stripped, got %q", ctx.Title)
+			}
+			if ctx.Title != "Annual report" && tc.wantMetadata {
+				t.Errorf("expected the title to be kept, got %q", ctx.Title)
+			}
+
+			page, _, _, err := ctx.PageDict(1, false)
+			if err != nil {
+				t.Fatalf("page: %v", err)
+			}
+			xobjects := 0
+			if res, _ := ctx.DereferenceDict(page["Resources"]); res != nil {
+				if xobj, _ := ctx.DereferenceDict(res["XObject"]); xobj != nil {
+					xobjects = len(xobj)
+				}
+			}
+			if xobjects != tc.wantXObjects {
+				t.Errorf("page XObjects = %d; want %d", xobjects, tc.wantXObjects)
+			}
+			if tc.wantXObjects > 0 {
+				if _, ok := page["Contents"].(types.Array); !ok {
+					t.Errorf("expected the flattened appearances appended to the page contents, got %T", page["Contents"])
+				}
+			}
+		})
+	}
+}
+
+func TestScrubPDFFile_InvalidPDF(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(in, []byte("not a pdf"), 0o644); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	if err := scrubPDFFile(in, filepath.Join(dir, "out.pdf"), model.PDFProfile{StripMetadata: true}); err == nil {
+		t.Fatal("expected an error for an invalid PDF")
+	}
+}
@@ -0,0 +1,149 @@
+package optimiser
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Bounds of the WebP quality explored by the quality search.
+const (
+	searchMinQuality = 30
+	searchMaxQuality = 100
+)
+
+// QualityReport describes the quality picked by an encoder searching for it.
+type QualityReport struct {
+	Quality int
+	// Score is the SSIM between the source image and its encoding, from 0 to 1.
+	Score float64
+}
+
+// QualityEncoder is implemented by encoders picking the quality themselves,
+// so the chosen quality can be recorded.
+type QualityEncoder interface {
+	EncodeReport(img image.Image, w io.Writer) (QualityReport, error)
+}
+
+type qualitySearchEncoder struct {
+	WebPEncoder
+	minScore float64
+}
+
+// compile-time check: *qualitySearchEncoder must satisfy QualityEncoder
+var _ QualityEncoder = (*qualitySearchEncoder)(nil)
+
+// NewQualitySearchEncoder wraps a WebP encoder so it binary-searches the lowest quality
+// keeping the SSIM of the encoded image at or above minScore, instead of using the given one.
+func NewQualitySearchEncoder(base WebPEncoder, minScore float64) WebPEncoder {
+	return &qualitySearchEncoder{WebPEncoder: base, minScore: minScore}
+}
+
+// Encode ignores the requested quality and searches for one instead.
+func (e *qualitySearchEncoder) Encode(img image.Image, _ int, w io.Writer) error {
+	_, err := e.EncodeReport(img, w)
+	return err
+}
+
+func (e *qualitySearchEncoder) EncodeReport(img image.Image, w io.Writer) (QualityReport, error) {
+	// the highest quality is the fallback when no lower one is good enough
+	best, report, err := e.try(img, searchMaxQuality)
+	if err != nil {
+		return QualityReport{}, err
+	}
+
+	lo, hi := searchMinQuality, searchMaxQuality
+	for lo < hi {
+		mid := (lo + hi) / 2
+		data, r, err := e.try(img, mid)
+		if err != nil {
+			return QualityReport{}, err
+		}
+		if r.Score >= e.minScore {
+			best, report, hi = data, r, mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	if _, err := w.Write(best); err != nil {
+		return QualityReport{}, err
+	}
+	return report, nil
+}
+
+// try encodes the image at the given quality and scores the result against the source.
+func (e *qualitySearchEncoder) try(img image.Image, quality int) ([]byte, QualityReport, error) {
+	var buf bytes.Buffer
+	if err := e.WebPEncoder.Encode(img, quality, &buf); err != nil {
+		return nil, QualityReport{}, err
+	}
+	decoded, _, err := e.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, QualityReport{}, fmt.Errorf("optimiser: failed to decode WebP at quality %d: %w", quality, err)
+	}
+	return buf.Bytes(), QualityReport{Quality: quality, Score: SSIM(img, decoded)}, nil
+}
+
+// ssimWindow is the side of the square windows the SSIM is averaged over.
+const ssimWindow = 8
+
+// SSIM computes the mean structural similarity of the luminance of two images, from 0 to 1.
+// Images of different sizes are compared over their common area.
+func SSIM(a, b image.Image) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	w := min(a.Bounds().Dx(), b.Bounds().Dx())
+	h := min(a.Bounds().Dy(), b.Bounds().Dy())
+	if w == 0 || h == 0 {
+		return 0
+	}
+	la, lb := luminance(a, w, h), luminance(b, w, h)
+
+	winW, winH := min(ssimWindow, w), min(ssimWindow, h)
+	var (
+		total   float64
+		windows int
+	)
+	for y := 0; y+winH <= h; y += winH {
+		for x := 0; x+winW <= w; x += winW {
+			var sa, sb, saa, sbb, sab float64
+			for j := y; j < y+winH; j++ {
+				for i := x; i < x+winW; i++ {
+					va, vb := la[j*w+i], lb[j*w+i]
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+			n := float64(winW * winH)
+			ma, mb := sa/n, sb/n
+			va, vb := saa/n-ma*ma, sbb/n-mb*mb
+			cov := sab/n - ma*mb
+
+			total += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (va + vb + c2))
+			windows++
+		}
+	}
+	return total / float64(windows)
+}
+
+// luminance returns the 0-255 luma of the top-left w×h pixels of the image.
+func luminance(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	out := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			g := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			out[y*w+x] = float64(g.Y)
+		}
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+package optimiser
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+// lossyEncoder simulates a lossy codec: the lower the quality, the more the decoded image drifts.
+type lossyEncoder struct {
+	src       image.Image
+	encodeErr error
+	tried     []int
+}
+
+func (e *lossyEncoder) Encode(img image.Image, quality int, w io.Writer) error {
+	if e.encodeErr != nil {
+		return e.encodeErr
+	}
+	e.src = img
+	e.tried = append(e.tried, quality)
+	_, err := w.Write([]byte{byte(quality)})
+	return err
+}
+
+func (e *lossyEncoder) EncodeLossless(img image.Image, w io.Writer) error {
+	return e.Encode(img, 100, w)
+}
+
+func (e *lossyEncoder) Decode(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil || len(data) == 0 {
+		return nil, "", errors.New("bad data")
+	}
+	drift := 100 - int(data[0])
+
+	b := e.src.Bounds()
+	out := image.NewGray(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.GrayModel.Convert(e.src.At(x, y)).(color.Gray)
+			v := int(g.Y)
+			if (x+y)%2 == 0 {
+				v = min(v+drift, 255)
+			} else {
+				v = max(v-drift, 0)
+			}
+			out.SetGray(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	return out, "webp", nil
+}
+
+func gradientImage() image.Image {
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(64 + 4*x)})
+		}
+	}
+	return img
+}
+
+func TestSSIM(t *testing.T) {
+	img := gradientImage()
+	if got := SSIM(img, img); got < 0.9999 {
+		t.Errorf("SSIM of identical images = %v; want 1", got)
+	}
+
+	blank := image.NewGray(img.Bounds())
+	if got := SSIM(img, blank); got > 0.5 {
+		t.Errorf("SSIM of unrelated images = %v; want a low score", got)
+	}
+
+	if got := SSIM(img, image.NewGray(image.Rect(0, 0, 0, 0))); got != 0 {
+		t.Errorf("SSIM with an empty image = %v; want 0", got)
+	}
+}
+
+func TestQualitySearch_PicksLowestQualityAboveThreshold(t *testing.T) {
+	base := &lossyEncoder{}
+	enc := NewQualitySearchEncoder(base, 0.95).(QualityEncoder)
+	img := gradientImage()
+
+	var buf bytes.Buffer
+	report, err := enc.EncodeReport(img, &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Score < 0.95 {
+		t.Errorf("score %v is below the threshold", report.Score)
+	}
+	if report.Quality <= searchMinQuality || report.Quality >= searchMaxQuality {
+		t.Errorf("quality %d should be found inside the search bounds", report.Quality)
+	}
+	if buf.Len() != 1 || int(buf.Bytes()[0]) != report.Quality {
+		t.Errorf("written encoding %v does not match the reported quality %d", buf.Bytes(), report.Quality)
+	}
+
+	// one quality lower must fall under the threshold
+	base.src = img
+	lower, _, _ := base.Decode(bytes.NewReader([]byte{byte(report.Quality - 1)}))
+	if SSIM(img, lower) >= 0.95 {
+		t.Errorf("quality %d is not the lowest meeting the threshold", report.Quality)
+	}
+}
+
+func TestQualitySearch_FallsBackToMaxQuality(t *testing.T) {
+	enc := NewQualitySearchEncoder(&lossyEncoder{}, 1).(QualityEncoder)
+
+	var buf bytes.Buffer
+	report, err := enc.EncodeReport(gradientImage(), &buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Quality != searchMaxQuality {
+		t.Errorf("quality = %d; want %d", report.Quality, searchMaxQuality)
+	}
+}
+
+func TestQualitySearch_EncodeError(t *testing.T) {
+	enc := NewQualitySearchEncoder(&lossyEncoder{encodeErr: errors.New("encode failed")}, 0.9)
+
+	err := enc.Encode(gradientImage(), 80, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "encode failed") {
+		t.Fatalf("expected encode error, got %v", err)
+	}
+}
+
+func TestCompress_QualitySearchRecorded(t *testing.T) {
+	img := gradientImage()
+	base := &lossyEncoder{src: img}
+	opt := NewFileOptimiser(NewQualitySearchEncoder(base, 0.9), &fakePDFOptimizer{})
+
+	// the fake codec reads the first byte as the quality, the padding makes the original the largest candidate
+	original := append([]byte{100}, make([]byte, 16)...)
+	res, err := opt.Compress("image/jpeg", bytes.NewReader(original), port.CompressOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Strategy != model.OptimisationLossyWebP {
+		t.Fatalf("expected strategy %q, got %q", model.OptimisationLossyWebP, res.Strategy)
+	}
+	if res.Quality <= searchMinQuality || res.Quality >= searchMaxQuality {
+		t.Errorf("quality = %d; want a searched one", res.Quality)
+	}
+	if res.Score < 0.9 {
+		t.Errorf("score = %v; want at least 0.9", res.Score)
+	}
+}
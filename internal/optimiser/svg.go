@@ -0,0 +1,53 @@
+package optimiser
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/svg"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// compressSVG sanitizes and minifies an SVG. The result is kept even when it is not smaller, as
+// it is the only version known to be safe.
+func compressSVG(r io.Reader) (*port.CompressResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to read SVG: %w", err)
+	}
+	minified, err := svg.Minify(data)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to minify SVG: %w", err)
+	}
+	return &port.CompressResult{
+		Reader:   io.NopCloser(bytes.NewReader(minified)),
+		MimeType: "image/svg+xml",
+		Strategy: model.OptimisationMinifiedSVG,
+	}, nil
+}
+
+// rasterizeSVG draws the SVG at the given dimensions, its viewBox stretched to them.
+func rasterizeSVG(data []byte, width, height int) (img *image.RGBA, err error) {
+	// the SVG renderer panics on some malformed paths
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("optimiser: failed to draw SVG: %v", r)
+		}
+	}()
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("optimiser: failed to parse SVG: %w", err)
+	}
+	icon.SetTarget(0, 0, float64(width), float64(height))
+
+	img = image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return img, nil
+}
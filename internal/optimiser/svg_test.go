@@ -0,0 +1,97 @@
+package optimiser
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"golang.org/x/image/webp"
+)
+
+// drawing is a 32x16 SVG: red on its left half, transparent on its right half.
+const drawing = `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 16" onload="alert(1)">
+  <!-- left half -->
+  <rect x="0" y="0" width="16" height="16" fill="#ff0000"/>
+</svg>
+`
+
+func TestCompress_SVG(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	res, err := opt.Compress("image/svg+xml", strings.NewReader(drawing), port.CompressOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.MimeType != "image/svg+xml" || res.Strategy != model.OptimisationMinifiedSVG {
+		t.Errorf("got %q with %q; want a minified SVG", res.MimeType, res.Strategy)
+	}
+	out, err := io.ReadAll(res.Reader)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 16"><rect x="0" y="0" width="16" height="16" fill="#ff0000"/></svg>`
+	if string(out) != want {
+		t.Errorf("got %s; want %s", out, want)
+	}
+}
+
+func TestCompress_InvalidSVG(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	if _, err := opt.Compress("image/svg+xml", strings.NewReader("<html/>"), port.CompressOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestResize_SVG(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	rc, err := opt.Resize("image/svg+xml", strings.NewReader(drawing), 64, 32, port.ResizeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = rc.Close() }()
+	img, err := webp.Decode(rc)
+	if err != nil {
+		t.Fatalf("output is not a valid WebP: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(64, 32) {
+		t.Errorf("variant is %v; want 64x32", size)
+	}
+	if r, g, b, _ := img.At(16, 16).RGBA(); r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
+		t.Errorf("left half = %d,%d,%d; want red", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestResizeFallback_SVG(t *testing.T) {
+	opt := NewFileOptimiser(NewWebPEncoder(), &fakePDFOptimizer{})
+
+	rc, mimeType, err := opt.ResizeFallback("image/svg+xml", strings.NewReader(drawing), 64, 32, port.ResizeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = rc.Close() }()
+	if mimeType != "image/png" {
+		t.Errorf("mime type = %q; want image/png", mimeType)
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("output is not a valid PNG: %v", err)
+	}
+	if _, _, _, a := img.At(48, 16).RGBA(); a != 0 {
+		t.Errorf("right half alpha = %d; want transparent", a>>8)
+	}
+	if r, _, _, a := img.At(16, 16).RGBA(); r>>8 < 200 || a>>8 < 200 {
+		t.Errorf("left half = %d alpha %d; want opaque red", r>>8, a>>8)
+	}
+}
@@ -15,4 +15,8 @@ type Cache interface {
 	SetEtagMediaDetails(ctx context.Context, id uuid.UUID, etag string, validUntil time.Time)
 	DeleteMediaDetails(ctx context.Context, id uuid.UUID) error
 	DeleteEtagMediaDetails(ctx context.Context, id uuid.UUID) error
+	// GetWatermarkedPDF returns the copy of the file with the given ETag watermarked for the
+	// user, or nil when there is none.
+	GetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string) ([]byte, error)
+	SetWatermarkedPDF(ctx context.Context, id, userID uuid.UUID, etag string, data []byte, validUntil time.Time)
 }
@@ -1,9 +1,56 @@
 package port
 
-import "io"
+import (
+	"io"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+)
 
 // FileOptimiser defines file optimisation operations, such as compressing and resizing files.
 type FileOptimiser interface {
-	Compress(mimeType string, r io.Reader) (io.ReadCloser, string, error)
-	Resize(mimeType string, r io.Reader, width, height int) (io.ReadCloser, error)
+	Compress(mimeType string, r io.Reader, opts CompressOptions) (*CompressResult, error)
+	// ConvertPage converts the page of a multi-page TIFF, counted from 1, to WebP.
+	ConvertPage(mimeType string, r io.Reader, page int) (*CompressResult, error)
+	// Resize resizes the image into a WebP, every frame of it for animated GIFs and WebPs. SVGs
+	// are drawn at the given size.
+	Resize(mimeType string, r io.Reader, width, height int, opts ResizeOptions) (io.ReadCloser, error)
+	// ResizeFallback resizes like Resize, but for clients without WebP support: the image is
+	// encoded as PNG when it has transparency, as JPEG otherwise. Animations are reduced to a
+	// still poster of their first frame, and SVGs always drawn as PNG. The chosen MIME type is
+	// returned.
+	ResizeFallback(mimeType string, r io.Reader, width, height int, opts ResizeOptions) (io.ReadCloser, string, error)
+	// Encode compresses the content with the given Content-Encoding, model.EncodingGzip or
+	// model.EncodingBrotli.
+	Encode(encoding string, r io.Reader) (io.ReadCloser, error)
+}
+
+// CompressOptions tune the compression of a file, usually from the settings of its bucket.
+type CompressOptions struct {
+	PDFProfile model.PDFProfile
+}
+
+// ResizeOptions tune the resizing of an image.
+type ResizeOptions struct {
+	// Overlay is drawn over the resized image, when set.
+	Overlay *Overlay
+}
+
+// Overlay is an image, such as a logo, drawn over the variants of the images of a bucket.
+type Overlay struct {
+	// Image is the encoded overlay, in any of the allowed image formats.
+	Image []byte
+	model.ImageOverlay
+}
+
+// CompressResult is the file kept by a compression, along with the strategy that produced it.
+type CompressResult struct {
+	Reader   io.ReadCloser
+	MimeType string
+	// Strategy is one of the model.Optimisation* values. With model.OptimisationOriginal,
+	// Reader holds the untouched input and there is nothing to save.
+	Strategy string
+	// Quality and Score describe the lossy WebP encoding, when it is the one kept.
+	// Score is only set when the encoder searched for the quality.
+	Quality int
+	Score   float64
 }
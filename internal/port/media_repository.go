@@ -16,4 +16,15 @@ type MediaRepository interface {
 	Delete(ctx context.Context, ID uuid.UUID) error
 	ListUnoptimisedCompletedBefore(ctx context.Context, before time.Time) ([]uuid.UUID, error)
 	ListOptimisedImagesNoVariantsBefore(ctx context.Context, before time.Time) ([]uuid.UUID, error)
+	ListDeletedBefore(ctx context.Context, bucket string, before time.Time) ([]uuid.UUID, error)
+	ListExpiredBefore(ctx context.Context, before time.Time) ([]uuid.UUID, error)
+	ListCompletedImagesAfter(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error)
+	// ReplaceReferences records the medias a media links to, in place of the previous ones.
+	ReplaceReferences(ctx context.Context, ID uuid.UUID, referencedIDs []uuid.UUID) error
+	// ListReferencing returns the medias, outside the trash, linking to the given one.
+	ListReferencing(ctx context.Context, ID uuid.UUID) ([]uuid.UUID, error)
+	// SaveText indexes the text content of a media for full-text search, in place of the previous one.
+	SaveText(ctx context.Context, ID uuid.UUID, content string) error
+	// SearchTexts returns the completed medias whose text matches the search, best matches first.
+	SearchTexts(ctx context.Context, search model.TextSearch) ([]model.TextMatch, error)
 }
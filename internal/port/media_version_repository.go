@@ -0,0 +1,16 @@
+package port
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// MediaVersionRepository defines persistence operations for the previous versions of medias.
+type MediaVersionRepository interface {
+	Create(ctx context.Context, version *model.MediaVersion) error
+	Get(ctx context.Context, mediaID uuid.UUID, version int) (*model.MediaVersion, error)
+	ListByMediaID(ctx context.Context, mediaID uuid.UUID) ([]model.MediaVersion, error)
+	Delete(ctx context.Context, mediaID uuid.UUID, version int) error
+}
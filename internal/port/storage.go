@@ -3,24 +3,58 @@ package port
 import (
 	"context"
 	"io"
+	"net/url"
 	"time"
 )
 
+// Options of Storage.SaveFile that are not plain headers such as Content-Type, Cache-Control,
+// Content-Disposition or Content-Encoding.
+const (
+	// MetadataOptionPrefix prefixes user metadata, e.g. X-Amz-Meta-Media-Id.
+	MetadataOptionPrefix = "X-Amz-Meta-"
+	// TaggingOption holds the tags of the object, URL-encoded like a query string.
+	TaggingOption = "X-Amz-Tagging"
+)
+
+// WithdrawnTag marks, with the value "true", the files of medias in the trash. Public buckets
+// refuse anonymous reads of them.
+const WithdrawnTag = "withdrawn"
+
 // FileInfo represents metadata about a stored file.
 type FileInfo struct {
-	SizeBytes   int64
-	ContentType string
+	SizeBytes          int64
+	ContentType        string
+	ETag               string
+	LastModified       time.Time
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	// Metadata holds the user metadata, keyed without their X-Amz-Meta- prefix.
+	Metadata map[string]string
+	// TagCount is how many tags the file has, read with GetFileTags.
+	TagCount int
 }
 
 // Storage defines file storage operations.
 type Storage interface {
-	InitBucket(bucket string) error
-	GeneratePresignedDownloadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration) (string, error)
+	// InitBucket creates the bucket if needed, and lets anyone read its files if it is public.
+	InitBucket(bucket string, public bool) error
+	// GeneratePresignedDownloadURL signs a download link. reqParams may override response
+	// headers of the download, such as response-content-disposition.
+	GeneratePresignedDownloadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration, reqParams url.Values) (string, error)
 	GeneratePresignedUploadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration) (string, error)
 	FileExists(ctx context.Context, bucket, fileKey string) (bool, error)
 	StatFile(ctx context.Context, bucket, fileKey string) (FileInfo, error)
 	RemoveFile(ctx context.Context, bucket, fileKey string) error
 	GetFile(ctx context.Context, bucket, fileKey string) (io.ReadSeekCloser, error)
+	// GetFileRange reads length bytes of a file, starting at offset.
+	GetFileRange(ctx context.Context, bucket, fileKey string, offset, length int64) (io.ReadCloser, error)
+	// SaveFile stores a file. opts sets its Content-Type, Cache-Control, Content-Disposition and
+	// Content-Encoding headers, its user metadata (MetadataOptionPrefix) and its tags (TaggingOption).
 	SaveFile(ctx context.Context, bucket, fileKey string, reader io.Reader, fileSize int64, opts map[string]string) error
 	CopyFile(ctx context.Context, bucket, srcKey, destKey string) error
+	// GetFileTags reads the tags of a file.
+	GetFileTags(ctx context.Context, bucket, fileKey string) (map[string]string, error)
+	// SetFileTags replaces the tags of a file.
+	SetFileTags(ctx context.Context, bucket, fileKey string, tags map[string]string) error
 }
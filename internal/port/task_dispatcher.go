@@ -10,4 +10,6 @@ import (
 type TaskDispatcher interface {
 	EnqueueOptimiseMedia(ctx context.Context, id uuid.UUID) error
 	EnqueueResizeImage(ctx context.Context, id uuid.UUID) error
+	EnqueueReconcileImage(ctx context.Context, id uuid.UUID) error
+	EnqueueDerivePDF(ctx context.Context, id uuid.UUID) error
 }
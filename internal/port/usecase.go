@@ -2,6 +2,7 @@ package port
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/model"
@@ -12,7 +13,13 @@ type UUIDGen func() uuid.UUID
 
 // MediaGetter retrieves media information from the repository and storage.
 type MediaGetter interface {
-	GetMedia(ctx context.Context, id uuid.UUID) (*GetMediaOutput, error)
+	GetMedia(ctx context.Context, in GetMediaInput) (*GetMediaOutput, error)
+}
+type GetMediaInput struct {
+	ID uuid.UUID
+	// UserID is the authenticated user requesting the media, if any. The owner of an image is
+	// given its clean variants in buckets with an overlay.
+	UserID *uuid.UUID
 }
 type MetadataOutput struct {
 	model.Metadata
@@ -20,16 +27,102 @@ type MetadataOutput struct {
 	MimeType  string `json:"mime_type"`
 }
 type GetMediaOutput struct {
-	ValidUntil time.Time            `json:"valid_until"`
-	Optimised  bool                 `json:"optimised"`
-	URL        string               `json:"url"`
-	Metadata   MetadataOutput       `json:"metadata"`
-	Variants   model.VariantsOutput `json:"variants"`
+	// ValidUntil is when the URLs expire. It is zero for medias of public buckets, whose
+	// URLs are stable, unless the media itself expires.
+	ValidUntil time.Time `json:"valid_until,omitzero"`
+	Public     bool      `json:"public"`
+	Optimised  bool      `json:"optimised"`
+	// URL is empty for watermarked files, only downloadable through the API.
+	URL         string `json:"url"`
+	Watermarked bool   `json:"watermarked,omitempty"`
+	OriginalURL string `json:"original_url,omitempty"`
+	// DerivedFrom tells which medias the file was extracted or merged from.
+	DerivedFrom *model.Derivation    `json:"derived_from,omitempty"`
+	Metadata    MetadataOutput       `json:"metadata"`
+	Variants    model.VariantsOutput `json:"variants"`
+	ExpiresAt   *time.Time           `json:"expires_at,omitempty"`
+	// Personal is set when the output is only meant for the requesting user, such as the clean
+	// variants given to the owner of an image, so it must not be shared with other users.
+	Personal bool `json:"-"`
+}
+
+// MediaDownloader links to the file of a media that suits the client best.
+type MediaDownloader interface {
+	DownloadMedia(ctx context.Context, in DownloadMediaInput) (*DownloadMediaOutput, error)
+}
+type DownloadMediaInput struct {
+	ID uuid.UUID
+	// Accept is the Accept header of the request, used to pick the file format.
+	Accept string
+	// Width, when set, picks the narrowest file at least that wide, or the widest one.
+	Width int
+	// Variant, when set, names the exact variant to download and overrides Accept and Width.
+	Variant string
+	// AcceptEncoding is the Accept-Encoding header of the request, used to pick a compressed
+	// copy of text files.
+	AcceptEncoding string
+	// UserID is the authenticated user requesting the file, if any. The owner of an image can
+	// download its clean variants in buckets with an overlay.
+	UserID *uuid.UUID
+}
+type DownloadMediaOutput struct {
+	URL      string
+	MimeType string
+	// Watermarked is set, without a URL, when the file is watermarked for each user and must be
+	// streamed through the API instead.
+	Watermarked bool
+}
+
+// MediaContentGetter opens the content of a media file, to stream it through the API.
+type MediaContentGetter interface {
+	GetMediaContent(ctx context.Context, in GetMediaContentInput) (*GetMediaContentOutput, error)
+}
+type GetMediaContentInput struct {
+	ID uuid.UUID
+	// Variant, when set, names the variant to stream instead of the main file.
+	Variant string
+	// AcceptEncoding is the Accept-Encoding header of the request, used to pick a compressed
+	// copy of text files.
+	AcceptEncoding string
+	// UserID is the authenticated user requesting the content, that watermarked files are
+	// stamped with. The owner of an image can stream its clean variants in buckets with an
+	// overlay.
+	UserID *uuid.UUID
+}
+type GetMediaContentOutput struct {
+	// Content reads the file through ranged requests, from wherever it is seeked to.
+	Content            io.ReadSeekCloser
+	MimeType           string
+	SizeBytes          int64
+	ETag               string
+	LastModified       time.Time
+	ContentDisposition string
+	// ContentEncoding is set when the content is a compressed copy of the file.
+	ContentEncoding string
+	// Watermarked is set when the content was stamped for the requesting user, so it must not
+	// be cached by shared caches.
+	Watermarked bool
 }
 
-// MediaDeleter deletes a media and its file.
+// MediaDeleter moves a media to the trash, or deletes it and its files for good.
 type MediaDeleter interface {
 	DeleteMedia(ctx context.Context, id uuid.UUID) error
+	PurgeMedia(ctx context.Context, id uuid.UUID) error
+}
+
+// MediaRestorer brings a media back from the trash.
+type MediaRestorer interface {
+	RestoreMedia(ctx context.Context, id uuid.UUID) error
+}
+
+// TrashPurger permanently deletes the medias that stayed in the trash longer than their bucket retention.
+type TrashPurger interface {
+	PurgeTrash(ctx context.Context) error
+}
+
+// ExpiredPurger permanently deletes the medias whose expiry date has passed.
+type ExpiredPurger interface {
+	PurgeExpired(ctx context.Context) error
 }
 
 // UploadLinkGenerator returns a presigned link to upload a file.
@@ -37,7 +130,10 @@ type UploadLinkGenerator interface {
 	GenerateUploadLink(ctx context.Context, in GenerateUploadLinkInput) (GenerateUploadLinkOutput, error)
 }
 type GenerateUploadLinkInput struct {
-	Name string
+	Name      string
+	ExpiresAt *time.Time
+	// OwnerID is the user the media belongs to, if any.
+	OwnerID *uuid.UUID
 }
 type GenerateUploadLinkOutput struct {
 	ID  uuid.UUID `json:"id"`
@@ -51,6 +147,99 @@ type UploadFinaliser interface {
 type FinaliseUploadInput struct {
 	ID         uuid.UUID
 	DestBucket string
+	ExpiresAt  *time.Time
+}
+
+// VersionUploadLinkGenerator returns a presigned link to upload a new version of an existing media.
+type VersionUploadLinkGenerator interface {
+	GenerateVersionUploadLink(ctx context.Context, id uuid.UUID) (GenerateUploadLinkOutput, error)
+}
+
+// VersionFinaliser validates the uploaded new version of a media and makes it the current one.
+type VersionFinaliser interface {
+	FinaliseVersion(ctx context.Context, id uuid.UUID) error
+}
+
+// VersionLister lists the previous versions of a media.
+type VersionLister interface {
+	ListVersions(ctx context.Context, id uuid.UUID) (ListVersionsOutput, error)
+}
+type VersionOutput struct {
+	Version   int            `json:"version"`
+	Metadata  MetadataOutput `json:"metadata"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+type ListVersionsOutput struct {
+	CurrentVersion int             `json:"current_version"`
+	Versions       []VersionOutput `json:"versions"`
+}
+
+// VersionRollbacker makes a previous version of a media the current one again.
+type VersionRollbacker interface {
+	RollbackVersion(ctx context.Context, in RollbackVersionInput) error
+}
+type RollbackVersionInput struct {
+	ID      uuid.UUID
+	Version int
+}
+
+// MediaSearcher finds the medias whose text matches a query.
+type MediaSearcher interface {
+	SearchMedias(ctx context.Context, in SearchMediasInput) (SearchMediasOutput, error)
+}
+type SearchMediasInput struct {
+	Query string
+	// Bucket and OwnerID narrow the search when set.
+	Bucket  string
+	OwnerID *uuid.UUID
+	Limit   int
+}
+type SearchResultOutput struct {
+	ID       uuid.UUID `json:"id"`
+	Bucket   string    `json:"bucket"`
+	Name     string    `json:"name"`
+	MimeType string    `json:"mime_type"`
+	// Snippet is an HTML-escaped excerpt of the text, the query words wrapped in <mark> tags.
+	Snippet string `json:"snippet"`
+}
+type SearchMediasOutput struct {
+	Results []SearchResultOutput `json:"results"`
+}
+
+// PDFPagesExtractor requests a new media made of some pages of a PDF.
+type PDFPagesExtractor interface {
+	ExtractPages(ctx context.Context, in ExtractPagesInput) (DerivedMediaOutput, error)
+}
+type ExtractPagesInput struct {
+	ID uuid.UUID
+	// Pages lists the pages to keep, as comma-separated pages and ranges, e.g. "1-3,7".
+	Pages string
+	// Name is the file name of the new media, named after the source when empty.
+	Name string
+	// OwnerID is the user the new media belongs to, if any.
+	OwnerID *uuid.UUID
+}
+
+// PDFMerger requests a new media made of several PDFs, one after the other.
+type PDFMerger interface {
+	MergePDFs(ctx context.Context, in MergePDFsInput) (DerivedMediaOutput, error)
+}
+type MergePDFsInput struct {
+	IDs []uuid.UUID
+	// Name is the file name of the new media, "merged.pdf" when empty.
+	Name string
+	// OwnerID is the user the new media belongs to, if any.
+	OwnerID *uuid.UUID
+}
+
+// DerivedMediaOutput is the pending media whose file gets built by the worker.
+type DerivedMediaOutput struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// PDFDeriver builds the file of a media derived from other PDFs.
+type PDFDeriver interface {
+	DerivePDF(ctx context.Context, id uuid.UUID) error
 }
 
 // MediaOptimiser reduces the file size with different techniques.
@@ -65,6 +254,13 @@ type ImageResizer interface {
 type ResizeImageInput struct {
 	ID    uuid.UUID
 	Sizes []int
+	// Reconcile only generates the sizes the media is missing, instead of all of them.
+	Reconcile bool
+}
+
+// VariantsReconciler triggers variants reconciliation for every image.
+type VariantsReconciler interface {
+	ReconcileVariants(ctx context.Context) error
 }
 
 // BacklogOptimiser triggers optimisation for stale medias.
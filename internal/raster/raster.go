@@ -0,0 +1,216 @@
+// Package raster reads what image.DecodeConfig leaves out of scanned images: the pages of
+// multi-page TIFFs, and the resolution of TIFFs and BMPs.
+package raster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"golang.org/x/image/tiff"
+)
+
+// MaxPages bounds the pages read from a TIFF.
+const MaxPages = 1000
+
+// TIFF tags and values, see https://www.itu.int/itudoc/itu-t/com16/tiff-fx/docs/tiff6.pdf.
+const (
+	tagNewSubfileType = 254
+	tagImageWidth     = 256
+	tagImageLength    = 257
+	tagXResolution    = 282
+	tagResolutionUnit = 296
+
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+
+	// a reduced-resolution version of another page, e.g. a thumbnail
+	subfileReducedImage = 1 << 0
+
+	resolutionUnitNone       = 1
+	resolutionUnitCentimetre = 3
+)
+
+var errInvalidTIFF = errors.New("raster: invalid TIFF")
+
+// Page is a page of a TIFF.
+type Page struct {
+	Width  int
+	Height int
+	// DPI is the horizontal resolution of the page, 0 when unknown.
+	DPI int
+
+	// offset of the image file directory of the page
+	offset uint32
+}
+
+// TIFFPages lists the pages of a TIFF, leaving out the reduced-resolution images such as
+// thumbnails.
+func TIFFPages(data []byte) ([]Page, error) {
+	bo, offset, err := tiffHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []Page
+	seen := make(map[uint32]struct{})
+	for offset != 0 {
+		if _, ok := seen[offset]; ok {
+			return nil, fmt.Errorf("raster: TIFF directories loop at offset %d", offset)
+		}
+		seen[offset] = struct{}{}
+		if len(seen) > MaxPages {
+			return nil, fmt.Errorf("raster: TIFF has more than %d pages", MaxPages)
+		}
+
+		page, reduced, next, err := readIFD(data, bo, offset)
+		if err != nil {
+			return nil, err
+		}
+		if !reduced {
+			pages = append(pages, page)
+		}
+		offset = next
+	}
+	if len(pages) == 0 {
+		return nil, errInvalidTIFF
+	}
+	return pages, nil
+}
+
+// DecodeTIFFPage decodes the page of the TIFF, as listed by TIFFPages.
+func DecodeTIFFPage(data []byte, page Page) (image.Image, error) {
+	bo, _, err := tiffHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	// the TIFF decoder only reads the first directory, so the page is made the first one
+	r := &pageReader{data: data}
+	copy(r.header[:], data[:8])
+	bo.PutUint32(r.header[4:8], page.offset)
+	img, err := tiff.Decode(io.NewSectionReader(r, 0, int64(len(data))))
+	if err != nil {
+		return nil, fmt.Errorf("raster: failed to decode TIFF page: %w", err)
+	}
+	return img, nil
+}
+
+// BMPResolution returns the horizontal resolution of a BMP in DPI, 0 when unknown.
+func BMPResolution(data []byte) int {
+	// the file header, then the size of the info header, which has the resolution from
+	// BITMAPINFOHEADER on
+	if len(data) < 46 || string(data[:2]) != "BM" || binary.LittleEndian.Uint32(data[14:18]) < 40 {
+		return 0
+	}
+	pixelsPerMetre := int32(binary.LittleEndian.Uint32(data[38:42]))
+	if pixelsPerMetre <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(pixelsPerMetre) * 0.0254))
+}
+
+// pageReader reads a TIFF with another header, without copying it.
+type pageReader struct {
+	data   []byte
+	header [8]byte
+}
+
+func (r *pageReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := bytes.NewReader(r.data).ReadAt(p, off)
+	for i := 0; i < n && off+int64(i) < int64(len(r.header)); i++ {
+		p[i] = r.header[off+int64(i)]
+	}
+	return n, err
+}
+
+func tiffHeader(data []byte) (binary.ByteOrder, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, errInvalidTIFF
+	}
+	var bo binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, 0, errInvalidTIFF
+	}
+	if bo.Uint16(data[2:4]) != 42 {
+		return nil, 0, errInvalidTIFF
+	}
+	return bo, bo.Uint32(data[4:8]), nil
+}
+
+// readIFD reads the image file directory at the offset, and returns the page it describes,
+// whether it is a reduced-resolution image, and the offset of the next directory.
+func readIFD(data []byte, bo binary.ByteOrder, offset uint32) (Page, bool, uint32, error) {
+	start := int64(offset)
+	if start+2 > int64(len(data)) {
+		return Page{}, false, 0, errInvalidTIFF
+	}
+	count := int64(bo.Uint16(data[start : start+2]))
+	end := start + 2 + count*12
+	if end+4 > int64(len(data)) {
+		return Page{}, false, 0, errInvalidTIFF
+	}
+
+	var (
+		page    Page
+		reduced bool
+		xres    float64
+		unit    uint32 = 2
+	)
+	for e := start + 2; e < end; e += 12 {
+		entry := data[e : e+12]
+		tag, typ := bo.Uint16(entry[0:2]), bo.Uint16(entry[2:4])
+		switch tag {
+		case tagNewSubfileType:
+			reduced = integer(bo, typ, entry)&subfileReducedImage != 0
+		case tagImageWidth:
+			page.Width = int(integer(bo, typ, entry))
+		case tagImageLength:
+			page.Height = int(integer(bo, typ, entry))
+		case tagResolutionUnit:
+			unit = integer(bo, typ, entry)
+		case tagXResolution:
+			if typ != typeRational {
+				continue
+			}
+			at := int64(bo.Uint32(entry[8:12]))
+			if at+8 > int64(len(data)) {
+				return Page{}, false, 0, errInvalidTIFF
+			}
+			if den := bo.Uint32(data[at+4 : at+8]); den != 0 {
+				xres = float64(bo.Uint32(data[at:at+4])) / float64(den)
+			}
+		}
+	}
+
+	switch unit {
+	case resolutionUnitNone:
+		xres = 0
+	case resolutionUnitCentimetre:
+		xres *= 2.54
+	}
+	page.DPI = int(math.Round(xres))
+	page.offset = offset
+	return page, reduced, bo.Uint32(data[end : end+4]), nil
+}
+
+// integer reads the value of an entry holding a single SHORT or LONG.
+func integer(bo binary.ByteOrder, typ uint16, entry []byte) uint32 {
+	switch typ {
+	case typeShort:
+		return uint32(bo.Uint16(entry[8:10]))
+	case typeLong:
+		return bo.Uint32(entry[8:12])
+	default:
+		return 0
+	}
+}
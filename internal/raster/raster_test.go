@@ -0,0 +1,155 @@
+package raster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+type testPage struct {
+	width, height int
+	shade         uint8
+	dpi           uint32
+	unit          uint16
+	reduced       bool
+}
+
+// multiPageTIFF builds a little-endian TIFF of uncompressed grey pages, each filled with its shade.
+func multiPageTIFF(pages ...testPage) []byte {
+	bo := binary.LittleEndian
+	buf := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	nextAt := 4
+	for _, p := range pages {
+		pixelsAt := len(buf)
+		buf = append(buf, bytes.Repeat([]byte{p.shade}, p.width*p.height)...)
+		if len(buf)%2 == 1 {
+			buf = append(buf, 0)
+		}
+		resAt := len(buf)
+		buf = bo.AppendUint32(buf, p.dpi)
+		buf = bo.AppendUint32(buf, 1)
+
+		ifdAt := len(buf)
+		bo.PutUint32(buf[nextAt:], uint32(ifdAt))
+		var subfile uint32
+		if p.reduced {
+			subfile = 1
+		}
+		entries := [][3]uint32{
+			{tagNewSubfileType, typeLong, subfile},
+			{tagImageWidth, typeShort, uint32(p.width)},
+			{tagImageLength, typeShort, uint32(p.height)},
+			{258, typeShort, 8},                         // BitsPerSample
+			{259, typeShort, 1},                         // Compression: none
+			{262, typeShort, 1},                         // PhotometricInterpretation: black is zero
+			{273, typeLong, uint32(pixelsAt)},           // StripOffsets
+			{277, typeShort, 1},                         // SamplesPerPixel
+			{278, typeShort, uint32(p.height)},          // RowsPerStrip
+			{279, typeLong, uint32(p.width * p.height)}, // StripByteCounts
+			{tagXResolution, typeRational, uint32(resAt)},
+			{tagResolutionUnit, typeShort, uint32(p.unit)},
+		}
+		buf = bo.AppendUint16(buf, uint16(len(entries)))
+		for _, e := range entries {
+			buf = bo.AppendUint16(buf, uint16(e[0]))
+			buf = bo.AppendUint16(buf, uint16(e[1]))
+			buf = bo.AppendUint32(buf, 1)
+			if e[1] == typeShort {
+				buf = bo.AppendUint16(buf, uint16(e[2]))
+				buf = append(buf, 0, 0)
+			} else {
+				buf = bo.AppendUint32(buf, e[2])
+			}
+		}
+		nextAt = len(buf)
+		buf = bo.AppendUint32(buf, 0)
+	}
+	return buf
+}
+
+func TestTIFFPages(t *testing.T) {
+	data := multiPageTIFF(
+		testPage{width: 4, height: 2, shade: 10, dpi: 300, unit: 2},
+		testPage{width: 2, height: 1, shade: 20, dpi: 300, unit: 2, reduced: true},
+		testPage{width: 3, height: 3, shade: 200, dpi: 118, unit: 3},
+	)
+
+	pages, err := TIFFPages(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages; want 2, without the thumbnail", len(pages))
+	}
+	if p := pages[0]; p.Width != 4 || p.Height != 2 || p.DPI != 300 {
+		t.Errorf("page 1 = %+v", p)
+	}
+	if p := pages[1]; p.Width != 3 || p.Height != 3 || p.DPI != 300 {
+		t.Errorf("page 2 = %+v; want 118 dots per centimetre as 300 DPI", p)
+	}
+
+	img, err := DecodeTIFFPage(data, pages[1])
+	if err != nil {
+		t.Fatalf("decode page 2: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 3, 3) {
+		t.Errorf("page 2 is %v; want 3x3", img.Bounds())
+	}
+	if got := color.GrayModel.Convert(img.At(1, 1)).(color.Gray).Y; got != 200 {
+		t.Errorf("page 2 shade = %d; want 200", got)
+	}
+}
+
+func TestTIFFPages_Encoded(t *testing.T) {
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, image.NewGray(image.Rect(0, 0, 5, 4)), nil); err != nil {
+		t.Fatalf("encode TIFF: %v", err)
+	}
+	pages, err := TIFFPages(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pages) != 1 || pages[0].Width != 5 || pages[0].Height != 4 || pages[0].DPI != 72 {
+		t.Errorf("pages = %+v", pages)
+	}
+}
+
+func TestTIFFPages_Invalid(t *testing.T) {
+	looping := multiPageTIFF(testPage{width: 1, height: 1, dpi: 72, unit: 2})
+	binary.LittleEndian.PutUint32(looping[len(looping)-4:], binary.LittleEndian.Uint32(looping[4:8]))
+
+	tests := map[string][]byte{
+		"not a TIFF": []byte("GIF89a not a TIFF"),
+		"truncated":  multiPageTIFF(testPage{width: 1, height: 1, dpi: 72, unit: 2})[:20],
+		"loop":       looping,
+	}
+	for name, data := range tests {
+		if _, err := TIFFPages(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestBMPResolution(t *testing.T) {
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("encode BMP: %v", err)
+	}
+	data := buf.Bytes()
+	if got := BMPResolution(data); got != 0 {
+		t.Errorf("BMPResolution = %d; want 0 when unset", got)
+	}
+
+	binary.LittleEndian.PutUint32(data[38:42], 11811) // pixels per metre
+	if got := BMPResolution(data); got != 300 {
+		t.Errorf("BMPResolution = %d; want 300", got)
+	}
+	if got := BMPResolution([]byte("not a bitmap")); got != 0 {
+		t.Errorf("BMPResolution = %d; want 0 for other files", got)
+	}
+}
@@ -5,13 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash/crc32"
+	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/port"
-	"github.com/fhuszti/medias-ms-go/internal/uuid"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
 )
 
+// PublicCacheTTL is how long the details of a media in a public bucket are cached.
+// Their URLs never expire, but the cache is bounded so that visibility changes apply.
+const PublicCacheTTL = 24 * time.Hour
+
 type httpRenderer struct {
 	cache port.Cache
 }
@@ -26,15 +30,19 @@ func NewHTTPRenderer(cache port.Cache) port.HTTPRenderer {
 
 // RenderGetMedia fetches media details either from cache or from the wrapped use
 // case. It returns the JSON encoded output and a quoted ETag string.
-func (r *httpRenderer) RenderGetMedia(ctx context.Context, getter port.MediaGetter, id uuid.UUID) ([]byte, string, error) {
+// Only the details shared by every user are cached: the cached ones listing variants with an
+// overlay are not returned to authenticated users, who may own the image and get its clean
+// variants instead.
+func (r *httpRenderer) RenderGetMedia(ctx context.Context, getter port.MediaGetter, in port.GetMediaInput) ([]byte, string, error) {
+	id := in.ID
 	raw, err := r.cache.GetMediaDetails(ctx, id)
 	etag, errEtag := r.cache.GetEtagMediaDetails(ctx, id)
-	if err == nil && errEtag == nil && raw != nil && etag != "" {
+	if err == nil && errEtag == nil && raw != nil && etag != "" && (in.UserID == nil || !hasWatermarkedVariants(raw)) {
 		logger.Infof(ctx, "http renderer used the cache to return details for media #%s", id)
 		return raw, etag, nil
 	}
 
-	out, err := getter.GetMedia(ctx, id)
+	out, err := getter.GetMedia(ctx, in)
 	if err != nil {
 		return nil, "", err
 	}
@@ -45,8 +53,40 @@ func (r *httpRenderer) RenderGetMedia(ctx context.Context, getter port.MediaGett
 	}
 
 	etag = fmt.Sprintf("\"%08x\"", crc32.ChecksumIEEE(raw))
-	r.cache.SetMediaDetails(ctx, id, raw, out.ValidUntil)
-	r.cache.SetEtagMediaDetails(ctx, id, etag, out.ValidUntil)
+	if out.Personal {
+		return raw, etag, nil
+	}
+	cacheUntil := cacheDeadline(out, time.Now())
+	r.cache.SetMediaDetails(ctx, id, raw, cacheUntil)
+	r.cache.SetEtagMediaDetails(ctx, id, etag, cacheUntil)
 
 	return raw, etag, nil
 }
+
+// hasWatermarkedVariants tells whether the encoded details list variants carrying an overlay.
+// Details that cannot be decoded are assumed to.
+func hasWatermarkedVariants(raw []byte) bool {
+	var out port.GetMediaOutput
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return true
+	}
+	for _, v := range out.Variants {
+		if v.Watermarked {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheDeadline returns until when the details of a media can be cached: as long as
+// its URLs are valid, or PublicCacheTTL for the stable URLs of public buckets.
+func cacheDeadline(out *port.GetMediaOutput, now time.Time) time.Time {
+	if !out.Public {
+		return out.ValidUntil
+	}
+	deadline := now.Add(PublicCacheTTL)
+	if out.ExpiresAt != nil && out.ExpiresAt.Before(deadline) {
+		deadline = *out.ExpiresAt
+	}
+	return deadline
+}
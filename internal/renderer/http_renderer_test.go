@@ -23,7 +23,7 @@ func TestRenderGetMedia_Cases(t *testing.T) {
 		r := NewHTTPRenderer(c)
 		getter := &mock.MediaGetter{}
 
-		out, etag, err := r.RenderGetMedia(ctx, getter, id)
+		out, etag, err := r.RenderGetMedia(ctx, getter, port.GetMediaInput{ID: id})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -48,7 +48,7 @@ func TestRenderGetMedia_Cases(t *testing.T) {
 		getter := &mock.MediaGetter{Out: resp}
 		r := NewHTTPRenderer(c)
 
-		out, etag, err := r.RenderGetMedia(ctx, getter, id)
+		out, etag, err := r.RenderGetMedia(ctx, getter, port.GetMediaInput{ID: id})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -79,7 +79,7 @@ func TestRenderGetMedia_Cases(t *testing.T) {
 		g := &mock.MediaGetter{Err: errors.New("fail")}
 		r := NewHTTPRenderer(c)
 
-		_, _, err := r.RenderGetMedia(ctx, g, id)
+		_, _, err := r.RenderGetMedia(ctx, g, port.GetMediaInput{ID: id})
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
@@ -98,7 +98,7 @@ func TestRenderGetMedia_Cases(t *testing.T) {
 		g := &mock.MediaGetter{Out: resp}
 		r := NewHTTPRenderer(c)
 
-		_, _, err := r.RenderGetMedia(ctx, g, id)
+		_, _, err := r.RenderGetMedia(ctx, g, port.GetMediaInput{ID: id})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -109,4 +109,67 @@ func TestRenderGetMedia_Cases(t *testing.T) {
 			t.Error("cache should be written when missing due to error")
 		}
 	})
+
+	t.Run("cached overlaid variants for an authenticated user", func(t *testing.T) {
+		userID := uuid.NewUUID()
+		c := &mock.Cache{MediaOut: []byte(`{"variants":[{"name":"300","watermarked":true}]}`), EtagMedia: "\"1234\""}
+		g := &mock.MediaGetter{Out: &port.GetMediaOutput{ValidUntil: time.Now().Add(time.Hour), Personal: true}}
+		r := NewHTTPRenderer(c)
+
+		if _, _, err := r.RenderGetMedia(ctx, g, port.GetMediaInput{ID: id, UserID: &userID}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !g.Called || g.In.UserID == nil || *g.In.UserID != userID {
+			t.Errorf("getter should be called with the user, got %+v", g.In)
+		}
+		if c.SetMediaCalled || c.SetEtagMediaCalled {
+			t.Error("the details personal to the owner should not be cached")
+		}
+	})
+
+	t.Run("cached clean variants for an authenticated user", func(t *testing.T) {
+		userID := uuid.NewUUID()
+		c := &mock.Cache{MediaOut: []byte(`{"variants":[{"name":"300"}]}`), EtagMedia: "\"1234\""}
+		g := &mock.MediaGetter{}
+		r := NewHTTPRenderer(c)
+
+		if _, _, err := r.RenderGetMedia(ctx, g, port.GetMediaInput{ID: id, UserID: &userID}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if g.Called {
+			t.Error("getter should not be called when the cached details are the same for every user")
+		}
+	})
+}
+
+func TestRenderGetMedia_CacheDeadline(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.NewUUID()
+	validUntil := time.Now().Add(time.Hour)
+	expiresAt := time.Now().Add(2 * time.Hour)
+
+	tests := []struct {
+		name string
+		out  *port.GetMediaOutput
+		min  time.Time
+		max  time.Time
+	}{
+		{"private", &port.GetMediaOutput{ValidUntil: validUntil}, validUntil, validUntil},
+		{"public", &port.GetMediaOutput{Public: true}, time.Now().Add(PublicCacheTTL - time.Minute), time.Now().Add(PublicCacheTTL + time.Minute)},
+		{"public expiring", &port.GetMediaOutput{Public: true, ValidUntil: expiresAt, ExpiresAt: &expiresAt}, expiresAt, expiresAt},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &mock.Cache{}
+			r := NewHTTPRenderer(c)
+
+			if _, _, err := r.RenderGetMedia(ctx, &mock.MediaGetter{Out: tc.out}, port.GetMediaInput{ID: id}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.ValidUntil.Before(tc.min) || c.ValidUntil.After(tc.max) {
+				t.Errorf("cached until %v; want between %v and %v", c.ValidUntil, tc.min, tc.max)
+			}
+		})
+	}
 }
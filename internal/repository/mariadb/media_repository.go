@@ -3,7 +3,11 @@ package mariadb
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
@@ -27,18 +31,19 @@ func (r *MediaRepository) GetByID(ctx context.Context, ID msuuid.UUID) (*model.M
 	logger.Debugf(ctx, "fetching media #%s from the database...", ID)
 
 	const query = `
-      SELECT id, object_key, bucket, original_filename, mime_type, size_bytes, status, optimised, failure_message, metadata, variants, created_at, updated_at
+      SELECT id, object_key, bucket, owner_id, original_filename, mime_type, size_bytes, original_object_key, original_size_bytes, status, optimised, failure_message, metadata, variants, version, derived_from, expires_at, deleted_at, created_at, updated_at
       FROM medias
       WHERE id = ?
     `
 	row := r.db.QueryRowContext(ctx, query, ID)
 	var media model.Media
 	if err := row.Scan(
-		&media.ID, &media.ObjectKey, &media.Bucket,
+		&media.ID, &media.ObjectKey, &media.Bucket, &media.OwnerID,
 		&media.OriginalFilename, &media.MimeType,
-		&media.SizeBytes, &media.Status, &media.Optimised,
+		&media.SizeBytes, &media.OriginalObjectKey, &media.OriginalSizeBytes,
+		&media.Status, &media.Optimised,
 		&media.FailureMessage, &media.Metadata, &media.Variants,
-		&media.CreatedAt, &media.UpdatedAt,
+		&media.Version, &media.DerivedFrom, &media.ExpiresAt, &media.DeletedAt, &media.CreatedAt, &media.UpdatedAt,
 	); err != nil {
 		return nil, err
 	}
@@ -51,14 +56,16 @@ func (r *MediaRepository) Create(ctx context.Context, media *model.Media) error
 
 	const query = `
       INSERT INTO medias 
-        (id, object_key, bucket, original_filename, mime_type, size_bytes, status, optimised, failure_message, metadata, variants)
-      VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        (id, object_key, bucket, owner_id, original_filename, mime_type, size_bytes, original_object_key, original_size_bytes, status, optimised, failure_message, metadata, variants, version, derived_from, expires_at, deleted_at)
+      VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
 	_, err := r.db.ExecContext(ctx, query,
-		media.ID, media.ObjectKey, media.Bucket,
+		media.ID, media.ObjectKey, media.Bucket, media.OwnerID,
 		media.OriginalFilename, media.MimeType,
-		media.SizeBytes, media.Status, media.Optimised,
+		media.SizeBytes, media.OriginalObjectKey, media.OriginalSizeBytes,
+		media.Status, media.Optimised,
 		media.FailureMessage, media.Metadata, media.Variants,
+		media.Version, media.DerivedFrom, media.ExpiresAt, media.DeletedAt,
 	)
 	if err != nil {
 		return err
@@ -77,11 +84,16 @@ func (r *MediaRepository) Update(ctx context.Context, media *model.Media) error
         bucket     		= ?,
         mime_type       = ?,
         size_bytes      = ?,
+        original_object_key = ?,
+        original_size_bytes = ?,
         status          = ?,
         optimised       = ?,
         failure_message = ?,
         metadata        = ?,
-        variants        = ?
+        variants        = ?,
+        version         = ?,
+        expires_at      = ?,
+        deleted_at      = ?
       WHERE id = ?
     `
 	_, err := r.db.ExecContext(ctx, query,
@@ -89,11 +101,16 @@ func (r *MediaRepository) Update(ctx context.Context, media *model.Media) error
 		media.Bucket,
 		media.MimeType,
 		media.SizeBytes,
+		media.OriginalObjectKey,
+		media.OriginalSizeBytes,
 		media.Status,
 		media.Optimised,
 		media.FailureMessage,
 		media.Metadata,
 		media.Variants,
+		media.Version,
+		media.ExpiresAt,
+		media.DeletedAt,
 		media.ID, // WHERE clause
 	)
 	if err != nil {
@@ -176,3 +193,252 @@ func (r *MediaRepository) ListOptimisedImagesNoVariantsBefore(ctx context.Contex
 	}
 	return ids, nil
 }
+
+func (r *MediaRepository) ListDeletedBefore(ctx context.Context, bucket string, before time.Time) ([]msuuid.UUID, error) {
+	logger.Debugf(ctx, "fetching medias deleted from bucket %q before %s...", bucket, before)
+
+	const query = `
+      SELECT id FROM medias
+      WHERE status = ?
+        AND bucket = ?
+        AND deleted_at <= ?
+    `
+	rows, err := r.db.QueryContext(ctx, query, model.MediaStatusDeleted, bucket, before)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			logger.Warnf(ctx, "rows close error: %v", cerr)
+		}
+	}()
+
+	var ids []msuuid.UUID
+	for rows.Next() {
+		var id msuuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *MediaRepository) ListExpiredBefore(ctx context.Context, before time.Time) ([]msuuid.UUID, error) {
+	logger.Debugf(ctx, "fetching medias expired before %s...", before)
+
+	const query = `
+      SELECT id FROM medias
+      WHERE expires_at IS NOT NULL
+        AND expires_at <= ?
+    `
+	rows, err := r.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			logger.Warnf(ctx, "rows close error: %v", cerr)
+		}
+	}()
+
+	var ids []msuuid.UUID
+	for rows.Next() {
+		var id msuuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *MediaRepository) ListCompletedImagesAfter(ctx context.Context, after msuuid.UUID, limit int) ([]msuuid.UUID, error) {
+	logger.Debugf(ctx, "fetching up to %d images after #%s...", limit, after)
+
+	const query = `
+      SELECT id FROM medias
+      WHERE status = ?
+        AND mime_type LIKE 'image/%'
+        AND id > ?
+      ORDER BY id
+      LIMIT ?
+    `
+	rows, err := r.db.QueryContext(ctx, query, model.MediaStatusCompleted, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			logger.Warnf(ctx, "rows close error: %v", cerr)
+		}
+	}()
+
+	var ids []msuuid.UUID
+	for rows.Next() {
+		var id msuuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *MediaRepository) ReplaceReferences(ctx context.Context, ID msuuid.UUID, referencedIDs []msuuid.UUID) error {
+	logger.Debugf(ctx, "recording %d references of media #%s...", len(referencedIDs), ID)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+			logger.Warnf(ctx, "rollback error: %v", rerr)
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media_references WHERE media_id = ?`, ID); err != nil {
+		return err
+	}
+	for _, referencedID := range referencedIDs {
+		const query = `INSERT IGNORE INTO media_references (media_id, referenced_id) VALUES (?, ?)`
+		if _, err := tx.ExecContext(ctx, query, ID, referencedID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *MediaRepository) ListReferencing(ctx context.Context, ID msuuid.UUID) ([]msuuid.UUID, error) {
+	logger.Debugf(ctx, "fetching medias referencing media #%s...", ID)
+
+	const query = `
+      SELECT m.id FROM media_references mr
+      JOIN medias m ON m.id = mr.media_id
+      WHERE mr.referenced_id = ?
+        AND mr.media_id != mr.referenced_id
+        AND m.status != ?
+      ORDER BY m.id
+    `
+	rows, err := r.db.QueryContext(ctx, query, ID, model.MediaStatusDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			logger.Warnf(ctx, "rows close error: %v", cerr)
+		}
+	}()
+
+	var ids []msuuid.UUID
+	for rows.Next() {
+		var id msuuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *MediaRepository) SaveText(ctx context.Context, ID msuuid.UUID, content string) error {
+	logger.Debugf(ctx, "indexing %d bytes of text of media #%s...", len(content), ID)
+
+	const query = `
+      INSERT INTO media_texts (media_id, content)
+      VALUES (?, ?)
+      ON DUPLICATE KEY UPDATE content = VALUES(content)
+    `
+	_, err := r.db.ExecContext(ctx, query, ID, content)
+	return err
+}
+
+func (r *MediaRepository) SearchTexts(ctx context.Context, search model.TextSearch) ([]model.TextMatch, error) {
+	logger.Debugf(ctx, "searching the text of medias for %q...", search.Query)
+
+	conditions := []string{
+		"MATCH (t.content) AGAINST (? IN NATURAL LANGUAGE MODE)",
+		"m.status = ?",
+		"(m.expires_at IS NULL OR m.expires_at > ?)",
+	}
+	// only an excerpt of the texts is fetched, around the first of the terms they contain
+	excerptStart, startArgs := "1", []any{}
+	excerptLength := 2 * search.ExcerptRadius
+	if len(search.Terms) > 0 {
+		quoted := make([]string, len(search.Terms))
+		longest := 0
+		for i, term := range search.Terms {
+			quoted[i] = regexp.QuoteMeta(term)
+			longest = max(longest, utf8.RuneCountInString(term))
+		}
+		excerptStart = "GREATEST(1, REGEXP_INSTR(t.content, ?) - ?)"
+		startArgs = []any{"(?i)" + strings.Join(quoted, "|"), search.ExcerptRadius}
+		excerptLength += longest
+	}
+
+	// the start of the excerpt is selected as well, to tell whether the text goes on before it
+	args := append([]any{}, startArgs...)
+	args = append(args, excerptLength)
+	args = append(args, startArgs...)
+	args = append(args, search.Query, search.Query, model.MediaStatusCompleted, time.Now())
+	if search.Bucket != "" {
+		conditions = append(conditions, "m.bucket = ?")
+		args = append(args, search.Bucket)
+	}
+	if search.OwnerID != nil {
+		conditions = append(conditions, "m.owner_id = ?")
+		args = append(args, *search.OwnerID)
+	}
+	args = append(args, search.Limit)
+
+	query := `
+      SELECT m.id, m.bucket, m.original_filename, m.mime_type,
+        SUBSTRING(t.content, ` + excerptStart + `, ?) AS excerpt,
+        ` + excerptStart + ` AS excerpt_start,
+        CHAR_LENGTH(t.content) AS content_length,
+        MATCH (t.content) AGAINST (? IN NATURAL LANGUAGE MODE) AS score
+      FROM media_texts t
+      JOIN medias m ON m.id = t.media_id
+      WHERE ` + strings.Join(conditions, "\n        AND ") + `
+      ORDER BY score DESC
+      LIMIT ?
+    `
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			logger.Warnf(ctx, "rows close error: %v", cerr)
+		}
+	}()
+
+	var matches []model.TextMatch
+	for rows.Next() {
+		var m model.TextMatch
+		var start, length int
+		if err := rows.Scan(&m.MediaID, &m.Bucket, &m.OriginalFilename, &m.MimeType, &m.Excerpt, &start, &length, &m.Score); err != nil {
+			return nil, err
+		}
+		m.TextBefore = start > 1
+		m.TextAfter = start-1+utf8.RuneCountInString(m.Excerpt) < length
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
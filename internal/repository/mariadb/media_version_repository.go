@@ -0,0 +1,108 @@
+package mariadb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type MediaVersionRepository struct {
+	db *sql.DB
+}
+
+// compile-time check: *MediaVersionRepository must satisfy port.MediaVersionRepository
+var _ port.MediaVersionRepository = (*MediaVersionRepository)(nil)
+
+func NewMediaVersionRepository(db *sql.DB) *MediaVersionRepository {
+	return &MediaVersionRepository{db: db}
+}
+
+func (r *MediaVersionRepository) Create(ctx context.Context, version *model.MediaVersion) error {
+	logger.Debugf(ctx, "creating database record for version %d of media #%s...", version.Version, version.MediaID)
+
+	const query = `
+      INSERT INTO media_versions
+        (media_id, version, object_key, mime_type, size_bytes, original_object_key, original_size_bytes, optimised, metadata, variants)
+      VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `
+	_, err := r.db.ExecContext(ctx, query,
+		version.MediaID, version.Version, version.ObjectKey,
+		version.MimeType, version.SizeBytes,
+		version.OriginalObjectKey, version.OriginalSizeBytes, version.Optimised,
+		version.Metadata, version.Variants,
+	)
+	return err
+}
+
+func (r *MediaVersionRepository) Get(ctx context.Context, mediaID msuuid.UUID, version int) (*model.MediaVersion, error) {
+	logger.Debugf(ctx, "fetching version %d of media #%s from the database...", version, mediaID)
+
+	const query = `
+      SELECT media_id, version, object_key, mime_type, size_bytes, original_object_key, original_size_bytes, optimised, metadata, variants, created_at
+      FROM media_versions
+      WHERE media_id = ? AND version = ?
+    `
+	row := r.db.QueryRowContext(ctx, query, mediaID, version)
+	var v model.MediaVersion
+	if err := row.Scan(
+		&v.MediaID, &v.Version, &v.ObjectKey,
+		&v.MimeType, &v.SizeBytes,
+		&v.OriginalObjectKey, &v.OriginalSizeBytes, &v.Optimised,
+		&v.Metadata, &v.Variants, &v.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func (r *MediaVersionRepository) ListByMediaID(ctx context.Context, mediaID msuuid.UUID) ([]model.MediaVersion, error) {
+	logger.Debugf(ctx, "fetching versions of media #%s from the database...", mediaID)
+
+	const query = `
+      SELECT media_id, version, object_key, mime_type, size_bytes, original_object_key, original_size_bytes, optimised, metadata, variants, created_at
+      FROM media_versions
+      WHERE media_id = ?
+      ORDER BY version DESC
+    `
+	rows, err := r.db.QueryContext(ctx, query, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := rows.Close(); cerr != nil {
+			logger.Warnf(ctx, "rows close error: %v", cerr)
+		}
+	}()
+
+	var versions []model.MediaVersion
+	for rows.Next() {
+		var v model.MediaVersion
+		if err := rows.Scan(
+			&v.MediaID, &v.Version, &v.ObjectKey,
+			&v.MimeType, &v.SizeBytes,
+			&v.OriginalObjectKey, &v.OriginalSizeBytes, &v.Optimised,
+			&v.Metadata, &v.Variants, &v.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (r *MediaVersionRepository) Delete(ctx context.Context, mediaID msuuid.UUID, version int) error {
+	logger.Debugf(ctx, "deleting version %d of media #%s from the database...", version, mediaID)
+
+	const query = `DELETE FROM media_versions WHERE media_id = ? AND version = ?`
+	_, err := r.db.ExecContext(ctx, query, mediaID, version)
+	return err
+}
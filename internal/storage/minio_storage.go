@@ -3,14 +3,18 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/tags"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
 )
@@ -34,7 +38,14 @@ func NewStorage(endpoint, accessKey, secretKey string, useSSL bool) (*Strg, erro
 	return &Strg{client}, nil
 }
 
-func (s *Strg) InitBucket(bucket string) error {
+// publicReadPolicy lets anyone get the objects of a bucket, without listing them, except the
+// withdrawn ones. It is formatted with the bucket, then port.WithdrawnTag.
+const publicReadPolicy = `{"Version":"2012-10-17","Statement":[` +
+	`{"Effect":"Allow","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::%[1]s/*"]},` +
+	`{"Effect":"Deny","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::%[1]s/*"],` +
+	`"Condition":{"StringEquals":{"s3:ExistingObjectTag/%[2]s":["true"]}}}]}`
+
+func (s *Strg) InitBucket(bucket string, public bool) error {
 	ok, err := s.Client.BucketExists(context.Background(), bucket)
 	if err != nil {
 		return mapMinioErr(err)
@@ -45,13 +56,23 @@ func (s *Strg) InitBucket(bucket string) error {
 			return mapMinioErr(err)
 		}
 	}
+
+	// an empty policy removes the public access of buckets turned back to private
+	policy := ""
+	if public {
+		logger.Infof(context.Background(), "making bucket %q publicly readable...", bucket)
+		policy = fmt.Sprintf(publicReadPolicy, bucket, port.WithdrawnTag)
+	}
+	if err := s.Client.SetBucketPolicy(context.Background(), bucket, policy); err != nil {
+		return mapMinioErr(err)
+	}
 	return nil
 }
 
-func (s *Strg) GeneratePresignedDownloadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration) (string, error) {
+func (s *Strg) GeneratePresignedDownloadURL(ctx context.Context, bucket, fileKey string, expiry time.Duration, reqParams url.Values) (string, error) {
 	logger.Debugf(ctx, "generating a presigned download link for file %q in bucket %q...", fileKey, bucket)
 
-	presignedURL, err := s.Client.PresignedGetObject(ctx, bucket, fileKey, expiry, url.Values{})
+	presignedURL, err := s.Client.PresignedGetObject(ctx, bucket, fileKey, expiry, reqParams)
 	if err != nil {
 		return "", mapMinioErr(err)
 	}
@@ -90,9 +111,17 @@ func (s *Strg) StatFile(ctx context.Context, bucket, fileKey string) (port.FileI
 	if err != nil {
 		return port.FileInfo{}, mapMinioErr(err)
 	}
+
 	return port.FileInfo{
-		SizeBytes:   info.Size,
-		ContentType: info.ContentType,
+		SizeBytes:          info.Size,
+		ContentType:        info.ContentType,
+		ETag:               info.ETag,
+		LastModified:       info.LastModified,
+		CacheControl:       info.Metadata.Get("Cache-Control"),
+		ContentDisposition: info.Metadata.Get("Content-Disposition"),
+		ContentEncoding:    info.Metadata.Get("Content-Encoding"),
+		Metadata:           info.UserMetadata,
+		TagCount:           info.UserTagCount,
 	}, nil
 }
 
@@ -113,21 +142,78 @@ func (s *Strg) GetFile(ctx context.Context, bucket, fileKey string) (io.ReadSeek
 	return obj, nil
 }
 
+func (s *Strg) GetFileRange(ctx context.Context, bucket, fileKey string, offset, length int64) (io.ReadCloser, error) {
+	logger.Debugf(ctx, "getting %d bytes at offset %d of file %q from bucket %q...", length, offset, fileKey, bucket)
+
+	if offset < 0 || length < 1 {
+		return nil, fmt.Errorf("%w: invalid range of %d bytes at offset %d", media.ErrInternal, length, offset)
+	}
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, mapMinioErr(err)
+	}
+
+	obj, err := s.Client.GetObject(ctx, bucket, fileKey, opts)
+	if err != nil {
+		return nil, mapMinioErr(err)
+	}
+	return obj, nil
+}
+
 func (s *Strg) SaveFile(ctx context.Context, bucket, fileKey string, reader io.Reader, fileSize int64, opts map[string]string) error {
 	logger.Debugf(ctx, "saving file %q into bucket %q...", fileKey, bucket)
 
-	putOpts := minio.PutObjectOptions{}
-	if ct := opts["Content-Type"]; ct != "" {
-		putOpts.ContentType = ct
+	putOpts, err := putObjectOptions(opts)
+	if err != nil {
+		return err
 	}
 
-	_, err := s.Client.PutObject(ctx, bucket, fileKey, reader, fileSize, putOpts)
+	_, err = s.Client.PutObject(ctx, bucket, fileKey, reader, fileSize, putOpts)
 	if err != nil {
 		return mapMinioErr(err)
 	}
 	return nil
 }
 
+// putObjectOptions maps the options of SaveFile to the ones of minio. Unknown options are
+// rejected rather than silently dropped.
+func putObjectOptions(opts map[string]string) (minio.PutObjectOptions, error) {
+	putOpts := minio.PutObjectOptions{}
+	for key, value := range opts {
+		if value == "" {
+			continue
+		}
+		key = http.CanonicalHeaderKey(key)
+		switch {
+		case key == "Content-Type":
+			putOpts.ContentType = value
+		case key == "Cache-Control":
+			putOpts.CacheControl = value
+		case key == "Content-Disposition":
+			putOpts.ContentDisposition = value
+		case key == "Content-Encoding":
+			putOpts.ContentEncoding = value
+		case key == port.TaggingOption:
+			values, err := url.ParseQuery(value)
+			if err != nil {
+				return minio.PutObjectOptions{}, fmt.Errorf("%w: invalid tags %q: %v", media.ErrInternal, value, err)
+			}
+			putOpts.UserTags = make(map[string]string, len(values))
+			for k := range values {
+				putOpts.UserTags[k] = values.Get(k)
+			}
+		case strings.HasPrefix(key, port.MetadataOptionPrefix) && len(key) > len(port.MetadataOptionPrefix):
+			if putOpts.UserMetadata == nil {
+				putOpts.UserMetadata = make(map[string]string)
+			}
+			putOpts.UserMetadata[strings.TrimPrefix(key, port.MetadataOptionPrefix)] = value
+		default:
+			return minio.PutObjectOptions{}, fmt.Errorf("%w: unsupported option %q", media.ErrInternal, key)
+		}
+	}
+	return putOpts, nil
+}
+
 func (s *Strg) CopyFile(ctx context.Context, bucket, srcKey, destKey string) error {
 	logger.Debugf(ctx, "copying file %q to %q inside bucket %q...", srcKey, destKey, bucket)
 
@@ -146,3 +232,26 @@ func (s *Strg) CopyFile(ctx context.Context, bucket, srcKey, destKey string) err
 	}
 	return nil
 }
+
+func (s *Strg) GetFileTags(ctx context.Context, bucket, fileKey string) (map[string]string, error) {
+	logger.Debugf(ctx, "getting the tags of file %q in bucket %q...", fileKey, bucket)
+
+	t, err := s.Client.GetObjectTagging(ctx, bucket, fileKey, minio.GetObjectTaggingOptions{})
+	if err != nil {
+		return nil, mapMinioErr(err)
+	}
+	return t.ToMap(), nil
+}
+
+func (s *Strg) SetFileTags(ctx context.Context, bucket, fileKey string, objectTags map[string]string) error {
+	logger.Debugf(ctx, "tagging file %q in bucket %q...", fileKey, bucket)
+
+	t, err := tags.NewTags(objectTags, true)
+	if err != nil {
+		return fmt.Errorf("%w: invalid tags: %v", media.ErrInternal, err)
+	}
+	if err := s.Client.PutObjectTagging(ctx, bucket, fileKey, t, minio.PutObjectTaggingOptions{}); err != nil {
+		return mapMinioErr(err)
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -12,17 +14,21 @@ import (
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	"github.com/fhuszti/medias-ms-go/internal/usecase/media"
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
 )
 
 type mockMinio struct {
 	bucketExistsFn       func(ctx context.Context, bucketName string) (bool, error)
 	makeBucketFn         func(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) (err error)
+	setBucketPolicyFn    func(ctx context.Context, bucketName, policy string) error
 	removeBucketFn       func(ctx context.Context, bucketName string) error
 	listObjectsFn        func(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
 	removeObjectFn       func(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
-	presignedGetObjectFn func(ctx context.Context, bucket, key string, expiry time.Duration) (*url.URL, error)
+	presignedGetObjectFn func(ctx context.Context, bucket, key string, expiry time.Duration, reqParams url.Values) (*url.URL, error)
 	presignedPutObjectFn func(ctx context.Context, bucket, key string, expiry time.Duration) (*url.URL, error)
 	statObjectFn         func(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	getObjectTaggingFn   func(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error)
+	putObjectTaggingFn   func(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error
 	getObjectFn          func(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error)
 	putObjectFn          func(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
 	copyObjectFn         func(ctx context.Context, dst minio.CopyDestOptions, src minio.CopySrcOptions) (minio.UploadInfo, error)
@@ -37,6 +43,9 @@ func (m *mockMinio) BucketExists(ctx context.Context, bucketName string) (bool,
 func (m *mockMinio) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) (err error) {
 	return m.makeBucketFn(ctx, bucketName, opts)
 }
+func (m *mockMinio) SetBucketPolicy(ctx context.Context, bucketName, policy string) error {
+	return m.setBucketPolicyFn(ctx, bucketName, policy)
+}
 func (m *mockMinio) RemoveBucket(ctx context.Context, bucketName string) error {
 	return m.removeBucketFn(ctx, bucketName)
 }
@@ -47,7 +56,7 @@ func (m *mockMinio) RemoveObject(ctx context.Context, bucketName, objectName str
 	return m.removeObjectFn(ctx, bucketName, objectName, opts)
 }
 func (m *mockMinio) PresignedGetObject(ctx context.Context, bucket, key string, expiry time.Duration, reqParams url.Values) (*url.URL, error) {
-	return m.presignedGetObjectFn(ctx, bucket, key, expiry)
+	return m.presignedGetObjectFn(ctx, bucket, key, expiry, reqParams)
 }
 func (m *mockMinio) PresignedPutObject(ctx context.Context, bucket, key string, expiry time.Duration) (*url.URL, error) {
 	return m.presignedPutObjectFn(ctx, bucket, key, expiry)
@@ -55,6 +64,12 @@ func (m *mockMinio) PresignedPutObject(ctx context.Context, bucket, key string,
 func (m *mockMinio) StatObject(ctx context.Context, bucket, key string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
 	return m.statObjectFn(ctx, bucket, key, opts)
 }
+func (m *mockMinio) GetObjectTagging(ctx context.Context, bucketName, objectName string, opts minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+	return m.getObjectTaggingFn(ctx, bucketName, objectName, opts)
+}
+func (m *mockMinio) PutObjectTagging(ctx context.Context, bucketName, objectName string, otags *tags.Tags, opts minio.PutObjectTaggingOptions) error {
+	return m.putObjectTaggingFn(ctx, bucketName, objectName, otags, opts)
+}
 func (m *mockMinio) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
 	return m.putObjectFn(ctx, bucketName, objectName, reader, objectSize, opts)
 }
@@ -72,9 +87,12 @@ func TestInitBucket(t *testing.T) {
 	tests := []struct {
 		name           string
 		exists         bool
+		public         bool
 		existsErr      error
 		makeErr        error
+		policyErr      error
 		wantMakeCalled bool
+		wantPolicy     string
 		wantErr        error
 	}{
 		{
@@ -87,6 +105,25 @@ func TestInitBucket(t *testing.T) {
 			exists:         false,
 			wantMakeCalled: true,
 		},
+		{
+			name:       "public bucket gets a read-only policy",
+			exists:     true,
+			public:     true,
+			wantPolicy: `"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::my-bucket/*"]`,
+		},
+		{
+			name:       "public bucket refuses withdrawn objects",
+			exists:     true,
+			public:     true,
+			wantPolicy: `"Effect":"Deny","Principal":{"AWS":["*"]},"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::my-bucket/*"],"Condition":{"StringEquals":{"s3:ExistingObjectTag/withdrawn":["true"]}}`,
+		},
+		{
+			name:      "SetBucketPolicy error bubbles up",
+			exists:    true,
+			public:    true,
+			policyErr: errors.New("policy fail"),
+			wantErr:   media.ErrInternal,
+		},
 		{
 			name:      "BucketExists error bubbles up",
 			existsErr: errors.New("exist fail"),
@@ -104,6 +141,7 @@ func TestInitBucket(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			makeCalled := false
+			policy := "unset"
 
 			mock := &mockMinio{
 				bucketExistsFn: func(ctx context.Context, bucketName string) (bool, error) {
@@ -113,10 +151,14 @@ func TestInitBucket(t *testing.T) {
 					makeCalled = true
 					return tc.makeErr
 				},
+				setBucketPolicyFn: func(ctx context.Context, bucketName, p string) error {
+					policy = p
+					return tc.policyErr
+				},
 			}
 
 			strg := &Strg{Client: mock}
-			err := strg.InitBucket("my-bucket")
+			err := strg.InitBucket("my-bucket", tc.public)
 
 			if tc.wantErr != nil {
 				if err == nil {
@@ -134,6 +176,10 @@ func TestInitBucket(t *testing.T) {
 			if makeCalled != tc.wantMakeCalled {
 				t.Errorf("MakeBucket called = %v; want %v", makeCalled, tc.wantMakeCalled)
 			}
+			// private buckets get their policy removed
+			if (tc.wantPolicy == "" && policy != "") || !strings.Contains(policy, tc.wantPolicy) {
+				t.Errorf("policy = %q; want it to contain %q", policy, tc.wantPolicy)
+			}
 		})
 	}
 }
@@ -141,7 +187,10 @@ func TestInitBucket(t *testing.T) {
 func TestGeneratePresignedDownloadURL(t *testing.T) {
 	fake, _ := url.Parse("https://cdn.example.com/download")
 	mock := &mockMinio{
-		presignedGetObjectFn: func(_ context.Context, bucket, key string, expiry time.Duration) (*url.URL, error) {
+		presignedGetObjectFn: func(_ context.Context, bucket, key string, expiry time.Duration, reqParams url.Values) (*url.URL, error) {
+			if got := reqParams.Get("response-content-disposition"); got != `inline; filename="a.bin"` {
+				t.Errorf("response-content-disposition = %q; want it passed through", got)
+			}
 			if bucket != "bucket" {
 				t.Errorf("bucket = %q; want %q", bucket, "bucket")
 			}
@@ -156,7 +205,9 @@ func TestGeneratePresignedDownloadURL(t *testing.T) {
 	}
 	s := makeStorage(mock)
 
-	out, err := s.GeneratePresignedDownloadURL(context.Background(), "bucket", "obj.bin", 5*time.Minute)
+	out, err := s.GeneratePresignedDownloadURL(context.Background(), "bucket", "obj.bin", 5*time.Minute, url.Values{
+		"response-content-disposition": {`inline; filename="a.bin"`},
+	})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -167,13 +218,13 @@ func TestGeneratePresignedDownloadURL(t *testing.T) {
 
 func TestGeneratePresignedDownloadURL_Error(t *testing.T) {
 	mock := &mockMinio{
-		presignedGetObjectFn: func(_ context.Context, _, _ string, _ time.Duration) (*url.URL, error) {
+		presignedGetObjectFn: func(_ context.Context, _, _ string, _ time.Duration, _ url.Values) (*url.URL, error) {
 			return nil, errors.New("fail-put")
 		},
 	}
 	s := makeStorage(mock)
 
-	_, err := s.GeneratePresignedDownloadURL(context.Background(), "bucket", "k", time.Minute)
+	_, err := s.GeneratePresignedDownloadURL(context.Background(), "bucket", "k", time.Minute, nil)
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -280,8 +331,10 @@ func TestObjectExists(t *testing.T) {
 func TestStatFile_Success(t *testing.T) {
 	ctx := context.Background()
 	expected := minio.ObjectInfo{
-		Size:        123,
-		ContentType: "image/png",
+		Size:         123,
+		ContentType:  "image/png",
+		ETag:         "abc123",
+		LastModified: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
 	}
 	mock := &mockMinio{
 		statObjectFn: func(_ context.Context, bucket, key string, _ minio.StatObjectOptions) (minio.ObjectInfo, error) {
@@ -305,6 +358,77 @@ func TestStatFile_Success(t *testing.T) {
 	if fi.ContentType != expected.ContentType {
 		t.Errorf("ContentType = %q; want %q", fi.ContentType, expected.ContentType)
 	}
+	if fi.ETag != expected.ETag || !fi.LastModified.Equal(expected.LastModified) {
+		t.Errorf("ETag, LastModified = %q, %v; want %q, %v", fi.ETag, fi.LastModified, expected.ETag, expected.LastModified)
+	}
+}
+
+func TestStatFile_HeadersMetadataAndTags(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockMinio{
+		statObjectFn: func(_ context.Context, _, _ string, _ minio.StatObjectOptions) (minio.ObjectInfo, error) {
+			return minio.ObjectInfo{
+				Metadata: http.Header{
+					"Cache-Control":       {"public, max-age=60"},
+					"Content-Disposition": {`inline; filename="a.txt"`},
+					"Content-Encoding":    {"gzip"},
+				},
+				UserMetadata: minio.StringMap{"Media-Id": "42"},
+				UserTagCount: 1,
+			}, nil
+		},
+		getObjectTaggingFn: func(context.Context, string, string, minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+			t.Error("the tags should only be read on demand")
+			return nil, nil
+		},
+	}
+	s := makeStorage(mock)
+	fi, err := s.StatFile(ctx, "bucket", "f.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fi.CacheControl != "public, max-age=60" || fi.ContentDisposition != `inline; filename="a.txt"` || fi.ContentEncoding != "gzip" {
+		t.Errorf("unexpected headers %q, %q, %q", fi.CacheControl, fi.ContentDisposition, fi.ContentEncoding)
+	}
+	if !reflect.DeepEqual(fi.Metadata, map[string]string{"Media-Id": "42"}) {
+		t.Errorf("Metadata = %v; want Media-Id", fi.Metadata)
+	}
+	if fi.TagCount != 1 {
+		t.Errorf("TagCount = %d; want 1", fi.TagCount)
+	}
+}
+
+func TestGetFileTags_Success(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockMinio{
+		getObjectTaggingFn: func(_ context.Context, bucket, key string, _ minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+			if bucket != "bucket" || key != "f.txt" {
+				t.Errorf("tags read from %q/%q; want bucket/f.txt", bucket, key)
+			}
+			return tags.NewTags(map[string]string{"team": "blog"}, true)
+		},
+	}
+	s := makeStorage(mock)
+	got, err := s.GetFileTags(ctx, "bucket", "f.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, map[string]string{"team": "blog"}) {
+		t.Errorf("tags = %v; want team=blog", got)
+	}
+}
+
+func TestGetFileTags_NotFound(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockMinio{
+		getObjectTaggingFn: func(context.Context, string, string, minio.GetObjectTaggingOptions) (*tags.Tags, error) {
+			return nil, minio.ErrorResponse{Code: "NoSuchKey"}
+		},
+	}
+	s := makeStorage(mock)
+	if _, err := s.GetFileTags(ctx, "bucket", "f.txt"); !errors.Is(err, media.ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
 }
 
 func TestStatFile_NotFound(t *testing.T) {
@@ -414,13 +538,19 @@ func TestSaveFile_Success(t *testing.T) {
 	}
 	s := makeStorage(mock)
 	content := "hello"
-	err := s.SaveFile(ctx, "dest", "obj", strings.NewReader(content), int64(len(content)), map[string]string{"Content-Type": "text/plain"})
+	err := s.SaveFile(ctx, "dest", "obj", strings.NewReader(content), int64(len(content)), map[string]string{
+		"Content-Type":  "text/plain",
+		"Cache-Control": "public, max-age=31536000, immutable",
+	})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if gotSize != int64(len(content)) {
 		t.Errorf("size = %d; want %d", gotSize, len(content))
 	}
+	if gotOpts.CacheControl != "public, max-age=31536000, immutable" {
+		t.Errorf("CacheControl = %q; want the immutable one", gotOpts.CacheControl)
+	}
 	if gotOpts.ContentType != "text/plain" {
 		t.Errorf("ContentType = %q; want %q", gotOpts.ContentType, "text/plain")
 	}
@@ -434,6 +564,57 @@ func TestSaveFile_Success(t *testing.T) {
 	}
 }
 
+func TestSaveFile_MetadataAndTags(t *testing.T) {
+	ctx := context.Background()
+	var gotOpts minio.PutObjectOptions
+	mock := &mockMinio{
+		putObjectFn: func(_ context.Context, _, _ string, _ io.Reader, _ int64, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+			gotOpts = opts
+			return minio.UploadInfo{}, nil
+		},
+	}
+	s := makeStorage(mock)
+	err := s.SaveFile(ctx, "bucket", "k", nil, 0, map[string]string{
+		"content-disposition": `attachment; filename="a.txt"`,
+		"Content-Encoding":    "gzip",
+		"X-Amz-Meta-Media-Id": "42",
+		"x-amz-meta-owner":    "me",
+		"X-Amz-Tagging":       "team=blog&tier=hot",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotOpts.ContentDisposition != `attachment; filename="a.txt"` || gotOpts.ContentEncoding != "gzip" {
+		t.Errorf("unexpected headers %q, %q", gotOpts.ContentDisposition, gotOpts.ContentEncoding)
+	}
+	if !reflect.DeepEqual(gotOpts.UserMetadata, map[string]string{"Media-Id": "42", "Owner": "me"}) {
+		t.Errorf("UserMetadata = %v", gotOpts.UserMetadata)
+	}
+	if !reflect.DeepEqual(gotOpts.UserTags, map[string]string{"team": "blog", "tier": "hot"}) {
+		t.Errorf("UserTags = %v", gotOpts.UserTags)
+	}
+}
+
+func TestSaveFile_InvalidOptions(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockMinio{
+		putObjectFn: func(_ context.Context, _, _ string, _ io.Reader, _ int64, _ minio.PutObjectOptions) (minio.UploadInfo, error) {
+			t.Error("nothing should be saved with invalid options")
+			return minio.UploadInfo{}, nil
+		},
+	}
+	s := makeStorage(mock)
+	for _, opts := range []map[string]string{
+		{"Expires": "tomorrow"},
+		{"X-Amz-Tagging": "team=%zz"},
+	} {
+		err := s.SaveFile(ctx, "bucket", "k", nil, 0, opts)
+		if !errors.Is(err, media.ErrInternal) {
+			t.Errorf("SaveFile(%v) error = %v; want ErrInternal", opts, err)
+		}
+	}
+}
+
 func TestSaveFile_NoContentType(t *testing.T) {
 	ctx := context.Background()
 	var gotOpts minio.PutObjectOptions
@@ -531,6 +712,61 @@ func TestGetFile_OtherError(t *testing.T) {
 	}
 }
 
+func TestGetFileRange_Success(t *testing.T) {
+	ctx := context.Background()
+	dummy := &minio.Object{}
+	mock := &mockMinio{
+		getObjectFn: func(_ context.Context, bucket, key string, opts minio.GetObjectOptions) (*minio.Object, error) {
+			if bucket != "bucket" || key != "key" {
+				t.Errorf("bucket, key = %q, %q; want bucket, key", bucket, key)
+			}
+			if got := opts.Header().Get("Range"); got != "bytes=10-29" {
+				t.Errorf("Range = %q; want %q", got, "bytes=10-29")
+			}
+			return dummy, nil
+		},
+	}
+	s := makeStorage(mock)
+	rc, err := s.GetFileRange(ctx, "bucket", "key", 10, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rc != dummy {
+		t.Errorf("reader = %v; want %v", rc, dummy)
+	}
+}
+
+func TestGetFileRange_InvalidRange(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockMinio{
+		getObjectFn: func(_ context.Context, _, _ string, _ minio.GetObjectOptions) (*minio.Object, error) {
+			t.Error("GetObject should not be called")
+			return nil, nil
+		},
+	}
+	s := makeStorage(mock)
+	for _, r := range [][2]int64{{-1, 10}, {0, 0}} {
+		if _, err := s.GetFileRange(ctx, "bucket", "k", r[0], r[1]); !errors.Is(err, media.ErrInternal) {
+			t.Errorf("range %v: err = %v; want ErrInternal", r, err)
+		}
+	}
+}
+
+func TestGetFileRange_NotFound(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockMinio{
+		getObjectFn: func(_ context.Context, _, _ string, _ minio.GetObjectOptions) (*minio.Object, error) {
+			e := minio.ToErrorResponse(errors.New("missing"))
+			e.Code = "NoSuchKey"
+			return nil, e
+		},
+	}
+	s := makeStorage(mock)
+	if _, err := s.GetFileRange(ctx, "bucket", "k", 0, 5); !errors.Is(err, media.ErrObjectNotFound) {
+		t.Fatalf("err = %v; want ErrObjectNotFound", err)
+	}
+}
+
 func TestCopyFile_Success(t *testing.T) {
 	ctx := context.Background()
 	called := false
@@ -591,3 +827,35 @@ func TestCopyFile_OtherError(t *testing.T) {
 		t.Fatalf("err = %v; want ErrInternal", err)
 	}
 }
+
+func TestSetFileTags_Success(t *testing.T) {
+	var got map[string]string
+	mock := &mockMinio{
+		putObjectTaggingFn: func(_ context.Context, bucket, key string, otags *tags.Tags, _ minio.PutObjectTaggingOptions) error {
+			if bucket != "bucket" || key != "file" {
+				t.Errorf("tagged %s/%s; want bucket/file", bucket, key)
+			}
+			got = otags.ToMap()
+			return nil
+		},
+	}
+	want := map[string]string{"team": "blog", port.WithdrawnTag: "true"}
+	if err := makeStorage(mock).SetFileTags(context.Background(), "bucket", "file", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v; want %v", got, want)
+	}
+}
+
+func TestSetFileTags_NotFound(t *testing.T) {
+	mock := &mockMinio{
+		putObjectTaggingFn: func(context.Context, string, string, *tags.Tags, minio.PutObjectTaggingOptions) error {
+			return minio.ErrorResponse{Code: "NoSuchKey"}
+		},
+	}
+	err := makeStorage(mock).SetFileTags(context.Background(), "bucket", "file", map[string]string{})
+	if !errors.Is(err, media.ErrObjectNotFound) {
+		t.Errorf("error = %v; want ErrObjectNotFound", err)
+	}
+}
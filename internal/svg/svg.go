@@ -0,0 +1,348 @@
+// Package svg makes SVG documents safe to serve as is, minifies them, and reads their viewBox.
+// The sanitizer keeps an allowlist of elements: anything else, such as scripts or
+// foreignObject, is dropped along with its content.
+package svg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const namespace = "http://www.w3.org/2000/svg"
+
+var (
+	// ErrInvalid is returned for documents that are not well-formed XML with an svg root.
+	ErrInvalid = errors.New("svg: invalid SVG")
+	// ErrNoViewBox is returned for documents with neither a viewBox nor an absolute size.
+	ErrNoViewBox = errors.New("svg: no viewBox")
+)
+
+// elements are the SVG elements kept by the sanitizer: shapes, text, paint servers and
+// filters, without scripts, links, animations, fonts nor foreign content.
+var elements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "symbol": true, "use": true, "switch": true,
+	"title": true, "desc": true, "style": true, "image": true,
+	"path": true, "rect": true, "circle": true, "ellipse": true, "line": true, "polyline": true, "polygon": true,
+	"text": true, "tspan": true, "textPath": true,
+	"linearGradient": true, "radialGradient": true, "stop": true, "pattern": true,
+	"clipPath": true, "mask": true, "marker": true,
+	"filter": true, "feBlend": true, "feColorMatrix": true, "feComponentTransfer": true, "feComposite": true,
+	"feConvolveMatrix": true, "feDiffuseLighting": true, "feDisplacementMap": true, "feDistantLight": true,
+	"feDropShadow": true, "feFlood": true, "feFuncA": true, "feFuncB": true, "feFuncG": true, "feFuncR": true,
+	"feGaussianBlur": true, "feMerge": true, "feMergeNode": true, "feMorphology": true, "feOffset": true,
+	"fePointLight": true, "feSpecularLighting": true, "feSpotLight": true, "feTile": true, "feTurbulence": true,
+}
+
+// textElements hold text in which whitespace matters.
+var textElements = map[string]bool{"title": true, "desc": true, "style": true, "text": true, "tspan": true, "textPath": true}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// embeddedImages are the data URIs the image element may show.
+var embeddedImages = []string{"data:image/png", "data:image/jpeg", "data:image/gif", "data:image/webp"}
+
+// Box is the area of its user space an SVG shows.
+type Box struct {
+	MinX, MinY    float64
+	Width, Height float64
+}
+
+// Sanitize returns the SVG without what could run code or load anything from outside the
+// document once served: elements missing from the allowlist along with their content, event
+// handlers, links that do not point within the document, external CSS, processing instructions
+// and the DOCTYPE with its entities.
+func Sanitize(data []byte) ([]byte, error) {
+	return clean(data, false)
+}
+
+// Minify sanitizes the SVG as Sanitize does, and also leaves out comments, the whitespace
+// between elements and the repeated whitespace of attributes.
+func Minify(data []byte) ([]byte, error) {
+	return clean(data, true)
+}
+
+// frame is an element being copied.
+type frame struct {
+	// name is the raw name of the element, to match its end tag
+	name string
+	// drop is set for the elements left out, and everything within them
+	drop bool
+	// style holds a style element, which is only written once its CSS is known to be safe
+	style *style
+}
+
+// style is a style element being read.
+type style struct {
+	tag []byte
+	css bytes.Buffer
+}
+
+func clean(data []byte, minify bool) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+
+	var (
+		out   bytes.Buffer
+		stack []frame
+		// the last start tag is left open, so it can be closed as empty
+		open bool
+		root bool
+	)
+	closeOpen := func() {
+		if open {
+			out.WriteByte('>')
+			open = false
+		}
+	}
+
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := rawName(t.Name)
+			if len(stack) == 0 {
+				if root || name != "svg" {
+					return nil, ErrInvalid
+				}
+				root = true
+			}
+			parent := frame{}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			if parent.drop || parent.style != nil || !elements[name] {
+				stack = append(stack, frame{name: name, drop: true})
+				continue
+			}
+
+			var tag bytes.Buffer
+			tag.WriteString("<" + name)
+			if len(stack) == 0 {
+				tag.WriteString(` xmlns="` + namespace + `"`)
+			}
+			written := make(map[string]bool, len(t.Attr))
+			for _, attr := range t.Attr {
+				// href and xlink:href are both written as href, the first one wins
+				if key, value, ok := keepAttr(name, attr, minify); ok && !written[key] {
+					written[key] = true
+					tag.WriteString(" " + key + `="` + attrEscaper.Replace(value) + `"`)
+				}
+			}
+
+			if name == "style" {
+				stack = append(stack, frame{name: name, style: &style{tag: tag.Bytes()}})
+				continue
+			}
+			closeOpen()
+			out.Write(tag.Bytes())
+			open = true
+			stack = append(stack, frame{name: name})
+
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != rawName(t.Name) {
+				return nil, ErrInvalid
+			}
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			switch {
+			case f.drop:
+			case f.style != nil:
+				if safeCSS(f.style.css.String()) {
+					closeOpen()
+					out.Write(f.style.tag)
+					out.WriteByte('>')
+					out.WriteString(textEscaper.Replace(f.style.css.String()))
+					out.WriteString("</style>")
+				}
+			case open:
+				out.WriteString("/>")
+				open = false
+			default:
+				out.WriteString("</" + f.name + ">")
+			}
+
+		case xml.CharData:
+			if len(stack) == 0 || stack[len(stack)-1].drop {
+				continue
+			}
+			f := stack[len(stack)-1]
+			if f.style != nil {
+				f.style.css.Write(t)
+				continue
+			}
+			if minify && !textElements[f.name] && len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			closeOpen()
+			out.WriteString(textEscaper.Replace(string(t)))
+
+		case xml.Comment:
+			if minify || len(stack) == 0 || stack[len(stack)-1].drop || stack[len(stack)-1].style != nil {
+				continue
+			}
+			closeOpen()
+			out.WriteString("<!--" + strings.ReplaceAll(string(t), "--", "- -") + "-->")
+
+		default:
+			// processing instructions, including the XML declaration, and the DOCTYPE
+		}
+	}
+
+	if !root || len(stack) != 0 {
+		return nil, ErrInvalid
+	}
+	return out.Bytes(), nil
+}
+
+// keepAttr returns the attribute as it is written, unless it is left out.
+func keepAttr(element string, attr xml.Attr, minify bool) (string, string, bool) {
+	key := rawName(attr.Name)
+	switch {
+	case key == "xlink:href":
+		// without the xlink namespace, which is not declared on the sanitized document
+		key = "href"
+	case key == "xml:space":
+	case attr.Name.Space != "" || attr.Name.Local == "xmlns":
+		// namespace declarations and attributes of other namespaces, such as editors'
+		return "", "", false
+	}
+
+	value := attr.Value
+	if minify {
+		value = strings.Join(strings.Fields(value), " ")
+	}
+	lower := strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case strings.HasPrefix(strings.ToLower(key), "on"):
+		return "", "", false
+	case key == "href":
+		if strings.HasPrefix(lower, "#") {
+			return key, value, true
+		}
+		if element == "image" {
+			for _, prefix := range embeddedImages {
+				if strings.HasPrefix(lower, prefix+";") || strings.HasPrefix(lower, prefix+",") {
+					return key, value, true
+				}
+			}
+		}
+		return "", "", false
+	case !safeCSS(value):
+		// style, but also presentation attributes such as fill="url(...)"
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// safeCSS tells whether the CSS only refers to the document itself. Escapes are refused, as
+// they could hide any of what is looked for.
+func safeCSS(css string) bool {
+	lower := strings.ToLower(css)
+	for _, unsafe := range []string{`\`, "@import", "expression(", "javascript:", "image-set(", "-moz-binding", "behavior:"} {
+		if strings.Contains(lower, unsafe) {
+			return false
+		}
+	}
+	for rest := lower; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return true
+		}
+		rest = strings.TrimLeft(rest[i+len("url("):], " \t\r\n\f'\"")
+		if !strings.HasPrefix(rest, "#") {
+			return false
+		}
+	}
+}
+
+// ViewBox reads the viewBox of the SVG, or its width and height when it has none.
+func ViewBox(data []byte) (Box, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return Box{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if rawName(start.Name) != "svg" {
+			return Box{}, ErrInvalid
+		}
+
+		var viewBox, width, height string
+		for _, attr := range start.Attr {
+			switch rawName(attr.Name) {
+			case "viewBox":
+				viewBox = attr.Value
+			case "width":
+				width = attr.Value
+			case "height":
+				height = attr.Value
+			}
+		}
+		if box, ok := parseViewBox(viewBox); ok {
+			return box, nil
+		}
+		w, wOK := parseLength(width)
+		h, hOK := parseLength(height)
+		if wOK && hOK {
+			return Box{Width: w, Height: h}, nil
+		}
+		return Box{}, ErrNoViewBox
+	}
+}
+
+// parseViewBox parses the four numbers of a viewBox, separated by whitespace or commas.
+func parseViewBox(s string) (Box, bool) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r' })
+	if len(fields) != 4 {
+		return Box{}, false
+	}
+	var v [4]float64
+	for i, field := range fields {
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return Box{}, false
+		}
+		v[i] = f
+	}
+	if v[2] <= 0 || v[3] <= 0 {
+		return Box{}, false
+	}
+	return Box{MinX: v[0], MinY: v[1], Width: v[2], Height: v[3]}, true
+}
+
+// parseLength parses a width or height in pixels, with or without its unit. Relative lengths
+// such as percentages have no size on their own.
+func parseLength(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 64)
+	if err != nil || f <= 0 {
+		return 0, false
+	}
+	return f, true
+}
+
+func rawName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
@@ -0,0 +1,135 @@
+package svg
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]struct {
+		in   string
+		want string
+	}{
+		"kept as is": {
+			`<svg viewBox="0 0 24 24"><path d="M0 0h24v24H0z" fill="#f00"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><path d="M0 0h24v24H0z" fill="#f00"/></svg>`,
+		},
+		"scripts": {
+			`<svg><script>alert(1)</script><g><script href="https://evil.test/x.js"/></g></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><g/></svg>`,
+		},
+		"event handlers": {
+			`<svg onload="alert(1)"><rect width="1" height="1" ONCLICK="alert(1)"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><rect width="1" height="1"/></svg>`,
+		},
+		"foreign content": {
+			`<svg><foreignObject><div xmlns="http://www.w3.org/1999/xhtml"><img src="x" onerror="alert(1)"/></div></foreignObject></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"/>`,
+		},
+		"links and animations": {
+			`<svg><a href="javascript:alert(1)"><text>click</text></a><set attributeName="href" to="javascript:alert(1)"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"/>`,
+		},
+		"references": {
+			`<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="#icon"/><use href="https://evil.test/sprite.svg#icon"/><image href="data:image/png;base64,AAAA"/><image href="data:image/svg+xml;base64,AAAA"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><use href="#icon"/><use/><image href="data:image/png;base64,AAAA"/><image/></svg>`,
+		},
+		"external CSS": {
+			`<svg><style>@import url(https://evil.test/x.css);</style><style>.a{fill:url(#g)}</style><rect style="fill:url('https://evil.test/x')"/><rect fill="url( #g)"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><style>.a{fill:url(#g)}</style><rect/><rect fill="url( #g)"/></svg>`,
+		},
+		"escaped CSS": {
+			`<svg><rect style="fill:\75rl(https://evil.test/x)"/></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><rect/></svg>`,
+		},
+		"namespaces": {
+			`<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"><g inkscape:label="layer" xml:space="preserve"><inkscape:grid/></g></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><g xml:space="preserve"/></svg>`,
+		},
+		"prolog": {
+			`<?xml version="1.0"?><?xml-stylesheet href="https://evil.test/x.css"?><!DOCTYPE svg [<!ENTITY a "b">]><svg><!-- made by hand --><text>1 &lt; 2 &amp; "ok"</text></svg>`,
+			`<svg xmlns="http://www.w3.org/2000/svg"><!-- made by hand --><text>1 &lt; 2 &amp; "ok"</text></svg>`,
+		},
+	}
+	for name, tc := range tests {
+		got, err := Sanitize([]byte(tc.in))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", name, got, tc.want)
+		}
+	}
+}
+
+func TestSanitize_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not XML":        "not an svg",
+		"another root":   `<html><svg/></html>`,
+		"two roots":      `<svg/><svg/>`,
+		"mismatched end": `<svg><g></svg></g>`,
+		"truncated":      `<svg><g>`,
+		"custom entity":  `<!DOCTYPE svg [<!ENTITY a "b">]><svg><text>&a;</text></svg>`,
+	}
+	for name, in := range tests {
+		if _, err := Sanitize([]byte(in)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestMinify(t *testing.T) {
+	in := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Generator: an editor -->
+<svg viewBox="0 0 24 24" onload="alert(1)">
+  <g>
+    <path d="M0 0
+             L24 24"/>
+    <text> a  <tspan>b</tspan></text>
+  </g>
+</svg>
+`
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24"><g><path d="M0 0 L24 24"/><text> a  <tspan>b</tspan></text></g></svg>`
+
+	got, err := Minify([]byte(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("\n got %s\nwant %s", got, want)
+	}
+	if len(got) >= len(in) {
+		t.Errorf("minified to %d bytes from %d", len(got), len(in))
+	}
+}
+
+func TestViewBox(t *testing.T) {
+	tests := map[string]Box{
+		`<svg viewBox="-2 -2 24,12"/>`:                         {MinX: -2, MinY: -2, Width: 24, Height: 12},
+		`<svg viewBox="0 0 16 16" width="100%" height="32"/>`:  {Width: 16, Height: 16},
+		`<?xml version="1.0"?><svg width="48px" height="24"/>`: {Width: 48, Height: 24},
+		`<svg viewBox="0 0 0 10" width="20" height="10"/>`:     {Width: 20, Height: 10},
+	}
+	for in, want := range tests {
+		got, err := ViewBox([]byte(in))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %+v; want %+v", in, got, want)
+		}
+	}
+
+	if _, err := ViewBox([]byte(`<svg width="100%"/>`)); !errors.Is(err, ErrNoViewBox) {
+		t.Errorf("expected ErrNoViewBox, got %v", err)
+	}
+	if _, err := ViewBox([]byte(strings.Repeat(" ", 3))); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for an empty document, got %v", err)
+	}
+	if _, err := ViewBox([]byte(`<html/>`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected ErrInvalid for another root, got %v", err)
+	}
+}
@@ -41,3 +41,25 @@ func (d *Dispatcher) EnqueueResizeImage(ctx context.Context, id uuid.UUID) error
 	}
 	return nil
 }
+
+func (d *Dispatcher) EnqueueReconcileImage(ctx context.Context, id uuid.UUID) error {
+	t, err := NewReconcileImageTask(id.String())
+	if err != nil {
+		return err
+	}
+	if _, err := d.client.EnqueueContext(ctx, t); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Dispatcher) EnqueueDerivePDF(ctx context.Context, id uuid.UUID) error {
+	t, err := NewDerivePDFTask(id.String())
+	if err != nil {
+		return err
+	}
+	if _, err := d.client.EnqueueContext(ctx, t); err != nil {
+		return err
+	}
+	return nil
+}
@@ -20,3 +20,11 @@ func (d *NoopDispatcher) EnqueueOptimiseMedia(ctx context.Context, id uuid.UUID)
 func (d *NoopDispatcher) EnqueueResizeImage(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
+
+func (d *NoopDispatcher) EnqueueReconcileImage(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (d *NoopDispatcher) EnqueueDerivePDF(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
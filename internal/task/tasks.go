@@ -9,15 +9,23 @@ import (
 
 const TypeOptimiseMedia = "media:optimise"
 const TypeResizeImage = "image:resize"
+const TypePurgeTrash = "trash:purge"
+const TypePurgeExpired = "media:purge_expired"
+const TypeDerivePDF = "pdf:derive"
 
 type OptimiseMediaPayload struct {
 	ID string `json:"id" validate:"required,uuid"`
 }
 
-type ResizeImagePayload struct {
+type DerivePDFPayload struct {
 	ID string `json:"id" validate:"required,uuid"`
 }
 
+type ResizeImagePayload struct {
+	ID        string `json:"id" validate:"required,uuid"`
+	Reconcile bool   `json:"reconcile,omitempty"`
+}
+
 // NewOptimiseMediaTask creates an Asynq task for optimising a media by ID.
 func NewOptimiseMediaTask(id string) (*asynq.Task, error) {
 	p := OptimiseMediaPayload{ID: id}
@@ -47,6 +55,16 @@ func NewResizeImageTask(id string) (*asynq.Task, error) {
 	return asynq.NewTask(TypeResizeImage, data), nil
 }
 
+// NewReconcileImageTask creates an Asynq task for generating only the missing variants of an image.
+func NewReconcileImageTask(id string) (*asynq.Task, error) {
+	p := ResizeImagePayload{ID: id, Reconcile: true}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal resize-image payload: %w", err)
+	}
+	return asynq.NewTask(TypeResizeImage, data), nil
+}
+
 // ParseResizeImagePayload parses the task payload to ResizeImagePayload.
 func ParseResizeImagePayload(t *asynq.Task) (ResizeImagePayload, error) {
 	var p ResizeImagePayload
@@ -55,3 +73,32 @@ func ParseResizeImagePayload(t *asynq.Task) (ResizeImagePayload, error) {
 	}
 	return p, nil
 }
+
+// NewDerivePDFTask creates an Asynq task for building the file of a media derived from other PDFs.
+func NewDerivePDFTask(id string) (*asynq.Task, error) {
+	p := DerivePDFPayload{ID: id}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal derive-pdf payload: %w", err)
+	}
+	return asynq.NewTask(TypeDerivePDF, data), nil
+}
+
+// ParseDerivePDFPayload parses the task payload to DerivePDFPayload.
+func ParseDerivePDFPayload(t *asynq.Task) (DerivePDFPayload, error) {
+	var p DerivePDFPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return DerivePDFPayload{}, fmt.Errorf("could not unmarshal payload: %w", err)
+	}
+	return p, nil
+}
+
+// NewPurgeTrashTask creates an Asynq task for purging the medias whose trash retention is over.
+func NewPurgeTrashTask() *asynq.Task {
+	return asynq.NewTask(TypePurgeTrash, nil)
+}
+
+// NewPurgeExpiredTask creates an Asynq task for purging the medias whose expiry date has passed.
+func NewPurgeExpiredTask() *asynq.Task {
+	return asynq.NewTask(TypePurgeExpired, nil)
+}
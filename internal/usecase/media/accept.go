@@ -0,0 +1,101 @@
+package media
+
+import (
+	"strconv"
+	"strings"
+)
+
+// acceptRange is a media range of an Accept header, such as "image/*;q=0.8".
+type acceptRange struct {
+	mainType string
+	subType  string
+	q        float64
+}
+
+// acceptRanges are the media ranges a client accepts. No ranges at all means anything goes.
+type acceptRanges []acceptRange
+
+// parseAccept parses the value of an Accept header, skipping the malformed ranges.
+func parseAccept(header string) acceptRanges {
+	var ranges acceptRanges
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mainType, subType, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || mainType == "" || subType == "" {
+			continue
+		}
+
+		ranges = append(ranges, acceptRange{mainType: mainType, subType: subType, q: parseQuality(params[1:])})
+	}
+	return ranges
+}
+
+// parseQuality reads the q parameter of an Accept or Accept-Encoding element, 1 by default.
+func parseQuality(params []string) float64 {
+	q := 1.0
+	for _, param := range params {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		if strings.ToLower(key) != "q" {
+			continue
+		}
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 && v <= 1 {
+			q = v
+		}
+	}
+	return q
+}
+
+// quality returns how much the client wants the MIME type, from 0 (not acceptable) to 1.
+// The most specific matching range wins, as in RFC 9110.
+func (ranges acceptRanges) quality(mimeType string) float64 {
+	if len(ranges) == 0 {
+		return 1
+	}
+	mainType, subType, _ := strings.Cut(strings.ToLower(mimeType), "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.mainType == mainType && r.subType == subType:
+			s = 2
+		case r.mainType == mainType && r.subType == "*":
+			s = 1
+		case r.mainType == "*" && r.subType == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// preferredEncoding returns the first of the given content encodings the Accept-Encoding header
+// gives the best quality, or "" when the client accepts none of them. A missing header is not
+// taken as accepting anything, as the file as is always works.
+func preferredEncoding(header string, encodings []string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		qualities[coding] = parseQuality(params[1:])
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,56 @@
+package media
+
+import "testing"
+
+func TestAcceptQuality(t *testing.T) {
+	tests := []struct {
+		header   string
+		mimeType string
+		want     float64
+	}{
+		{"", "image/webp", 1},
+		{"image/webp,image/*;q=0.8", "image/webp", 1},
+		{"image/webp,image/*;q=0.8", "image/jpeg", 0.8},
+		{"image/png, */*;q=0.1", "image/jpeg", 0.1},
+		{"image/png", "image/jpeg", 0},
+		{"image/*;q=0.8, image/webp;q=0", "image/webp", 0},
+		{"IMAGE/JPEG; Q=0.5", "image/jpeg", 0.5},
+		{"image/jpeg;q=abc", "image/jpeg", 1},
+		{"garbage, image/png", "image/png", 1},
+		{"text/html", "image/png", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.header+"→"+tc.mimeType, func(t *testing.T) {
+			if got := parseAccept(tc.header).quality(tc.mimeType); got != tc.want {
+				t.Errorf("quality = %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPreferredEncoding(t *testing.T) {
+	encodings := []string{"br", "gzip"}
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"GZIP;Q=0.8", "gzip"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.header, func(t *testing.T) {
+			if got := preferredEncoding(tc.header, encodings); got != tc.want {
+				t.Errorf("preferredEncoding(%q) = %q; want %q", tc.header, got, tc.want)
+			}
+		})
+	}
+}
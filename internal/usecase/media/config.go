@@ -10,10 +10,20 @@ const MaxFileSize = 10 * 1024 * 1024 // 10 MB
 
 const DownloadUrlTTL = 2 * time.Hour
 
+// ImmutableCacheControl is set on content-addressed files, whose content never changes under a given key.
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// OriginalsPrefix is where the pristine uploads are kept, in buckets configured to keep them.
+const OriginalsPrefix = "originals/"
+
 var AllowedMimeTypes = map[string]bool{
 	"image/png":       true,
 	"image/jpeg":      true,
+	"image/gif":       true,
 	"image/webp":      true,
+	"image/tiff":      true,
+	"image/bmp":       true,
+	"image/svg+xml":   true,
 	"application/pdf": true,
 	"text/markdown":   true,
 }
@@ -28,8 +38,16 @@ func MimeTypeToExtension(mimeType string) (string, error) {
 		return ".png", nil
 	case "image/jpeg":
 		return ".jpg", nil
+	case "image/gif":
+		return ".gif", nil
 	case "image/webp":
 		return ".webp", nil
+	case "image/tiff":
+		return ".tiff", nil
+	case "image/bmp":
+		return ".bmp", nil
+	case "image/svg+xml":
+		return ".svg", nil
 	case "application/pdf":
 		return ".pdf", nil
 	case "text/markdown":
@@ -40,7 +58,23 @@ func MimeTypeToExtension(mimeType string) (string, error) {
 }
 
 func IsImage(mimeType string) bool {
-	return mimeType == "image/png" || mimeType == "image/jpeg" || mimeType == "image/webp"
+	return IsWebImage(mimeType) || mimeType == "image/tiff" || mimeType == "image/bmp"
+}
+
+// IsWebImage reports whether browsers display the image, so it can be kept as is when
+// re-encoding it does not make it smaller.
+func IsWebImage(mimeType string) bool {
+	return mimeType == "image/png" || mimeType == "image/jpeg" || mimeType == "image/gif" || mimeType == "image/webp"
+}
+
+// IsTIFF reports whether the image is a TIFF, which may hold several pages.
+func IsTIFF(mimeType string) bool {
+	return mimeType == "image/tiff"
+}
+
+// IsSVG reports whether the file is an SVG. SVGs are not decoded as images, but drawn.
+func IsSVG(mimeType string) bool {
+	return mimeType == "image/svg+xml"
 }
 
 func IsPdf(mimeType string) bool {
@@ -50,3 +84,8 @@ func IsPdf(mimeType string) bool {
 func IsMarkdown(mimeType string) bool {
 	return mimeType == "text/markdown"
 }
+
+// IsText reports whether the file is text, stored along with compressed copies.
+func IsText(mimeType string) bool {
+	return IsMarkdown(mimeType)
+}
@@ -0,0 +1,66 @@
+package media
+
+import (
+	"context"
+	"encoding/hex"
+	"path"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// contentHashLength is how many hex characters of the SHA-256 of a file end up in its key.
+const contentHashLength = 16
+
+// contentKey returns the content-addressed key of a file under dir, from the SHA-256 of its content.
+func contentKey(dir string, sum []byte, ext string) string {
+	return path.Join(dir, hex.EncodeToString(sum)[:contentHashLength]+ext)
+}
+
+// referencedKeys lists the files the media points at.
+func referencedKeys(media *model.Media) map[string]struct{} {
+	keys := map[string]struct{}{media.ObjectKey: {}}
+	if media.OriginalObjectKey != nil {
+		keys[*media.OriginalObjectKey] = struct{}{}
+	}
+	for _, v := range media.Variants {
+		keys[v.ObjectKey] = struct{}{}
+	}
+	return keys
+}
+
+// removeStaleFiles removes files the media used to point at. It must only be called once the
+// database points at the new ones, and skips the files the media or its versions still
+// reference, as content-addressed keys are shared by files with the same content. Nothing is
+// removed when the versions cannot be listed.
+func removeStaleFiles(ctx context.Context, strg port.Storage, versions port.MediaVersionRepository, media *model.Media, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	list, err := versions.ListByMediaID(ctx, media.ID)
+	if err != nil {
+		logger.Warnf(ctx, "failed listing the versions of media #%s, keeping its stale files: %v", media.ID, err)
+		return
+	}
+	referenced := referencedKeys(media)
+	for _, version := range list {
+		referenced[version.ObjectKey] = struct{}{}
+		if version.OriginalObjectKey != nil {
+			referenced[*version.OriginalObjectKey] = struct{}{}
+		}
+		for _, v := range version.Variants {
+			referenced[v.ObjectKey] = struct{}{}
+		}
+	}
+	for _, key := range keys {
+		if _, ok := referenced[key]; ok {
+			continue
+		}
+		referenced[key] = struct{}{}
+		if err := strg.RemoveFile(ctx, media.Bucket, key); err != nil {
+			logger.Warnf(ctx, "failed to remove stale file %q from bucket %q: %v", key, media.Bucket, err)
+		}
+	}
+}
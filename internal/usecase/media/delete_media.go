@@ -4,7 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 
@@ -12,28 +16,117 @@ import (
 )
 
 type deleteMediaSrv struct {
-	repo  port.MediaRepository
-	cache port.Cache
-	strg  port.Storage
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	cache    port.Cache
+	strg     port.Storage
 }
 
 // compile-time check: *deleteMediaSrv must satisfy port.MediaDeleter
 var _ port.MediaDeleter = (*deleteMediaSrv)(nil)
 
 // NewMediaDeleter constructs a MediaDeleter implementation.
-func NewMediaDeleter(repo port.MediaRepository, cache port.Cache, strg port.Storage) port.MediaDeleter {
-	return &deleteMediaSrv{repo: repo, cache: cache, strg: strg}
+func NewMediaDeleter(repo port.MediaRepository, versions port.MediaVersionRepository, cache port.Cache, strg port.Storage) port.MediaDeleter {
+	return &deleteMediaSrv{repo: repo, versions: versions, cache: cache, strg: strg}
 }
 
-// DeleteMedia removes the file from storage, deletes DB record and clears the cache.
+// DeleteMedia moves a completed media to the trash and clears the cache, unless other medias link
+// to it. Its files are withdrawn, so public buckets stop serving them until it is restored.
+// Medias that never completed have nothing worth restoring, so they are purged right away.
 func (s *deleteMediaSrv) DeleteMedia(ctx context.Context, id msuuid.UUID) error {
+	media, err := s.getMedia(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	switch media.Status {
+	case model.MediaStatusDeleted:
+		return nil
+	case model.MediaStatusCompleted:
+	default:
+		return s.purge(ctx, media)
+	}
+
+	referencing, err := s.repo.ListReferencing(ctx, media.ID)
+	if err != nil {
+		return err
+	}
+	if len(referencing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMediaReferenced, joinIDs(referencing))
+	}
+
+	keys, err := mediaFileKeys(ctx, s.versions, media)
+	if err != nil {
+		return err
+	}
+	if err := setWithdrawn(ctx, s.strg, media.Bucket, keys, true); err != nil {
+		revertWithdrawn(ctx, s.strg, media, keys, false)
+		return err
+	}
+
+	now := time.Now()
+	media.Status = model.MediaStatusDeleted
+	media.DeletedAt = &now
+
+	if err := s.repo.Update(ctx, media); err != nil {
+		revertWithdrawn(ctx, s.strg, media, keys, false)
+		return err
+	}
+
+	s.clearCache(ctx, media.ID)
+
+	return nil
+}
+
+// PurgeMedia removes the files of every version from storage, deletes DB record and clears the cache.
+// Medias still linked to are purged all the same, as they are past their retention or expiry.
+func (s *deleteMediaSrv) PurgeMedia(ctx context.Context, id msuuid.UUID) error {
+	media, err := s.getMedia(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if referencing, err := s.repo.ListReferencing(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed listing the medias referencing media #%s: %v", media.ID, err)
+	} else if len(referencing) > 0 {
+		logger.Warnf(ctx, "purging media #%s, still referenced by %s", media.ID, joinIDs(referencing))
+	}
+
+	return s.purge(ctx, media)
+}
+
+func (s *deleteMediaSrv) getMedia(ctx context.Context, id msuuid.UUID) (*model.Media, error) {
 	media, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return ErrObjectNotFound
+			return nil, ErrObjectNotFound
 		}
+		return nil, err
+	}
+	return media, nil
+}
+
+func (s *deleteMediaSrv) purge(ctx context.Context, media *model.Media) error {
+	versions, err := s.versions.ListByMediaID(ctx, media.ID)
+	if err != nil {
 		return err
 	}
+	// version records go away with the media, only their files need removing
+	for _, version := range versions {
+		for _, v := range version.Variants {
+			if err := s.strg.RemoveFile(ctx, media.Bucket, v.ObjectKey); err != nil {
+				logger.Warnf(ctx, "failed to remove variant %q: %v", v.ObjectKey, err)
+			}
+		}
+		if version.OriginalObjectKey != nil {
+			if err := s.strg.RemoveFile(ctx, media.Bucket, *version.OriginalObjectKey); err != nil {
+				logger.Warnf(ctx, "failed to remove version %d original %q: %v", version.Version, *version.OriginalObjectKey, err)
+			}
+		}
+		if err := s.strg.RemoveFile(ctx, media.Bucket, version.ObjectKey); err != nil {
+			logger.Warnf(ctx, "failed to remove version %d file %q: %v", version.Version, version.ObjectKey, err)
+		}
+	}
 
 	for _, v := range media.Variants {
 		if err := s.strg.RemoveFile(ctx, media.Bucket, v.ObjectKey); err != nil {
@@ -41,6 +134,12 @@ func (s *deleteMediaSrv) DeleteMedia(ctx context.Context, id msuuid.UUID) error
 		}
 	}
 
+	if media.OriginalObjectKey != nil {
+		if err := s.strg.RemoveFile(ctx, media.Bucket, *media.OriginalObjectKey); err != nil {
+			logger.Warnf(ctx, "failed to remove original %q: %v", *media.OriginalObjectKey, err)
+		}
+	}
+
 	if err := s.strg.RemoveFile(ctx, media.Bucket, media.ObjectKey); err != nil {
 		return err
 	}
@@ -49,12 +148,24 @@ func (s *deleteMediaSrv) DeleteMedia(ctx context.Context, id msuuid.UUID) error
 		return err
 	}
 
-	if err := s.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
-		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
+	s.clearCache(ctx, media.ID)
+
+	return nil
+}
+
+func (s *deleteMediaSrv) clearCache(ctx context.Context, id msuuid.UUID) {
+	if err := s.cache.DeleteMediaDetails(ctx, id); err != nil {
+		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", id, err)
 	}
-	if err := s.cache.DeleteEtagMediaDetails(ctx, media.ID); err != nil {
-		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", media.ID, err)
+	if err := s.cache.DeleteEtagMediaDetails(ctx, id); err != nil {
+		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", id, err)
 	}
+}
 
-	return nil
+func joinIDs(ids []msuuid.UUID) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = "#" + id.String()
+	}
+	return strings.Join(s, ", ")
 }
@@ -4,17 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/fhuszti/medias-ms-go/internal/mock"
 	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 	"github.com/google/uuid"
 )
 
 func TestDeleteMedia_NotFound(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
-	svc := NewMediaDeleter(repo, &mock.Cache{}, &mock.Storage{})
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.DeleteMedia(context.Background(), id)
@@ -25,7 +28,7 @@ func TestDeleteMedia_NotFound(t *testing.T) {
 
 func TestDeleteMedia_GetByIDError(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: errors.New("db fail")}
-	svc := NewMediaDeleter(repo, &mock.Cache{}, &mock.Storage{})
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	if err := svc.DeleteMedia(context.Background(), id); err == nil || err.Error() != "db fail" {
@@ -33,38 +36,151 @@ func TestDeleteMedia_GetByIDError(t *testing.T) {
 	}
 }
 
-func TestDeleteMedia_RemoveError(t *testing.T) {
+func TestDeleteMedia_UpdateError(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusCompleted}
+	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	err := svc.DeleteMedia(context.Background(), m.ID)
+	if err == nil || err.Error() != "update fail" {
+		t.Fatalf("expected update fail, got %v", err)
+	}
+}
+
+func TestDeleteMedia_MovesToTrash(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusCompleted, Variants: model.Variants{{ObjectKey: "v1"}}}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	cache := &mock.Cache{}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, cache, strg)
+
+	if err := svc.DeleteMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strg.RemoveCalled {
+		t.Error("expected files to be kept while in the trash")
+	}
+	if repo.DeleteCalled {
+		t.Error("expected DB record to be kept while in the trash")
+	}
+	if !repo.UpdateCalled || repo.GotUpdated.Status != model.MediaStatusDeleted {
+		t.Fatalf("expected media to be updated with status %q", model.MediaStatusDeleted)
+	}
+	if repo.GotUpdated.DeletedAt == nil {
+		t.Error("expected DeletedAt to be set")
+	}
+	if !cache.DelMediaCalled {
+		t.Error("expected cache delete to be called")
+	}
+	if !cache.DelEtagMediaCalled {
+		t.Error("expected etag cache delete to be called")
+	}
+}
+
+func TestDeleteMedia_Referenced(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusCompleted}
+	docID := msuuid.UUID(uuid.MustParse("bbbbbbbb-cccc-dddd-eeee-ffffffffffff"))
+	repo := &mock.MediaRepo{MediaOut: m, ReferencingOut: []msuuid.UUID{docID}}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	err := svc.DeleteMedia(context.Background(), m.ID)
+	if !errors.Is(err, ErrMediaReferenced) {
+		t.Fatalf("expected ErrMediaReferenced, got %v", err)
+	}
+	if !strings.Contains(err.Error(), docID.String()) {
+		t.Errorf("error %q should name the referencing media", err)
+	}
+	if repo.UpdateCalled || repo.DeleteCalled {
+		t.Error("expected the media to be kept")
+	}
+}
+
+func TestDeleteMedia_ListReferencingError(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusCompleted}
+	repo := &mock.MediaRepo{MediaOut: m, ListReferencingErr: errors.New("db fail")}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	if err := svc.DeleteMedia(context.Background(), m.ID); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("expected the media to be kept")
+	}
+}
+
+func TestDeleteMedia_AlreadyInTrash(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusDeleted}
+	repo := &mock.MediaRepo{MediaOut: m}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	if err := svc.DeleteMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.UpdateCalled || repo.DeleteCalled {
+		t.Error("expected no change on a media already in the trash")
+	}
+}
+
+func TestDeleteMedia_NotCompletedIsPurged(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "staging", ObjectKey: "k", Status: model.MediaStatusFailed}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, strg)
+
+	if err := svc.DeleteMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strg.RemoveCalled {
+		t.Error("expected RemoveFile to be called")
+	}
+	if !repo.DeleteCalled || repo.GotDeletedID != m.ID {
+		t.Error("expected repo.Delete to be called with ID")
+	}
+}
+
+func TestPurgeMedia_NotFound(t *testing.T) {
+	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	err := svc.PurgeMedia(context.Background(), id)
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestPurgeMedia_RemoveError(t *testing.T) {
 	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k"}
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{RemoveErr: errors.New("remove fail")}
-	svc := NewMediaDeleter(repo, &mock.Cache{}, strg)
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, strg)
 
-	err := svc.DeleteMedia(context.Background(), m.ID)
+	err := svc.PurgeMedia(context.Background(), m.ID)
 	if err == nil || err.Error() != "remove fail" {
 		t.Fatalf("expected remove fail, got %v", err)
 	}
 }
 
-func TestDeleteMedia_DeleteError(t *testing.T) {
+func TestPurgeMedia_DeleteError(t *testing.T) {
 	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k"}
 	repo := &mock.MediaRepo{MediaOut: m, DeleteErr: errors.New("delete fail")}
 	strg := &mock.Storage{}
-	svc := NewMediaDeleter(repo, &mock.Cache{}, strg)
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, strg)
 
-	err := svc.DeleteMedia(context.Background(), m.ID)
+	err := svc.PurgeMedia(context.Background(), m.ID)
 	if err == nil || err.Error() != "delete fail" {
 		t.Fatalf("expected delete fail, got %v", err)
 	}
 }
 
-func TestDeleteMedia_Success(t *testing.T) {
-	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Variants: model.Variants{{ObjectKey: "v1"}}}
+func TestPurgeMedia_Success(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusDeleted, Variants: model.Variants{{ObjectKey: "v1"}}}
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{}
 	cache := &mock.Cache{}
-	svc := NewMediaDeleter(repo, cache, strg)
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, cache, strg)
 
-	if err := svc.DeleteMedia(context.Background(), m.ID); err != nil {
+	if err := svc.PurgeMedia(context.Background(), m.ID); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if !strg.RemoveCalled {
@@ -80,3 +196,101 @@ func TestDeleteMedia_Success(t *testing.T) {
 		t.Error("expected etag cache delete to be called")
 	}
 }
+
+func TestPurgeMedia_ReferencedIsPurged(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusDeleted}
+	repo := &mock.MediaRepo{MediaOut: m, ReferencingOut: []msuuid.UUID{msuuid.NewUUID()}}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	if err := svc.PurgeMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !repo.DeleteCalled {
+		t.Error("expected the media to be purged all the same")
+	}
+}
+
+func TestPurgeMedia_RemovesVersions(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k_v2", Status: model.MediaStatusDeleted, Variants: model.Variants{}}
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{ListOut: []model.MediaVersion{
+		{Version: 1, ObjectKey: "k", Variants: model.Variants{{ObjectKey: "variants/k_100.webp"}}},
+	}}
+	strg := &mock.Storage{}
+	svc := NewMediaDeleter(repo, versions, &mock.Cache{}, strg)
+
+	if err := svc.PurgeMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"variants/k_100.webp", "k", "k_v2"}
+	if !reflect.DeepEqual(strg.RemovedKeys, want) {
+		t.Errorf("removed keys = %v; want %v", strg.RemovedKeys, want)
+	}
+}
+
+func TestPurgeMedia_RemovesOriginals(t *testing.T) {
+	original := "originals/k_v2.png"
+	versionOriginal := "originals/k.png"
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k_v2.webp", OriginalObjectKey: &original, Status: model.MediaStatusDeleted, Variants: model.Variants{}}
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{ListOut: []model.MediaVersion{
+		{Version: 1, ObjectKey: "k.webp", OriginalObjectKey: &versionOriginal},
+	}}
+	strg := &mock.Storage{}
+	svc := NewMediaDeleter(repo, versions, &mock.Cache{}, strg)
+
+	if err := svc.PurgeMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"originals/k.png", "k.webp", "originals/k_v2.png", "k_v2.webp"}
+	if !reflect.DeepEqual(strg.RemovedKeys, want) {
+		t.Errorf("removed keys = %v; want %v", strg.RemovedKeys, want)
+	}
+}
+
+func TestPurgeMedia_VersionsError(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k"}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{ListErr: errors.New("db fail")}, &mock.Cache{}, strg)
+
+	if err := svc.PurgeMedia(context.Background(), m.ID); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+	if strg.RemoveCalled || repo.DeleteCalled {
+		t.Error("expected nothing to be removed")
+	}
+}
+
+func TestDeleteMedia_WithdrawsFiles(t *testing.T) {
+	original := "originals/k.png"
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", OriginalObjectKey: &original, Status: model.MediaStatusCompleted, Variants: model.Variants{{ObjectKey: "v1"}}}
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{ListOut: []model.MediaVersion{{Version: 1, ObjectKey: "k1", Variants: model.Variants{{ObjectKey: "v1-1"}}}}}
+	strg := &mock.Storage{TagsOut: map[string]string{"team": "blog"}}
+	svc := NewMediaDeleter(repo, versions, &mock.Cache{}, strg)
+
+	if err := svc.DeleteMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"team": "blog", port.WithdrawnTag: "true"}
+	for _, key := range []string{"k", original, "v1", "k1", "v1-1"} {
+		if !reflect.DeepEqual(strg.TaggedFiles[key], want) {
+			t.Errorf("tags of %q = %v; want %v, so public buckets stop serving it", key, strg.TaggedFiles[key], want)
+		}
+	}
+}
+
+func TestDeleteMedia_WithdrawError(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusCompleted}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{SetTagsErr: errors.New("tag fail")}
+	svc := NewMediaDeleter(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, strg)
+
+	if err := svc.DeleteMedia(context.Background(), m.ID); err == nil {
+		t.Fatal("expected an error")
+	}
+	if repo.UpdateCalled {
+		t.Error("the media should not be trashed while its files are still served")
+	}
+}
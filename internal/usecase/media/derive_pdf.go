@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type pdfDeriverSrv struct {
+	repo    port.MediaRepository
+	strg    port.Storage
+	tasks   port.TaskDispatcher
+	buckets model.BucketsSettings
+}
+
+// compile-time check: *pdfDeriverSrv must satisfy port.PDFDeriver
+var _ port.PDFDeriver = (*pdfDeriverSrv)(nil)
+
+// NewPDFDeriver constructs a PDFDeriver implementation.
+func NewPDFDeriver(repo port.MediaRepository, strg port.Storage, tasks port.TaskDispatcher, buckets model.BucketsSettings) port.PDFDeriver {
+	return &pdfDeriverSrv{repo, strg, tasks, buckets}
+}
+
+// DerivePDF builds the file of a media extracted from or merged out of other PDFs, then hands it
+// to the optimisation like an uploaded file. Sources that are gone or unreadable fail the media;
+// storage and database errors are returned so the task is retried.
+func (s *pdfDeriverSrv) DerivePDF(ctx context.Context, id msuuid.UUID) error {
+	media, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrObjectNotFound
+		}
+		return err
+	}
+	if media.Status == model.MediaStatusCompleted {
+		return nil
+	}
+	if media.Status == model.MediaStatusFailed {
+		logger.Infof(ctx, "media #%s has failed, skipping its derivation", media.ID)
+		return nil
+	}
+	if media.Status != model.MediaStatusPending || media.DerivedFrom == nil {
+		return errors.New("media should be a pending derived media to be derived")
+	}
+
+	sources, err := s.readSources(ctx, media.DerivedFrom.Sources)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) || errors.Is(err, ErrNotCompleted) {
+			return s.markAsFailed(ctx, media, err)
+		}
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := derivePDF(media.DerivedFrom, sources, &out); err != nil {
+		return s.markAsFailed(ctx, media, err)
+	}
+	size := int64(out.Len())
+	if size > MaxFileSize {
+		return s.markAsFailed(ctx, media, fmt.Errorf("derived PDF too large: %d bytes (max size: %d bytes)", size, MaxFileSize))
+	}
+
+	metadata, err := fillPdfMetadata(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		return s.markAsFailed(ctx, media, err)
+	}
+	settings := s.buckets.Get(media.Bucket)
+	if err := checkPDFSafety(settings, metadata); err != nil {
+		return s.markAsFailed(ctx, media, err)
+	}
+	mimeType := "application/pdf"
+	text, err := extractText(ctx, mimeType, bytes.NewReader(out.Bytes()))
+	if err != nil {
+		return s.markAsFailed(ctx, media, err)
+	}
+
+	if err := s.strg.SaveFile(ctx, media.Bucket, media.ObjectKey, bytes.NewReader(out.Bytes()), size, objectOptions(settings, media, mimeType)); err != nil {
+		return err
+	}
+
+	updated := *media
+	updated.Status = model.MediaStatusCompleted
+	updated.SizeBytes = &size
+	updated.MimeType = &mimeType
+	updated.Metadata = metadata
+	if err := s.repo.Update(ctx, &updated); err != nil {
+		if remErr := s.strg.RemoveFile(ctx, media.Bucket, media.ObjectKey); remErr != nil {
+			logger.Warnf(ctx, "failed to remove file %q from bucket %q after update failure: %v", media.ObjectKey, media.Bucket, remErr)
+		}
+		return fmt.Errorf("failed updating media: %w", err)
+	}
+	indexText(ctx, s.repo, media.ID, text)
+
+	if err := s.tasks.EnqueueOptimiseMedia(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed to enqueue optimise task for media #%s: %v", media.ID, err)
+	}
+
+	return nil
+}
+
+// readSources reads the files of the source PDFs, in order.
+func (s *pdfDeriverSrv) readSources(ctx context.Context, ids []msuuid.UUID) ([][]byte, error) {
+	sources := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		source, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%w: source media #%s", ErrObjectNotFound, id)
+			}
+			return nil, err
+		}
+		if source.Status != model.MediaStatusCompleted {
+			return nil, fmt.Errorf("%w: source media #%s is %s", ErrNotCompleted, id, source.Status)
+		}
+
+		file, err := s.strg.GetFile(ctx, source.Bucket, source.ObjectKey)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading source media #%s: %w", id, err)
+		}
+		sources = append(sources, data)
+	}
+	return sources, nil
+}
+
+func (s *pdfDeriverSrv) markAsFailed(ctx context.Context, media *model.Media, cause error) error {
+	logger.Warnf(ctx, "derivation of media #%s failed: %v", media.ID, cause)
+
+	reason := cause.Error()
+	media.Status = model.MediaStatusFailed
+	media.FailureMessage = &reason
+	if err := s.repo.Update(ctx, media); err != nil {
+		return fmt.Errorf("failed marking media #%s as failed: %w", media.ID, err)
+	}
+	return nil
+}
+
+// derivePDF writes the pages of the source, or the sources merged in order, to w.
+func derivePDF(derivation *model.Derivation, sources [][]byte, w io.Writer) error {
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	switch derivation.Operation {
+	case model.DerivationPages:
+		if len(sources) != 1 {
+			return fmt.Errorf("extracting pages needs one source, got %d", len(sources))
+		}
+		if err := api.Trim(bytes.NewReader(sources[0]), w, strings.Split(derivation.Pages, ","), conf); err != nil {
+			return fmt.Errorf("error extracting pages %s: %w", derivation.Pages, err)
+		}
+	case model.DerivationMerge:
+		rsc := make([]io.ReadSeeker, len(sources))
+		for i, data := range sources {
+			rsc[i] = bytes.NewReader(data)
+		}
+		if err := api.MergeRaw(rsc, w, false, conf); err != nil {
+			return fmt.Errorf("error merging PDFs: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown derivation %q", derivation.Operation)
+	}
+	return nil
+}
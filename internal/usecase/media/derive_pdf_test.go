@@ -0,0 +1,142 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func derivedMedia(id msuuid.UUID, derivation *model.Derivation) *model.Media {
+	return &model.Media{
+		ID:          id,
+		ObjectKey:   id.String() + ".pdf",
+		Bucket:      "docs",
+		Status:      model.MediaStatusPending,
+		DerivedFrom: derivation,
+	}
+}
+
+func TestDerivePDF(t *testing.T) {
+	id1 := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	id2 := msuuid.UUID(uuid.MustParse("bbbbbbbb-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(uuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+
+	tests := []struct {
+		name       string
+		derivation *model.Derivation
+		wantPages  int
+	}{
+		{"pages", &model.Derivation{Operation: model.DerivationPages, Sources: []msuuid.UUID{id1}, Pages: "2"}, 1},
+		{"merge", &model.Derivation{Operation: model.DerivationMerge, Sources: []msuuid.UUID{id1, id2}}, 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{
+				id1:   pdfSource(id1, "docs", 2),
+				id2:   pdfSource(id2, "docs", 2),
+				newID: derivedMedia(newID, tc.derivation),
+			}}
+			strg := &mock.Storage{FilesByKey: map[string][]byte{
+				id1.String() + ".pdf": buildPDF(""),
+				id2.String() + ".pdf": buildPDF(""),
+			}}
+			tasks := &mock.Dispatcher{}
+			svc := NewPDFDeriver(repo, strg, tasks, model.BucketsSettings{})
+
+			if err := svc.DerivePDF(context.Background(), newID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(strg.SavedKeys) != 1 || strg.SavedKeys[0] != newID.String()+".pdf" {
+				t.Fatalf("expected the file to be saved at its key, got %v", strg.SavedKeys)
+			}
+			metadata, err := fillPdfMetadata(bytes.NewReader(strg.SavedContent))
+			if err != nil {
+				t.Fatalf("saved file is not a PDF: %v", err)
+			}
+			if metadata.PageCount != tc.wantPages {
+				t.Errorf("expected %d pages, got %d", tc.wantPages, metadata.PageCount)
+			}
+
+			m := repo.GotUpdated
+			if m == nil || m.Status != model.MediaStatusCompleted {
+				t.Fatalf("expected the media to be completed, got %+v", m)
+			}
+			if m.MimeType == nil || *m.MimeType != "application/pdf" {
+				t.Errorf("expected PDF mime type, got %v", m.MimeType)
+			}
+			if m.SizeBytes == nil || *m.SizeBytes != int64(len(strg.SavedContent)) {
+				t.Errorf("expected size %d, got %v", len(strg.SavedContent), m.SizeBytes)
+			}
+			if m.Metadata.PageCount != tc.wantPages {
+				t.Errorf("expected metadata with %d pages, got %d", tc.wantPages, m.Metadata.PageCount)
+			}
+			if len(tasks.OptimiseIDs) != 1 || tasks.OptimiseIDs[0] != newID {
+				t.Errorf("expected optimise task for %s, got %v", newID, tasks.OptimiseIDs)
+			}
+		})
+	}
+}
+
+func TestDerivePDF_SourceGone(t *testing.T) {
+	sourceID := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(uuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{
+		newID: derivedMedia(newID, &model.Derivation{Operation: model.DerivationPages, Sources: []msuuid.UUID{sourceID}, Pages: "1"}),
+	}}
+	strg := &mock.Storage{}
+	tasks := &mock.Dispatcher{}
+	svc := NewPDFDeriver(repo, strg, tasks, model.BucketsSettings{})
+
+	if err := svc.DerivePDF(context.Background(), newID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := repo.GotUpdated
+	if m == nil || m.Status != model.MediaStatusFailed || m.FailureMessage == nil {
+		t.Fatalf("expected the media to be failed, got %+v", m)
+	}
+	if strg.SaveCalled || tasks.OptimiseCalled {
+		t.Error("expected nothing to be saved nor optimised")
+	}
+}
+
+func TestDerivePDF_StorageError(t *testing.T) {
+	sourceID := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(uuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{
+		sourceID: pdfSource(sourceID, "docs", 2),
+		newID:    derivedMedia(newID, &model.Derivation{Operation: model.DerivationPages, Sources: []msuuid.UUID{sourceID}, Pages: "1"}),
+	}}
+	storageErr := errors.New("storage down")
+	strg := &mock.Storage{GetErr: storageErr}
+	svc := NewPDFDeriver(repo, strg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	if err := svc.DerivePDF(context.Background(), newID); !errors.Is(err, storageErr) {
+		t.Fatalf("expected storage error to be returned for a retry, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("expected the media to be left pending")
+	}
+}
+
+func TestDerivePDF_AlreadyCompleted(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	media := derivedMedia(id, &model.Derivation{Operation: model.DerivationMerge})
+	media.Status = model.MediaStatusCompleted
+	repo := &mock.MediaRepo{MediaOut: media}
+	strg := &mock.Storage{}
+	svc := NewPDFDeriver(repo, strg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	if err := svc.DerivePDF(context.Background(), id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strg.GetCalled || repo.UpdateCalled {
+		t.Error("expected a completed media to be left alone")
+	}
+}
@@ -0,0 +1,223 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+type mediaDownloaderSrv struct {
+	repo    port.MediaRepository
+	strg    port.Storage
+	buckets model.BucketsSettings
+}
+
+// compile-time check: *mediaDownloaderSrv must satisfy port.MediaDownloader
+var _ port.MediaDownloader = (*mediaDownloaderSrv)(nil)
+
+// NewMediaDownloader constructs a MediaDownloader implementation.
+func NewMediaDownloader(repo port.MediaRepository, strg port.Storage, buckets model.BucketsSettings) port.MediaDownloader {
+	return &mediaDownloaderSrv{repo: repo, strg: strg, buckets: buckets}
+}
+
+// downloadCandidate is a file of a media that can be downloaded.
+type downloadCandidate struct {
+	objectKey string
+	mimeType  string
+	width     int
+	// encoding is the Content-Encoding of a compressed copy of a text file
+	encoding string
+}
+
+// DownloadMedia generates a download link to the file of the media that suits the client best.
+// A named variant is returned as is. Otherwise the files in the format the client prefers are
+// kept, falling back to the format of the main file when the client accepts none of them, and
+// the one fitting the requested width is picked, the widest by default. Text files are swapped
+// for the compressed copy the client prefers. Users given the overlaid variants of an image
+// only choose among them, and get ErrVariantNotFound until there is one.
+// The link makes the browser save the file under its original name, with the right extension.
+// Watermarked files get no link, as they are stamped for each user by the API.
+func (s *mediaDownloaderSrv) DownloadMedia(ctx context.Context, in port.DownloadMediaInput) (*port.DownloadMediaOutput, error) {
+	media, ttl, err := getDownloadableMedia(ctx, s.repo, in.ID)
+	if err != nil {
+		return nil, err
+	}
+	settings := s.buckets.Get(media.Bucket)
+	media.Variants = visibleVariants(media, settings, in.UserID)
+
+	var chosen downloadCandidate
+	if in.Variant != "" {
+		chosen, err = namedVariant(media, in.Variant)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		candidates := downloadCandidates(media, !overlaid(media, settings, in.UserID))
+		if len(candidates) == 0 {
+			return nil, ErrVariantNotFound
+		}
+		chosen = fitWidth(negotiate(parseAccept(in.Accept), candidates), in.Width)
+		chosen = withEncoding(media, chosen, in.AcceptEncoding)
+	}
+
+	if chosen.objectKey == media.ObjectKey && isWatermarked(settings, chosen.mimeType) {
+		return &port.DownloadMediaOutput{MimeType: chosen.mimeType, Watermarked: true}, nil
+	}
+
+	params := url.Values{}
+	if disposition := contentDisposition(media, chosen.mimeType); disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+
+	url, err := s.strg.GeneratePresignedDownloadURL(ctx, media.Bucket, chosen.objectKey, ttl, params)
+	if err != nil {
+		return nil, fmt.Errorf("error generating presigned download URL for file %q: %w", chosen.objectKey, err)
+	}
+
+	return &port.DownloadMediaOutput{URL: url, MimeType: chosen.mimeType}, nil
+}
+
+// getDownloadableMedia fetches a media whose files can be served, along with how long
+// they can be linked to.
+func getDownloadableMedia(ctx context.Context, repo port.MediaRepository, id msuuid.UUID) (*model.Media, time.Duration, error) {
+	media, err := repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, ErrObjectNotFound
+		}
+		return nil, 0, err
+	}
+	if media.Status == model.MediaStatusDeleted {
+		return nil, 0, ErrObjectNotFound
+	}
+	if media.Status != model.MediaStatusCompleted {
+		return nil, 0, ErrNotCompleted
+	}
+
+	ttl, err := downloadTTL(media, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	return media, ttl, nil
+}
+
+// downloadCandidates lists the files of the media that can stand in for it, the main one first
+// unless it is left out.
+func downloadCandidates(media *model.Media, withMain bool) []downloadCandidate {
+	var candidates []downloadCandidate
+	if withMain {
+		candidates = append(candidates, downloadCandidate{
+			objectKey: media.ObjectKey,
+			mimeType:  *media.MimeType,
+			width:     media.Metadata.Width,
+		})
+	}
+	if IsImage(*media.MimeType) || IsSVG(*media.MimeType) {
+		for _, v := range media.Variants {
+			// the other pages of a TIFF are only downloaded by name
+			if v.Page != 0 {
+				continue
+			}
+			candidates = append(candidates, downloadCandidate{
+				objectKey: v.ObjectKey,
+				mimeType:  v.Format(),
+				width:     v.Width,
+			})
+		}
+	}
+	return candidates
+}
+
+// namedVariant returns the variant of the media with the given name.
+func namedVariant(media *model.Media, name string) (downloadCandidate, error) {
+	for _, v := range media.Variants {
+		if v.Name() == name {
+			return downloadCandidate{objectKey: v.ObjectKey, mimeType: v.Format(), width: v.Width, encoding: v.Encoding}, nil
+		}
+	}
+	return downloadCandidate{}, ErrVariantNotFound
+}
+
+// withEncoding swaps the main file of the media for the compressed copy the Accept-Encoding
+// header prefers, when there is one. Any other file is returned as is.
+func withEncoding(media *model.Media, file downloadCandidate, acceptEncoding string) downloadCandidate {
+	if file.objectKey != media.ObjectKey {
+		return file
+	}
+
+	var encodings []string
+	copies := make(map[string]model.Variant)
+	for _, v := range media.Variants {
+		if v.Encoding != "" {
+			encodings = append(encodings, v.Encoding)
+			copies[v.Encoding] = v
+		}
+	}
+	v, ok := copies[preferredEncoding(acceptEncoding, encodings)]
+	if !ok {
+		return file
+	}
+	return downloadCandidate{objectKey: v.ObjectKey, mimeType: v.Format(), width: file.width, encoding: v.Encoding}
+}
+
+// negotiate keeps the candidates with the best quality for the client, in their original order.
+// When the client accepts none of them, the ones in the format of the first candidate are kept.
+func negotiate(accept acceptRanges, candidates []downloadCandidate) []downloadCandidate {
+	bestQ := 0.0
+	for _, c := range candidates {
+		bestQ = max(bestQ, accept.quality(c.mimeType))
+	}
+
+	var kept []downloadCandidate
+	for _, c := range candidates {
+		if (bestQ > 0 && accept.quality(c.mimeType) == bestQ) ||
+			(bestQ == 0 && c.mimeType == candidates[0].mimeType) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// fitWidth picks the narrowest candidate at least width wide, or the widest one when none is
+// or without a width. Variants are never wider than the main file, which wins ties as the
+// earliest candidate.
+func fitWidth(candidates []downloadCandidate, width int) downloadCandidate {
+	var fit, widest *downloadCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		if widest == nil || c.width > widest.width {
+			widest = c
+		}
+		if width > 0 && c.width >= width && (fit == nil || c.width < fit.width) {
+			fit = c
+		}
+	}
+	if fit != nil {
+		return *fit
+	}
+	return *widest
+}
+
+// contentDisposition builds an inline Content-Disposition naming the file after the original
+// upload, with the extension of the downloaded format.
+func contentDisposition(media *model.Media, mimeType string) string {
+	ext, err := MimeTypeToExtension(mimeType)
+	if err != nil {
+		return ""
+	}
+	base := strings.TrimSuffix(path.Base(media.OriginalFilename), path.Ext(media.OriginalFilename))
+	if base == "" || base == "." || base == "/" {
+		base = media.ID.String()
+	}
+	return mime.FormatMediaType("inline", map[string]string{"filename": base + ext})
+}
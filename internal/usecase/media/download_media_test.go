@@ -0,0 +1,281 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func newDownloadableMedia() *model.Media {
+	mt := "image/webp"
+	return &model.Media{
+		Status:           model.MediaStatusCompleted,
+		OriginalFilename: "holiday photo.PNG",
+		Bucket:           "images",
+		ObjectKey:        "foo.webp",
+		MimeType:         &mt,
+		Metadata:         model.Metadata{Width: 800, Height: 400},
+		Variants: model.Variants{
+			{ObjectKey: "variants/x/foo_100.webp", Width: 100},
+			{ObjectKey: "variants/x/foo_100.jpg", Width: 100, MimeType: "image/jpeg"},
+			{ObjectKey: "variants/x/foo_300.webp", Width: 300, MimeType: "image/webp"},
+			{ObjectKey: "variants/x/foo_300.png", Width: 300, MimeType: "image/png"},
+			{ObjectKey: "variants/x/foo_1200.webp", Width: 800, TargetWidth: 1200, MimeType: "image/webp"},
+			{ObjectKey: "variants/x/foo_page2.webp", Width: 50, MimeType: "image/webp", Page: 2},
+		},
+	}
+}
+
+func newEncodedTextMedia() *model.Media {
+	mt := "text/markdown"
+	return &model.Media{
+		Status:           model.MediaStatusCompleted,
+		OriginalFilename: "notes.md",
+		Bucket:           "docs",
+		ObjectKey:        "foo.md",
+		MimeType:         &mt,
+		Variants: model.Variants{
+			{ObjectKey: "variants/x/foo.md.br", MimeType: mt, Encoding: model.EncodingBrotli},
+			{ObjectKey: "variants/x/foo.md.gz", MimeType: mt, Encoding: model.EncodingGzip},
+		},
+	}
+}
+
+func TestDownloadMedia_Errors(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name  string
+		repo  *mock.MediaRepo
+		strg  *mock.Storage
+		check func(error) bool
+	}{
+		{"not found", &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}, &mock.Storage{}, func(err error) bool { return errors.Is(err, ErrObjectNotFound) }},
+		{"trashed", &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusDeleted}}, &mock.Storage{}, func(err error) bool { return errors.Is(err, ErrObjectNotFound) }},
+		{"pending", &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusPending}}, &mock.Storage{}, func(err error) bool { return errors.Is(err, ErrNotCompleted) }},
+		{"expired", &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusCompleted, ExpiresAt: &expired}}, &mock.Storage{}, func(err error) bool { return errors.Is(err, ErrMediaExpired) }},
+		{"link error", &mock.MediaRepo{MediaOut: newDownloadableMedia()}, &mock.Storage{GenerateDownloadLinkErr: errors.New("minio down")}, func(err error) bool { return err != nil && errors.Is(err, errors.Unwrap(err)) }},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewMediaDownloader(tc.repo, tc.strg, nil)
+			if _, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{}); !tc.check(err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadMedia_Negotiation(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		wantKey  string
+		wantMime string
+	}{
+		{"no accept header", "", "foo.webp", "image/webp"},
+		{"webp supported", "image/webp,image/*;q=0.8", "foo.webp", "image/webp"},
+		{"jpeg only", "image/jpeg", "variants/x/foo_100.jpg", "image/jpeg"},
+		{"png preferred", "image/png,image/*;q=0.5", "variants/x/foo_300.png", "image/png"},
+		{"legacy fallback", "image/jpeg,image/png", "variants/x/foo_300.png", "image/png"},
+		{"nothing acceptable", "text/html", "foo.webp", "image/webp"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{}
+			svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: newDownloadableMedia()}, strg, nil)
+
+			out, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{Accept: tc.accept})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("linked to %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+			if out.MimeType != tc.wantMime || out.URL != "https://example.com/download" {
+				t.Errorf("output = %+v; want %s", out, tc.wantMime)
+			}
+			if strg.TTL != DownloadUrlTTL {
+				t.Errorf("TTL = %v; want %v", strg.TTL, DownloadUrlTTL)
+			}
+		})
+	}
+}
+
+func TestDownloadMedia_Selection(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       port.DownloadMediaInput
+		wantKey  string
+		wantName string
+	}{
+		{"narrowest fitting width", port.DownloadMediaInput{Width: 90}, "variants/x/foo_100.webp", "holiday photo.webp"},
+		{"next size up", port.DownloadMediaInput{Width: 200}, "variants/x/foo_300.webp", "holiday photo.webp"},
+		{"other pages left out", port.DownloadMediaInput{Width: 40}, "variants/x/foo_100.webp", "holiday photo.webp"},
+		{"wider than everything", port.DownloadMediaInput{Width: 5000}, "foo.webp", "holiday photo.webp"},
+		{"width within accepted formats", port.DownloadMediaInput{Accept: "image/jpeg", Width: 500}, "variants/x/foo_100.jpg", "holiday photo.jpg"},
+		{"named webp variant", port.DownloadMediaInput{Variant: "100"}, "variants/x/foo_100.webp", "holiday photo.webp"},
+		{"named by target width", port.DownloadMediaInput{Variant: "1200"}, "variants/x/foo_1200.webp", "holiday photo.webp"},
+		{"named page", port.DownloadMediaInput{Variant: "page-2"}, "variants/x/foo_page2.webp", "holiday photo.webp"},
+		{"named fallback overrides accept and width", port.DownloadMediaInput{Variant: "300-png", Accept: "image/webp", Width: 50}, "variants/x/foo_300.png", "holiday photo.png"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{}
+			svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: newDownloadableMedia()}, strg, nil)
+
+			if _, err := svc.DownloadMedia(context.Background(), tc.in); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("linked to %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+			want := `inline; filename="` + tc.wantName + `"`
+			if got := strg.ReqParams.Get("response-content-disposition"); got != want {
+				t.Errorf("content disposition = %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDownloadMedia_UnknownVariant(t *testing.T) {
+	strg := &mock.Storage{}
+	svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: newDownloadableMedia()}, strg, nil)
+
+	_, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{Variant: "999"})
+	if !errors.Is(err, ErrVariantNotFound) {
+		t.Fatalf("expected ErrVariantNotFound, got %v", err)
+	}
+	if strg.GenerateDownloadLinkCalled {
+		t.Error("no link should be generated")
+	}
+}
+
+func TestDownloadMedia_DispositionWithoutFilename(t *testing.T) {
+	media := newDownloadableMedia()
+	media.OriginalFilename = ""
+	strg := &mock.Storage{}
+	svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: media}, strg, nil)
+
+	if _, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "inline; filename=" + media.ID.String() + ".webp"
+	if got := strg.ReqParams.Get("response-content-disposition"); got != want {
+		t.Errorf("content disposition = %q; want %q", got, want)
+	}
+}
+
+func TestDownloadMedia_EncodedText(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		variant        string
+		wantKey        string
+	}{
+		{"no accept-encoding", "", "", "foo.md"},
+		{"brotli preferred", "gzip, br", "", "variants/x/foo.md.br"},
+		{"gzip only", "gzip", "", "variants/x/foo.md.gz"},
+		{"named copy", "", "gzip", "variants/x/foo.md.gz"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{}
+			svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: newEncodedTextMedia()}, strg, nil)
+
+			out, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{AcceptEncoding: tc.acceptEncoding, Variant: tc.variant})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("linked %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+			if out.MimeType != "text/markdown" {
+				t.Errorf("mime type = %q; want text/markdown", out.MimeType)
+			}
+			if got := strg.ReqParams.Get("response-content-disposition"); got != "inline; filename=notes.md" {
+				t.Errorf("content disposition = %q; want the markdown file name", got)
+			}
+		})
+	}
+}
+
+func newOverlaidMedia(owner msuuid.UUID) *model.Media {
+	mt := "image/png"
+	return &model.Media{
+		Status:           model.MediaStatusCompleted,
+		OriginalFilename: "logo.png",
+		Bucket:           "images",
+		ObjectKey:        "foo.png",
+		MimeType:         &mt,
+		OwnerID:          &owner,
+		Metadata:         model.Metadata{Width: 800, Height: 400},
+		Variants: model.Variants{
+			{ObjectKey: "variants/x/clean_300.webp", Width: 300, MimeType: "image/webp"},
+			{ObjectKey: "variants/x/clean_300.png", Width: 300, MimeType: "image/png"},
+			{ObjectKey: "variants/x/foo_100_overlay.webp", Width: 100, MimeType: "image/webp", Watermarked: true},
+			{ObjectKey: "variants/x/foo_300_overlay.webp", Width: 300, MimeType: "image/webp", Watermarked: true},
+			{ObjectKey: "variants/x/foo_300_overlay.png", Width: 300, MimeType: "image/png", Watermarked: true},
+		},
+	}
+}
+
+func TestDownloadMedia_Overlay(t *testing.T) {
+	owner := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	other := msuuid.UUID(uuid.MustParse("66666666-7777-8888-9999-000000000000"))
+	buckets := model.BucketsSettings{"images": {Overlay: &model.ImageOverlay{MediaID: other, Opacity: 0.5, Scale: 0.2}}}
+
+	tests := []struct {
+		name    string
+		in      port.DownloadMediaInput
+		wantKey string
+	}{
+		{"anonymous without width", port.DownloadMediaInput{}, "variants/x/foo_300_overlay.webp"},
+		{"other user without width", port.DownloadMediaInput{UserID: &other}, "variants/x/foo_300_overlay.webp"},
+		{"other user accepting the original format", port.DownloadMediaInput{UserID: &other, Accept: "image/png"}, "variants/x/foo_300_overlay.png"},
+		{"other user wider than everything", port.DownloadMediaInput{UserID: &other, Width: 5000}, "variants/x/foo_300_overlay.webp"},
+		{"owner without width", port.DownloadMediaInput{UserID: &owner}, "foo.png"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{}
+			svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: newOverlaidMedia(owner)}, strg, buckets)
+
+			if _, err := svc.DownloadMedia(context.Background(), tc.in); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("linked to %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestDownloadMedia_OverlayNotDrawnYet(t *testing.T) {
+	owner := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	media := newOverlaidMedia(owner)
+	media.Variants = media.Variants[:2]
+	buckets := model.BucketsSettings{"images": {Overlay: &model.ImageOverlay{Opacity: 0.5, Scale: 0.2}}}
+	strg := &mock.Storage{}
+	svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: media}, strg, buckets)
+
+	_, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{})
+	if !errors.Is(err, ErrVariantNotFound) {
+		t.Fatalf("expected ErrVariantNotFound, got %v", err)
+	}
+	if strg.GenerateDownloadLinkCalled {
+		t.Error("the clean main file should not be linked to")
+	}
+}
@@ -0,0 +1,143 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/fhuszti/medias-ms-go/internal/markdown"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// textEncodings are the compressed copies kept next to text files, the smallest one first.
+var textEncodings = []string{model.EncodingBrotli, model.EncodingGzip}
+
+// encodingExtensions are appended to the key of a file to name its compressed copies.
+var encodingExtensions = map[string]string{
+	model.EncodingBrotli: ".br",
+	model.EncodingGzip:   ".gz",
+}
+
+// textVariants replaces the variants of a text media with a compressed copy of its file for each
+// of the textEncodings, skipping the ones that would not make it smaller, and with the HTML
+// rendering of markdown documents. It returns the keys of the previous variants, to remove once
+// the media is updated.
+func (m *mediaOptimiserSrv) textVariants(ctx context.Context, media *model.Media) ([]string, error) {
+	file, err := m.strg.GetFile(ctx, media.Bucket, media.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %q: %w", media.ObjectKey, err)
+	}
+
+	variants := make(model.Variants, 0, len(textEncodings))
+	for _, encoding := range textEncodings {
+		variant, ok, err := m.saveEncodedVariant(ctx, media, raw, encoding)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			variants = append(variants, variant)
+		}
+	}
+	if IsMarkdown(*media.MimeType) {
+		variant, err := m.saveHTMLVariant(ctx, media, raw)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+
+	staleKeys := make([]string, 0, len(media.Variants))
+	for _, v := range media.Variants {
+		staleKeys = append(staleKeys, v.ObjectKey)
+	}
+	media.Variants = variants
+	return staleKeys, nil
+}
+
+// saveEncodedVariant compresses the file with the given encoding and saves it, unless it does
+// not get any smaller. In buckets with content-addressed keys, the copy is stored under the hash
+// of its content and marked immutable.
+func (m *mediaOptimiserSrv) saveEncodedVariant(ctx context.Context, media *model.Media, raw []byte, encoding string) (model.Variant, bool, error) {
+	encoded, err := m.opt.Encode(encoding, bytes.NewReader(raw))
+	if err != nil {
+		return model.Variant{}, false, err
+	}
+	data, err := io.ReadAll(encoded)
+	_ = encoded.Close()
+	if err != nil {
+		return model.Variant{}, false, fmt.Errorf("failed to read %s copy of media #%s: %w", encoding, media.ID, err)
+	}
+	if len(data) >= len(raw) {
+		logger.Infof(ctx, "%s does not make media #%s any smaller, skipping it", encoding, media.ID)
+		return model.Variant{}, false, nil
+	}
+
+	settings := m.buckets.Get(media.Bucket)
+	opts := objectOptions(settings, media, *media.MimeType)
+	opts["Content-Encoding"] = encoding
+
+	dir := path.Join("variants", media.ID.String())
+	key := path.Join(dir, path.Base(media.ObjectKey)+encodingExtensions[encoding])
+	if settings.ContentAddressedKeys {
+		sum := sha256.Sum256(data)
+		key = contentKey(dir, sum[:], path.Ext(media.ObjectKey)+encodingExtensions[encoding])
+		opts["Cache-Control"] = ImmutableCacheControl
+	}
+
+	if err := m.strg.SaveFile(ctx, media.Bucket, key, bytes.NewReader(data), int64(len(data)), opts); err != nil {
+		return model.Variant{}, false, fmt.Errorf("failed to save %s copy %q: %w", encoding, key, err)
+	}
+
+	return model.Variant{
+		ObjectKey: key,
+		SizeBytes: int64(len(data)),
+		MimeType:  *media.MimeType,
+		Encoding:  encoding,
+	}, true, nil
+}
+
+// saveHTMLVariant renders a markdown document as sanitized HTML, its media references pointing at
+// the current files of the medias, and saves it next to it.
+func (m *mediaOptimiserSrv) saveHTMLVariant(ctx context.Context, media *model.Media, raw []byte) (model.Variant, error) {
+	doc, err := markdown.Parse(raw)
+	if err != nil {
+		return model.Variant{}, fmt.Errorf("failed to parse media #%s: %w", media.ID, err)
+	}
+	data, err := doc.HTML(m.mediaLinks(ctx, doc.MediaReferences))
+	if err != nil {
+		return model.Variant{}, err
+	}
+
+	settings := m.buckets.Get(media.Bucket)
+	opts := objectOptions(settings, media, "text/html")
+
+	dir := path.Join("variants", media.ID.String())
+	base := path.Base(media.ObjectKey)
+	key := path.Join(dir, strings.TrimSuffix(base, path.Ext(base))+".html")
+	if settings.ContentAddressedKeys {
+		sum := sha256.Sum256(data)
+		key = contentKey(dir, sum[:], ".html")
+		opts["Cache-Control"] = ImmutableCacheControl
+	}
+
+	if err := m.strg.SaveFile(ctx, media.Bucket, key, bytes.NewReader(data), int64(len(data)), opts); err != nil {
+		return model.Variant{}, fmt.Errorf("failed to save HTML rendering %q: %w", key, err)
+	}
+
+	return model.Variant{
+		ObjectKey: key,
+		SizeBytes: int64(len(data)),
+		MimeType:  "text/html",
+	}, nil
+}
@@ -7,4 +7,19 @@ var (
 	ErrBucketNotFound = errors.New("storage: bucket not found")
 	ErrUnauthorized   = errors.New("storage: unauthorized")
 	ErrInternal       = errors.New("storage: internal error")
+
+	ErrMediaNotDeleted = errors.New("media: not in the trash")
+	ErrMediaExpired    = errors.New("media: expired")
+	ErrNotCompleted    = errors.New("media: not completed")
+	ErrVersionNotFound = errors.New("media: version not found")
+	ErrNoVersionUpload = errors.New("media: no new version uploaded")
+	ErrVariantNotFound = errors.New("media: variant not found")
+	ErrMediaReferenced = errors.New("media: referenced by other medias")
+	ErrUnsafePDF       = errors.New("media: unsafe PDF")
+
+	ErrWatermarkNeedsUser = errors.New("media: watermarked files require an authenticated user")
+
+	ErrNotPDF           = errors.New("media: not a PDF")
+	ErrInvalidPageRange = errors.New("media: invalid page range")
+	ErrMixedBuckets     = errors.New("media: sources in different buckets")
 )
@@ -0,0 +1,127 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type pdfPagesExtractorSrv struct {
+	repo    port.MediaRepository
+	tasks   port.TaskDispatcher
+	genUUID port.UUIDGen
+}
+
+// compile-time check: *pdfPagesExtractorSrv must satisfy port.PDFPagesExtractor
+var _ port.PDFPagesExtractor = (*pdfPagesExtractorSrv)(nil)
+
+// NewPDFPagesExtractor constructs a PDFPagesExtractor implementation.
+func NewPDFPagesExtractor(repo port.MediaRepository, tasks port.TaskDispatcher, genUUID port.UUIDGen) port.PDFPagesExtractor {
+	return &pdfPagesExtractorSrv{repo: repo, tasks: tasks, genUUID: genUUID}
+}
+
+// ExtractPages creates a pending media, in the bucket of the source PDF, that the worker fills
+// with the requested pages.
+func (s *pdfPagesExtractorSrv) ExtractPages(ctx context.Context, in port.ExtractPagesInput) (port.DerivedMediaOutput, error) {
+	source, err := getPDFSource(ctx, s.repo, in.ID)
+	if err != nil {
+		return port.DerivedMediaOutput{}, err
+	}
+	pages, err := parsePageRanges(in.Pages, source.Metadata.PageCount)
+	if err != nil {
+		return port.DerivedMediaOutput{}, err
+	}
+
+	name := in.Name
+	if name == "" {
+		base := strings.TrimSuffix(path.Base(source.OriginalFilename), path.Ext(source.OriginalFilename))
+		name = fmt.Sprintf("%s (pages %s).pdf", base, pages)
+	}
+	derivation := &model.Derivation{Operation: model.DerivationPages, Sources: []msuuid.UUID{source.ID}, Pages: pages}
+	return createDerivedMedia(ctx, s.repo, s.tasks, s.genUUID(), []*model.Media{source}, derivation, name, in.OwnerID)
+}
+
+// getPDFSource fetches a PDF that a new media can be made from.
+func getPDFSource(ctx context.Context, repo port.MediaRepository, id msuuid.UUID) (*model.Media, error) {
+	media, _, err := getDownloadableMedia(ctx, repo, id)
+	if err != nil {
+		return nil, err
+	}
+	if media.MimeType == nil || !IsPdf(*media.MimeType) {
+		return nil, fmt.Errorf("%w: media #%s", ErrNotPDF, id)
+	}
+	return media, nil
+}
+
+// parsePageRanges checks a comma-separated list of pages and page ranges (e.g. "1-3, 7") against
+// the page count of the document, and returns it normalised (e.g. "1-3,7").
+func parsePageRanges(spec string, pageCount int) (string, error) {
+	var ranges []string
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		first, last, isRange := strings.Cut(item, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPageRange, item)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+				return "", fmt.Errorf("%w: %q", ErrInvalidPageRange, item)
+			}
+		}
+		if from < 1 || to < from || to > pageCount {
+			return "", fmt.Errorf("%w: %q is not within pages 1 to %d", ErrInvalidPageRange, item, pageCount)
+		}
+
+		if from == to {
+			ranges = append(ranges, strconv.Itoa(from))
+		} else {
+			ranges = append(ranges, strconv.Itoa(from)+"-"+strconv.Itoa(to))
+		}
+	}
+	return strings.Join(ranges, ","), nil
+}
+
+// createDerivedMedia records a pending media made of the sources, in their bucket, and enqueues
+// the building of its file. It expires with the first of its sources.
+func createDerivedMedia(ctx context.Context, repo port.MediaRepository, tasks port.TaskDispatcher, id msuuid.UUID, sources []*model.Media, derivation *model.Derivation, name string, ownerID *msuuid.UUID) (port.DerivedMediaOutput, error) {
+	var expiresAt *time.Time
+	for _, source := range sources {
+		if source.ExpiresAt != nil && (expiresAt == nil || source.ExpiresAt.Before(*expiresAt)) {
+			expiresAt = source.ExpiresAt
+		}
+	}
+
+	media := &model.Media{
+		ID:               id,
+		ObjectKey:        id.String() + ".pdf",
+		Bucket:           sources[0].Bucket,
+		OwnerID:          ownerID,
+		OriginalFilename: name,
+		Status:           model.MediaStatusPending,
+		Metadata:         model.Metadata{},
+		Variants:         model.Variants{},
+		Version:          1,
+		DerivedFrom:      derivation,
+		ExpiresAt:        expiresAt,
+	}
+	if err := repo.Create(ctx, media); err != nil {
+		return port.DerivedMediaOutput{}, err
+	}
+
+	if err := tasks.EnqueueDerivePDF(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed to enqueue derive task for media #%s: %v", media.ID, err)
+	}
+
+	return port.DerivedMediaOutput{ID: media.ID}, nil
+}
@@ -0,0 +1,141 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func pdfSource(id msuuid.UUID, bucket string, pageCount int) *model.Media {
+	mimeType := "application/pdf"
+	return &model.Media{
+		ID:               id,
+		ObjectKey:        id.String() + ".pdf",
+		Bucket:           bucket,
+		OriginalFilename: "report.pdf",
+		MimeType:         &mimeType,
+		Status:           model.MediaStatusCompleted,
+		Metadata:         model.Metadata{PageCount: pageCount},
+	}
+}
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "1", want: "1"},
+		{spec: " 1 - 3 , 7", want: "1-3,7"},
+		{spec: "2-2,5-10", want: "2,5-10"},
+		{spec: "", wantErr: true},
+		{spec: "0", wantErr: true},
+		{spec: "3-1", wantErr: true},
+		{spec: "9-11", wantErr: true},
+		{spec: "1,,2", wantErr: true},
+		{spec: "a-b", wantErr: true},
+		{spec: "-2", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := parsePageRanges(tc.spec, 10)
+		if tc.wantErr {
+			if !errors.Is(err, ErrInvalidPageRange) {
+				t.Errorf("parsePageRanges(%q): expected ErrInvalidPageRange, got %v", tc.spec, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePageRanges(%q): unexpected error: %v", tc.spec, err)
+		} else if got != tc.want {
+			t.Errorf("parsePageRanges(%q) = %q; want %q", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestExtractPages_Success(t *testing.T) {
+	sourceID := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(uuid.MustParse("bbbbbbbb-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	ownerID := msuuid.UUID(uuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	source := pdfSource(sourceID, "docs", 10)
+	expiresAt := time.Now().Add(time.Hour)
+	source.ExpiresAt = &expiresAt
+
+	repo := &mock.MediaRepo{MediaOut: source}
+	tasks := &mock.Dispatcher{}
+	svc := NewPDFPagesExtractor(repo, tasks, func() msuuid.UUID { return newID })
+
+	out, err := svc.ExtractPages(context.Background(), port.ExtractPagesInput{ID: sourceID, Pages: "1-3, 7", OwnerID: &ownerID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.ID != newID {
+		t.Errorf("expected ID %s, got %s", newID, out.ID)
+	}
+
+	m := repo.GotCreated
+	if m == nil {
+		t.Fatal("expected repo.Create to be called")
+	}
+	if m.Status != model.MediaStatusPending || m.Bucket != "docs" || m.ObjectKey != newID.String()+".pdf" {
+		t.Errorf("unexpected media created: %+v", m)
+	}
+	if m.OriginalFilename != "report (pages 1-3,7).pdf" {
+		t.Errorf("expected name after the source, got %q", m.OriginalFilename)
+	}
+	if m.OwnerID == nil || *m.OwnerID != ownerID {
+		t.Errorf("expected owner %s, got %v", ownerID, m.OwnerID)
+	}
+	if m.ExpiresAt == nil || !m.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected the media to expire with its source, got %v", m.ExpiresAt)
+	}
+	want := model.Derivation{Operation: model.DerivationPages, Sources: []msuuid.UUID{sourceID}, Pages: "1-3,7"}
+	if m.DerivedFrom == nil || m.DerivedFrom.Operation != want.Operation || m.DerivedFrom.Pages != want.Pages ||
+		len(m.DerivedFrom.Sources) != 1 || m.DerivedFrom.Sources[0] != sourceID {
+		t.Errorf("expected derivation %+v, got %+v", want, m.DerivedFrom)
+	}
+	if len(tasks.DeriveIDs) != 1 || tasks.DeriveIDs[0] != newID {
+		t.Errorf("expected derive task for %s, got %v", newID, tasks.DeriveIDs)
+	}
+}
+
+func TestExtractPages_Errors(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	image := pdfSource(id, "docs", 0)
+	mimeType := "image/png"
+	image.MimeType = &mimeType
+	pending := pdfSource(id, "docs", 2)
+	pending.Status = model.MediaStatusPending
+
+	tests := []struct {
+		name    string
+		media   *model.Media
+		pages   string
+		wantErr error
+	}{
+		{"not a PDF", image, "1", ErrNotPDF},
+		{"not completed", pending, "1", ErrNotCompleted},
+		{"page out of range", pdfSource(id, "docs", 2), "1-3", ErrInvalidPageRange},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &mock.MediaRepo{MediaOut: tc.media}
+			tasks := &mock.Dispatcher{}
+			svc := NewPDFPagesExtractor(repo, tasks, msuuid.NewUUID)
+
+			_, err := svc.ExtractPages(context.Background(), port.ExtractPagesInput{ID: id, Pages: tc.pages})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if repo.CreateCalled || tasks.DeriveCalled {
+				t.Error("expected no media to be created")
+			}
+		})
+	}
+}
@@ -7,31 +7,38 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
-	"regexp"
-	"strings"
+	"math"
 
+	"github.com/fhuszti/medias-ms-go/internal/animation"
+	"github.com/fhuszti/medias-ms-go/internal/markdown"
 	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
-	"github.com/ledongthuc/pdf"
+	"github.com/fhuszti/medias-ms-go/internal/raster"
+	"github.com/fhuszti/medias-ms-go/internal/svg"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
 )
 
 type uploadFinaliserSrv struct {
-	repo  port.MediaRepository
-	strg  port.Storage
-	tasks port.TaskDispatcher
+	repo    port.MediaRepository
+	strg    port.Storage
+	tasks   port.TaskDispatcher
+	buckets model.BucketsSettings
 }
 
 // compile-time check: *uploadFinaliserSrv must satisfy port.UploadFinaliser
 var _ port.UploadFinaliser = (*uploadFinaliserSrv)(nil)
 
-func NewUploadFinaliser(repo port.MediaRepository, strg port.Storage, tasks port.TaskDispatcher) port.UploadFinaliser {
-	return &uploadFinaliserSrv{repo, strg, tasks}
+func NewUploadFinaliser(repo port.MediaRepository, strg port.Storage, tasks port.TaskDispatcher, buckets model.BucketsSettings) port.UploadFinaliser {
+	return &uploadFinaliserSrv{repo, strg, tasks, buckets}
 }
 
 func (s *uploadFinaliserSrv) FinaliseUpload(ctx context.Context, in port.FinaliseUploadInput) error {
@@ -72,18 +79,13 @@ func (s *uploadFinaliserSrv) FinaliseUpload(ctx context.Context, in port.Finalis
 		return finalErr
 	}
 
-	if info.SizeBytes < MinFileSize {
-		finalErr = fmt.Errorf("file %q too small: %d bytes (min size: %d bytes)", media.ObjectKey, info.SizeBytes, MinFileSize)
-		return finalErr
-	}
-	if info.SizeBytes > MaxFileSize {
-		finalErr = fmt.Errorf("file %q too large: %d bytes (max size: %d bytes)", media.ObjectKey, info.SizeBytes, MaxFileSize)
+	if err := validateStagedFile(info, media.ObjectKey); err != nil {
+		finalErr = err
 		return finalErr
 	}
 
-	if !IsMimeTypeAllowed(info.ContentType) {
-		finalErr = fmt.Errorf("unsupported mime-type %q for file %q", info.ContentType, media.ObjectKey)
-		return finalErr
+	if in.ExpiresAt != nil {
+		media.ExpiresAt = in.ExpiresAt
 	}
 
 	if err := s.moveFile(ctx, media, info.SizeBytes, info.ContentType, in.DestBucket); err != nil {
@@ -91,6 +93,10 @@ func (s *uploadFinaliserSrv) FinaliseUpload(ctx context.Context, in port.Finalis
 		return finalErr
 	}
 
+	if IsMarkdown(*media.MimeType) {
+		recordReferences(ctx, s.repo, media)
+	}
+
 	if err := s.tasks.EnqueueOptimiseMedia(ctx, media.ID); err != nil {
 		logger.Warnf(ctx, "failed to enqueue optimise task for media #%s: %v", media.ID, err)
 	}
@@ -98,6 +104,20 @@ func (s *uploadFinaliserSrv) FinaliseUpload(ctx context.Context, in port.Finalis
 	return nil
 }
 
+// validateStagedFile checks the size and type of a file uploaded to the staging bucket.
+func validateStagedFile(info port.FileInfo, objectKey string) error {
+	if info.SizeBytes < MinFileSize {
+		return fmt.Errorf("file %q too small: %d bytes (min size: %d bytes)", objectKey, info.SizeBytes, MinFileSize)
+	}
+	if info.SizeBytes > MaxFileSize {
+		return fmt.Errorf("file %q too large: %d bytes (max size: %d bytes)", objectKey, info.SizeBytes, MaxFileSize)
+	}
+	if !IsMimeTypeAllowed(info.ContentType) {
+		return fmt.Errorf("unsupported mime-type %q for file %q", info.ContentType, objectKey)
+	}
+	return nil
+}
+
 func (s *uploadFinaliserSrv) cleanupFile(objectKey string) error {
 	if err := s.strg.RemoveFile(context.Background(), "staging", objectKey); err != nil {
 		return err
@@ -126,9 +146,20 @@ func (s *uploadFinaliserSrv) moveFile(ctx context.Context, media *model.Media, s
 	if err != nil {
 		return fmt.Errorf("failed to fill metadata: %w", err)
 	}
+	if err := checkPDFSafety(s.buckets.Get(destBucket), metadata); err != nil {
+		return err
+	}
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
 		return fmt.Errorf("failed to reset reader: %w", err)
 	}
+	text, err := extractText(ctx, contentType, file)
+	if err != nil {
+		return err
+	}
+	body, size, err := sanitizedFile(contentType, file, size)
+	if err != nil {
+		return err
+	}
 	defer func(file io.ReadSeekCloser) {
 		if err := file.Close(); err != nil {
 			logger.Warn(ctx, "failed to close reader")
@@ -145,11 +176,9 @@ func (s *uploadFinaliserSrv) moveFile(ctx context.Context, media *model.Media, s
 		ctx,
 		destBucket,
 		newObjectKey,
-		file,
+		body,
 		size,
-		map[string]string{
-			"Content-Type": contentType,
-		},
+		objectOptions(s.buckets.Get(destBucket), media, contentType),
 	); err != nil {
 		return err
 	}
@@ -174,6 +203,9 @@ func (s *uploadFinaliserSrv) moveFile(ctx context.Context, media *model.Media, s
 	}
 
 	*media = updated
+	if HasText(contentType) {
+		indexText(ctx, s.repo, media.ID, text)
+	}
 
 	return nil
 }
@@ -183,6 +215,8 @@ func fillMetadata(mimeType string, file io.Reader) (model.Metadata, error) {
 	switch {
 	case IsImage(mimeType):
 		return fillImageMetadata(file)
+	case IsSVG(mimeType):
+		return fillSVGMetadata(file)
 	case IsPdf(mimeType):
 		return fillPdfMetadata(file)
 	case IsMarkdown(mimeType):
@@ -198,30 +232,74 @@ func fillImageMetadata(file io.Reader) (model.Metadata, error) {
 		return model.Metadata{}, fmt.Errorf("error reading image data: %w", err)
 	}
 
-	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
 		return model.Metadata{}, fmt.Errorf("error decoding image config: %w", err)
 	}
 
-	return model.Metadata{
+	metadata := model.Metadata{
 		Width:  cfg.Width,
 		Height: cfg.Height,
-	}, nil
+	}
+	switch format {
+	case "tiff":
+		pages, err := raster.TIFFPages(data)
+		if err != nil {
+			return model.Metadata{}, fmt.Errorf("error reading TIFF pages: %w", err)
+		}
+		metadata.PageCount = len(pages)
+		metadata.DPI = pages[0].DPI
+	case "bmp":
+		metadata.DPI = raster.BMPResolution(data)
+	}
+
+	info, animated, err := animation.Probe(data)
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error reading image frames: %w", err)
+	}
+	if animated {
+		metadata.FrameCount = info.FrameCount
+		metadata.DurationMs = info.Duration.Milliseconds()
+		metadata.LoopCount = info.LoopCount
+	}
+	return metadata, nil
 }
 
-func fillPdfMetadata(file io.Reader) (model.Metadata, error) {
+// sanitizedFile returns the file to store. SVGs are served as is, so they are only ever stored
+// sanitized; other files are stored untouched.
+func sanitizedFile(mimeType string, file io.Reader, size int64) (io.Reader, int64, error) {
+	if !IsSVG(mimeType) {
+		return file, size, nil
+	}
 	data, err := io.ReadAll(file)
 	if err != nil {
-		return model.Metadata{}, fmt.Errorf("error reading PDF data: %w", err)
+		return nil, 0, fmt.Errorf("error reading SVG data: %w", err)
 	}
+	sanitized, err := svg.Sanitize(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(sanitized), int64(len(sanitized)), nil
+}
 
-	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+func fillSVGMetadata(file io.Reader) (model.Metadata, error) {
+	data, err := io.ReadAll(file)
 	if err != nil {
-		return model.Metadata{}, fmt.Errorf("error opening pdf reader: %w", err)
+		return model.Metadata{}, fmt.Errorf("error reading SVG data: %w", err)
 	}
 
+	box, err := svg.ViewBox(data)
+	if errors.Is(err, svg.ErrNoViewBox) {
+		// it takes the size of wherever it is embedded
+		return model.Metadata{}, nil
+	}
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error reading SVG viewBox: %w", err)
+	}
 	return model.Metadata{
-		PageCount: reader.NumPage(),
+		Width:   max(1, int(math.Round(box.Width))),
+		Height:  max(1, int(math.Round(box.Height))),
+		ViewBox: []float64{box.MinX, box.MinY, box.Width, box.Height},
 	}, nil
 }
 
@@ -230,23 +308,35 @@ func fillMarkdownMetadata(file io.Reader) (model.Metadata, error) {
 	if err != nil {
 		return model.Metadata{}, fmt.Errorf("error reading markdown data: %w", err)
 	}
-	text := string(data)
 
-	words := strings.Fields(text)
+	doc, err := markdown.Parse(data)
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error parsing markdown: %w", err)
+	}
 
-	headingCount := 0
-	for _, line := range strings.Split(text, "\n") {
-		if strings.HasPrefix(line, "# ") || strings.HasPrefix(line, "##") {
-			headingCount++
+	var toc []model.TOCEntry
+	for _, h := range doc.Headings {
+		toc = append(toc, model.TOCEntry{Level: h.Level, Text: h.Text, ID: h.ID})
+	}
+	var refs []msuuid.UUID
+	for _, raw := range doc.MediaReferences {
+		var id msuuid.UUID
+		if err := id.UnmarshalText([]byte(raw)); err != nil {
+			// not a media of this service, the link is dropped from the rendering
+			continue
 		}
+		refs = append(refs, id)
 	}
 
-	linkRe := regexp.MustCompile(`\[[^]]+]\([^)]+\)`)
-	links := linkRe.FindAllString(text, -1)
-
 	return model.Metadata{
-		WordCount:    int64(len(words)),
-		HeadingCount: int64(headingCount),
-		LinkCount:    int64(len(links)),
+		WordCount:          int64(doc.WordCount),
+		HeadingCount:       int64(len(doc.Headings)),
+		LinkCount:          int64(doc.LinkCount),
+		Title:              doc.Title,
+		Tags:               doc.Tags,
+		Date:               doc.Date,
+		ReadingTimeMinutes: doc.ReadingTime(),
+		TableOfContents:    toc,
+		References:         refs,
 	}, nil
 }
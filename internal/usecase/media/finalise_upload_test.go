@@ -3,23 +3,30 @@ package media
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"image"
+	"image/color"
+	"image/gif"
 	"image/png"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/mock"
 	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 	"github.com/google/uuid"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
 func TestFinaliseUpload_ErrGetByID(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: errors.New("db fail")}
-	svc := NewUploadFinaliser(repo, &mock.Storage{}, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, &mock.Storage{}, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || err.Error() != "db fail" {
@@ -30,7 +37,7 @@ func TestFinaliseUpload_ErrGetByID(t *testing.T) {
 func TestFinaliseUpload_AlreadyCompleted(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusCompleted}
 	repo := &mock.MediaRepo{MediaOut: mrec}
-	svc := NewUploadFinaliser(repo, &mock.Storage{}, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, &mock.Storage{}, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -40,7 +47,7 @@ func TestFinaliseUpload_AlreadyCompleted(t *testing.T) {
 func TestFinaliseUpload_WrongStatus(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusFailed}
 	repo := &mock.MediaRepo{MediaOut: mrec}
-	svc := NewUploadFinaliser(repo, &mock.Storage{}, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, &mock.Storage{}, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "media status should be 'pending'") {
@@ -52,7 +59,7 @@ func TestFinaliseUpload_StatNotFound(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	stg := &mock.Storage{StatErr: ErrObjectNotFound}
 	repo := &mock.MediaRepo{MediaOut: mrec}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "staging file \"k\" not found") {
@@ -78,7 +85,7 @@ func TestFinaliseUpload_SizeValidation(t *testing.T) {
 		mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 		stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: tc.size, ContentType: "image/png"}}
 		repo := &mock.MediaRepo{MediaOut: mrec}
-		svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+		svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 		err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
 			t.Errorf("size %d: expected error containing %q, got %v", tc.size, tc.wantErr, err)
@@ -90,7 +97,7 @@ func TestFinaliseUpload_UnsupportedMime(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "application/zip"}}
 	repo := &mock.MediaRepo{MediaOut: mrec}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "unsupported mime-type") {
@@ -102,7 +109,7 @@ func TestFinaliseUpload_MoveGetFileError(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetErr: errors.New("can't read file")}
 	repo := &mock.MediaRepo{MediaOut: mrec}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "can't read file") {
@@ -114,7 +121,7 @@ func TestFinaliseUpload_MoveExtensionError(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "application/unknown"}}
 	repo := &mock.MediaRepo{MediaOut: mrec}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "unsupported mime-type") {
@@ -126,7 +133,7 @@ func TestFinaliseUpload_MoveMetadataError(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	repo := &mock.MediaRepo{MediaOut: mrec}
 	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: strings.NewReader("not-a-png")}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "error decoding") {
@@ -138,7 +145,7 @@ func TestFinaliseUpload_MoveSaveFileError(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	repo := &mock.MediaRepo{MediaOut: mrec}
 	stg := &mock.Storage{SaveErr: errors.New("save fail"), StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "save fail") {
@@ -150,7 +157,7 @@ func TestFinaliseUpload_MoveUpdateMediaError(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "k"}
 	repo := &mock.MediaRepo{MediaOut: mrec, UpdateErr: errors.New("update fail")}
 	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
-	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{})
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
 
 	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"})
 	if err == nil || !strings.Contains(err.Error(), "update fail") {
@@ -163,7 +170,7 @@ func TestFinaliseUpload_Success(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: mrec}
 	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
 	dispatcher := &mock.Dispatcher{}
-	svc := NewUploadFinaliser(repo, stg, dispatcher)
+	svc := NewUploadFinaliser(repo, stg, dispatcher, model.BucketsSettings{})
 
 	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -186,6 +193,193 @@ func TestFinaliseUpload_Success(t *testing.T) {
 	if !dispatcher.OptimiseCalled {
 		t.Error("expected optimise task to be enqueued")
 	}
+	if repo.SaveTextCalled {
+		t.Error("only PDFs and markdown documents have their text indexed")
+	}
+}
+
+func TestFinaliseUpload_BucketObjectOptions(t *testing.T) {
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name", OriginalFilename: "cat.png"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
+	buckets := model.BucketsSettings{"images": {CacheControl: "public, max-age=60", ObjectTags: map[string]string{"tier": "hot"}}}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, buckets)
+
+	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := stg.SaveOpts["Cache-Control"]; got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q; want the bucket one", got)
+	}
+	if got := stg.SaveOpts[port.TaggingOption]; got != "tier=hot" {
+		t.Errorf("tags = %q; want tier=hot", got)
+	}
+	if got := stg.SaveOpts["Content-Disposition"]; got != `inline; filename=cat.png` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if repo.ReplaceReferencesCalled {
+		t.Error("only markdown documents have references")
+	}
+}
+
+func TestFinaliseUpload_ExpiresAt(t *testing.T) {
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	expiresAt := time.Now().Add(time.Hour)
+	in := port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images", ExpiresAt: &expiresAt}
+	if err := svc.FinaliseUpload(context.Background(), in); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.GotUpdated == nil || repo.GotUpdated.ExpiresAt == nil || !repo.GotUpdated.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected repo.Update to set ExpiresAt %v", expiresAt)
+	}
+}
+
+func TestFinaliseUpload_AnimatedGIFMetadata(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 8, 6), palette),
+			image.NewPaletted(image.Rect(0, 0, 8, 6), palette),
+		},
+		Delay: []int{50, 25},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encode GIF: %v", err)
+	}
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/gif"}, GetOut: bytes.NewReader(buf.Bytes())}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "images"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := model.Metadata{Width: 8, Height: 6, FrameCount: 2, DurationMs: 750}
+	if !reflect.DeepEqual(mrec.Metadata, want) {
+		t.Errorf("metadata = %+v; want %+v", mrec.Metadata, want)
+	}
+	if mrec.ObjectKey != "name.gif" {
+		t.Errorf("ObjectKey = %q; want name.gif", mrec.ObjectKey)
+	}
+}
+
+func TestFinaliseUpload_ScanMetadata(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 8, 6))
+	var tiffData, bmpData bytes.Buffer
+	if err := tiff.Encode(&tiffData, img, nil); err != nil {
+		t.Fatalf("encode TIFF: %v", err)
+	}
+	if err := bmp.Encode(&bmpData, img); err != nil {
+		t.Fatalf("encode BMP: %v", err)
+	}
+	bmpBytes := bmpData.Bytes()
+	binary.LittleEndian.PutUint32(bmpBytes[38:42], 11811) // 300 DPI in pixels per metre
+
+	tests := []struct {
+		mimeType string
+		data     []byte
+		wantKey  string
+		want     model.Metadata
+	}{
+		{"image/tiff", tiffData.Bytes(), "name.tiff", model.Metadata{Width: 8, Height: 6, PageCount: 1, DPI: 72}},
+		{"image/bmp", bmpBytes, "name.bmp", model.Metadata{Width: 8, Height: 6, DPI: 300}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.mimeType, func(t *testing.T) {
+			mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+			repo := &mock.MediaRepo{MediaOut: mrec}
+			stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: tc.mimeType}, GetOut: bytes.NewReader(tc.data)}
+			svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+			if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "scans"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mrec.Metadata, tc.want) {
+				t.Errorf("metadata = %+v; want %+v", mrec.Metadata, tc.want)
+			}
+			if mrec.ObjectKey != tc.wantKey {
+				t.Errorf("ObjectKey = %q; want %q", mrec.ObjectKey, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestFinaliseUpload_MarkdownMetadata(t *testing.T) {
+	imageID := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	doc := "---\ntitle: Guide\ntags: [go, docs]\ndate: 2024-05-01\n---\n" +
+		"# Guide\n\nRead the [docs](https://example.com).\n\n## Set up\n\n```\nnot counted\n```\n" +
+		"![](media:aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee) ![](media:not-an-id)\n"
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "text/markdown"}, GetOut: strings.NewReader(doc)}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "docs"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := model.Metadata{
+		WordCount:          6,
+		HeadingCount:       2,
+		LinkCount:          1,
+		Title:              "Guide",
+		Tags:               []string{"go", "docs"},
+		Date:               "2024-05-01",
+		ReadingTimeMinutes: 1,
+		TableOfContents: []model.TOCEntry{
+			{Level: 1, Text: "Guide", ID: "guide"},
+			{Level: 2, Text: "Set up", ID: "set-up"},
+		},
+		References: []msuuid.UUID{imageID},
+	}
+	if !reflect.DeepEqual(mrec.Metadata, want) {
+		t.Errorf("metadata = %+v; want %+v", mrec.Metadata, want)
+	}
+	if !repo.ReplaceReferencesCalled || !reflect.DeepEqual(repo.GotReferences, []msuuid.UUID{imageID}) {
+		t.Errorf("references recorded = %v; want the image", repo.GotReferences)
+	}
+	if !repo.SaveTextCalled || !strings.HasPrefix(repo.GotText, "Guide Guide Read the docs.") || strings.Contains(repo.GotText, "\n") {
+		t.Errorf("indexed text = %q; want the title then the collapsed text", repo.GotText)
+	}
+}
+
+func TestFinaliseUpload_MarkdownInvalidFrontMatter(t *testing.T) {
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "text/markdown"}, GetOut: strings.NewReader("---\ntitle: [oops\n---\ntext\n")}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "docs"})
+	if err == nil || !strings.Contains(err.Error(), "invalid front matter") {
+		t.Errorf("expected metadata error, got %v", err)
+	}
+	if stg.SaveCalled {
+		t.Error("file should not be moved")
+	}
+}
+
+func TestFinaliseUpload_UnsafePDF(t *testing.T) {
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	pdf := buildPDF("/OpenAction 6 0 R", "<< /S /JavaScript /JS (app.alert(1)) >>")
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "application/pdf"}, GetOut: bytes.NewReader(pdf)}
+	buckets := model.BucketsSettings{"docs": {RejectUnsafePDFs: true}}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, buckets)
+
+	err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "docs"})
+	if !errors.Is(err, ErrUnsafePDF) {
+		t.Fatalf("expected ErrUnsafePDF, got %v", err)
+	}
+	if stg.SaveCalled {
+		t.Error("file should not be moved")
+	}
+	if mrec.Status != model.MediaStatusFailed {
+		t.Errorf("Status = %q; want Failed", mrec.Status)
+	}
 }
 
 func getPNGReader(t *testing.T) io.ReadSeeker {
@@ -198,3 +392,42 @@ func getPNGReader(t *testing.T) io.ReadSeeker {
 
 	return bytes.NewReader(buf.Bytes())
 }
+
+func TestFinaliseUpload_SVG(t *testing.T) {
+	src := `<svg viewBox="0 0 24 12.4" onload="alert(1)"><script>alert(1)</script><rect width="24" height="12"/></svg>`
+	want := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 12.4"><rect width="24" height="12"/></svg>`
+	mrec := &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/svg+xml"}, GetOut: strings.NewReader(src)}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "icons"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(stg.SavedContent) != want {
+		t.Errorf("saved %s; want %s", stg.SavedContent, want)
+	}
+	if mrec.SizeBytes == nil || *mrec.SizeBytes != int64(len(want)) {
+		t.Errorf("size = %v; want the sanitized size %d", mrec.SizeBytes, len(want))
+	}
+	wantMeta := model.Metadata{Width: 24, Height: 12, ViewBox: []float64{0, 0, 24, 12.4}}
+	if !reflect.DeepEqual(mrec.Metadata, wantMeta) {
+		t.Errorf("metadata = %+v; want %+v", mrec.Metadata, wantMeta)
+	}
+	if mrec.ObjectKey != "name.svg" {
+		t.Errorf("ObjectKey = %q; want name.svg", mrec.ObjectKey)
+	}
+}
+
+func TestFinaliseUpload_InvalidSVG(t *testing.T) {
+	stg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/svg+xml"}, GetOut: strings.NewReader(`<html><script>alert(1)</script></html>`)}
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusPending, ObjectKey: "name"}}
+	svc := NewUploadFinaliser(repo, stg, &mock.Dispatcher{}, model.BucketsSettings{})
+
+	if err := svc.FinaliseUpload(context.Background(), port.FinaliseUploadInput{ID: msuuid.UUID(uuid.Nil), DestBucket: "icons"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if stg.SaveCalled {
+		t.Error("an invalid SVG should not be stored")
+	}
+}
@@ -0,0 +1,158 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type versionFinaliserSrv struct {
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	strg     port.Storage
+	tasks    port.TaskDispatcher
+	cache    port.Cache
+	buckets  model.BucketsSettings
+}
+
+// compile-time check: *versionFinaliserSrv must satisfy port.VersionFinaliser
+var _ port.VersionFinaliser = (*versionFinaliserSrv)(nil)
+
+// NewVersionFinaliser constructs a VersionFinaliser implementation.
+func NewVersionFinaliser(repo port.MediaRepository, versions port.MediaVersionRepository, strg port.Storage, tasks port.TaskDispatcher, cache port.Cache, buckets model.BucketsSettings) port.VersionFinaliser {
+	return &versionFinaliserSrv{repo, versions, strg, tasks, cache, buckets}
+}
+
+// FinaliseVersion validates the new version waiting in the staging bucket and swaps it with the current file.
+// The current file is kept in the version history, and the new one goes through optimisation again.
+func (s *versionFinaliserSrv) FinaliseVersion(ctx context.Context, id msuuid.UUID) error {
+	media, err := getCompletedMedia(ctx, s.repo, id)
+	if err != nil {
+		return err
+	}
+
+	version, err := nextVersion(ctx, s.versions, media)
+	if err != nil {
+		return err
+	}
+	stagingKey := versionStagingKey(media.ID, version)
+
+	info, err := s.strg.StatFile(ctx, "staging", stagingKey)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return ErrNoVersionUpload
+		}
+		return fmt.Errorf("stats for file %q failed: %w", stagingKey, err)
+	}
+
+	if err := validateStagedFile(info, stagingKey); err != nil {
+		if remErr := s.strg.RemoveFile(ctx, "staging", stagingKey); remErr != nil {
+			logger.Errorf(ctx, "cleanup failed for file %q: %v", stagingKey, remErr)
+		}
+		return err
+	}
+
+	file, err := s.strg.GetFile(ctx, "staging", stagingKey)
+	if err != nil {
+		return err
+	}
+	defer func(file io.ReadSeekCloser) {
+		if err := file.Close(); err != nil {
+			logger.Warn(ctx, "failed to close reader")
+		}
+	}(file)
+
+	metadata, err := fillMetadata(info.ContentType, file)
+	if err != nil {
+		return fmt.Errorf("failed to fill metadata: %w", err)
+	}
+	if err := checkPDFSafety(s.buckets.Get(media.Bucket), metadata); err != nil {
+		if remErr := s.strg.RemoveFile(ctx, "staging", stagingKey); remErr != nil {
+			logger.Errorf(ctx, "cleanup failed for file %q: %v", stagingKey, remErr)
+		}
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reset reader: %w", err)
+	}
+	text, err := extractText(ctx, info.ContentType, file)
+	if err != nil {
+		return err
+	}
+
+	ext, err := MimeTypeToExtension(info.ContentType)
+	if err != nil {
+		return err
+	}
+	newObjectKey := fmt.Sprintf("%s%s", stagingKey, ext)
+
+	if err := s.strg.SaveFile(
+		ctx,
+		media.Bucket,
+		newObjectKey,
+		file,
+		info.SizeBytes,
+		objectOptions(s.buckets.Get(media.Bucket), media, info.ContentType),
+	); err != nil {
+		return fmt.Errorf("failed to save version %d of media #%s: %w", version, media.ID, err)
+	}
+
+	if err := s.strg.RemoveFile(ctx, "staging", stagingKey); err != nil {
+		logger.Warnf(ctx, "failed to clean up file %q in staging: %v", stagingKey, err)
+	}
+
+	previous := snapshotVersion(media)
+	if err := s.versions.Create(ctx, previous); err != nil {
+		s.removeFile(ctx, media.Bucket, newObjectKey)
+		return fmt.Errorf("failed archiving version %d of media #%s: %w", previous.Version, media.ID, err)
+	}
+
+	size := info.SizeBytes
+	contentType := info.ContentType
+	media.ObjectKey = newObjectKey
+	media.MimeType = &contentType
+	media.SizeBytes = &size
+	media.OriginalObjectKey = nil
+	media.OriginalSizeBytes = nil
+	media.Metadata = metadata
+	media.Optimised = false
+	media.Variants = model.Variants{}
+	media.Version = version
+
+	if err := s.repo.Update(ctx, media); err != nil {
+		if delErr := s.versions.Delete(ctx, previous.MediaID, previous.Version); delErr != nil {
+			logger.Warnf(ctx, "failed to remove archived version %d of media #%s after update failure: %v", previous.Version, media.ID, delErr)
+		}
+		s.removeFile(ctx, media.Bucket, newObjectKey)
+		return fmt.Errorf("failed updating media: %w", err)
+	}
+	recordReferences(ctx, s.repo, media)
+	// also clears the text of a previous version the new one does not have
+	indexText(ctx, s.repo, media.ID, text)
+
+	if err := s.tasks.EnqueueOptimiseMedia(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed to enqueue optimise task for media #%s: %v", media.ID, err)
+	}
+
+	if err := s.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
+	}
+	if err := s.cache.DeleteEtagMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", media.ID, err)
+	}
+
+	return nil
+}
+
+func (s *versionFinaliserSrv) removeFile(ctx context.Context, bucket, objectKey string) {
+	if err := s.strg.RemoveFile(ctx, bucket, objectKey); err != nil {
+		logger.Warnf(ctx, "failed to remove file %q from bucket %q: %v", objectKey, bucket, err)
+	}
+}
@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func newVersionedMedia() *model.Media {
+	mt := "image/webp"
+	size := int64(2048)
+	return &model.Media{
+		ID:        msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")),
+		ObjectKey: "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee.webp",
+		Bucket:    "images",
+		Status:    model.MediaStatusCompleted,
+		MimeType:  &mt,
+		SizeBytes: &size,
+		Optimised: true,
+		Metadata:  model.Metadata{Width: 10, Height: 10},
+		Variants:  model.Variants{{ObjectKey: "variants/foo_100.webp", Width: 100}},
+		Version:   1,
+	}
+}
+
+func TestFinaliseVersion_NotCompleted(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusDeleted}}
+	svc := NewVersionFinaliser(repo, &mock.MediaVersionRepo{}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.FinaliseVersion(context.Background(), msuuid.UUID{}); !errors.Is(err, ErrNotCompleted) {
+		t.Fatalf("expected ErrNotCompleted, got %v", err)
+	}
+}
+
+func TestFinaliseVersion_NothingUploaded(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: newVersionedMedia()}
+	strg := &mock.Storage{StatErr: ErrObjectNotFound}
+	svc := NewVersionFinaliser(repo, &mock.MediaVersionRepo{}, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.FinaliseVersion(context.Background(), msuuid.UUID{}); !errors.Is(err, ErrNoVersionUpload) {
+		t.Fatalf("expected ErrNoVersionUpload, got %v", err)
+	}
+}
+
+func TestFinaliseVersion_InvalidFile(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: newVersionedMedia()}
+	versions := &mock.MediaVersionRepo{}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "application/zip"}}
+	svc := NewVersionFinaliser(repo, versions, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	err := svc.FinaliseVersion(context.Background(), msuuid.UUID{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported mime-type") {
+		t.Fatalf("expected unsupported mime-type error, got %v", err)
+	}
+	if !strg.RemoveCalled {
+		t.Error("expected staging file to be removed")
+	}
+	if versions.CreateCalled || repo.UpdateCalled {
+		t.Error("expected the current version to stay untouched")
+	}
+}
+
+func TestFinaliseVersion_UnsafePDF(t *testing.T) {
+	m := newVersionedMedia()
+	m.Bucket = "docs"
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{}
+	pdf := buildPDF(
+		"/Names << /EmbeddedFiles << /Names [(run.bat) 6 0 R] >> >>",
+		"<< /Type /Filespec /F (run.bat) /EF << /F 7 0 R >> >>",
+		"<< /Type /EmbeddedFile /Length 2 >>\nstream\nMZ\nendstream",
+	)
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "application/pdf"}, GetOut: bytes.NewReader(pdf)}
+	buckets := model.BucketsSettings{"docs": {RejectUnsafePDFs: true}}
+	svc := NewVersionFinaliser(repo, versions, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets)
+
+	if err := svc.FinaliseVersion(context.Background(), m.ID); !errors.Is(err, ErrUnsafePDF) {
+		t.Fatalf("expected ErrUnsafePDF, got %v", err)
+	}
+	if !strg.RemoveCalled {
+		t.Error("expected staging file to be removed")
+	}
+	if strg.SaveCalled || versions.CreateCalled || repo.UpdateCalled {
+		t.Error("expected the current version to stay untouched")
+	}
+}
+
+func TestFinaliseVersion_ArchiveError(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: newVersionedMedia()}
+	versions := &mock.MediaVersionRepo{CreateErr: errors.New("insert fail")}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
+	svc := NewVersionFinaliser(repo, versions, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	err := svc.FinaliseVersion(context.Background(), msuuid.UUID{})
+	if err == nil || !strings.Contains(err.Error(), "insert fail") {
+		t.Fatalf("expected archive error, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("expected no media update")
+	}
+}
+
+func TestFinaliseVersion_UpdateError(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: newVersionedMedia(), UpdateErr: errors.New("update fail")}
+	versions := &mock.MediaVersionRepo{}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
+	svc := NewVersionFinaliser(repo, versions, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	err := svc.FinaliseVersion(context.Background(), msuuid.UUID{})
+	if err == nil || !strings.Contains(err.Error(), "update fail") {
+		t.Fatalf("expected update error, got %v", err)
+	}
+	if len(versions.GotDeletedVersion) != 1 || versions.GotDeletedVersion[0] != 1 {
+		t.Errorf("expected archived version 1 to be removed, got %v", versions.GotDeletedVersion)
+	}
+}
+
+func TestFinaliseVersion_Success(t *testing.T) {
+	m := newVersionedMedia()
+	previous := *m
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: MinFileSize, ContentType: "image/png"}, GetOut: getPNGReader(t)}
+	dispatcher := &mock.Dispatcher{}
+	cache := &mock.Cache{}
+	svc := NewVersionFinaliser(repo, versions, strg, dispatcher, cache, model.BucketsSettings{})
+
+	if err := svc.FinaliseVersion(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(versions.GotCreated) != 1 {
+		t.Fatalf("expected one archived version, got %d", len(versions.GotCreated))
+	}
+	archived := versions.GotCreated[0]
+	if archived.Version != 1 || archived.ObjectKey != previous.ObjectKey || len(archived.Variants) != 1 {
+		t.Errorf("archived version = %+v; want a copy of version 1", archived)
+	}
+
+	got := repo.GotUpdated
+	if got == nil {
+		t.Fatal("expected repo.Update to be called")
+	}
+	if got.Version != 2 {
+		t.Errorf("Version = %d; want 2", got.Version)
+	}
+	if want := m.ID.String() + "_v2.png"; got.ObjectKey != want {
+		t.Errorf("ObjectKey = %q; want %q", got.ObjectKey, want)
+	}
+	if got.Optimised || len(got.Variants) != 0 {
+		t.Errorf("expected an unoptimised media without variants, got %+v", got)
+	}
+	if *got.MimeType != "image/png" || *got.SizeBytes != MinFileSize {
+		t.Errorf("MimeType/SizeBytes = %q/%d; want image/png/%d", *got.MimeType, *got.SizeBytes, MinFileSize)
+	}
+	if !strg.SaveCalled {
+		t.Error("expected the new version to be saved")
+	}
+	if !dispatcher.OptimiseCalled {
+		t.Error("expected optimise task to be enqueued")
+	}
+	if !repo.ReplaceReferencesCalled || len(repo.GotReferences) != 0 {
+		t.Errorf("references = %v; want those of the new version cleared", repo.GotReferences)
+	}
+	if !repo.SaveTextCalled || repo.GotText != "" {
+		t.Errorf("indexed text = %q; want the text of the previous version cleared", repo.GotText)
+	}
+	if !cache.DelMediaCalled || !cache.DelEtagMediaCalled {
+		t.Error("expected cache to be cleared")
+	}
+}
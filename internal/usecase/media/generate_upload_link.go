@@ -32,6 +32,9 @@ func (s *uploadLinkGeneratorSrv) GenerateUploadLink(ctx context.Context, in port
 		Status:           model.MediaStatusPending,
 		Metadata:         model.Metadata{},
 		Variants:         model.Variants{},
+		Version:          1,
+		ExpiresAt:        in.ExpiresAt,
+		OwnerID:          in.OwnerID,
 	}
 
 	if err := s.repo.Create(ctx, media); err != nil {
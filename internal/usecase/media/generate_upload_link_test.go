@@ -116,3 +116,30 @@ func TestGenerateUploadLink_StorageError(t *testing.T) {
 		t.Error("expected strg.GeneratePresignedUploadURL to be called")
 	}
 }
+
+func TestGenerateUploadLink_ExpiresAt(t *testing.T) {
+	mockID := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	repo := &mock.MediaRepo{}
+	svc := NewUploadLinkGenerator(repo, &mock.Storage{}, func() msuuid.UUID { return mockID })
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	if _, err := svc.GenerateUploadLink(context.Background(), port.GenerateUploadLinkInput{Name: "export.pdf", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if repo.GotCreated == nil || repo.GotCreated.ExpiresAt == nil || !repo.GotCreated.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected media to be created with ExpiresAt %v, got %+v", expiresAt, repo.GotCreated)
+	}
+}
+
+func TestGenerateUploadLink_Owner(t *testing.T) {
+	ownerID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	repo := &mock.MediaRepo{}
+	svc := NewUploadLinkGenerator(repo, &mock.Storage{}, msuuid.NewUUID)
+
+	if _, err := svc.GenerateUploadLink(context.Background(), port.GenerateUploadLinkInput{Name: "notes.md", OwnerID: &ownerID}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if repo.GotCreated == nil || repo.GotCreated.OwnerID == nil || *repo.GotCreated.OwnerID != ownerID {
+		t.Errorf("expected media to be created for owner %s, got %+v", ownerID, repo.GotCreated)
+	}
+}
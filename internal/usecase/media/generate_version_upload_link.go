@@ -0,0 +1,46 @@
+package media
+
+import (
+	"context"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+type versionUploadLinkGeneratorSrv struct {
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	strg     port.Storage
+}
+
+// compile-time check: *versionUploadLinkGeneratorSrv must satisfy port.VersionUploadLinkGenerator
+var _ port.VersionUploadLinkGenerator = (*versionUploadLinkGeneratorSrv)(nil)
+
+// NewVersionUploadLinkGenerator constructs a VersionUploadLinkGenerator implementation.
+func NewVersionUploadLinkGenerator(repo port.MediaRepository, versions port.MediaVersionRepository, strg port.Storage) port.VersionUploadLinkGenerator {
+	return &versionUploadLinkGeneratorSrv{repo, versions, strg}
+}
+
+// GenerateVersionUploadLink returns a link to upload the next version of a completed media to the staging bucket.
+func (s *versionUploadLinkGeneratorSrv) GenerateVersionUploadLink(ctx context.Context, id msuuid.UUID) (port.GenerateUploadLinkOutput, error) {
+	media, err := getCompletedMedia(ctx, s.repo, id)
+	if err != nil {
+		return port.GenerateUploadLinkOutput{}, err
+	}
+
+	version, err := nextVersion(ctx, s.versions, media)
+	if err != nil {
+		return port.GenerateUploadLinkOutput{}, err
+	}
+
+	url, err := s.strg.GeneratePresignedUploadURL(ctx, "staging", versionStagingKey(media.ID, version), 5*time.Minute)
+	if err != nil {
+		return port.GenerateUploadLinkOutput{}, err
+	}
+
+	return port.GenerateUploadLinkOutput{
+		ID:  media.ID,
+		URL: url,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestGenerateVersionUploadLink_NotFound(t *testing.T) {
+	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
+	svc := NewVersionUploadLinkGenerator(repo, &mock.MediaVersionRepo{}, &mock.Storage{})
+
+	if _, err := svc.GenerateVersionUploadLink(context.Background(), msuuid.UUID{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestGenerateVersionUploadLink_NotCompleted(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusPending}}
+	strg := &mock.Storage{}
+	svc := NewVersionUploadLinkGenerator(repo, &mock.MediaVersionRepo{}, strg)
+
+	if _, err := svc.GenerateVersionUploadLink(context.Background(), msuuid.UUID{}); !errors.Is(err, ErrNotCompleted) {
+		t.Fatalf("expected ErrNotCompleted, got %v", err)
+	}
+	if strg.GenerateUploadLinkCalled {
+		t.Error("expected no upload link to be generated")
+	}
+}
+
+func TestGenerateVersionUploadLink_VersionsError(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusCompleted, Version: 1}}
+	versions := &mock.MediaVersionRepo{ListErr: errors.New("db fail")}
+	svc := NewVersionUploadLinkGenerator(repo, versions, &mock.Storage{})
+
+	if _, err := svc.GenerateVersionUploadLink(context.Background(), msuuid.UUID{}); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+}
+
+func TestGenerateVersionUploadLink_Success(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	repo := &mock.MediaRepo{MediaOut: &model.Media{ID: id, Status: model.MediaStatusCompleted, Version: 2}}
+	// version 3 was rolled back from, so the next one must be 4
+	versions := &mock.MediaVersionRepo{ListOut: []model.MediaVersion{{Version: 3}, {Version: 1}}}
+	strg := &mock.Storage{}
+	svc := NewVersionUploadLinkGenerator(repo, versions, strg)
+
+	out, err := svc.GenerateVersionUploadLink(context.Background(), id)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.ID != id {
+		t.Errorf("ID = %s; want %s", out.ID, id)
+	}
+	if out.URL != "https://example.com/upload" {
+		t.Errorf("URL = %q; want %q", out.URL, "https://example.com/upload")
+	}
+	if want := id.String() + "_v4"; strg.ObjectKey != want {
+		t.Errorf("staging key = %q; want %q", strg.ObjectKey, want)
+	}
+	if strg.TTL != 5*time.Minute {
+		t.Errorf("TTL = %v; want %v", strg.TTL, 5*time.Minute)
+	}
+}
@@ -5,42 +5,81 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
-	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
 
 	"github.com/fhuszti/medias-ms-go/internal/logger"
 )
 
 type mediaGetterSrv struct {
-	repo port.MediaRepository
-	strg port.Storage
+	repo    port.MediaRepository
+	strg    port.Storage
+	buckets model.BucketsSettings
 }
 
 // compile-time check: *mediaGetterSrv must satisfy port.MediaGetter
 var _ port.MediaGetter = (*mediaGetterSrv)(nil)
 
-func NewMediaGetter(repo port.MediaRepository, strg port.Storage) port.MediaGetter {
-	return &mediaGetterSrv{repo: repo, strg: strg}
+func NewMediaGetter(repo port.MediaRepository, strg port.Storage, buckets model.BucketsSettings) port.MediaGetter {
+	return &mediaGetterSrv{repo: repo, strg: strg, buckets: buckets}
 }
 
-func (s *mediaGetterSrv) GetMedia(ctx context.Context, id msuuid.UUID) (*port.GetMediaOutput, error) {
-	media, err := s.repo.GetByID(ctx, id)
+func (s *mediaGetterSrv) GetMedia(ctx context.Context, in port.GetMediaInput) (*port.GetMediaOutput, error) {
+	media, err := s.repo.GetByID(ctx, in.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrObjectNotFound
 		}
 		return nil, err
 	}
+	if media.Status == model.MediaStatusDeleted {
+		return nil, ErrObjectNotFound
+	}
 	if media.Status != model.MediaStatusCompleted {
 		return nil, errors.New("media status should be 'completed' to be returned")
 	}
 
-	url, err := s.strg.GeneratePresignedDownloadURL(ctx, media.Bucket, media.ObjectKey, DownloadUrlTTL)
+	now := time.Now()
+	urlTTL, err := downloadTTL(media, now)
 	if err != nil {
-		return nil, fmt.Errorf("error generating presigned download URL for file %q: %w", media.ObjectKey, err)
+		return nil, err
+	}
+	bucket := s.buckets.Get(media.Bucket)
+	var validUntil time.Time
+	if !bucket.IsPublic() {
+		validUntil = now.Add(DownloadUrlTTL - 5*time.Minute)
+	}
+	if media.ExpiresAt != nil && (validUntil.IsZero() || media.ExpiresAt.Before(validUntil)) {
+		validUntil = *media.ExpiresAt
+	}
+
+	link := fileLinker(ctx, s.strg, media.Bucket, bucket, urlTTL)
+
+	// watermarked files, and their originals, are only downloadable through the API
+	watermarked := isWatermarked(bucket, *media.MimeType)
+	// users only given the overlaid variants get the widest one in place of the clean main file,
+	// and no original
+	overlay := overlaid(media, bucket, in.UserID)
+	shown := *media
+	shown.Variants = visibleVariants(media, bucket, in.UserID)
+	mainKey, linked := media.ObjectKey, !watermarked
+	if overlay {
+		candidates := downloadCandidates(&shown, false)
+		linked = len(candidates) > 0
+		if linked {
+			mainKey = fitWidth(candidates, 0).objectKey
+		}
+	}
+	var url string
+	if linked {
+		url, err = link(mainKey)
+		if err != nil {
+			return nil, fmt.Errorf("error generating presigned download URL for file %q: %w", mainKey, err)
+		}
 	}
 
 	mt := port.MetadataOutput{
@@ -49,29 +88,85 @@ func (s *mediaGetterSrv) GetMedia(ctx context.Context, id msuuid.UUID) (*port.Ge
 		MimeType:  *media.MimeType,
 	}
 	output := port.GetMediaOutput{
-		ValidUntil: time.Now().Add(DownloadUrlTTL - 5*time.Minute),
-		Optimised:  media.Optimised,
-		URL:        url,
-		Metadata:   mt,
-	}
-
-	if IsImage(*media.MimeType) {
-		var variants model.VariantsOutput
-		for _, v := range media.Variants {
-			vUrl, vErr := s.strg.GeneratePresignedDownloadURL(ctx, media.Bucket, v.ObjectKey, DownloadUrlTTL)
-			if vErr != nil {
-				logger.Warnf(ctx, "error generating presigned download URL for variant %q: %+v", v.ObjectKey, vErr)
-				continue
-			}
-			variants = append(variants, model.VariantOutput{
-				URL:       vUrl,
-				Width:     v.Width,
-				SizeBytes: v.SizeBytes,
-				Height:    v.Height,
-			})
+		ValidUntil:  validUntil,
+		Public:      bucket.IsPublic(),
+		Optimised:   media.Optimised,
+		URL:         url,
+		Watermarked: watermarked,
+		DerivedFrom: media.DerivedFrom,
+		Metadata:    mt,
+		ExpiresAt:   media.ExpiresAt,
+	}
+
+	if media.OriginalObjectKey != nil && !watermarked && !overlay {
+		oUrl, oErr := link(*media.OriginalObjectKey)
+		if oErr != nil {
+			logger.Warnf(ctx, "error generating presigned download URL for original %q: %+v", *media.OriginalObjectKey, oErr)
+		} else {
+			output.OriginalURL = oUrl
+		}
+	}
+
+	var variants model.VariantsOutput
+	for _, v := range shown.Variants {
+		// compressed copies are served in place of the file itself
+		if v.Encoding != "" {
+			continue
+		}
+		vUrl, vErr := link(v.ObjectKey)
+		if vErr != nil {
+			logger.Warnf(ctx, "error generating presigned download URL for variant %q: %+v", v.ObjectKey, vErr)
+			continue
 		}
-		output.Variants = variants
+		variants = append(variants, model.VariantOutput{
+			Name:        v.Name(),
+			URL:         vUrl,
+			Width:       v.Width,
+			SizeBytes:   v.SizeBytes,
+			Height:      v.Height,
+			MimeType:    v.Format(),
+			Watermarked: v.Watermarked,
+		})
 	}
+	output.Variants = variants
+	// the clean variants of the owner are not to be cached for everyone
+	output.Personal = bucket.Overlay != nil && IsImage(*media.MimeType) && isOwner(media, in.UserID)
 
 	return &output, nil
 }
+
+// fileLinker returns how the files of a bucket are linked to: files of public buckets have
+// stable URLs, the others are presigned for ttl.
+func fileLinker(ctx context.Context, strg port.Storage, bucket string, settings model.BucketSettings, ttl time.Duration) func(key string) (string, error) {
+	return func(key string) (string, error) {
+		if settings.IsPublic() {
+			return publicURL(settings.PublicBaseURL, key), nil
+		}
+		return strg.GeneratePresignedDownloadURL(ctx, bucket, key, ttl, nil)
+	}
+}
+
+// publicURL builds the stable URL of a file in a public bucket.
+func publicURL(baseURL, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return baseURL + "/" + strings.Join(segments, "/")
+}
+
+// downloadTTL returns how long the download links of the media can be valid,
+// so they never outlive the media itself.
+func downloadTTL(media *model.Media, now time.Time) (time.Duration, error) {
+	if media.ExpiresAt == nil {
+		return DownloadUrlTTL, nil
+	}
+	remaining := media.ExpiresAt.Sub(now)
+	if remaining < time.Second {
+		return 0, ErrMediaExpired
+	}
+	if remaining < DownloadUrlTTL {
+		return remaining.Truncate(time.Second), nil
+	}
+	return DownloadUrlTTL, nil
+}
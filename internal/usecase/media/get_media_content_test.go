@@ -0,0 +1,185 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestGetMediaContent_Errors(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name    string
+		repo    *mock.MediaRepo
+		strg    *mock.Storage
+		variant string
+		wantErr error
+	}{
+		{"not found", &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}, &mock.Storage{}, "", ErrObjectNotFound},
+		{"trashed", &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusDeleted}}, &mock.Storage{}, "", ErrObjectNotFound},
+		{"pending", &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusPending}}, &mock.Storage{}, "", ErrNotCompleted},
+		{"expired", &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusCompleted, ExpiresAt: &expired}}, &mock.Storage{}, "", ErrMediaExpired},
+		{"unknown variant", &mock.MediaRepo{MediaOut: newDownloadableMedia()}, &mock.Storage{}, "999", ErrVariantNotFound},
+		{"missing file", &mock.MediaRepo{MediaOut: newDownloadableMedia()}, &mock.Storage{StatErr: ErrObjectNotFound}, "", ErrObjectNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewMediaContentGetter(tc.repo, tc.strg, &mock.Cache{}, nil)
+			_, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{Variant: tc.variant})
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("error = %v; want %v", err, tc.wantErr)
+			}
+			if tc.strg.GetRangeCalled || tc.strg.GetCalled {
+				t.Error("no content should be read")
+			}
+		})
+	}
+}
+
+func TestGetMediaContent_Success(t *testing.T) {
+	modified := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		variant  string
+		wantKey  string
+		wantMime string
+	}{
+		{"main file", "", "foo.webp", "image/webp"},
+		{"named variant", "300-png", "variants/x/foo_300.png", "image/png"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{
+				StatInfoOut: port.FileInfo{SizeBytes: 5, ContentType: "binary/octet-stream", ETag: "abc", LastModified: modified},
+				GetOut:      bytes.NewReader([]byte("hello")),
+			}
+			svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: newDownloadableMedia()}, strg, &mock.Cache{}, nil)
+
+			out, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{Variant: tc.variant})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.MimeType != tc.wantMime || out.SizeBytes != 5 || out.ETag != "abc" || !out.LastModified.Equal(modified) {
+				t.Errorf("output = %+v", out)
+			}
+			if out.ContentDisposition == "" {
+				t.Error("expected a content disposition")
+			}
+			if strg.GetRangeCalled {
+				t.Error("content should only be read on demand")
+			}
+
+			body, err := io.ReadAll(out.Content)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(body) != "hello" {
+				t.Errorf("content = %q; want %q", body, "hello")
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("read %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestGetMediaContent_EncodedText(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		variant        string
+		wantKey        string
+		wantEncoding   string
+	}{
+		{"identity", "", "", "foo.md", ""},
+		{"brotli", "br, gzip", "", "variants/x/foo.md.br", "br"},
+		{"named copy", "", "gzip", "variants/x/foo.md.gz", "gzip"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 5}}
+			svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: newEncodedTextMedia()}, strg, &mock.Cache{}, nil)
+
+			out, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{AcceptEncoding: tc.acceptEncoding, Variant: tc.variant})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := io.ReadAll(out.Content); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("read %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+			if out.ContentEncoding != tc.wantEncoding || out.MimeType != "text/markdown" {
+				t.Errorf("encoding, mime type = %q, %q; want %q, text/markdown", out.ContentEncoding, out.MimeType, tc.wantEncoding)
+			}
+		})
+	}
+}
+
+func TestGetMediaContent_Overlay(t *testing.T) {
+	owner := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	other := msuuid.UUID(uuid.MustParse("66666666-7777-8888-9999-000000000000"))
+	buckets := model.BucketsSettings{"images": {Overlay: &model.ImageOverlay{MediaID: other, Opacity: 0.5, Scale: 0.2}}}
+
+	tests := []struct {
+		name    string
+		userID  *msuuid.UUID
+		wantKey string
+	}{
+		{"anonymous", nil, "variants/x/foo_300_overlay.webp"},
+		{"other user", &other, "variants/x/foo_300_overlay.webp"},
+		{"owner", &owner, "foo.png"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			strg := &mock.Storage{
+				StatInfoOut: port.FileInfo{SizeBytes: 5},
+				GetOut:      bytes.NewReader([]byte("hello")),
+			}
+			svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: newOverlaidMedia(owner)}, strg, &mock.Cache{}, buckets)
+
+			out, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{UserID: tc.userID})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := io.ReadAll(out.Content); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strg.ObjectKey != tc.wantKey {
+				t.Errorf("read %q; want %q", strg.ObjectKey, tc.wantKey)
+			}
+		})
+	}
+}
+
+func TestGetMediaContent_OverlayNotDrawnYet(t *testing.T) {
+	owner := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	media := newOverlaidMedia(owner)
+	media.Variants = media.Variants[:2]
+	buckets := model.BucketsSettings{"images": {Overlay: &model.ImageOverlay{Opacity: 0.5, Scale: 0.2}}}
+	strg := &mock.Storage{}
+	svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: media}, strg, &mock.Cache{}, buckets)
+
+	_, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{})
+	if !errors.Is(err, ErrVariantNotFound) {
+		t.Fatalf("expected ErrVariantNotFound, got %v", err)
+	}
+	if strg.GetRangeCalled || strg.GetCalled {
+		t.Error("the clean main file should not be read")
+	}
+}
@@ -6,18 +6,21 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fhuszti/medias-ms-go/internal/mock"
 	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
 	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
 )
 
 func TestGetMedia_RepoError(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: errors.New("db fail")}
 	strg := &mock.Storage{}
-	svc := NewMediaGetter(repo, strg)
+	svc := NewMediaGetter(repo, strg, nil)
 
-	_, err := svc.GetMedia(context.Background(), msuuid.UUID{})
+	_, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -27,23 +30,34 @@ func TestGetMedia_WrongStatus(t *testing.T) {
 	mrec := &model.Media{Status: model.MediaStatusPending}
 	repo := &mock.MediaRepo{MediaOut: mrec}
 	strg := &mock.Storage{}
-	svc := NewMediaGetter(repo, strg)
+	svc := NewMediaGetter(repo, strg, nil)
 
-	_, err := svc.GetMedia(context.Background(), msuuid.UUID{})
+	_, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
 	want := "media status should be 'completed' to be returned"
 	if err == nil || err.Error() != want {
 		t.Fatalf("expected %q, got %v", want, err)
 	}
 }
 
+func TestGetMedia_Trashed(t *testing.T) {
+	mrec := &model.Media{Status: model.MediaStatusDeleted}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	svc := NewMediaGetter(repo, &mock.Storage{}, nil)
+
+	_, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
 func TestGetMedia_URLGenError(t *testing.T) {
 	mt := "image/png"
 	mrec := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt}
 	repo := &mock.MediaRepo{MediaOut: mrec}
 	strg := &mock.Storage{GenerateDownloadLinkErr: errors.New("link generation failed")}
-	svc := NewMediaGetter(repo, strg)
+	svc := NewMediaGetter(repo, strg, nil)
 
-	_, err := svc.GetMedia(context.Background(), msuuid.UUID{})
+	_, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
 	wantPrefix := "error generating presigned download URL"
 	if err == nil || !strings.HasPrefix(err.Error(), wantPrefix) {
 		t.Fatalf("expected error prefix %q, got %v", wantPrefix, err)
@@ -74,14 +88,15 @@ func TestGetMedia_VariantSuccess(t *testing.T) {
 				SizeBytes: 500,
 				Width:     500,
 				Height:    500,
+				MimeType:  "image/jpeg",
 			},
 		},
 	}
 	repo := &mock.MediaRepo{MediaOut: mrec}
 	strg := &mock.Storage{}
-	svc := NewMediaGetter(repo, strg)
+	svc := NewMediaGetter(repo, strg, nil)
 
-	out, err := svc.GetMedia(context.Background(), msuuid.UUID{})
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -132,4 +147,234 @@ func TestGetMedia_VariantSuccess(t *testing.T) {
 	if out.Variants[1].Height != mrec.Variants[1].Height {
 		t.Errorf("Variants[1].Height = %d, want %d", out.Variants[1].Height, mrec.Variants[1].Height)
 	}
+	if out.Variants[0].MimeType != "image/webp" || out.Variants[1].MimeType != "image/jpeg" {
+		t.Errorf("variant mime types = %q, %q; want image/webp, image/jpeg", out.Variants[0].MimeType, out.Variants[1].MimeType)
+	}
+	if out.Variants[0].Name != "200" || out.Variants[1].Name != "500-jpeg" {
+		t.Errorf("variant names = %q, %q; want 200, 500-jpeg", out.Variants[0].Name, out.Variants[1].Name)
+	}
+}
+
+func TestGetMedia_MarkdownHTMLVariant(t *testing.T) {
+	mt := "text/markdown"
+	sb := int64(640)
+	mrec := &model.Media{
+		Status:    model.MediaStatusCompleted,
+		MimeType:  &mt,
+		ObjectKey: "guide.md",
+		SizeBytes: &sb,
+		Variants: model.Variants{
+			{ObjectKey: "variants/x/guide.md.br", SizeBytes: 200, MimeType: mt, Encoding: model.EncodingBrotli},
+			{ObjectKey: "variants/x/guide.html", SizeBytes: 900, MimeType: "text/html"},
+		},
+	}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	strg := &mock.Storage{}
+	svc := NewMediaGetter(repo, strg, nil)
+
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := model.VariantsOutput{{Name: "html", URL: "https://example.com/download", SizeBytes: 900, MimeType: "text/html"}}
+	if !reflect.DeepEqual(out.Variants, want) {
+		t.Errorf("variants = %+v; want only the HTML rendering %+v", out.Variants, want)
+	}
+	if strg.ObjectKey != "variants/x/guide.html" {
+		t.Errorf("last link generated for %q; want the HTML rendering", strg.ObjectKey)
+	}
+}
+
+func TestGetMedia_Expired(t *testing.T) {
+	mt := "image/png"
+	expiresAt := time.Now().Add(-time.Minute)
+	mrec := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt, ExpiresAt: &expiresAt}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	strg := &mock.Storage{}
+	svc := NewMediaGetter(repo, strg, nil)
+
+	_, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if !errors.Is(err, ErrMediaExpired) {
+		t.Fatalf("expected ErrMediaExpired, got %v", err)
+	}
+	if strg.GenerateDownloadLinkCalled {
+		t.Error("no download link should be generated for an expired media")
+	}
+}
+
+func TestGetMedia_ExpiryCapsLinks(t *testing.T) {
+	mt := "application/pdf"
+	sb := int64(1234)
+	expiresAt := time.Now().Add(30 * time.Minute)
+	mrec := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt, SizeBytes: &sb, ExpiresAt: &expiresAt}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	strg := &mock.Storage{}
+	svc := NewMediaGetter(repo, strg, nil)
+
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strg.TTL > 30*time.Minute {
+		t.Errorf("download link TTL = %v; should not outlive the media", strg.TTL)
+	}
+	if !out.ValidUntil.Equal(expiresAt) {
+		t.Errorf("ValidUntil = %v; want %v", out.ValidUntil, expiresAt)
+	}
+	if out.ExpiresAt == nil || !out.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("ExpiresAt = %v; want %v", out.ExpiresAt, expiresAt)
+	}
+}
+
+func TestGetMedia_OriginalURL(t *testing.T) {
+	mt := "image/webp"
+	sb := int64(1234)
+	key := OriginalsPrefix + "foo.png"
+	mrec := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt, SizeBytes: &sb, OriginalObjectKey: &key}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	strg := &mock.Storage{}
+	svc := NewMediaGetter(repo, strg, nil)
+
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.OriginalURL != "https://example.com/download" {
+		t.Errorf("OriginalURL = %q; want the presigned link", out.OriginalURL)
+	}
+}
+
+func TestGetMedia_Watermarked(t *testing.T) {
+	mt := "application/pdf"
+	sb := int64(1234)
+	key := OriginalsPrefix + "foo.pdf"
+	mrec := &model.Media{Status: model.MediaStatusCompleted, Bucket: "docs", MimeType: &mt, SizeBytes: &sb, OriginalObjectKey: &key}
+	repo := &mock.MediaRepo{MediaOut: mrec}
+	strg := &mock.Storage{}
+	svc := NewMediaGetter(repo, strg, model.BucketsSettings{"docs": {WatermarkPDFs: true}})
+
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !out.Watermarked || out.URL != "" || out.OriginalURL != "" {
+		t.Errorf("expected a watermarked media without links, got %+v", out)
+	}
+	if strg.GenerateDownloadLinkCalled {
+		t.Error("no link should be generated for a watermarked file")
+	}
+}
+
+func TestGetMedia_PublicBucket(t *testing.T) {
+	mt := "image/webp"
+	sb := int64(1234)
+	original := OriginalsPrefix + "foo bar.png"
+	mrec := &model.Media{
+		Status:            model.MediaStatusCompleted,
+		Bucket:            "images",
+		ObjectKey:         "foo.webp",
+		MimeType:          &mt,
+		SizeBytes:         &sb,
+		OriginalObjectKey: &original,
+		Variants:          model.Variants{{ObjectKey: "variants/foo/foo_300.webp", Width: 300}},
+	}
+	strg := &mock.Storage{}
+	buckets := model.BucketsSettings{"images": {Visibility: model.BucketVisibilityPublic, PublicBaseURL: "https://cdn.example.com/images"}}
+	svc := NewMediaGetter(&mock.MediaRepo{MediaOut: mrec}, strg, buckets)
+
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strg.GenerateDownloadLinkCalled {
+		t.Error("no link should be presigned for a public bucket")
+	}
+	if !out.Public || !out.ValidUntil.IsZero() {
+		t.Errorf("Public, ValidUntil = %v, %v; want true and no expiry", out.Public, out.ValidUntil)
+	}
+	if out.URL != "https://cdn.example.com/images/foo.webp" {
+		t.Errorf("URL = %q", out.URL)
+	}
+	if out.OriginalURL != "https://cdn.example.com/images/originals/foo%20bar.png" {
+		t.Errorf("OriginalURL = %q", out.OriginalURL)
+	}
+	if len(out.Variants) != 1 || out.Variants[0].URL != "https://cdn.example.com/images/variants/foo/foo_300.webp" {
+		t.Errorf("Variants = %+v", out.Variants)
+	}
+}
+
+func TestGetMedia_PublicBucketExpiringMedia(t *testing.T) {
+	mt := "application/pdf"
+	sb := int64(1234)
+	expiresAt := time.Now().Add(72 * time.Hour)
+	mrec := &model.Media{Status: model.MediaStatusCompleted, Bucket: "docs", ObjectKey: "a.pdf", MimeType: &mt, SizeBytes: &sb, ExpiresAt: &expiresAt}
+	buckets := model.BucketsSettings{"docs": {Visibility: model.BucketVisibilityPublic, PublicBaseURL: "https://cdn.example.com"}}
+	svc := NewMediaGetter(&mock.MediaRepo{MediaOut: mrec}, &mock.Storage{}, buckets)
+
+	out, err := svc.GetMedia(context.Background(), port.GetMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !out.ValidUntil.Equal(expiresAt) {
+		t.Errorf("ValidUntil = %v; want the expiry of the media %v", out.ValidUntil, expiresAt)
+	}
+}
+
+func TestGetMedia_Overlay(t *testing.T) {
+	mt := "image/webp"
+	sb := int64(1234)
+	owner := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	other := msuuid.UUID(uuid.MustParse("66666666-7777-8888-9999-000000000000"))
+	mrec := &model.Media{
+		Status:    model.MediaStatusCompleted,
+		Bucket:    "images",
+		ObjectKey: "foo.webp",
+		MimeType:  &mt,
+		SizeBytes: &sb,
+		OwnerID:   &owner,
+		Metadata:  model.Metadata{Width: 800},
+		Variants: model.Variants{
+			{ObjectKey: "variants/foo/clean.webp", Width: 300},
+			{ObjectKey: "variants/foo/foo_300_overlay.webp", Width: 300, Watermarked: true},
+		},
+	}
+	orig := "originals/foo.png"
+	mrec.OriginalObjectKey = &orig
+	buckets := model.BucketsSettings{"images": {
+		Overlay:       &model.ImageOverlay{MediaID: other, Opacity: 0.5, Scale: 0.2},
+		Visibility:    model.BucketVisibilityPublic,
+		PublicBaseURL: "https://cdn.example.com",
+	}}
+	svc := NewMediaGetter(&mock.MediaRepo{MediaOut: mrec}, &mock.Storage{}, buckets)
+
+	tests := []struct {
+		name         string
+		userID       *msuuid.UUID
+		wantPersonal bool
+		wantURL      string
+		wantOriginal string
+	}{
+		{"anonymous", nil, false, "https://cdn.example.com/variants/foo/foo_300_overlay.webp", ""},
+		{"other user", &other, false, "https://cdn.example.com/variants/foo/foo_300_overlay.webp", ""},
+		{"owner", &owner, true, "https://cdn.example.com/foo.webp", "https://cdn.example.com/originals/foo.png"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := svc.GetMedia(context.Background(), port.GetMediaInput{UserID: tc.userID})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// only the owner gets the clean main file and its original
+			if out.URL != tc.wantURL || out.OriginalURL != tc.wantOriginal {
+				t.Errorf("URL = %q, OriginalURL = %q; want %q, %q", out.URL, out.OriginalURL, tc.wantURL, tc.wantOriginal)
+			}
+			// only the owner gets the clean variant
+			if len(out.Variants) != 1 || out.Variants[0].Watermarked == tc.wantPersonal {
+				t.Fatalf("Variants = %+v", out.Variants)
+			}
+			if out.Personal != tc.wantPersonal {
+				t.Errorf("Personal = %v; want %v", out.Personal, tc.wantPersonal)
+			}
+		})
+	}
 }
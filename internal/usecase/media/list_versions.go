@@ -0,0 +1,64 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+type versionListerSrv struct {
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+}
+
+// compile-time check: *versionListerSrv must satisfy port.VersionLister
+var _ port.VersionLister = (*versionListerSrv)(nil)
+
+// NewVersionLister constructs a VersionLister implementation.
+func NewVersionLister(repo port.MediaRepository, versions port.MediaVersionRepository) port.VersionLister {
+	return &versionListerSrv{repo, versions}
+}
+
+// ListVersions returns the current version number of a media and its previous versions, most recent first.
+func (s *versionListerSrv) ListVersions(ctx context.Context, id msuuid.UUID) (port.ListVersionsOutput, error) {
+	media, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return port.ListVersionsOutput{}, ErrObjectNotFound
+		}
+		return port.ListVersionsOutput{}, err
+	}
+	if media.Status == model.MediaStatusDeleted {
+		return port.ListVersionsOutput{}, ErrObjectNotFound
+	}
+
+	versions, err := s.versions.ListByMediaID(ctx, media.ID)
+	if err != nil {
+		return port.ListVersionsOutput{}, err
+	}
+
+	out := port.ListVersionsOutput{
+		CurrentVersion: media.Version,
+		Versions:       make([]port.VersionOutput, 0, len(versions)),
+	}
+	for _, v := range versions {
+		mt := port.MetadataOutput{Metadata: v.Metadata}
+		if v.SizeBytes != nil {
+			mt.SizeBytes = *v.SizeBytes
+		}
+		if v.MimeType != nil {
+			mt.MimeType = *v.MimeType
+		}
+		out.Versions = append(out.Versions, port.VersionOutput{
+			Version:   v.Version,
+			Metadata:  mt,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+func TestListVersions_NotFound(t *testing.T) {
+	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
+	svc := NewVersionLister(repo, &mock.MediaVersionRepo{})
+
+	if _, err := svc.ListVersions(context.Background(), msuuid.UUID{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestListVersions_Trashed(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusDeleted}}
+	versions := &mock.MediaVersionRepo{}
+	svc := NewVersionLister(repo, versions)
+
+	if _, err := svc.ListVersions(context.Background(), msuuid.UUID{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+	if versions.ListCalled {
+		t.Error("expected versions not to be listed")
+	}
+}
+
+func TestListVersions_RepoError(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusCompleted}}
+	svc := NewVersionLister(repo, &mock.MediaVersionRepo{ListErr: errors.New("db fail")})
+
+	if _, err := svc.ListVersions(context.Background(), msuuid.UUID{}); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+}
+
+func TestListVersions_Success(t *testing.T) {
+	mt := "application/pdf"
+	size := int64(1234)
+	createdAt := time.Now()
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusCompleted, Version: 3}}
+	versions := &mock.MediaVersionRepo{ListOut: []model.MediaVersion{
+		{Version: 2, MimeType: &mt, SizeBytes: &size, Metadata: model.Metadata{PageCount: 4}, CreatedAt: createdAt},
+		{Version: 1},
+	}}
+	svc := NewVersionLister(repo, versions)
+
+	out, err := svc.ListVersions(context.Background(), msuuid.UUID{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.CurrentVersion != 3 {
+		t.Errorf("CurrentVersion = %d; want 3", out.CurrentVersion)
+	}
+	if len(out.Versions) != 2 {
+		t.Fatalf("got %d versions; want 2", len(out.Versions))
+	}
+	v := out.Versions[0]
+	if v.Version != 2 || v.Metadata.MimeType != mt || v.Metadata.SizeBytes != size || v.Metadata.PageCount != 4 || !v.CreatedAt.Equal(createdAt) {
+		t.Errorf("first version = %+v", v)
+	}
+}
@@ -0,0 +1,144 @@
+package media
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/markdown"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// recordReferences stores the medias the media links to, in place of the previous ones, so they
+// are not deleted from under it.
+func recordReferences(ctx context.Context, repo port.MediaRepository, media *model.Media) {
+	if err := repo.ReplaceReferences(ctx, media.ID, media.Metadata.References); err != nil {
+		logger.Warnf(ctx, "failed recording the references of media #%s: %v", media.ID, err)
+	}
+}
+
+// rerenderReferencing enqueues the optimisation of the documents linking to the media, so their
+// HTML rendering points at its current files.
+func rerenderReferencing(ctx context.Context, repo port.MediaRepository, tasks port.TaskDispatcher, id msuuid.UUID) {
+	ids, err := repo.ListReferencing(ctx, id)
+	if err != nil {
+		logger.Warnf(ctx, "failed listing the medias referencing media #%s: %v", id, err)
+		return
+	}
+	for _, refID := range ids {
+		if err := tasks.EnqueueOptimiseMedia(ctx, refID); err != nil {
+			logger.Warnf(ctx, "failed to enqueue optimise task for media #%s: %v", refID, err)
+		}
+	}
+}
+
+// mediaLinks resolves the media references of a document to the files of the medias, with the
+// srcset of their variants for images. Files of public buckets are linked to at their stable URL.
+// The others are linked to through the download endpoint of the API, as presigned links would
+// expire long before the rendering is read. References to medias that are unknown, not completed
+// or expired are left out.
+func (m *mediaOptimiserSrv) mediaLinks(ctx context.Context, refs []string) map[string]markdown.MediaLink {
+	links := make(map[string]markdown.MediaLink, len(refs))
+	now := time.Now()
+	for _, raw := range refs {
+		var id msuuid.UUID
+		if err := id.UnmarshalText([]byte(raw)); err != nil {
+			continue
+		}
+		media, err := m.repo.GetByID(ctx, id)
+		if err != nil {
+			logger.Warnf(ctx, "failed fetching referenced media #%s: %v", id, err)
+			continue
+		}
+		if media.Status != model.MediaStatusCompleted {
+			logger.Infof(ctx, "referenced media #%s is %s, leaving its links out", id, media.Status)
+			continue
+		}
+		if _, err := downloadTTL(media, now); err != nil {
+			continue
+		}
+		settings := m.buckets.Get(media.Bucket)
+		if media.MimeType != nil && isWatermarked(settings, *media.MimeType) {
+			logger.Infof(ctx, "referenced media #%s is watermarked for each user, leaving its links out", id)
+			continue
+		}
+
+		// documents are read by anyone, not only the owner of the image
+		overlay := overlaid(media, settings, nil)
+		mainKey := media.ObjectKey
+		if media.MimeType != nil && IsImage(*media.MimeType) {
+			media.Variants = visibleVariants(media, settings, nil)
+		}
+		if overlay {
+			candidates := downloadCandidates(media, false)
+			if len(candidates) == 0 {
+				logger.Infof(ctx, "referenced media #%s has no overlaid variant yet, leaving its links out", id)
+				continue
+			}
+			mainKey = fitWidth(candidates, 0).objectKey
+		}
+
+		link := m.referenceLinker(media, settings)
+		ml := markdown.MediaLink{URL: link(mainKey, 0)}
+		if media.MimeType != nil && IsImage(*media.MimeType) {
+			ml.SrcSet = srcSet(media, link, !overlay)
+		}
+		links[raw] = ml
+	}
+	return links
+}
+
+// referenceLinker returns how a document links to the files of the media, given their object
+// key and width. Links to the API pick the file by width, 0 linking to the main file.
+func (m *mediaOptimiserSrv) referenceLinker(media *model.Media, settings model.BucketSettings) func(key string, width int) string {
+	if settings.IsPublic() {
+		return func(key string, _ int) string {
+			return publicURL(settings.PublicBaseURL, key)
+		}
+	}
+	download := m.apiBaseURL + "/medias/" + media.ID.String() + "/download"
+	return func(_ string, width int) string {
+		if width == 0 {
+			return download
+		}
+		return download + "?width=" + strconv.Itoa(width)
+	}
+}
+
+// srcSet lists the main file of an image, unless it is left out, and its WebP variants by width,
+// or nothing when the image has no other width to offer.
+func srcSet(media *model.Media, link func(key string, width int) string, withMain bool) string {
+	type candidate struct {
+		url   string
+		width int
+	}
+	var candidates []candidate
+	if withMain && media.Metadata.Width > 0 {
+		candidates = append(candidates, candidate{link(media.ObjectKey, 0), media.Metadata.Width})
+	}
+	for _, v := range media.Variants {
+		if v.Encoding != "" || v.Page != 0 || v.Width == 0 || v.Format() != "image/webp" {
+			continue
+		}
+		candidates = append(candidates, candidate{link(v.ObjectKey, v.Width), v.Width})
+	}
+
+	// variants kept as untouched copies have the width of the main file
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return a.width - b.width })
+	candidates = slices.CompactFunc(candidates, func(a, b candidate) bool { return a.width == b.width })
+	if len(candidates) < 2 {
+		return ""
+	}
+
+	entries := make([]string, len(candidates))
+	for i, c := range candidates {
+		entries[i] = c.url + " " + strconv.Itoa(c.width) + "w"
+	}
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,126 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fhuszti/medias-ms-go/internal/markdown"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/ledongthuc/pdf"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// MaxIndexedTextBytes caps the text of a media indexed for search.
+const MaxIndexedTextBytes = 1024 * 1024 // 1 MB
+
+// HasText tells whether the text of files of the MIME type is indexed for search.
+func HasText(mimeType string) bool {
+	return IsPdf(mimeType) || IsMarkdown(mimeType)
+}
+
+// extractText returns the text of a PDF or markdown file, with its whitespace collapsed, then
+// rewinds the file. Other files have no text, nor do the ones it cannot be extracted from: this
+// is only logged, as search is not worth failing an upload for.
+func extractText(ctx context.Context, mimeType string, file io.ReadSeeker) (string, error) {
+	if !HasText(mimeType) {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to reset reader: %w", err)
+	}
+
+	var text string
+	if IsPdf(mimeType) {
+		text, err = pdfText(data)
+	} else {
+		text, err = markdownText(data)
+	}
+	if err != nil {
+		logger.Warnf(ctx, "leaving the text out of search: %v", err)
+		return "", nil
+	}
+	return truncateText(strings.Join(strings.Fields(text), " "), MaxIndexedTextBytes), nil
+}
+
+func pdfText(data []byte) (text string, err error) {
+	// the PDF reader panics on some malformed content streams
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("error extracting PDF text: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("error opening pdf reader: %w", err)
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("error extracting PDF text: %w", err)
+	}
+	raw, err := io.ReadAll(plain)
+	if err != nil {
+		return "", fmt.Errorf("error extracting PDF text: %w", err)
+	}
+	return string(raw), nil
+}
+
+func markdownText(data []byte) (string, error) {
+	doc, err := markdown.Parse(data)
+	if err != nil {
+		return "", fmt.Errorf("error parsing markdown: %w", err)
+	}
+	if doc.Title == "" {
+		return doc.Text(), nil
+	}
+	return doc.Title + " " + doc.Text(), nil
+}
+
+// truncateText cuts text to at most max bytes, on a rune boundary.
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return text[:max]
+}
+
+// indexText stores the text of a media for search, only logging errors.
+func indexText(ctx context.Context, repo port.MediaRepository, id msuuid.UUID, text string) {
+	if err := repo.SaveText(ctx, id, text); err != nil {
+		logger.Warnf(ctx, "failed indexing the text of media #%s: %v", id, err)
+	}
+}
+
+// reindexText indexes the text of the current file of a media, e.g. once an older version of it is
+// restored, only logging errors.
+func reindexText(ctx context.Context, repo port.MediaRepository, strg port.Storage, media *model.Media) {
+	var text string
+	if media.MimeType != nil && HasText(*media.MimeType) {
+		file, err := strg.GetFile(ctx, media.Bucket, media.ObjectKey)
+		if err != nil {
+			logger.Warnf(ctx, "failed reading media #%s to index its text: %v", media.ID, err)
+			return
+		}
+		defer func() { _ = file.Close() }()
+		if text, err = extractText(ctx, *media.MimeType, file); err != nil {
+			logger.Warnf(ctx, "failed reading media #%s to index its text: %v", media.ID, err)
+			return
+		}
+	}
+	indexText(ctx, repo, media.ID, text)
+}
@@ -0,0 +1,72 @@
+package media
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+func TestExtractText_Markdown(t *testing.T) {
+	file := strings.NewReader("---\ntitle: Notes\n---\n# Shopping\n\n- apples\n- pears\n\n```\ncode\n```\n")
+
+	text, err := extractText(context.Background(), "text/markdown", file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if text != "Notes Shopping apples pears" {
+		t.Errorf("text = %q; want the title and the words of the document", text)
+	}
+	if pos, _ := file.Seek(0, 1); pos != 0 {
+		t.Errorf("file offset = %d; want it rewound", pos)
+	}
+}
+
+func TestExtractText_NotText(t *testing.T) {
+	text, err := extractText(context.Background(), "image/png", getPNGReader(t))
+	if err != nil || text != "" {
+		t.Errorf("got %q, %v; want no text", text, err)
+	}
+}
+
+func TestExtractText_InvalidPDF(t *testing.T) {
+	text, err := extractText(context.Background(), "application/pdf", strings.NewReader("%PDF-1.4 broken"))
+	if err != nil || text != "" {
+		t.Errorf("got %q, %v; want the text left out", text, err)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc"},
+		{"héllo", 2, "h"},
+		{"héllo", 3, "hé"},
+	}
+	for _, tc := range tests {
+		if got := truncateText(tc.text, tc.max); got != tc.want {
+			t.Errorf("truncateText(%q, %d) = %q; want %q", tc.text, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestReindexText_Markdown(t *testing.T) {
+	mt := "text/markdown"
+	m := &model.Media{ID: msuuid.NewUUID(), Bucket: "docs", ObjectKey: "notes.md", MimeType: &mt}
+	repo := &mock.MediaRepo{}
+	strg := &mock.Storage{GetOut: strings.NewReader("# Restored notes")}
+
+	reindexText(context.Background(), repo, strg, m)
+
+	if repo.GotTextOf != m.ID || repo.GotText != "Restored notes" {
+		t.Errorf("indexed %q for #%s; want the restored text", repo.GotText, repo.GotTextOf)
+	}
+}
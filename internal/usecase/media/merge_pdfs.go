@@ -0,0 +1,49 @@
+package media
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// MaxMergedPDFs caps the number of PDFs merged into one.
+const MaxMergedPDFs = 20
+
+type pdfMergerSrv struct {
+	repo    port.MediaRepository
+	tasks   port.TaskDispatcher
+	genUUID port.UUIDGen
+}
+
+// compile-time check: *pdfMergerSrv must satisfy port.PDFMerger
+var _ port.PDFMerger = (*pdfMergerSrv)(nil)
+
+// NewPDFMerger constructs a PDFMerger implementation.
+func NewPDFMerger(repo port.MediaRepository, tasks port.TaskDispatcher, genUUID port.UUIDGen) port.PDFMerger {
+	return &pdfMergerSrv{repo: repo, tasks: tasks, genUUID: genUUID}
+}
+
+// MergePDFs creates a pending media that the worker fills with the PDFs, in the given order. The
+// PDFs must share a bucket, so the merged file is never readable more widely than its sources.
+func (s *pdfMergerSrv) MergePDFs(ctx context.Context, in port.MergePDFsInput) (port.DerivedMediaOutput, error) {
+	sources := make([]*model.Media, 0, len(in.IDs))
+	for _, id := range in.IDs {
+		source, err := getPDFSource(ctx, s.repo, id)
+		if err != nil {
+			return port.DerivedMediaOutput{}, err
+		}
+		if len(sources) > 0 && source.Bucket != sources[0].Bucket {
+			return port.DerivedMediaOutput{}, ErrMixedBuckets
+		}
+		sources = append(sources, source)
+	}
+
+	name := in.Name
+	if name == "" {
+		name = "merged.pdf"
+	}
+	derivation := &model.Derivation{Operation: model.DerivationMerge, Sources: append([]msuuid.UUID(nil), in.IDs...)}
+	return createDerivedMedia(ctx, s.repo, s.tasks, s.genUUID(), sources, derivation, name, in.OwnerID)
+}
@@ -0,0 +1,82 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestMergePDFs_Success(t *testing.T) {
+	id1 := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	id2 := msuuid.UUID(uuid.MustParse("bbbbbbbb-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	newID := msuuid.UUID(uuid.MustParse("cccccccc-bbbb-cccc-dddd-eeeeeeeeeeee"))
+
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{
+		id1: pdfSource(id1, "docs", 2),
+		id2: pdfSource(id2, "docs", 3),
+	}}
+	tasks := &mock.Dispatcher{}
+	svc := NewPDFMerger(repo, tasks, func() msuuid.UUID { return newID })
+
+	out, err := svc.MergePDFs(context.Background(), port.MergePDFsInput{IDs: []msuuid.UUID{id2, id1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.ID != newID {
+		t.Errorf("expected ID %s, got %s", newID, out.ID)
+	}
+
+	m := repo.GotCreated
+	if m == nil {
+		t.Fatal("expected repo.Create to be called")
+	}
+	if m.Bucket != "docs" || m.OriginalFilename != "merged.pdf" {
+		t.Errorf("unexpected media created: %+v", m)
+	}
+	if m.DerivedFrom == nil || m.DerivedFrom.Operation != model.DerivationMerge ||
+		len(m.DerivedFrom.Sources) != 2 || m.DerivedFrom.Sources[0] != id2 || m.DerivedFrom.Sources[1] != id1 {
+		t.Errorf("expected the sources to be merged in order, got %+v", m.DerivedFrom)
+	}
+	if len(tasks.DeriveIDs) != 1 || tasks.DeriveIDs[0] != newID {
+		t.Errorf("expected derive task for %s, got %v", newID, tasks.DeriveIDs)
+	}
+}
+
+func TestMergePDFs_Errors(t *testing.T) {
+	id1 := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	id2 := msuuid.UUID(uuid.MustParse("bbbbbbbb-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	unknown := msuuid.UUID(uuid.MustParse("dddddddd-bbbb-cccc-dddd-eeeeeeeeeeee"))
+
+	tests := []struct {
+		name    string
+		ids     []msuuid.UUID
+		wantErr error
+	}{
+		{"different buckets", []msuuid.UUID{id1, id2}, ErrMixedBuckets},
+		{"unknown source", []msuuid.UUID{id1, unknown}, ErrObjectNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{
+				id1: pdfSource(id1, "docs", 2),
+				id2: pdfSource(id2, "invoices", 2),
+			}}
+			tasks := &mock.Dispatcher{}
+			svc := NewPDFMerger(repo, tasks, msuuid.NewUUID)
+
+			_, err := svc.MergePDFs(context.Background(), port.MergePDFsInput{IDs: tc.ids})
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if repo.CreateCalled || tasks.DeriveCalled {
+				t.Error("expected no media to be created")
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package media
+
+import (
+	"net/url"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+// objectOptions returns the options to save a file of the media with: its headers, and the
+// metadata and tags configured for the bucket. Every file records the ID of its media.
+func objectOptions(settings model.BucketSettings, media *model.Media, mimeType string) map[string]string {
+	opts := map[string]string{
+		"Content-Type":                         mimeType,
+		port.MetadataOptionPrefix + "Media-Id": media.ID.String(),
+	}
+	if settings.CacheControl != "" {
+		opts["Cache-Control"] = settings.CacheControl
+	}
+	if cd := contentDisposition(media, mimeType); cd != "" {
+		opts["Content-Disposition"] = cd
+	}
+	for k, v := range settings.ObjectMetadata {
+		opts[port.MetadataOptionPrefix+k] = v
+	}
+	if len(settings.ObjectTags) > 0 {
+		tags := url.Values{}
+		for k, v := range settings.ObjectTags {
+			tags.Set(k, v)
+		}
+		opts[port.TaggingOption] = tags.Encode()
+	}
+	return opts
+}
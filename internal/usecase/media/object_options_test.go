@@ -0,0 +1,49 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestObjectOptions(t *testing.T) {
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	media := &model.Media{ID: id, OriginalFilename: "report final.pdf"}
+	settings := model.BucketSettings{
+		CacheControl:   "public, max-age=3600",
+		ObjectMetadata: map[string]string{"Service": "medias"},
+		ObjectTags:     map[string]string{"tier": "hot", "team": "blog"},
+	}
+
+	got := objectOptions(settings, media, "application/pdf")
+	want := map[string]string{
+		"Content-Type":        "application/pdf",
+		"Cache-Control":       "public, max-age=3600",
+		"Content-Disposition": `inline; filename="report final.pdf"`,
+		"X-Amz-Meta-Media-Id": id.String(),
+		"X-Amz-Meta-Service":  "medias",
+		port.TaggingOption:    "team=blog&tier=hot",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("objectOptions() = %v; want %v", got, want)
+	}
+}
+
+func TestObjectOptions_Defaults(t *testing.T) {
+	media := &model.Media{ID: msuuid.UUID(uuid.Nil)}
+
+	got := objectOptions(model.BucketSettings{}, media, "image/webp")
+	if _, ok := got["Cache-Control"]; ok {
+		t.Error("no Cache-Control expected without a bucket default")
+	}
+	if _, ok := got[port.TaggingOption]; ok {
+		t.Error("no tags expected without bucket tags")
+	}
+	if got["Content-Type"] != "image/webp" {
+		t.Errorf("Content-Type = %q; want image/webp", got["Content-Type"])
+	}
+}
@@ -1,6 +1,7 @@
 package media
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -17,18 +18,22 @@ import (
 )
 
 type mediaOptimiserSrv struct {
-	repo  port.MediaRepository
-	opt   port.FileOptimiser
-	strg  port.Storage
-	tasks port.TaskDispatcher
-	cache port.Cache
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	opt      port.FileOptimiser
+	strg     port.Storage
+	tasks    port.TaskDispatcher
+	cache    port.Cache
+	buckets  model.BucketsSettings
+	// apiBaseURL is where the API is reached at, for the links of documents to private medias
+	apiBaseURL string
 }
 
 // compile-time check: *mediaOptimiserSrv must satisfy port.MediaOptimiser
 var _ port.MediaOptimiser = (*mediaOptimiserSrv)(nil)
 
-func NewMediaOptimiser(repo port.MediaRepository, opt port.FileOptimiser, strg port.Storage, tasks port.TaskDispatcher, cache port.Cache) port.MediaOptimiser {
-	return &mediaOptimiserSrv{repo, opt, strg, tasks, cache}
+func NewMediaOptimiser(repo port.MediaRepository, versions port.MediaVersionRepository, opt port.FileOptimiser, strg port.Storage, tasks port.TaskDispatcher, cache port.Cache, buckets model.BucketsSettings, apiBaseURL string) port.MediaOptimiser {
+	return &mediaOptimiserSrv{repo, versions, opt, strg, tasks, cache, buckets, apiBaseURL}
 }
 
 func (m *mediaOptimiserSrv) OptimiseMedia(ctx context.Context, id msuuid.UUID) error {
@@ -39,6 +44,10 @@ func (m *mediaOptimiserSrv) OptimiseMedia(ctx context.Context, id msuuid.UUID) e
 		}
 		return err
 	}
+	if media.Status == model.MediaStatusDeleted {
+		logger.Infof(ctx, "media #%s is in the trash, skipping optimisation", media.ID)
+		return nil
+	}
 	if media.Status != model.MediaStatusCompleted {
 		return errors.New("media status should be 'completed' to be optimised")
 	}
@@ -52,42 +61,139 @@ func (m *mediaOptimiserSrv) OptimiseMedia(ctx context.Context, id msuuid.UUID) e
 	}(originalReader)
 
 	// Actually do the compression here
-	compressedReader, newMimeType, err := m.opt.Compress(*media.MimeType, originalReader)
+	settings := m.buckets.Get(media.Bucket)
+	result, err := m.opt.Compress(*media.MimeType, originalReader, port.CompressOptions{PDFProfile: settings.PDFProfile})
 	if err != nil {
 		return err
 	}
 	defer func(compressedReader io.ReadCloser) {
 		_ = compressedReader.Close()
-	}(compressedReader)
+	}(result.Reader)
 
-	newObjectKey := media.ObjectKey
-	if newMimeType != *media.MimeType {
-		ext, err := MimeTypeToExtension(newMimeType)
+	var originalSize int64
+	if media.SizeBytes != nil {
+		originalSize = *media.SizeBytes
+	}
+
+	// the MIME type of the media changes along with its file
+	sourceMimeType := *media.MimeType
+
+	var staleKeys []string
+	if result.Strategy == model.OptimisationOriginal && !settings.ContentAddressedKeys {
+		logger.Infof(ctx, "no re-encoding beats the original of media #%s, keeping it as is", media.ID)
+	} else if staleKeys, err = m.replaceFile(ctx, media, result); err != nil {
+		return err
+	}
+
+	media.Optimised = true
+	media.Metadata.OptimisationStrategy = result.Strategy
+	media.Metadata.WebPQuality = result.Quality
+	media.Metadata.QualityScore = result.Score
+	media.Metadata.SavedBytes = 0
+	if media.SizeBytes != nil {
+		media.Metadata.SavedBytes = originalSize - *media.SizeBytes
+	}
+	if IsPdf(*media.MimeType) {
+		scrubPDFMetadata(&media.Metadata, settings.PDFProfile)
+	}
+
+	if IsText(*media.MimeType) {
+		textKeys, err := m.textVariants(ctx, media)
+		if err != nil {
+			return err
+		}
+		staleKeys = append(staleKeys, textKeys...)
+	}
+
+	if IsTIFF(sourceMimeType) {
+		pageKeys, err := m.pageVariants(ctx, media, originalReader, sourceMimeType)
 		if err != nil {
 			return err
 		}
+		staleKeys = append(staleKeys, pageKeys...)
+	}
+
+	if err := m.repo.Update(ctx, media); err != nil {
+		return fmt.Errorf("failed updating media: %w", err)
+	}
+	removeStaleFiles(ctx, m.strg, m.versions, media, staleKeys)
+
+	if IsImage(*media.MimeType) || (IsSVG(*media.MimeType) && m.buckets.Get(media.Bucket).SVGRasterVariants != "") {
+		if err := m.tasks.EnqueueResizeImage(ctx, media.ID); err != nil {
+			logger.Warnf(ctx, "failed to enqueue resize task for media #%s: %v", media.ID, err)
+		}
+	}
+
+	if err := m.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
+	}
+	if err := m.cache.DeleteEtagMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", media.ID, err)
+	}
+
+	return nil
+}
+
+// replaceFile saves the compressed file in place of the current one, and updates the media accordingly.
+// In buckets with content-addressed keys, the file is saved under the hash of its content and marked
+// immutable. It returns the keys the media no longer points at, to remove once the media is updated.
+func (m *mediaOptimiserSrv) replaceFile(ctx context.Context, media *model.Media, result *port.CompressResult) ([]string, error) {
+	settings := m.buckets.Get(media.Bucket)
+
+	// Keep the pristine upload before it gets overwritten or removed, unless it is kept as the file itself
+	if settings.KeepOriginals && result.Strategy != model.OptimisationOriginal && !media.Optimised && media.OriginalObjectKey == nil {
+		originalKey := OriginalsPrefix + media.ObjectKey
+		if err := m.strg.CopyFile(ctx, media.Bucket, media.ObjectKey, originalKey); err != nil {
+			return nil, fmt.Errorf("failed to keep original %q→%q inside bucket %q: %w", media.ObjectKey, originalKey, media.Bucket, err)
+		}
+		media.OriginalObjectKey = &originalKey
+		if media.SizeBytes != nil {
+			originalSize := *media.SizeBytes
+			media.OriginalSizeBytes = &originalSize
+		}
+	}
+
+	newMimeType := result.MimeType
+	ext, err := MimeTypeToExtension(newMimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	newObjectKey := media.ObjectKey
+	if newMimeType != *media.MimeType {
 		// Update extension in object key
 		newObjectKey = strings.TrimSuffix(media.ObjectKey, filepath.Ext(media.ObjectKey)) + ext
 	}
 
+	opts := objectOptions(settings, media, newMimeType)
+	reader := io.Reader(result.Reader)
+	hash := sha256.New()
+	if settings.ContentAddressedKeys {
+		opts["Cache-Control"] = ImmutableCacheControl
+		reader = io.TeeReader(reader, hash)
+	}
+
 	// Save the compressed file to tmp file (failsafe in case it breaks in the middle)
 	tempKey := newObjectKey + ".tmp"
 	if err := m.strg.SaveFile(
 		ctx,
 		media.Bucket,
 		tempKey,
-		compressedReader,
+		reader,
 		-1, // streaming mode
-		map[string]string{
-			"Content-Type": newMimeType,
-		},
+		opts,
 	); err != nil {
-		return fmt.Errorf("failed to save temp file %q inside bucket %q: %w", tempKey, media.Bucket, err)
+		return nil, fmt.Errorf("failed to save temp file %q inside bucket %q: %w", tempKey, media.Bucket, err)
+	}
+
+	// The hash is only known once the whole file went through
+	if settings.ContentAddressedKeys {
+		newObjectKey = contentKey(media.ID.String(), hash.Sum(nil), ext)
 	}
 
 	// Copy the finished tmp file to its final object key
 	if err := m.strg.CopyFile(ctx, media.Bucket, tempKey, newObjectKey); err != nil {
-		return fmt.Errorf("failed to copy %q→%q inside bucket %q: %w", tempKey, newObjectKey, media.Bucket, err)
+		return nil, fmt.Errorf("failed to copy %q→%q inside bucket %q: %w", tempKey, newObjectKey, media.Bucket, err)
 	}
 
 	// Remove the tmp file
@@ -95,40 +201,21 @@ func (m *mediaOptimiserSrv) OptimiseMedia(ctx context.Context, id msuuid.UUID) e
 		logger.Warnf(ctx, "failed to remove temp file %q from bucket %q: %v", tempKey, media.Bucket, err)
 	}
 
-	// If the file extension has changed, remove the original
-	if newObjectKey != media.ObjectKey {
-		if err := m.strg.RemoveFile(ctx, media.Bucket, media.ObjectKey); err != nil {
-			logger.Warnf(ctx, "failed to remove old file %q from bucket %q: %v", media.ObjectKey, media.Bucket, err)
-		}
-	}
-
 	info, err := m.strg.StatFile(ctx, media.Bucket, newObjectKey)
 	if err != nil {
-		return fmt.Errorf("failed reading info about file %q inside bucket %q: %w", newObjectKey, media.Bucket, err)
+		return nil, fmt.Errorf("failed reading info about file %q inside bucket %q: %w", newObjectKey, media.Bucket, err)
 	}
 	newSize := info.SizeBytes
 
-	media.Optimised = true
+	// The previous file is removed once the media points at the new one
+	var staleKeys []string
+	if newObjectKey != media.ObjectKey {
+		staleKeys = append(staleKeys, media.ObjectKey)
+	}
+
 	media.SizeBytes = &newSize
 	media.MimeType = &newMimeType
 	media.ObjectKey = newObjectKey
 
-	if err := m.repo.Update(ctx, media); err != nil {
-		return fmt.Errorf("failed updating media: %w", err)
-	}
-
-	if IsImage(newMimeType) {
-		if err := m.tasks.EnqueueResizeImage(ctx, media.ID); err != nil {
-			logger.Warnf(ctx, "failed to enqueue resize task for media #%s: %v", media.ID, err)
-		}
-	}
-
-	if err := m.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
-		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
-	}
-	if err := m.cache.DeleteEtagMediaDetails(ctx, media.ID); err != nil {
-		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", media.ID, err)
-	}
-
-	return nil
+	return staleKeys, nil
 }
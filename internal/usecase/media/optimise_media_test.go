@@ -1,12 +1,19 @@
 package media
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/binary"
 	"errors"
+	"image"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fhuszti/medias-ms-go/internal/markdown"
 	"github.com/fhuszti/medias-ms-go/internal/mock"
 	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/port"
@@ -30,7 +37,7 @@ func newCompletedMedia() *model.Media {
 func TestOptimiseMedia_GetByIDNotFound(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
 	strg := &mock.Storage{}
-	svc := NewMediaOptimiser(repo, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), msuuid.NewUUID())
 	if !errors.Is(err, ErrObjectNotFound) {
@@ -41,7 +48,7 @@ func TestOptimiseMedia_GetByIDNotFound(t *testing.T) {
 func TestOptimiseMedia_GetByIDError(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: errors.New("db fail")}
 	strg := &mock.Storage{}
-	svc := NewMediaOptimiser(repo, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), msuuid.NewUUID())
 	if err == nil || err.Error() != "db fail" {
@@ -54,7 +61,7 @@ func TestOptimiseMedia_WrongStatus(t *testing.T) {
 	m.Status = model.MediaStatusPending
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{}
-	svc := NewMediaOptimiser(repo, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || !strings.Contains(err.Error(), "completed") {
@@ -62,11 +69,26 @@ func TestOptimiseMedia_WrongStatus(t *testing.T) {
 	}
 }
 
+func TestOptimiseMedia_SkipsTrashed(t *testing.T) {
+	m := newCompletedMedia()
+	m.Status = model.MediaStatusDeleted
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strg.GetCalled || repo.UpdateCalled {
+		t.Error("expected trashed media to be skipped")
+	}
+}
+
 func TestOptimiseMedia_GetFileError(t *testing.T) {
 	m := newCompletedMedia()
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{GetErr: errors.New("get fail")}
-	svc := NewMediaOptimiser(repo, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || err.Error() != "get fail" {
@@ -79,7 +101,7 @@ func TestOptimiseMedia_CompressError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{}
 	fo := &mock.FileOptimiser{CompressErr: errors.New("compress fail")}
-	svc := NewMediaOptimiser(repo, fo, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || err.Error() != "compress fail" {
@@ -92,7 +114,7 @@ func TestOptimiseMedia_ExtensionError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{}
 	fo := &mock.FileOptimiser{MimeOut: "application/unknown"}
-	svc := NewMediaOptimiser(repo, fo, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || !strings.Contains(err.Error(), "unsupported mime type") {
@@ -105,7 +127,7 @@ func TestOptimiseMedia_SaveFileError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{SaveErr: errors.New("save fail")}
 	fo := &mock.FileOptimiser{MimeOut: *m.MimeType}
-	svc := NewMediaOptimiser(repo, fo, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || !strings.Contains(err.Error(), "save fail") {
@@ -118,7 +140,7 @@ func TestOptimiseMedia_CopyFileError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{CopyErr: errors.New("copy fail")}
 	fo := &mock.FileOptimiser{MimeOut: *m.MimeType}
-	svc := NewMediaOptimiser(repo, fo, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || !strings.Contains(err.Error(), "copy fail") {
@@ -131,7 +153,7 @@ func TestOptimiseMedia_StatError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	strg := &mock.Storage{StatErr: errors.New("stat fail")}
 	fo := &mock.FileOptimiser{MimeOut: *m.MimeType}
-	svc := NewMediaOptimiser(repo, fo, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || !strings.Contains(err.Error(), "stat fail") {
@@ -145,7 +167,7 @@ func TestOptimiseMedia_UpdateError(t *testing.T) {
 	strg := &mock.Storage{}
 	strg.StatInfoOut = port.FileInfo{SizeBytes: 200}
 	fo := &mock.FileOptimiser{MimeOut: *m.MimeType}
-	svc := NewMediaOptimiser(repo, fo, strg, &mock.Dispatcher{}, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err == nil || !strings.Contains(err.Error(), "update fail") {
@@ -160,7 +182,7 @@ func TestOptimiseMedia_SuccessSameMime(t *testing.T) {
 	strg.StatInfoOut = port.FileInfo{SizeBytes: 456}
 	fo := &mock.FileOptimiser{MimeOut: *m.MimeType, CompressOut: []byte("comp")}
 	dispatcher := &mock.Dispatcher{}
-	svc := NewMediaOptimiser(repo, fo, strg, dispatcher, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, dispatcher, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err != nil {
@@ -191,7 +213,7 @@ func TestOptimiseMedia_SuccessMimeChange(t *testing.T) {
 	strg.StatInfoOut = port.FileInfo{SizeBytes: 789}
 	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
 	dispatcher := &mock.Dispatcher{}
-	svc := NewMediaOptimiser(repo, fo, strg, dispatcher, &mock.Cache{})
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, dispatcher, &mock.Cache{}, model.BucketsSettings{}, "")
 
 	err := svc.OptimiseMedia(context.Background(), m.ID)
 	if err != nil {
@@ -210,3 +232,612 @@ func TestOptimiseMedia_SuccessMimeChange(t *testing.T) {
 		t.Error("resize task not enqueued")
 	}
 }
+
+func TestOptimiseMedia_KeepOriginal(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	strg.StatInfoOut = port.FileInfo{SizeBytes: 789}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {KeepOriginals: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantKey := OriginalsPrefix + "foo.png"
+	if len(strg.CopiedKeys) == 0 || strg.CopiedKeys[0] != wantKey {
+		t.Errorf("expected original copied to %q first, got %v", wantKey, strg.CopiedKeys)
+	}
+	if repo.GotUpdated.OriginalObjectKey == nil || *repo.GotUpdated.OriginalObjectKey != wantKey {
+		t.Errorf("original object key not recorded: %v", repo.GotUpdated.OriginalObjectKey)
+	}
+	if repo.GotUpdated.OriginalSizeBytes == nil || *repo.GotUpdated.OriginalSizeBytes != 123 {
+		t.Errorf("original size not recorded: %v", repo.GotUpdated.OriginalSizeBytes)
+	}
+	if *repo.GotUpdated.SizeBytes != 789 {
+		t.Errorf("size = %d; want 789", *repo.GotUpdated.SizeBytes)
+	}
+}
+
+func TestOptimiseMedia_KeepOriginalCopyError(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{CopyErr: errors.New("copy fail")}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {KeepOriginals: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	err := svc.OptimiseMedia(context.Background(), m.ID)
+	if err == nil || !strings.Contains(err.Error(), "failed to keep original") {
+		t.Fatalf("expected keep original error, got %v", err)
+	}
+	if strg.SaveCalled || strg.RemoveCalled || repo.UpdateCalled {
+		t.Error("file should not be touched when the original cannot be kept")
+	}
+}
+
+func TestOptimiseMedia_OriginalAlreadyKept(t *testing.T) {
+	m := newCompletedMedia()
+	key := OriginalsPrefix + "foo.png"
+	m.OriginalObjectKey = &key
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {KeepOriginals: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, k := range strg.CopiedKeys {
+		if k == key {
+			t.Error("original should not be copied again")
+		}
+	}
+}
+
+func TestOptimiseMedia_RecordsStrategy(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	strg.StatInfoOut = port.FileInfo{SizeBytes: 100}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", StrategyOut: model.OptimisationLossyWebP, QualityOut: 62, ScoreOut: 0.97, CompressOut: []byte("webp")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.GotUpdated.Metadata.OptimisationStrategy != model.OptimisationLossyWebP {
+		t.Errorf("strategy = %q; want %q", repo.GotUpdated.Metadata.OptimisationStrategy, model.OptimisationLossyWebP)
+	}
+	if repo.GotUpdated.Metadata.WebPQuality != 62 || repo.GotUpdated.Metadata.QualityScore != 0.97 {
+		t.Errorf("quality = %d, score = %v; want 62 and 0.97", repo.GotUpdated.Metadata.WebPQuality, repo.GotUpdated.Metadata.QualityScore)
+	}
+	if repo.GotUpdated.Metadata.SavedBytes != 23 {
+		t.Errorf("saved bytes = %d; want 23", repo.GotUpdated.Metadata.SavedBytes)
+	}
+}
+
+func TestOptimiseMedia_OriginalKept(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{}
+	fo := &mock.FileOptimiser{MimeOut: "image/png", StrategyOut: model.OptimisationOriginal, CompressOut: []byte("png")}
+	dispatcher := &mock.Dispatcher{}
+	buckets := model.BucketsSettings{m.Bucket: {KeepOriginals: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, dispatcher, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strg.SaveCalled || strg.CopyCalled || strg.RemoveCalled {
+		t.Error("the original file should be left untouched")
+	}
+	if !repo.GotUpdated.Optimised {
+		t.Error("media should be marked optimised")
+	}
+	if repo.GotUpdated.ObjectKey != "foo.png" || *repo.GotUpdated.MimeType != "image/png" || *repo.GotUpdated.SizeBytes != 123 {
+		t.Errorf("file details should not change, got %q %q %d", repo.GotUpdated.ObjectKey, *repo.GotUpdated.MimeType, *repo.GotUpdated.SizeBytes)
+	}
+	if repo.GotUpdated.OriginalObjectKey != nil {
+		t.Error("no copy of the original is needed when it is kept as the file")
+	}
+	if repo.GotUpdated.Metadata.OptimisationStrategy != model.OptimisationOriginal || repo.GotUpdated.Metadata.SavedBytes != 0 {
+		t.Errorf("unexpected metadata %+v", repo.GotUpdated.Metadata)
+	}
+	if !dispatcher.ResizeCalled {
+		t.Error("resize task should still be enqueued")
+	}
+}
+
+func TestOptimiseMedia_PDFProfile(t *testing.T) {
+	m := newCompletedMedia()
+	mt := "application/pdf"
+	m.MimeType = &mt
+	m.ObjectKey = "foo.pdf"
+	m.Bucket = "docs"
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	m.Metadata = model.Metadata{PageCount: 2, Title: "Draft", Author: "Jane Doe", Keywords: []string{"internal"}, CreatedAt: &created, HasForms: true}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 100}}
+	fo := &mock.FileOptimiser{MimeOut: mt, StrategyOut: model.OptimisationPDF, CompressOut: []byte("pdf")}
+	profile := model.PDFProfile{StripMetadata: true, Flatten: true}
+	buckets := model.BucketsSettings{"docs": {PDFProfile: profile}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fo.GotCompressOpts.PDFProfile != profile {
+		t.Errorf("PDF profile = %+v; want %+v", fo.GotCompressOpts.PDFProfile, profile)
+	}
+	got := repo.GotUpdated.Metadata
+	if got.Title != "" || got.Author != "" || got.Keywords != nil || got.CreatedAt != nil {
+		t.Errorf("expected the document information to be forgotten, got %+v", got)
+	}
+	if got.HasForms {
+		t.Error("expected the flattened PDF to have no forms")
+	}
+	if got.PageCount != 2 {
+		t.Errorf("page count = %d; want 2", got.PageCount)
+	}
+}
+
+func TestOptimiseMedia_ContentAddressedKeys(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 789}}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {ContentAddressedKeys: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("webp"))
+	want := contentKey(m.ID.String(), sum[:], ".webp")
+	if repo.GotUpdated.ObjectKey != want {
+		t.Errorf("object key = %q; want %q", repo.GotUpdated.ObjectKey, want)
+	}
+	if !reflect.DeepEqual(strg.CopiedKeys, []string{want}) {
+		t.Errorf("copied keys = %v; want %v", strg.CopiedKeys, []string{want})
+	}
+	if strg.SaveOpts["Cache-Control"] != ImmutableCacheControl {
+		t.Errorf("Cache-Control = %q; want %q", strg.SaveOpts["Cache-Control"], ImmutableCacheControl)
+	}
+	if !reflect.DeepEqual(strg.RemovedKeys, []string{"foo.webp.tmp", "foo.png"}) {
+		t.Errorf("removed keys = %v; want the temp file and the previous file", strg.RemovedKeys)
+	}
+}
+
+func TestOptimiseMedia_ContentAddressedKeysSharedWithVersion(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	// the previous file of the media is also the file of one of its versions
+	versions := &mock.MediaVersionRepo{ListOut: []model.MediaVersion{{MediaID: m.ID, Version: 1, ObjectKey: "foo.png"}}}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 789}}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {ContentAddressedKeys: true}}
+	svc := NewMediaOptimiser(repo, versions, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(strg.RemovedKeys, []string{"foo.webp.tmp"}) {
+		t.Errorf("removed keys = %v; want only the temp file", strg.RemovedKeys)
+	}
+}
+
+func TestOptimiseMedia_ContentAddressedKeysVersionsListError(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{ListErr: errors.New("db fail")}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 789}}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {ContentAddressedKeys: true}}
+	svc := NewMediaOptimiser(repo, versions, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, key := range strg.RemovedKeys {
+		if key == "foo.png" {
+			t.Error("the previous file must be kept when the versions cannot be checked")
+		}
+	}
+}
+
+func TestOptimiseMedia_ContentAddressedKeysOriginalStrategy(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 123}}
+	fo := &mock.FileOptimiser{MimeOut: "image/png", StrategyOut: model.OptimisationOriginal, CompressOut: []byte("png")}
+	buckets := model.BucketsSettings{m.Bucket: {ContentAddressedKeys: true, KeepOriginals: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("png"))
+	if want := contentKey(m.ID.String(), sum[:], ".png"); repo.GotUpdated.ObjectKey != want {
+		t.Errorf("object key = %q; want %q", repo.GotUpdated.ObjectKey, want)
+	}
+	if repo.GotUpdated.OriginalObjectKey != nil {
+		t.Error("no copy of the original is needed when it is kept as the file")
+	}
+}
+
+func TestOptimiseMedia_ContentAddressedKeysUpdateError(t *testing.T) {
+	m := newCompletedMedia()
+	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
+	strg := &mock.Storage{}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp")}
+	buckets := model.BucketsSettings{m.Bucket: {ContentAddressedKeys: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	err := svc.OptimiseMedia(context.Background(), m.ID)
+	if err == nil || !strings.Contains(err.Error(), "update fail") {
+		t.Fatalf("expected update error, got %v", err)
+	}
+	for _, key := range strg.RemovedKeys {
+		if key == "foo.png" {
+			t.Error("the file still referenced by the media must not be removed")
+		}
+	}
+}
+
+func newCompletedMarkdown() *model.Media {
+	mt := "text/markdown"
+	size := int64(64)
+	return &model.Media{
+		ID:        msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")),
+		ObjectKey: "notes.md",
+		Bucket:    "docs",
+		MimeType:  &mt,
+		SizeBytes: &size,
+		Status:    model.MediaStatusCompleted,
+		Variants:  model.Variants{{ObjectKey: "variants/old.md.gz", Encoding: model.EncodingGzip}},
+	}
+}
+
+func TestOptimiseMedia_TextEncodedCopies(t *testing.T) {
+	m := newCompletedMarkdown()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{GetOut: strings.NewReader(strings.Repeat("# markdown\n", 8))}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("tiny")}
+	dispatcher := &mock.Dispatcher{}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, dispatcher, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(fo.Encodings, []string{model.EncodingBrotli, model.EncodingGzip}) {
+		t.Errorf("encodings = %v; want br then gzip", fo.Encodings)
+	}
+	prefix := "variants/" + m.ID.String() + "/notes"
+	want := model.Variants{
+		{ObjectKey: prefix + ".md.br", SizeBytes: 4, MimeType: "text/markdown", Encoding: model.EncodingBrotli},
+		{ObjectKey: prefix + ".md.gz", SizeBytes: 4, MimeType: "text/markdown", Encoding: model.EncodingGzip},
+		{ObjectKey: prefix + ".html", SizeBytes: renderedSize(t, strings.Repeat("# markdown\n", 8)), MimeType: "text/html"},
+	}
+	if !reflect.DeepEqual(repo.GotUpdated.Variants, want) {
+		t.Errorf("variants = %+v; want %+v", repo.GotUpdated.Variants, want)
+	}
+	if strg.SaveOpts["Content-Type"] != "text/html" || strg.SaveOpts["Content-Encoding"] != "" {
+		t.Errorf("unexpected save options for the HTML rendering %v", strg.SaveOpts)
+	}
+	if !reflect.DeepEqual(strg.RemovedKeys, []string{"variants/old.md.gz"}) {
+		t.Errorf("removed keys = %v; want the previous copy", strg.RemovedKeys)
+	}
+	if dispatcher.ResizeCalled {
+		t.Error("text files should not be resized")
+	}
+}
+
+func TestOptimiseMedia_TextCopyNotSmaller(t *testing.T) {
+	m := newCompletedMarkdown()
+	m.Variants = nil
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{GetOut: strings.NewReader("# hi")}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("longer than the file")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.GotUpdated.Variants) != 1 || repo.GotUpdated.Variants[0].Name() != "html" {
+		t.Errorf("only the HTML rendering should be kept, got %+v", repo.GotUpdated.Variants)
+	}
+}
+
+func TestOptimiseMedia_MarkdownHTMLContentAddressed(t *testing.T) {
+	m := newCompletedMarkdown()
+	m.Variants = nil
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{GetOut: strings.NewReader("# hi")}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("longer than the file")}
+	buckets := model.BucketsSettings{"docs": {ContentAddressedKeys: true}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	variants := repo.GotUpdated.Variants
+	if len(variants) != 1 {
+		t.Fatalf("variants = %+v; want the HTML rendering", variants)
+	}
+	key := variants[0].ObjectKey
+	if !strings.HasPrefix(key, "variants/"+m.ID.String()+"/") || !strings.HasSuffix(key, ".html") || strings.Contains(key, "notes") {
+		t.Errorf("key %q should be named after the content of the rendering", key)
+	}
+	if strg.SaveOpts["Cache-Control"] != ImmutableCacheControl {
+		t.Errorf("Cache-Control = %q; want immutable", strg.SaveOpts["Cache-Control"])
+	}
+}
+
+func TestOptimiseMedia_MarkdownInvalidFrontMatter(t *testing.T) {
+	m := newCompletedMarkdown()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{GetOut: strings.NewReader("---\ntitle: [oops\n---\ntext\n")}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("tiny")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err == nil {
+		t.Fatal("expected an error")
+	}
+	if repo.UpdateCalled {
+		t.Error("media should not be updated")
+	}
+}
+
+func TestOptimiseMedia_MarkdownResolvesReferences(t *testing.T) {
+	doc := newCompletedMarkdown()
+	doc.Variants = nil
+	imageID := msuuid.UUID(uuid.MustParse("bbbbbbbb-cccc-dddd-eeee-ffffffffffff"))
+	pendingID := msuuid.UUID(uuid.MustParse("cccccccc-dddd-eeee-ffff-aaaaaaaaaaaa"))
+	webp := "image/webp"
+	image := &model.Media{
+		ID:        imageID,
+		ObjectKey: "cat.webp",
+		Bucket:    "images",
+		MimeType:  &webp,
+		Status:    model.MediaStatusCompleted,
+		Metadata:  model.Metadata{Width: 1200},
+		Variants: model.Variants{
+			{ObjectKey: "variants/cat_600.webp", Width: 600},
+			{ObjectKey: "variants/cat_300.webp", Width: 300},
+			{ObjectKey: "variants/cat_300.jpg", Width: 300, MimeType: "image/jpeg"},
+		},
+	}
+	pending := &model.Media{ID: pendingID, Status: model.MediaStatusPending}
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{doc.ID: doc, imageID: image, pendingID: pending}}
+	src := "![Cat](media:" + imageID.String() + ") [draft](media:" + pendingID.String() + ")\n"
+	strg := &mock.Storage{GetOut: strings.NewReader(src)}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("longer than the whole file, for sure")}
+	buckets := model.BucketsSettings{"images": {Visibility: model.BucketVisibilityPublic, PublicBaseURL: "https://cdn.example.com"}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), doc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := string(strg.SavedContent)
+	want := `<img src="https://cdn.example.com/cat.webp" alt="Cat" srcset="https://cdn.example.com/variants/cat_300.webp 300w, https://cdn.example.com/variants/cat_600.webp 600w, https://cdn.example.com/cat.webp 1200w">`
+	if !strings.Contains(html, want) {
+		t.Errorf("HTML should contain %q:\n%s", want, html)
+	}
+	if strings.Contains(html, "media:") || !strings.Contains(html, "draft") {
+		t.Errorf("the link to the pending media should be dropped, keeping its text:\n%s", html)
+	}
+}
+
+func TestOptimiseMedia_MarkdownPrivateReferences(t *testing.T) {
+	doc := newCompletedMarkdown()
+	doc.Variants = nil
+	imageID := msuuid.UUID(uuid.MustParse("bbbbbbbb-cccc-dddd-eeee-ffffffffffff"))
+	webp := "image/webp"
+	image := &model.Media{
+		ID:        imageID,
+		ObjectKey: "cat.webp",
+		Bucket:    "images",
+		MimeType:  &webp,
+		Status:    model.MediaStatusCompleted,
+		Metadata:  model.Metadata{Width: 1200},
+		Variants:  model.Variants{{ObjectKey: "variants/cat_300.webp", Width: 300}},
+	}
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{doc.ID: doc, imageID: image}}
+	src := "![Cat](media:" + imageID.String() + ")\n"
+	strg := &mock.Storage{GetOut: strings.NewReader(src)}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("longer than the whole file, for sure")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "https://api.example.com")
+
+	if err := svc.OptimiseMedia(context.Background(), doc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := string(strg.SavedContent)
+	download := "https://api.example.com/medias/" + imageID.String() + "/download"
+	want := `<img src="` + download + `" alt="Cat" srcset="` + download + `?width=300 300w, ` + download + ` 1200w">`
+	if !strings.Contains(html, want) {
+		t.Errorf("HTML should contain %q:\n%s", want, html)
+	}
+	if strings.Contains(html, "https://example.com/download") {
+		t.Errorf("presigned links expire and should not be stored:\n%s", html)
+	}
+
+	// long after any presigned link would have expired, the endpoint presigns a fresh one
+	downloader := NewMediaDownloader(repo, &mock.Storage{}, model.BucketsSettings{})
+	out, err := downloader.DownloadMedia(context.Background(), port.DownloadMediaInput{ID: imageID, Width: 300, Accept: "image/webp"})
+	if err != nil || out.URL == "" {
+		t.Errorf("the stored link should still resolve, got %+v, %v", out, err)
+	}
+}
+
+func TestOptimiseMedia_MarkdownOverlaidReferences(t *testing.T) {
+	doc := newCompletedMarkdown()
+	doc.Variants = nil
+	imageID := msuuid.UUID(uuid.MustParse("bbbbbbbb-cccc-dddd-eeee-ffffffffffff"))
+	webp := "image/webp"
+	image := &model.Media{
+		ID:        imageID,
+		ObjectKey: "cat.webp",
+		Bucket:    "images",
+		MimeType:  &webp,
+		Status:    model.MediaStatusCompleted,
+		Metadata:  model.Metadata{Width: 1200},
+		Variants: model.Variants{
+			{ObjectKey: "variants/clean_300.webp", Width: 300},
+			{ObjectKey: "variants/cat_300_overlay.webp", Width: 300, Watermarked: true},
+			{ObjectKey: "variants/cat_600_overlay.webp", Width: 600, Watermarked: true},
+		},
+	}
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{doc.ID: doc, imageID: image}}
+	src := "![Cat](media:" + imageID.String() + ")\n"
+	strg := &mock.Storage{GetOut: strings.NewReader(src)}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeOut: []byte("longer than the whole file, for sure")}
+	buckets := model.BucketsSettings{"images": {
+		Visibility:    model.BucketVisibilityPublic,
+		PublicBaseURL: "https://cdn.example.com",
+		Overlay:       &model.ImageOverlay{Opacity: 0.5, Scale: 0.2},
+	}}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, buckets, "")
+
+	if err := svc.OptimiseMedia(context.Background(), doc.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html := string(strg.SavedContent)
+	want := `<img src="https://cdn.example.com/variants/cat_600_overlay.webp" alt="Cat" srcset="https://cdn.example.com/variants/cat_300_overlay.webp 300w, https://cdn.example.com/variants/cat_600_overlay.webp 600w">`
+	if !strings.Contains(html, want) {
+		t.Errorf("HTML should contain %q:\n%s", want, html)
+	}
+	if strings.Contains(html, "cdn.example.com/cat.webp") || strings.Contains(html, "clean") {
+		t.Errorf("the clean files should not be linked to:\n%s", html)
+	}
+}
+
+// renderedSize returns the size of the HTML rendering of a markdown document.
+func renderedSize(t *testing.T, src string) int64 {
+	t.Helper()
+	doc, err := markdown.Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	html, err := doc.HTML(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return int64(len(html))
+}
+
+// tiffPages returns a little-endian TIFF listing pages of the given sizes without their pixels,
+// which the mock optimiser never reads.
+func tiffPages(sizes ...image.Point) []byte {
+	bo := binary.LittleEndian
+	data := []byte{'I', 'I', 42, 0}
+	for _, size := range sizes {
+		// the offset of the next directory, written right after it
+		data = bo.AppendUint32(data, uint32(len(data)+4))
+		data = bo.AppendUint16(data, 2)
+		for _, entry := range [][2]int{{256, size.X}, {257, size.Y}} { // ImageWidth, ImageLength
+			data = bo.AppendUint16(data, uint16(entry[0]))
+			data = bo.AppendUint16(data, 4) // LONG
+			data = bo.AppendUint32(data, 1)
+			data = bo.AppendUint32(data, uint32(entry[1]))
+		}
+	}
+	return bo.AppendUint32(data, 0)
+}
+
+func TestOptimiseMedia_TIFFPageVariants(t *testing.T) {
+	m := newCompletedMedia()
+	mt := "image/tiff"
+	m.MimeType, m.ObjectKey = &mt, "foo.tiff"
+	sized := model.Variant{ObjectKey: "variants/x/foo_300.webp", Width: 300, Height: 200, TargetWidth: 300}
+	previousPage := model.Variant{ObjectKey: "variants/x/old_page2.webp", Width: 10, Height: 10, Page: 2}
+	m.Variants = model.Variants{sized, previousPage}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{
+		StatInfoOut: port.FileInfo{SizeBytes: 789},
+		GetOut:      bytes.NewReader(tiffPages(image.Pt(40, 30), image.Pt(30, 40), image.Pt(20, 20))),
+	}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", StrategyOut: model.OptimisationLossyWebP, CompressOut: []byte("webp"), PageOut: []byte("page")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(fo.GotPages, []int{2, 3}) {
+		t.Errorf("converted pages = %v; want 2 and 3", fo.GotPages)
+	}
+	want := model.Variants{
+		sized,
+		{ObjectKey: "variants/" + m.ID.String() + "/foo_page2.webp", SizeBytes: 4, Width: 30, Height: 40, MimeType: "image/webp", Page: 2},
+		{ObjectKey: "variants/" + m.ID.String() + "/foo_page3.webp", SizeBytes: 4, Width: 20, Height: 20, MimeType: "image/webp", Page: 3},
+	}
+	if !reflect.DeepEqual(repo.GotUpdated.Variants, want) {
+		t.Errorf("variants = %+v; want %+v", repo.GotUpdated.Variants, want)
+	}
+	if repo.GotUpdated.ObjectKey != "foo.webp" {
+		t.Errorf("object key = %q; want foo.webp", repo.GotUpdated.ObjectKey)
+	}
+	if !reflect.DeepEqual(strg.RemovedKeys, []string{"foo.webp.tmp", "foo.tiff", previousPage.ObjectKey}) {
+		t.Errorf("removed keys = %v; want the temp file, the TIFF and the previous page", strg.RemovedKeys)
+	}
+}
+
+func TestOptimiseMedia_TIFFPageError(t *testing.T) {
+	m := newCompletedMedia()
+	mt := "image/tiff"
+	m.MimeType, m.ObjectKey = &mt, "foo.tiff"
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 789}, GetOut: bytes.NewReader(tiffPages(image.Pt(4, 4), image.Pt(4, 4)))}
+	fo := &mock.FileOptimiser{MimeOut: "image/webp", CompressOut: []byte("webp"), PageErr: errors.New("page fail")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	if err := svc.OptimiseMedia(context.Background(), m.ID); err == nil || err.Error() != "page fail" {
+		t.Fatalf("expected page error, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("media should not be updated")
+	}
+}
+
+func TestOptimiseMedia_TextEncodeError(t *testing.T) {
+	m := newCompletedMarkdown()
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{GetOut: strings.NewReader(strings.Repeat("# markdown\n", 8))}
+	fo := &mock.FileOptimiser{MimeOut: "text/markdown", StrategyOut: model.OptimisationOriginal, EncodeErr: errors.New("encode fail")}
+	svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, strg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{}, "")
+
+	err := svc.OptimiseMedia(context.Background(), m.ID)
+	if err == nil || !strings.Contains(err.Error(), "encode fail") {
+		t.Fatalf("expected encode error, got %v", err)
+	}
+	if repo.UpdateCalled || strg.RemoveCalled {
+		t.Error("the media and its previous copies should be left untouched")
+	}
+}
+
+func TestOptimiseMedia_SVGRasterVariants(t *testing.T) {
+	for format, wantResize := range map[string]bool{"": false, "image/png": true} {
+		m := newCompletedMedia()
+		mt := "image/svg+xml"
+		m.MimeType, m.ObjectKey = &mt, "foo.svg"
+		repo := &mock.MediaRepo{MediaOut: m}
+		fo := &mock.FileOptimiser{MimeOut: mt, CompressOut: []byte("<svg/>")}
+		dispatcher := &mock.Dispatcher{}
+		buckets := model.BucketsSettings{"images": {SVGRasterVariants: format}}
+		svc := NewMediaOptimiser(repo, &mock.MediaVersionRepo{}, fo, &mock.Storage{}, dispatcher, &mock.Cache{}, buckets, "")
+
+		if err := svc.OptimiseMedia(context.Background(), m.ID); err != nil {
+			t.Fatalf("%q: unexpected error: %v", format, err)
+		}
+		if dispatcher.ResizeCalled != wantResize {
+			t.Errorf("%q: resize enqueued = %v; want %v", format, dispatcher.ResizeCalled, wantResize)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/raster"
+)
+
+// pageVariants replaces the page variants of a media converted from a TIFF with a WebP of each of
+// its pages but the first one, which the main file holds. The other variants are kept. It returns
+// the keys of the previous page variants, to remove once the media is updated.
+func (m *mediaOptimiserSrv) pageVariants(ctx context.Context, media *model.Media, original io.ReadSeeker, mimeType string) ([]string, error) {
+	if _, err := original.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind original of media #%s: %w", media.ID, err)
+	}
+	raw, err := io.ReadAll(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original of media #%s: %w", media.ID, err)
+	}
+	pages, err := raster.TIFFPages(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pages of media #%s: %w", media.ID, err)
+	}
+
+	var staleKeys []string
+	variants := make(model.Variants, 0, len(media.Variants)+len(pages)-1)
+	for _, v := range media.Variants {
+		if v.Page != 0 {
+			staleKeys = append(staleKeys, v.ObjectKey)
+			continue
+		}
+		variants = append(variants, v)
+	}
+	for i, page := range pages[1:] {
+		variant, err := m.savePageVariant(ctx, media, raw, mimeType, i+2)
+		if err != nil {
+			return nil, err
+		}
+		variant.Width, variant.Height = page.Width, page.Height
+		variants = append(variants, variant)
+	}
+	media.Variants = variants
+	return staleKeys, nil
+}
+
+// savePageVariant converts the page of the TIFF and saves it next to the main file. In buckets
+// with content-addressed keys, it is stored under the hash of its content and marked immutable.
+func (m *mediaOptimiserSrv) savePageVariant(ctx context.Context, media *model.Media, raw []byte, mimeType string, page int) (model.Variant, error) {
+	result, err := m.opt.ConvertPage(mimeType, bytes.NewReader(raw), page)
+	if err != nil {
+		return model.Variant{}, err
+	}
+	data, err := io.ReadAll(result.Reader)
+	_ = result.Reader.Close()
+	if err != nil {
+		return model.Variant{}, fmt.Errorf("failed to read page %d of media #%s: %w", page, media.ID, err)
+	}
+	ext, err := MimeTypeToExtension(result.MimeType)
+	if err != nil {
+		return model.Variant{}, err
+	}
+
+	settings := m.buckets.Get(media.Bucket)
+	opts := objectOptions(settings, media, result.MimeType)
+
+	dir := path.Join("variants", media.ID.String())
+	base := path.Base(media.ObjectKey)
+	key := path.Join(dir, strings.TrimSuffix(base, path.Ext(base))+"_page"+strconv.Itoa(page)+ext)
+	if settings.ContentAddressedKeys {
+		sum := sha256.Sum256(data)
+		key = contentKey(dir, sum[:], ext)
+		opts["Cache-Control"] = ImmutableCacheControl
+	}
+
+	if err := m.strg.SaveFile(ctx, media.Bucket, key, bytes.NewReader(data), int64(len(data)), opts); err != nil {
+		return model.Variant{}, fmt.Errorf("failed to save page %d %q: %w", page, key, err)
+	}
+
+	return model.Variant{
+		ObjectKey: key,
+		SizeBytes: int64(len(data)),
+		MimeType:  result.MimeType,
+		Page:      page,
+	}, nil
+}
@@ -0,0 +1,160 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// executableExtensions are the attachments refused in the buckets rejecting unsafe PDFs.
+var executableExtensions = map[string]struct{}{
+	".apk": {}, ".app": {}, ".bat": {}, ".bin": {}, ".cmd": {}, ".com": {}, ".cpl": {}, ".dll": {},
+	".dmg": {}, ".elf": {}, ".exe": {}, ".hta": {}, ".jar": {}, ".js": {}, ".jse": {}, ".msi": {},
+	".ps1": {}, ".scr": {}, ".sh": {}, ".vbe": {}, ".vbs": {}, ".wsf": {},
+}
+
+func fillPdfMetadata(file io.Reader) (model.Metadata, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error reading PDF data: %w", err)
+	}
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), conf)
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error reading PDF: %w", err)
+	}
+
+	dims, err := ctx.PageDims()
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error reading PDF page sizes: %w", err)
+	}
+	attachments, err := ctx.ListAttachments()
+	if err != nil {
+		return model.Metadata{}, fmt.Errorf("error listing PDF attachments: %w", err)
+	}
+
+	metadata := model.Metadata{
+		PageCount:     ctx.PageCount,
+		PDFVersion:    ctx.VersionString(),
+		Title:         strings.TrimSpace(ctx.Title),
+		Author:        strings.TrimSpace(ctx.Author),
+		Subject:       strings.TrimSpace(ctx.Subject),
+		Keywords:      pdfKeywords(ctx.Keywords),
+		CreatedAt:     pdfDate(ctx.XRefTable.CreationDate),
+		ModifiedAt:    pdfDate(ctx.ModDate),
+		Encrypted:     ctx.Encrypt != nil,
+		HasForms:      ctx.Form != nil,
+		HasJavaScript: hasJavaScript(ctx),
+	}
+	for _, d := range dims {
+		metadata.PageSizes = append(metadata.PageSizes, model.PageSize{Width: d.Width, Height: d.Height})
+	}
+	for _, a := range attachments {
+		metadata.EmbeddedFiles = append(metadata.EmbeddedFiles, a.FileName)
+	}
+	return metadata, nil
+}
+
+// pdfKeywords splits the keywords of the document information, separated by commas or semicolons.
+func pdfKeywords(raw string) []string {
+	var keywords []string
+	for _, k := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ';' }) {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// pdfDate parses a date of the document information, e.g. D:20240501120000+02'00'.
+func pdfDate(raw string) *time.Time {
+	if raw == "" {
+		return nil
+	}
+	t, ok := types.DateTime(raw, true)
+	if !ok {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// hasJavaScript looks for JavaScript actions in every object of the document, which covers the
+// document-level scripts as well as those run when opening it, on page events or by form fields.
+func hasJavaScript(ctx *pdfmodel.Context) bool {
+	for _, entry := range ctx.Table {
+		if entry != nil && !entry.Free && containsJavaScript(entry.Object) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsJavaScript(o types.Object) bool {
+	switch obj := o.(type) {
+	case types.Dict:
+		if _, ok := obj["JS"]; ok {
+			return true
+		}
+		if s, ok := obj["S"].(types.Name); ok && s == "JavaScript" {
+			return true
+		}
+		for _, v := range obj {
+			if containsJavaScript(v) {
+				return true
+			}
+		}
+	case types.StreamDict:
+		return containsJavaScript(obj.Dict)
+	case types.Array:
+		for _, v := range obj {
+			if containsJavaScript(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scrubPDFMetadata forgets what the PDF profile of the bucket removed from the file, so it is not
+// published with the media either.
+func scrubPDFMetadata(metadata *model.Metadata, profile model.PDFProfile) {
+	if profile.StripMetadata {
+		metadata.Title = ""
+		metadata.Author = ""
+		metadata.Subject = ""
+		metadata.Keywords = nil
+		metadata.CreatedAt = nil
+		metadata.ModifiedAt = nil
+	}
+	if profile.RemoveForms || profile.Flatten {
+		metadata.HasForms = false
+	}
+}
+
+// checkPDFSafety refuses the PDFs with JavaScript or executable attachments when the bucket
+// rejects unsafe PDFs.
+func checkPDFSafety(settings model.BucketSettings, metadata model.Metadata) error {
+	if !settings.RejectUnsafePDFs {
+		return nil
+	}
+	if metadata.HasJavaScript {
+		return fmt.Errorf("%w: it contains JavaScript", ErrUnsafePDF)
+	}
+	for _, name := range metadata.EmbeddedFiles {
+		if _, ok := executableExtensions[strings.ToLower(path.Ext(name))]; ok {
+			return fmt.Errorf("%w: attachment %q is executable", ErrUnsafePDF, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+)
+
+// buildPDF writes a two-page PDF with document information, the catalog entries and the objects
+// given, numbered from 6 on.
+func buildPDF(catalog string, objects ...string) []byte {
+	all := append([]string{
+		"<< /Type /Catalog /Pages 2 0 R " + catalog + " >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 842 595] >>",
+		"<< /Title (Annual report) /Author (Jane Doe) /Subject (Finance) /Keywords (report, 2024; finance) " +
+			"/CreationDate (D:20240501120000+02'00') /ModDate (D:20240601000000Z) >>",
+	}, objects...)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(all))
+	for i, obj := range all {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(all)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(all)+1, xref)
+	return buf.Bytes()
+}
+
+func TestFillPdfMetadata(t *testing.T) {
+	metadata, err := fillPdfMetadata(bytes.NewReader(buildPDF("/AcroForm << /Fields [6 0 R] >>", "<< /Type /Annot /Subtype /Widget /Rect [0 0 100 20] /FT /Tx /T (name) /DA (/Helv 0 Tf 0 g) >>")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	want := model.Metadata{
+		PageCount:  2,
+		PDFVersion: "1.7",
+		Title:      "Annual report",
+		Author:     "Jane Doe",
+		Subject:    "Finance",
+		Keywords:   []string{"report", "2024", "finance"},
+		CreatedAt:  &created,
+		ModifiedAt: &modified,
+		PageSizes:  []model.PageSize{{Width: 612, Height: 792}, {Width: 842, Height: 595}},
+		HasForms:   true,
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %+v; want %+v", metadata, want)
+	}
+}
+
+func TestFillPdfMetadata_JavaScript(t *testing.T) {
+	metadata, err := fillPdfMetadata(bytes.NewReader(buildPDF("/OpenAction 6 0 R", "<< /S /JavaScript /JS (app.alert(1)) >>")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !metadata.HasJavaScript {
+		t.Error("expected the JavaScript action to be found")
+	}
+}
+
+func TestFillPdfMetadata_EmbeddedFiles(t *testing.T) {
+	pdf := buildPDF(
+		"/Names << /EmbeddedFiles << /Names [(setup.exe) 6 0 R] >> >>",
+		"<< /Type /Filespec /F (setup.exe) /UF (setup.exe) /EF << /F 7 0 R >> >>",
+		"<< /Type /EmbeddedFile /Length 2 >>\nstream\nMZ\nendstream",
+	)
+	metadata, err := fillPdfMetadata(bytes.NewReader(pdf))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(metadata.EmbeddedFiles, []string{"setup.exe"}) {
+		t.Errorf("embedded files = %v; want [setup.exe]", metadata.EmbeddedFiles)
+	}
+	if metadata.HasJavaScript {
+		t.Error("expected no JavaScript")
+	}
+}
+
+func TestFillPdfMetadata_Invalid(t *testing.T) {
+	if _, err := fillPdfMetadata(bytes.NewReader([]byte("%PDF-1.4 broken"))); err == nil {
+		t.Fatal("expected an error for an invalid PDF")
+	}
+}
+
+func TestCheckPDFSafety(t *testing.T) {
+	strict := model.BucketSettings{RejectUnsafePDFs: true}
+	tests := []struct {
+		name     string
+		settings model.BucketSettings
+		metadata model.Metadata
+		wantErr  bool
+	}{
+		{"policy disabled", model.BucketSettings{}, model.Metadata{HasJavaScript: true}, false},
+		{"safe", strict, model.Metadata{EmbeddedFiles: []string{"data.csv"}}, false},
+		{"javascript", strict, model.Metadata{HasJavaScript: true}, true},
+		{"executable attachment", strict, model.Metadata{EmbeddedFiles: []string{"data.csv", "Setup.EXE"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := checkPDFSafety(tc.settings, tc.metadata)
+			if tc.wantErr != errors.Is(err, ErrUnsafePDF) {
+				t.Errorf("checkPDFSafety() = %v; want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestScrubPDFMetadata(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	full := model.Metadata{
+		PageCount:  2,
+		Title:      "Annual report",
+		Author:     "Jane Doe",
+		Subject:    "Finance",
+		Keywords:   []string{"report"},
+		CreatedAt:  &created,
+		ModifiedAt: &created,
+		HasForms:   true,
+	}
+	tests := []struct {
+		name    string
+		profile model.PDFProfile
+		want    model.Metadata
+	}{
+		{"empty profile", model.PDFProfile{}, full},
+		{"strip metadata", model.PDFProfile{StripMetadata: true}, model.Metadata{PageCount: 2, HasForms: true}},
+		{"remove annotations", model.PDFProfile{RemoveAnnotations: true}, full},
+		{"remove forms", model.PDFProfile{RemoveForms: true}, func() model.Metadata { m := full; m.HasForms = false; return m }()},
+		{"flatten", model.PDFProfile{Flatten: true}, func() model.Metadata { m := full; m.HasForms = false; return m }()},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := full
+			scrubPDFMetadata(&got, tc.profile)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("metadata = %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
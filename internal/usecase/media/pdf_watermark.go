@@ -0,0 +1,91 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// WatermarkCacheTTL is how long the copy of a PDF watermarked for a user is reused. Downloads
+// within that time carry the timestamp of the first one.
+const WatermarkCacheTTL = 10 * time.Minute
+
+// watermarkDescription lays the watermark along the bottom of every page, under the content.
+const watermarkDescription = "font:Helvetica, points:9, pos:bc, off:0 12, rot:0, scale:1 abs, fillcolor:#808080, opacity:0.8"
+
+// isWatermarked reports whether the file is stamped for the user downloading it.
+func isWatermarked(settings model.BucketSettings, mimeType string) bool {
+	return settings.WatermarkPDFs && IsPdf(mimeType)
+}
+
+// watermarkText is what the PDF downloaded by the user is stamped with.
+func watermarkText(userID msuuid.UUID, at time.Time) string {
+	return fmt.Sprintf("Downloaded by %s on %s", userID, at.UTC().Format("2006-01-02 15:04 UTC"))
+}
+
+// watermarkPDF writes the PDF read from rs to w, with text stamped on every page.
+func watermarkPDF(rs io.ReadSeeker, w io.Writer, text string) error {
+	wm, err := api.TextWatermark(text, watermarkDescription, true, false, types.POINTS)
+	if err != nil {
+		return fmt.Errorf("error building PDF watermark: %w", err)
+	}
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+	if err := api.AddWatermarks(rs, w, nil, wm, conf); err != nil {
+		return fmt.Errorf("error watermarking PDF: %w", err)
+	}
+	return nil
+}
+
+// watermarkedContent returns the file of the media stamped for the user, reusing the copy made
+// for their previous download of the same file while it is cached.
+func watermarkedContent(ctx context.Context, strg port.Storage, ca port.Cache, media *model.Media, info port.FileInfo, userID msuuid.UUID) ([]byte, error) {
+	data, err := ca.GetWatermarkedPDF(ctx, media.ID, userID, info.ETag)
+	if err != nil {
+		logger.Warnf(ctx, "failed reading the watermarked PDF of media #%s from the cache: %v", media.ID, err)
+	}
+	if data != nil {
+		return data, nil
+	}
+
+	file, err := strg.GetFile(ctx, media.Bucket, media.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file %q: %w", media.ObjectKey, err)
+	}
+	defer func() {
+		if cerr := file.Close(); cerr != nil {
+			logger.Warnf(ctx, "error closing file %q: %v", media.ObjectKey, cerr)
+		}
+	}()
+
+	now := time.Now()
+	buf := &bytes.Buffer{}
+	if err := watermarkPDF(file, buf, watermarkText(userID, now)); err != nil {
+		return nil, err
+	}
+
+	validUntil := now.Add(WatermarkCacheTTL)
+	if media.ExpiresAt != nil && media.ExpiresAt.Before(validUntil) {
+		validUntil = *media.ExpiresAt
+	}
+	ca.SetWatermarkedPDF(ctx, media.ID, userID, info.ETag, buf.Bytes(), validUntil)
+	return buf.Bytes(), nil
+}
+
+// memoryFile serves content already in memory.
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
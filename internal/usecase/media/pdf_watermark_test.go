@@ -0,0 +1,164 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func newWatermarkedMedia() *model.Media {
+	mt := "application/pdf"
+	return &model.Media{
+		ID:               msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")),
+		Status:           model.MediaStatusCompleted,
+		OriginalFilename: "report.pdf",
+		Bucket:           "docs",
+		ObjectKey:        "foo.pdf",
+		MimeType:         &mt,
+	}
+}
+
+var watermarkBuckets = model.BucketsSettings{"docs": {WatermarkPDFs: true}}
+
+func TestWatermarkPDF(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := watermarkPDF(bytes.NewReader(buildPDF("")), out, "Downloaded by someone"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ok, err := api.HasWatermarks(bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("reading watermarked PDF: %v", err)
+	}
+	if !ok {
+		t.Error("expected the PDF to be watermarked")
+	}
+}
+
+func TestWatermarkPDF_Invalid(t *testing.T) {
+	if err := watermarkPDF(bytes.NewReader([]byte("not a pdf")), io.Discard, "text"); err == nil {
+		t.Fatal("expected an error for an invalid PDF")
+	}
+}
+
+func TestWatermarkText(t *testing.T) {
+	userID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	at := time.Date(2025, 6, 1, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	want := "Downloaded by 11111111-2222-3333-4444-555555555555 on 2025-06-01 12:30 UTC"
+	if got := watermarkText(userID, at); got != want {
+		t.Errorf("watermarkText = %q; want %q", got, want)
+	}
+}
+
+func TestGetMediaContent_WatermarkNeedsUser(t *testing.T) {
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 5, ETag: "abc"}}
+	svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: newWatermarkedMedia()}, strg, &mock.Cache{}, watermarkBuckets)
+
+	_, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{})
+	if !errors.Is(err, ErrWatermarkNeedsUser) {
+		t.Fatalf("error = %v; want ErrWatermarkNeedsUser", err)
+	}
+	if strg.GetCalled || strg.GetRangeCalled {
+		t.Error("no content should be read")
+	}
+}
+
+func TestGetMediaContent_Watermarked(t *testing.T) {
+	userID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	strg := &mock.Storage{
+		StatInfoOut: port.FileInfo{SizeBytes: 5, ETag: "abc", LastModified: time.Now()},
+		GetOut:      bytes.NewReader(buildPDF("")),
+	}
+	ca := &mock.Cache{}
+	svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: newWatermarkedMedia()}, strg, ca, watermarkBuckets)
+
+	out, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{UserID: &userID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !out.Watermarked || out.ETag != "" || !out.LastModified.IsZero() {
+		t.Errorf("expected a watermarked output without validators, got %+v", out)
+	}
+	data, err := io.ReadAll(out.Content)
+	if err != nil {
+		t.Fatalf("reading content: %v", err)
+	}
+	if int64(len(data)) != out.SizeBytes {
+		t.Errorf("size = %d; want %d", out.SizeBytes, len(data))
+	}
+	if ok, err := api.HasWatermarks(bytes.NewReader(data), nil); err != nil || !ok {
+		t.Errorf("expected the content to be watermarked, got %v (%v)", ok, err)
+	}
+	if out.ContentDisposition != `inline; filename=report.pdf` {
+		t.Errorf("Content-Disposition = %q", out.ContentDisposition)
+	}
+
+	if !ca.SetWatermarkCalled || ca.GotWatermarkUserID != userID || ca.GotWatermarkEtag != "abc" {
+		t.Errorf("expected the copy to be cached for the user and the ETag, got user %s and ETag %q", ca.GotWatermarkUserID, ca.GotWatermarkEtag)
+	}
+	if ttl := time.Until(ca.WatermarkValidUntil); ttl <= 0 || ttl > WatermarkCacheTTL {
+		t.Errorf("cached for %v; want at most %v", ttl, WatermarkCacheTTL)
+	}
+}
+
+func TestGetMediaContent_WatermarkedFromCache(t *testing.T) {
+	userID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 5, ETag: "abc"}}
+	ca := &mock.Cache{WatermarkedOut: []byte("%PDF-cached")}
+	svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: newWatermarkedMedia()}, strg, ca, watermarkBuckets)
+
+	out, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{UserID: &userID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := io.ReadAll(out.Content)
+	if string(data) != "%PDF-cached" {
+		t.Errorf("content = %q; want the cached copy", data)
+	}
+	if strg.GetCalled || ca.SetWatermarkCalled {
+		t.Error("the cached copy should be served as is")
+	}
+}
+
+func TestGetMediaContent_WatermarkedExpiringMedia(t *testing.T) {
+	userID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	media := newWatermarkedMedia()
+	expiresAt := time.Now().Add(time.Minute)
+	media.ExpiresAt = &expiresAt
+	strg := &mock.Storage{StatInfoOut: port.FileInfo{SizeBytes: 5, ETag: "abc"}, GetOut: bytes.NewReader(buildPDF(""))}
+	ca := &mock.Cache{}
+	svc := NewMediaContentGetter(&mock.MediaRepo{MediaOut: media}, strg, ca, watermarkBuckets)
+
+	if _, err := svc.GetMediaContent(context.Background(), port.GetMediaContentInput{UserID: &userID}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ca.WatermarkValidUntil.Equal(expiresAt) {
+		t.Errorf("cached until %v; want the expiry of the media %v", ca.WatermarkValidUntil, expiresAt)
+	}
+}
+
+func TestDownloadMedia_Watermarked(t *testing.T) {
+	strg := &mock.Storage{}
+	svc := NewMediaDownloader(&mock.MediaRepo{MediaOut: newWatermarkedMedia()}, strg, watermarkBuckets)
+
+	out, err := svc.DownloadMedia(context.Background(), port.DownloadMediaInput{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !out.Watermarked || out.URL != "" || out.MimeType != "application/pdf" {
+		t.Errorf("expected a watermarked output without URL, got %+v", out)
+	}
+	if strg.GenerateDownloadLinkCalled {
+		t.Error("no link should be generated for a watermarked file")
+	}
+}
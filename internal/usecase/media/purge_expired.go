@@ -0,0 +1,39 @@
+package media
+
+import (
+	"context"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type expiredPurgerSrv struct {
+	repo    port.MediaRepository
+	deleter port.MediaDeleter
+}
+
+// compile-time check: *expiredPurgerSrv must satisfy port.ExpiredPurger
+var _ port.ExpiredPurger = (*expiredPurgerSrv)(nil)
+
+// NewExpiredPurger constructs an ExpiredPurger implementation.
+func NewExpiredPurger(repo port.MediaRepository, deleter port.MediaDeleter) port.ExpiredPurger {
+	return &expiredPurgerSrv{repo, deleter}
+}
+
+// PurgeExpired removes for good every media, whatever its status, whose expiry date has passed.
+func (s *expiredPurgerSrv) PurgeExpired(ctx context.Context) error {
+	ids, err := s.repo.ListExpiredBefore(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		logger.Infof(ctx, "purging expired media #%s", id)
+		if err := s.deleter.PurgeMedia(ctx, id); err != nil {
+			logger.Warnf(ctx, "failed to purge expired media #%s: %v", id, err)
+		}
+	}
+	return nil
+}
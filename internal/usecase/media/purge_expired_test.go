@@ -0,0 +1,48 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestPurgeExpired_RepoError(t *testing.T) {
+	repo := &mock.MediaRepo{ListExpiredBeforeErr: errors.New("db fail")}
+	deleter := &mock.MediaDeleter{}
+	svc := NewExpiredPurger(repo, deleter)
+
+	if err := svc.PurgeExpired(context.Background()); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+	if len(deleter.PurgedIDs) != 0 {
+		t.Errorf("expected no purge, got %v", deleter.PurgedIDs)
+	}
+}
+
+func TestPurgeExpired_Success(t *testing.T) {
+	id1 := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	id2 := msuuid.UUID(uuid.MustParse("ffffffff-1111-2222-3333-444444444444"))
+	repo := &mock.MediaRepo{ListExpiredOut: []msuuid.UUID{id1, id2}}
+	deleter := &mock.MediaDeleter{PurgeErr: errors.New("purge fail")}
+	svc := NewExpiredPurger(repo, deleter)
+
+	before := time.Now()
+	if err := svc.PurgeExpired(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := time.Now()
+
+	if cutoff := repo.GotListExpiredBefore; cutoff.Before(before) || cutoff.After(after) {
+		t.Errorf("cutoff %v should be now", cutoff)
+	}
+	// a failing purge must not stop the others
+	if !reflect.DeepEqual(deleter.PurgedIDs, []msuuid.UUID{id1, id2}) {
+		t.Errorf("purged IDs = %v; want %v", deleter.PurgedIDs, []msuuid.UUID{id1, id2})
+	}
+}
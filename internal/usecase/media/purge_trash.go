@@ -0,0 +1,53 @@
+package media
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type trashPurgerSrv struct {
+	repo    port.MediaRepository
+	deleter port.MediaDeleter
+	buckets model.BucketsSettings
+}
+
+// compile-time check: *trashPurgerSrv must satisfy port.TrashPurger
+var _ port.TrashPurger = (*trashPurgerSrv)(nil)
+
+// NewTrashPurger constructs a TrashPurger implementation.
+func NewTrashPurger(repo port.MediaRepository, deleter port.MediaDeleter, buckets model.BucketsSettings) port.TrashPurger {
+	return &trashPurgerSrv{repo, deleter, buckets}
+}
+
+// PurgeTrash looks, bucket by bucket, for medias deleted longer ago than the bucket
+// trash retention and removes them for good.
+func (s *trashPurgerSrv) PurgeTrash(ctx context.Context) error {
+	buckets := make([]string, 0, len(s.buckets))
+	for b := range s.buckets {
+		buckets = append(buckets, b)
+	}
+	sort.Strings(buckets)
+
+	now := time.Now()
+	for _, bucket := range buckets {
+		cutoff := now.Add(-s.buckets.Get(bucket).TrashRetention)
+		ids, err := s.repo.ListDeletedBefore(ctx, bucket, cutoff)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			logger.Infof(ctx, "purging media #%s from the trash of bucket %q", id, bucket)
+			if err := s.deleter.PurgeMedia(ctx, id); err != nil {
+				logger.Warnf(ctx, "failed to purge media #%s: %v", id, err)
+			}
+		}
+	}
+	return nil
+}
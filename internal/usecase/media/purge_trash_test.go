@@ -0,0 +1,54 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestPurgeTrash_RepoError(t *testing.T) {
+	repo := &mock.MediaRepo{ListDeletedBeforeErr: errors.New("db fail")}
+	deleter := &mock.MediaDeleter{}
+	svc := NewTrashPurger(repo, deleter, model.BucketsSettings{"images": {TrashRetention: time.Hour}})
+
+	if err := svc.PurgeTrash(context.Background()); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+	if len(deleter.PurgedIDs) != 0 {
+		t.Errorf("expected no purge, got %v", deleter.PurgedIDs)
+	}
+}
+
+func TestPurgeTrash_Success(t *testing.T) {
+	id1 := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	id2 := msuuid.UUID(uuid.MustParse("ffffffff-1111-2222-3333-444444444444"))
+	repo := &mock.MediaRepo{ListDeletedOut: []msuuid.UUID{id1, id2}}
+	deleter := &mock.MediaDeleter{PurgeErr: errors.New("purge fail")}
+	retention := 48 * time.Hour
+	svc := NewTrashPurger(repo, deleter, model.BucketsSettings{"images": {TrashRetention: retention}})
+
+	before := time.Now()
+	if err := svc.PurgeTrash(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := time.Now()
+
+	if !reflect.DeepEqual(repo.GotListDeletedBuckets, []string{"images"}) {
+		t.Errorf("listed buckets = %v; want [images]", repo.GotListDeletedBuckets)
+	}
+	cutoff := repo.GotListDeletedBefore
+	if cutoff.Before(before.Add(-retention)) || cutoff.After(after.Add(-retention)) {
+		t.Errorf("cutoff %v should be %v ago", cutoff, retention)
+	}
+	// a failing purge must not stop the others
+	if !reflect.DeepEqual(deleter.PurgedIDs, []msuuid.UUID{id1, id2}) {
+		t.Errorf("purged IDs = %v; want %v", deleter.PurgedIDs, []msuuid.UUID{id1, id2})
+	}
+}
@@ -0,0 +1,78 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+// rangedFile reads a stored file of known size through ranged requests. The request is
+// only sent on the first read after a seek, and reads from there to the end of the file,
+// so that serving a range never downloads the whole file.
+type rangedFile struct {
+	ctx    context.Context
+	strg   port.Storage
+	bucket string
+	key    string
+	size   int64
+
+	offset int64
+	body   io.ReadCloser
+}
+
+func newRangedFile(ctx context.Context, strg port.Storage, bucket, key string, size int64) *rangedFile {
+	return &rangedFile{ctx: ctx, strg: strg, bucket: bucket, key: key, size: size}
+}
+
+func (f *rangedFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		body, err := f.strg.GetFileRange(f.ctx, f.bucket, f.key, f.offset, f.size-f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *rangedFile) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = f.offset + offset
+	case io.SeekEnd:
+		pos = f.size + offset
+	default:
+		return 0, errors.New("rangedFile.Seek: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("rangedFile.Seek: negative position")
+	}
+
+	if pos != f.offset {
+		if err := f.Close(); err != nil {
+			return 0, err
+		}
+		f.offset = pos
+	}
+	return pos, nil
+}
+
+func (f *rangedFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
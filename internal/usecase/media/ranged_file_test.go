@@ -0,0 +1,82 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+)
+
+func TestRangedFile_ReadsLazilyFromOffset(t *testing.T) {
+	content := []byte("0123456789")
+	strg := &mock.Storage{GetOut: bytes.NewReader(content)}
+	f := newRangedFile(context.Background(), strg, "bucket", "key", int64(len(content)))
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil || size != 10 {
+		t.Fatalf("Seek end = %d, %v; want 10", size, err)
+	}
+	if _, err := f.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strg.GetRangeCalled {
+		t.Fatal("seeking should not read from the storage")
+	}
+
+	got := make([]byte, 3)
+	if _, err := io.ReadFull(f, got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "456" {
+		t.Errorf("read %q; want %q", got, "456")
+	}
+
+	if _, err := f.Seek(-2, io.SeekCurrent); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(rest) != "56789" {
+		t.Errorf("read %q; want %q", rest, "56789")
+	}
+
+	want := [][2]int64{{4, 6}, {5, 5}}
+	if len(strg.Ranges) != len(want) || strg.Ranges[0] != want[0] || strg.Ranges[1] != want[1] {
+		t.Errorf("ranges = %v; want %v", strg.Ranges, want)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("unexpected close error: %v", err)
+	}
+}
+
+func TestRangedFile_EOFWithoutRequest(t *testing.T) {
+	strg := &mock.Storage{}
+	f := newRangedFile(context.Background(), strg, "bucket", "key", 0)
+
+	if n, err := f.Read(make([]byte, 4)); n != 0 || err != io.EOF {
+		t.Errorf("Read = %d, %v; want 0, EOF", n, err)
+	}
+	if strg.GetRangeCalled {
+		t.Error("an empty file should not be requested")
+	}
+}
+
+func TestRangedFile_Errors(t *testing.T) {
+	strg := &mock.Storage{GetErr: errors.New("minio down")}
+	f := newRangedFile(context.Background(), strg, "bucket", "key", 10)
+
+	if _, err := f.Read(make([]byte, 4)); err == nil {
+		t.Error("expected the storage error")
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("expected an error seeking before the start")
+	}
+	if _, err := f.Seek(0, 42); err == nil {
+		t.Error("expected an error for an invalid whence")
+	}
+}
@@ -0,0 +1,56 @@
+package media
+
+import (
+	"context"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// ReconcileBatchSize is the number of images fetched from the database at once when reconciling variants.
+const ReconcileBatchSize = 100
+
+type variantsReconcilerSrv struct {
+	repo  port.MediaRepository
+	tasks port.TaskDispatcher
+}
+
+// compile-time check: *variantsReconcilerSrv must satisfy port.VariantsReconciler
+var _ port.VariantsReconciler = (*variantsReconcilerSrv)(nil)
+
+// NewVariantsReconciler constructs a VariantsReconciler implementation.
+func NewVariantsReconciler(repo port.MediaRepository, tasks port.TaskDispatcher) port.VariantsReconciler {
+	return &variantsReconcilerSrv{repo, tasks}
+}
+
+// ReconcileVariants walks through every completed image in batches and enqueues a reconcile
+// task for each, so their variants end up matching the configured sizes.
+func (s *variantsReconcilerSrv) ReconcileVariants(ctx context.Context) error {
+	var (
+		after msuuid.UUID
+		total int
+	)
+	for {
+		ids, err := s.repo.ListCompletedImagesAfter(ctx, after, ReconcileBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if err := s.tasks.EnqueueReconcileImage(ctx, id); err != nil {
+				logger.Warnf(ctx, "failed to enqueue reconcile task for media #%s: %v", id, err)
+			}
+		}
+		total += len(ids)
+
+		if len(ids) < ReconcileBatchSize {
+			break
+		}
+		after = ids[len(ids)-1]
+	}
+
+	logger.Infof(ctx, "enqueued variants reconciliation for %d images", total)
+	return nil
+}
@@ -0,0 +1,52 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestReconcileVariants_RepoError(t *testing.T) {
+	repo := &mock.MediaRepo{ListCompletedImagesAfterErr: errors.New("db fail")}
+	dispatcher := &mock.Dispatcher{}
+	svc := NewVariantsReconciler(repo, dispatcher)
+
+	if err := svc.ReconcileVariants(context.Background()); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+	if dispatcher.ReconcileCalled {
+		t.Error("expected no task to be enqueued")
+	}
+}
+
+func TestReconcileVariants_Batches(t *testing.T) {
+	full := make([]msuuid.UUID, ReconcileBatchSize)
+	for i := range full {
+		full[i] = msuuid.NewUUID()
+	}
+	last := msuuid.UUID(uuid.MustParse("ffffffff-1111-2222-3333-444444444444"))
+	repo := &mock.MediaRepo{ListImagesPages: [][]msuuid.UUID{full, {last}}}
+	dispatcher := &mock.Dispatcher{ReconcileErr: errors.New("enqueue fail")}
+	svc := NewVariantsReconciler(repo, dispatcher)
+
+	if err := svc.ReconcileVariants(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantAfter := []msuuid.UUID{{}, full[len(full)-1]}
+	if !reflect.DeepEqual(repo.GotListImagesAfter, wantAfter) {
+		t.Errorf("pages fetched after %v; want %v", repo.GotListImagesAfter, wantAfter)
+	}
+	if repo.GotListImagesLimit != ReconcileBatchSize {
+		t.Errorf("limit = %d; want %d", repo.GotListImagesLimit, ReconcileBatchSize)
+	}
+	// a failing enqueue must not stop the others
+	if len(dispatcher.ReconcileIDs) != ReconcileBatchSize+1 {
+		t.Errorf("enqueued %d tasks; want %d", len(dispatcher.ReconcileIDs), ReconcileBatchSize+1)
+	}
+}
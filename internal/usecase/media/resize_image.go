@@ -1,12 +1,16 @@
 package media
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/fhuszti/medias-ms-go/internal/model"
@@ -16,21 +20,30 @@ import (
 )
 
 type imageResizerSrv struct {
-	repo  port.MediaRepository
-	opt   port.FileOptimiser
-	strg  port.Storage
-	cache port.Cache
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	opt      port.FileOptimiser
+	strg     port.Storage
+	tasks    port.TaskDispatcher
+	cache    port.Cache
+	buckets  model.BucketsSettings
 }
 
 // compile-time check: *imageResizerSrv must satisfy port.ImageResizer
 var _ port.ImageResizer = (*imageResizerSrv)(nil)
 
 // NewImageResizer constructs an ImageResizer implementation.
-func NewImageResizer(repo port.MediaRepository, opt port.FileOptimiser, strg port.Storage, cache port.Cache) port.ImageResizer {
-	return &imageResizerSrv{repo, opt, strg, cache}
+func NewImageResizer(repo port.MediaRepository, versions port.MediaVersionRepository, opt port.FileOptimiser, strg port.Storage, tasks port.TaskDispatcher, cache port.Cache, buckets model.BucketsSettings) port.ImageResizer {
+	return &imageResizerSrv{repo, versions, opt, strg, tasks, cache, buckets}
 }
 
 // ResizeImage fetches the media by ID and generates resized variants for the given sizes.
+// Variants of sizes that are no longer given are removed, so the media ends up with exactly
+// one WebP variant per size, plus a fallback one when the bucket asks for it or the image is
+// animated. In reconcile mode, only the sizes the media does not have yet are generated.
+// In buckets with an overlay, each variant is generated twice: clean for the owner of the image,
+// and with the overlay drawn over it for everyone else.
+// SVGs get raster variants in the format the bucket asks for, if any, and never an overlay.
 func (s *imageResizerSrv) ResizeImage(ctx context.Context, in port.ResizeImageInput) error {
 	media, err := s.repo.GetByID(ctx, in.ID)
 	if err != nil {
@@ -39,81 +52,91 @@ func (s *imageResizerSrv) ResizeImage(ctx context.Context, in port.ResizeImageIn
 		}
 		return err
 	}
+	if media.Status == model.MediaStatusDeleted {
+		logger.Infof(ctx, "media #%s is in the trash, skipping resize", media.ID)
+		return nil
+	}
 	if media.Status != model.MediaStatusCompleted {
 		return fmt.Errorf("media status should be 'completed' to be resized")
 	}
-	if media.MimeType == nil || !IsImage(*media.MimeType) {
+	if media.MimeType == nil || (!IsImage(*media.MimeType) && !IsSVG(*media.MimeType)) {
 		return fmt.Errorf("media is not an image")
 	}
 
-	originalReader, err := s.strg.GetFile(ctx, media.Bucket, media.ObjectKey)
-	if err != nil {
-		return err
+	settings := s.buckets.Get(media.Bucket)
+	// animated variants are not played by every client, so they always come with a still poster
+	withFallback := settings.FallbackVariants || media.Metadata.FrameCount > 1
+	slots := variantSlots(uniqueSizes(in.Sizes), withFallback, settings.Overlay != nil)
+	if IsSVG(*media.MimeType) {
+		slots = svgVariantSlots(media, uniqueSizes(in.Sizes), settings.SVGRasterVariants)
 	}
-	defer func(originalReader io.ReadSeekCloser) { _ = originalReader.Close() }(originalReader)
+	existing, obsolete, pages := matchVariants(media.Variants, slots)
 
-	for _, width := range in.Sizes {
-		if width <= 0 {
-			continue
+	var missing []variantSlot
+	for _, slot := range slots {
+		if _, ok := existing[slot]; !ok || !in.Reconcile {
+			missing = append(missing, slot)
 		}
+	}
+	if len(missing) == 0 && len(obsolete) == 0 {
+		logger.Infof(ctx, "variants of media #%s are already up to date", media.ID)
+		return nil
+	}
 
-		ext := path.Ext(media.ObjectKey)
-		base := strings.TrimSuffix(media.ObjectKey, ext)
-		variantKey := path.Join(
-			"variants",
-			media.ID.String(),
-			fmt.Sprintf("%s_%d.webp", base, width),
-		)
-
-		var (
-			variantWidth  int
-			variantHeight int
-		)
-
-		if width < media.Metadata.Width {
-			variantWidth = width
-			variantHeight = int(float64(media.Metadata.Height) * float64(width) / float64(media.Metadata.Width))
+	if len(missing) > 0 {
+		originalReader, err := s.strg.GetFile(ctx, media.Bucket, media.ObjectKey)
+		if err != nil {
+			return err
+		}
+		defer func(originalReader io.ReadSeekCloser) { _ = originalReader.Close() }(originalReader)
 
-			if _, err := originalReader.Seek(0, io.SeekStart); err != nil {
-				return fmt.Errorf("failed to reset reader: %w", err)
+		var overlay *port.Overlay
+		if settings.Overlay != nil {
+			if overlay, err = s.loadOverlay(ctx, *settings.Overlay); err != nil {
+				return err
 			}
+		}
 
-			resized, err := s.opt.Resize(*media.MimeType, originalReader, variantWidth, variantHeight)
+		for _, slot := range missing {
+			generate := s.generateVariant
+			if slot.fallback {
+				generate = s.generateFallbackVariant
+			}
+			var opts port.ResizeOptions
+			if slot.overlay {
+				opts.Overlay = overlay
+			}
+			variant, err := generate(ctx, media, originalReader, slot.width, opts)
 			if err != nil {
 				return err
 			}
-
-			if err := s.strg.SaveFile(ctx, media.Bucket, variantKey, resized, -1, map[string]string{"Content-Type": "image/webp"}); err != nil {
-				_ = resized.Close()
-				return fmt.Errorf("failed to save variant %q: %w", variantKey, err)
+			if prev, ok := existing[slot]; ok && prev.ObjectKey != variant.ObjectKey {
+				// e.g. a fallback switching from JPEG to PNG
+				obsolete = append(obsolete, prev)
 			}
-			_ = resized.Close()
-		} else {
-			variantWidth = media.Metadata.Width
-			variantHeight = media.Metadata.Height
-
-			if err := s.strg.CopyFile(ctx, media.Bucket, media.ObjectKey, variantKey); err != nil {
-				return fmt.Errorf("failed to copy original file to variant %q: %w", variantKey, err)
-			}
-		}
-		info, err := s.strg.StatFile(ctx, media.Bucket, variantKey)
-		if err != nil {
-			return fmt.Errorf("failed reading info about variant %q: %w", variantKey, err)
+			existing[slot] = variant
 		}
+	}
 
-		media.Variants = append(media.Variants, model.Variant{
-			ObjectKey: variantKey,
-			SizeBytes: info.SizeBytes,
-			Width:     variantWidth,
-			Height:    variantHeight,
-		})
+	// exactly one entry per configured size and format, in the configured order
+	variants := make(model.Variants, 0, len(slots)+len(pages))
+	for _, slot := range slots {
+		variants = append(variants, existing[slot])
 	}
+	media.Variants = append(variants, pages...)
 
 	if err := s.repo.Update(ctx, media); err != nil {
 		logger.Errorf(ctx, "failed updating media with variants: %v", err)
 		return fmt.Errorf("failed updating media: %w", err)
 	}
 
+	obsoleteKeys := make([]string, 0, len(obsolete))
+	for _, v := range obsolete {
+		obsoleteKeys = append(obsoleteKeys, v.ObjectKey)
+	}
+	removeStaleFiles(ctx, s.strg, s.versions, media, obsoleteKeys)
+	rerenderReferencing(ctx, s.repo, s.tasks, media.ID)
+
 	if err := s.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
 		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
 	}
@@ -122,3 +145,274 @@ func (s *imageResizerSrv) ResizeImage(ctx context.Context, in port.ResizeImageIn
 	}
 	return nil
 }
+
+// loadOverlay reads the image drawn over the variants of the bucket.
+func (s *imageResizerSrv) loadOverlay(ctx context.Context, settings model.ImageOverlay) (*port.Overlay, error) {
+	media, err := s.repo.GetByID(ctx, settings.MediaID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("overlay media #%s: %w", settings.MediaID, ErrObjectNotFound)
+		}
+		return nil, err
+	}
+	if media.Status != model.MediaStatusCompleted || media.MimeType == nil || !IsImage(*media.MimeType) {
+		return nil, fmt.Errorf("overlay media #%s should be a completed image", settings.MediaID)
+	}
+
+	file, err := s.strg.GetFile(ctx, media.Bucket, media.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get overlay media #%s: %w", settings.MediaID, err)
+	}
+	defer func(file io.ReadSeekCloser) { _ = file.Close() }(file)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overlay media #%s: %w", settings.MediaID, err)
+	}
+	return &port.Overlay{Image: data, ImageOverlay: settings}, nil
+}
+
+// variantKey returns the object key of the variant of the given width, with the given extension.
+func variantKey(media *model.Media, width int, ext string) string {
+	base := strings.TrimSuffix(media.ObjectKey, path.Ext(media.ObjectKey))
+	return path.Join(
+		"variants",
+		media.ID.String(),
+		fmt.Sprintf("%s_%d%s", base, width, ext),
+	)
+}
+
+// variantDimensions returns the dimensions of the variant of the given width.
+// Images are never stretched, so sizes wider than the original get its dimensions. SVGs are
+// drawn at any size.
+func variantDimensions(media *model.Media, width int) (int, int) {
+	if width >= media.Metadata.Width && !IsSVG(*media.MimeType) {
+		return media.Metadata.Width, media.Metadata.Height
+	}
+	return width, int(float64(media.Metadata.Height) * float64(width) / float64(media.Metadata.Width))
+}
+
+func (s *imageResizerSrv) generateVariant(ctx context.Context, media *model.Media, originalReader io.ReadSeeker, width int, opts port.ResizeOptions) (model.Variant, error) {
+	variantWidth, variantHeight := variantDimensions(media, width)
+	sameAsOriginal := variantWidth == media.Metadata.Width && *media.MimeType == "image/webp" && opts.Overlay == nil
+
+	var key string
+	if sameAsOriginal && !hashedVariantKeys(s.buckets.Get(media.Bucket), opts) {
+		key = variantKey(media, width, ".webp")
+		if err := s.strg.CopyFile(ctx, media.Bucket, media.ObjectKey, key); err != nil {
+			return model.Variant{}, fmt.Errorf("failed to copy original file to variant %q: %w", key, err)
+		}
+	} else {
+		if _, err := originalReader.Seek(0, io.SeekStart); err != nil {
+			return model.Variant{}, fmt.Errorf("failed to reset reader: %w", err)
+		}
+
+		// content-addressed variants are saved again to be hashed and marked immutable
+		resized := io.NopCloser(originalReader)
+		if !sameAsOriginal {
+			var err error
+			if resized, err = s.opt.Resize(*media.MimeType, originalReader, variantWidth, variantHeight, opts); err != nil {
+				return model.Variant{}, err
+			}
+		}
+
+		var err error
+		if key, err = s.saveVariant(ctx, media, width, resized, "image/webp", opts); err != nil {
+			return model.Variant{}, err
+		}
+	}
+
+	return s.statVariant(ctx, media, key, "image/webp", width, variantWidth, variantHeight, opts)
+}
+
+func (s *imageResizerSrv) generateFallbackVariant(ctx context.Context, media *model.Media, originalReader io.ReadSeeker, width int, opts port.ResizeOptions) (model.Variant, error) {
+	variantWidth, variantHeight := variantDimensions(media, width)
+
+	if _, err := originalReader.Seek(0, io.SeekStart); err != nil {
+		return model.Variant{}, fmt.Errorf("failed to reset reader: %w", err)
+	}
+
+	resized, mimeType, err := s.opt.ResizeFallback(*media.MimeType, originalReader, variantWidth, variantHeight, opts)
+	if err != nil {
+		return model.Variant{}, err
+	}
+	key, err := s.saveVariant(ctx, media, width, resized, mimeType, opts)
+	if err != nil {
+		return model.Variant{}, err
+	}
+
+	return s.statVariant(ctx, media, key, mimeType, width, variantWidth, variantHeight, opts)
+}
+
+// hashedVariantKeys tells whether a variant is stored under the hash of its content: in buckets
+// with content-addressed keys, and for the clean variants of buckets with an overlay, so their
+// keys cannot be guessed from the ones of the variants carrying the overlay.
+func hashedVariantKeys(settings model.BucketSettings, opts port.ResizeOptions) bool {
+	return settings.ContentAddressedKeys || (settings.Overlay != nil && opts.Overlay == nil)
+}
+
+// saveVariant saves the variant of the given width and returns its key. In buckets with
+// content-addressed keys, the variant is stored under the hash of its content and marked immutable.
+func (s *imageResizerSrv) saveVariant(ctx context.Context, media *model.Media, width int, r io.ReadCloser, mimeType string, opts port.ResizeOptions) (string, error) {
+	defer func(r io.ReadCloser) { _ = r.Close() }(r)
+
+	ext, err := MimeTypeToExtension(mimeType)
+	if err != nil {
+		return "", err
+	}
+
+	settings := s.buckets.Get(media.Bucket)
+	objOpts := objectOptions(settings, media, mimeType)
+	if !hashedVariantKeys(settings, opts) {
+		if opts.Overlay != nil {
+			ext = overlayKeySuffix + ext
+		}
+		key := variantKey(media, width, ext)
+		if err := s.strg.SaveFile(ctx, media.Bucket, key, r, -1, objOpts); err != nil {
+			return "", fmt.Errorf("failed to save variant %q: %w", key, err)
+		}
+		return key, nil
+	}
+
+	// variants are small enough to be hashed in memory before being saved
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read variant of width %d: %w", width, err)
+	}
+	sum := sha256.Sum256(data)
+	key := contentKey(path.Join("variants", media.ID.String()), sum[:], ext)
+	objOpts["Cache-Control"] = ImmutableCacheControl
+	if err := s.strg.SaveFile(ctx, media.Bucket, key, bytes.NewReader(data), int64(len(data)), objOpts); err != nil {
+		return "", fmt.Errorf("failed to save variant %q: %w", key, err)
+	}
+	return key, nil
+}
+
+func (s *imageResizerSrv) statVariant(ctx context.Context, media *model.Media, key, mimeType string, targetWidth, width, height int, opts port.ResizeOptions) (model.Variant, error) {
+	info, err := s.strg.StatFile(ctx, media.Bucket, key)
+	if err != nil {
+		return model.Variant{}, fmt.Errorf("failed reading info about variant %q: %w", key, err)
+	}
+
+	return model.Variant{
+		ObjectKey:   key,
+		SizeBytes:   info.SizeBytes,
+		Width:       width,
+		Height:      height,
+		TargetWidth: targetWidth,
+		MimeType:    mimeType,
+		Watermarked: opts.Overlay != nil,
+	}, nil
+}
+
+// uniqueSizes drops the invalid and repeated sizes, keeping the configured order.
+func uniqueSizes(sizes []int) []int {
+	seen := make(map[int]struct{}, len(sizes))
+	out := make([]int, 0, len(sizes))
+	for _, width := range sizes {
+		if width <= 0 {
+			continue
+		}
+		if _, ok := seen[width]; ok {
+			continue
+		}
+		seen[width] = struct{}{}
+		out = append(out, width)
+	}
+	return out
+}
+
+// overlayKeySuffix ends the name of the variants carrying the overlay of their bucket, before
+// their extension.
+const overlayKeySuffix = "_overlay"
+
+var variantKeyWidthRe = regexp.MustCompile(`_(\d+)\.webp$`)
+
+// variantTargetWidth returns the configured size a variant was generated for.
+// Variants stored before it was recorded get it back from their object key.
+func variantTargetWidth(v model.Variant) int {
+	if v.TargetWidth > 0 {
+		return v.TargetWidth
+	}
+	m := variantKeyWidthRe.FindStringSubmatch(v.ObjectKey)
+	if m == nil {
+		return 0
+	}
+	width, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// variantSlot identifies a variant a media should have: one per size and format, clean or with
+// the overlay of the bucket.
+type variantSlot struct {
+	width    int
+	fallback bool
+	overlay  bool
+}
+
+// variantSlots lists the variants expected for the given sizes, in order.
+func variantSlots(sizes []int, withFallback, withOverlay bool) []variantSlot {
+	slots := make([]variantSlot, 0, 4*len(sizes))
+	for _, width := range sizes {
+		for _, overlay := range []bool{false, true} {
+			if overlay && !withOverlay {
+				continue
+			}
+			slots = append(slots, variantSlot{width: width, overlay: overlay})
+			if withFallback {
+				slots = append(slots, variantSlot{width: width, fallback: true, overlay: overlay})
+			}
+		}
+	}
+	return slots
+}
+
+// svgVariantSlots lists the raster variants expected for an SVG: WebP ones, or PNG ones in the
+// place of the fallback ones. SVGs without a size of their own cannot be drawn and get none.
+func svgVariantSlots(media *model.Media, sizes []int, format string) []variantSlot {
+	if format == "" || media.Metadata.Width == 0 {
+		return nil
+	}
+	slots := make([]variantSlot, 0, len(sizes))
+	for _, width := range sizes {
+		slots = append(slots, variantSlot{width: width, fallback: format != "image/webp"})
+	}
+	return slots
+}
+
+// matchVariants sorts the stored variants into the ones matching an expected slot, the
+// obsolete ones whose size or format is no longer configured or that duplicate another entry,
+// and the pages of a TIFF, which are left as they are.
+func matchVariants(variants model.Variants, slots []variantSlot) (map[variantSlot]model.Variant, []model.Variant, []model.Variant) {
+	wanted := make(map[variantSlot]struct{}, len(slots))
+	for _, slot := range slots {
+		wanted[slot] = struct{}{}
+	}
+
+	existing := make(map[variantSlot]model.Variant, len(slots))
+	var obsolete, pages []model.Variant
+	for _, v := range variants {
+		if v.Page != 0 {
+			pages = append(pages, v)
+			continue
+		}
+		slot := variantSlot{width: variantTargetWidth(v), fallback: v.Format() != "image/webp", overlay: v.Watermarked}
+		if _, ok := wanted[slot]; !ok {
+			obsolete = append(obsolete, v)
+			continue
+		}
+		if prev, ok := existing[slot]; ok {
+			// an older run appended the same size again; the object key is the same, keep a single entry
+			if prev.ObjectKey != v.ObjectKey {
+				obsolete = append(obsolete, v)
+			}
+			continue
+		}
+		v.TargetWidth = slot.width
+		v.MimeType = v.Format()
+		existing[slot] = v
+	}
+	return existing, obsolete, pages
+}
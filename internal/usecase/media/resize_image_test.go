@@ -3,10 +3,12 @@ package media
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -25,7 +27,7 @@ func (errSeekReader) Close() error                   { return nil }
 
 func TestResizeImage_GetByIDNotFound(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
-	svc := NewImageResizer(repo, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id})
@@ -36,7 +38,7 @@ func TestResizeImage_GetByIDNotFound(t *testing.T) {
 
 func TestResizeImage_GetByIDError(t *testing.T) {
 	repo := &mock.MediaRepo{GetByIDErr: errors.New("db fail")}
-	svc := NewImageResizer(repo, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id})
@@ -49,7 +51,7 @@ func TestResizeImage_WrongStatus(t *testing.T) {
 	mt := "image/png"
 	m := &model.Media{Status: model.MediaStatusPending, MimeType: &mt}
 	repo := &mock.MediaRepo{MediaOut: m}
-	svc := NewImageResizer(repo, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id})
@@ -59,11 +61,27 @@ func TestResizeImage_WrongStatus(t *testing.T) {
 	}
 }
 
+func TestResizeImage_SkipsTrashed(t *testing.T) {
+	mt := "image/png"
+	m := &model.Media{Status: model.MediaStatusDeleted, MimeType: &mt}
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stg.GetCalled || repo.UpdateCalled {
+		t.Error("expected trashed media to be skipped")
+	}
+}
+
 func TestResizeImage_NotImage(t *testing.T) {
 	mt := "application/pdf"
 	m := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt}
 	repo := &mock.MediaRepo{MediaOut: m}
-	svc := NewImageResizer(repo, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id})
@@ -77,10 +95,10 @@ func TestResizeImage_GetFileError(t *testing.T) {
 	m := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt}
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{GetErr: errors.New("get fail")}
-	svc := NewImageResizer(repo, &mock.FileOptimiser{}, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
-	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id})
+	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}})
 	if err == nil || err.Error() != "get fail" {
 		t.Fatalf("expected get fail, got %v", err)
 	}
@@ -91,7 +109,7 @@ func TestResizeImage_SeekError(t *testing.T) {
 	m := &model.Media{Status: model.MediaStatusCompleted, MimeType: &mt, Metadata: model.Metadata{Width: 100, Height: 50}}
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{GetOut: errSeekReader{bytes.NewReader([]byte("a"))}}
-	svc := NewImageResizer(repo, &mock.FileOptimiser{}, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}})
@@ -106,7 +124,7 @@ func TestResizeImage_ResizeError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("a"))}
 	fo := &mock.FileOptimiser{ResizeErr: errors.New("resize fail")}
-	svc := NewImageResizer(repo, fo, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}})
@@ -121,7 +139,7 @@ func TestResizeImage_SaveFileError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{SaveErr: errors.New("save fail"), GetOut: bytes.NewReader([]byte("a"))}
 	fo := &mock.FileOptimiser{ResizeOut: []byte("r")}
-	svc := NewImageResizer(repo, fo, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}})
@@ -136,7 +154,7 @@ func TestResizeImage_StatError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{StatErr: errors.New("stat fail"), GetOut: bytes.NewReader([]byte("a"))}
 	fo := &mock.FileOptimiser{ResizeOut: []byte("r")}
-	svc := NewImageResizer(repo, fo, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}})
@@ -151,7 +169,7 @@ func TestResizeImage_UpdateError(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
 	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("a")), StatInfoOut: port.FileInfo{SizeBytes: 1}}
 	fo := &mock.FileOptimiser{ResizeOut: []byte("r")}
-	svc := NewImageResizer(repo, fo, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: id, Sizes: []int{10}})
@@ -179,7 +197,7 @@ func TestResizeImage_Success(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 123}}
 	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
-	svc := NewImageResizer(repo, fo, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20, 0, -1, 40}})
 	if err != nil {
@@ -202,16 +220,40 @@ func TestResizeImage_Success(t *testing.T) {
 	}
 }
 
+func TestResizeImage_RerendersReferencingDocuments(t *testing.T) {
+	mt := "image/png"
+	m := &model.Media{
+		ID:        msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")),
+		Status:    model.MediaStatusCompleted,
+		MimeType:  &mt,
+		Bucket:    "images",
+		ObjectKey: "foo.png",
+		Metadata:  model.Metadata{Width: 100, Height: 50},
+	}
+	docID := msuuid.UUID(uuid.MustParse("bbbbbbbb-cccc-dddd-eeee-ffffffffffff"))
+	repo := &mock.MediaRepo{MediaOut: m, ReferencingOut: []msuuid.UUID{docID}}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 123}}
+	dispatcher := &mock.Dispatcher{}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{ResizeOut: []byte("resized")}, stg, dispatcher, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(dispatcher.OptimiseIDs, []msuuid.UUID{docID}) {
+		t.Errorf("optimised = %v; want the referencing document re-rendered", dispatcher.OptimiseIDs)
+	}
+}
+
 func TestResizeImage_CopyWhenWidthTooLarge(t *testing.T) {
 	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
-	mt := "image/png"
+	mt := "image/webp"
 	size := int64(0)
 	m := &model.Media{
 		ID:        msuuid.UUID(uuid.MustParse(idStr)),
 		Status:    model.MediaStatusCompleted,
 		MimeType:  &mt,
 		Bucket:    "images",
-		ObjectKey: "foo.png",
+		ObjectKey: "foo.webp",
 		Metadata: model.Metadata{
 			Width:  100,
 			Height: 50,
@@ -221,7 +263,7 @@ func TestResizeImage_CopyWhenWidthTooLarge(t *testing.T) {
 	repo := &mock.MediaRepo{MediaOut: m}
 	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 456}}
 	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
-	svc := NewImageResizer(repo, fo, stg, &mock.Cache{})
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
 
 	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{200}})
 	if err != nil {
@@ -245,3 +287,406 @@ func TestResizeImage_CopyWhenWidthTooLarge(t *testing.T) {
 		t.Errorf("variant unexpected: %+v", v)
 	}
 }
+
+func newResizableMedia(variants model.Variants) *model.Media {
+	mt := "image/webp"
+	size := int64(0)
+	return &model.Media{
+		ID:        msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")),
+		Status:    model.MediaStatusCompleted,
+		MimeType:  &mt,
+		Bucket:    "images",
+		ObjectKey: "foo.webp",
+		Metadata:  model.Metadata{Width: 100, Height: 50},
+		SizeBytes: &size,
+		Variants:  variants,
+	}
+}
+
+func TestResizeImage_RerunDoesNotDuplicate(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	m := newResizableMedia(model.Variants{
+		{ObjectKey: fmt.Sprintf("variants/%s/foo_20.webp", idStr), Width: 20, Height: 10},
+		{ObjectKey: fmt.Sprintf("variants/%s/foo_20.webp", idStr), Width: 20, Height: 10},
+	})
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 123}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20, 20}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(repo.GotUpdated.Variants) != 1 {
+		t.Fatalf("expected 1 variant, got %+v", repo.GotUpdated.Variants)
+	}
+	if v := repo.GotUpdated.Variants[0]; v.TargetWidth != 20 || v.SizeBytes != 123 {
+		t.Errorf("variant unexpected: %+v", v)
+	}
+	if !fo.ResizeCalled {
+		t.Error("expected the variant to be generated again outside of reconcile mode")
+	}
+	if stg.RemoveCalled {
+		t.Error("the duplicate shares its object with the kept entry and must not be removed")
+	}
+}
+
+func TestResizeImage_ReconcileGeneratesMissingOnly(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	legacy := model.Variant{ObjectKey: fmt.Sprintf("variants/%s/foo_20.webp", idStr), Width: 20, Height: 10, SizeBytes: 50}
+	dropped := model.Variant{ObjectKey: fmt.Sprintf("variants/%s/foo_60.webp", idStr), Width: 60, Height: 30, TargetWidth: 60}
+	m := newResizableMedia(model.Variants{legacy, dropped})
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 123}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{40, 20}, Reconcile: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := repo.GotUpdated.Variants
+	if len(got) != 2 {
+		t.Fatalf("expected 2 variants, got %+v", got)
+	}
+	if got[0].TargetWidth != 40 || got[0].ObjectKey != fmt.Sprintf("variants/%s/foo_40.webp", idStr) || got[0].SizeBytes != 123 {
+		t.Errorf("generated variant unexpected: %+v", got[0])
+	}
+	if got[1].TargetWidth != 20 || got[1].SizeBytes != 50 {
+		t.Errorf("existing variant should be kept as is: %+v", got[1])
+	}
+	if !reflect.DeepEqual(stg.RemovedKeys, []string{dropped.ObjectKey}) {
+		t.Errorf("removed keys = %v; want %v", stg.RemovedKeys, []string{dropped.ObjectKey})
+	}
+}
+
+func TestResizeImage_ReconcileUpToDate(t *testing.T) {
+	m := newResizableMedia(model.Variants{{ObjectKey: "variants/x/foo_20.webp", Width: 20, Height: 10, TargetWidth: 20}})
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20}, Reconcile: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stg.GetCalled || repo.UpdateCalled {
+		t.Error("expected nothing to be done for an up to date image")
+	}
+}
+
+func TestResizeImage_KeepsPageVariants(t *testing.T) {
+	page := model.Variant{ObjectKey: "variants/x/foo_page2.webp", Width: 30, Height: 40, MimeType: "image/webp", Page: 2}
+	m := newResizableMedia(model.Variants{page})
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 123}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := repo.GotUpdated.Variants
+	if len(got) != 2 || got[0].TargetWidth != 20 || !reflect.DeepEqual(got[1], page) {
+		t.Errorf("variants = %+v; want the resized one, then the page as is", got)
+	}
+	if len(stg.RemovedKeys) != 0 {
+		t.Errorf("removed keys = %v; want the page kept", stg.RemovedKeys)
+	}
+}
+
+func TestResizeImage_ObsoleteKeptOnUpdateError(t *testing.T) {
+	m := newResizableMedia(model.Variants{{ObjectKey: "variants/x/foo_60.webp", TargetWidth: 60}})
+	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
+	stg := &mock.Storage{}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Reconcile: true})
+	if err == nil || !strings.Contains(err.Error(), "update fail") {
+		t.Fatalf("expected update fail, got %v", err)
+	}
+	if stg.RemoveCalled {
+		t.Error("variants still referenced by the media must not be removed")
+	}
+}
+
+func TestResizeImage_ReencodeNonWebPWhenWidthTooLarge(t *testing.T) {
+	m := newResizableMedia(nil)
+	mt := "image/jpeg"
+	m.MimeType = &mt
+	m.ObjectKey = "foo.jpg"
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 456}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{200}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stg.CopyCalled || !fo.ResizeCalled {
+		t.Error("a non WebP original must be re-encoded rather than copied as a WebP variant")
+	}
+	if v := repo.GotUpdated.Variants[0]; v.Width != 100 || v.Height != 50 || v.MimeType != "image/webp" {
+		t.Errorf("variant unexpected: %+v", v)
+	}
+}
+
+func TestResizeImage_FallbackVariants(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	m := newResizableMedia(nil)
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 77}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized"), FallbackOut: []byte("fallback"), FallbackMimeOut: "image/png"}
+	buckets := model.BucketsSettings{"images": {FallbackVariants: true}}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, buckets)
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20, 40}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		key      string
+		mimeType string
+	}{
+		{fmt.Sprintf("variants/%s/foo_20.webp", idStr), "image/webp"},
+		{fmt.Sprintf("variants/%s/foo_20.png", idStr), "image/png"},
+		{fmt.Sprintf("variants/%s/foo_40.webp", idStr), "image/webp"},
+		{fmt.Sprintf("variants/%s/foo_40.png", idStr), "image/png"},
+	}
+	got := repo.GotUpdated.Variants
+	if len(got) != len(want) {
+		t.Fatalf("expected %d variants, got %+v", len(want), got)
+	}
+	for i, w := range want {
+		if got[i].ObjectKey != w.key || got[i].MimeType != w.mimeType {
+			t.Errorf("variant %d = %s (%s); want %s (%s)", i, got[i].ObjectKey, got[i].MimeType, w.key, w.mimeType)
+		}
+	}
+}
+
+func TestResizeImage_ReconcileFallbackVariants(t *testing.T) {
+	webp := model.Variant{ObjectKey: "variants/x/foo_20.webp", TargetWidth: 20, MimeType: "image/webp"}
+	jpeg := model.Variant{ObjectKey: "variants/x/foo_20.jpg", TargetWidth: 20, MimeType: "image/jpeg"}
+
+	t.Run("missing fallback is generated", func(t *testing.T) {
+		repo := &mock.MediaRepo{MediaOut: newResizableMedia(model.Variants{webp})}
+		stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc"))}
+		fo := &mock.FileOptimiser{}
+		svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{"images": {FallbackVariants: true}})
+
+		if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{Sizes: []int{20}, Reconcile: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fo.ResizeCalled || !fo.FallbackCalled {
+			t.Error("only the fallback variant should be generated")
+		}
+		if len(repo.GotUpdated.Variants) != 2 {
+			t.Errorf("expected 2 variants, got %+v", repo.GotUpdated.Variants)
+		}
+	})
+
+	t.Run("disabled fallback is removed", func(t *testing.T) {
+		repo := &mock.MediaRepo{MediaOut: newResizableMedia(model.Variants{webp, jpeg})}
+		stg := &mock.Storage{}
+		svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, &mock.FileOptimiser{}, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+		if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{Sizes: []int{20}, Reconcile: true}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(repo.GotUpdated.Variants, model.Variants{webp}) {
+			t.Errorf("variants = %+v; want only the WebP one", repo.GotUpdated.Variants)
+		}
+		if !reflect.DeepEqual(stg.RemovedKeys, []string{jpeg.ObjectKey}) {
+			t.Errorf("removed keys = %v; want %v", stg.RemovedKeys, []string{jpeg.ObjectKey})
+		}
+	})
+}
+
+func TestResizeImage_FallbackError(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: newResizableMedia(nil)}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc"))}
+	fo := &mock.FileOptimiser{FallbackErr: errors.New("fallback fail")}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{"images": {FallbackVariants: true}})
+
+	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{Sizes: []int{20}})
+	if err == nil || !strings.Contains(err.Error(), "fallback fail") {
+		t.Fatalf("expected fallback fail, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("media should not be updated")
+	}
+}
+
+func TestResizeImage_ContentAddressedKeys(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	dir := fmt.Sprintf("variants/%s", idStr)
+	resizedSum := sha256.Sum256([]byte("resized"))
+	originalSum := sha256.Sum256([]byte("abc"))
+	resizedKey := contentKey(dir, resizedSum[:], ".webp")
+	originalKey := contentKey(dir, originalSum[:], ".webp")
+
+	// the dropped variant had the same content as the new one, so they share their object
+	m := newResizableMedia(model.Variants{{ObjectKey: resizedKey, Width: 60, Height: 30, TargetWidth: 60}})
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 123}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	buckets := model.BucketsSettings{m.Bucket: {ContentAddressedKeys: true}}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, buckets)
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20, 200}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := repo.GotUpdated.Variants
+	if len(got) != 2 || got[0].ObjectKey != resizedKey || got[1].ObjectKey != originalKey {
+		t.Fatalf("variants unexpected: %+v", got)
+	}
+	if stg.CopyCalled {
+		t.Error("a variant matching the original should be saved again under its own hash")
+	}
+	if stg.SaveOpts["Cache-Control"] != ImmutableCacheControl {
+		t.Errorf("Cache-Control = %q; want %q", stg.SaveOpts["Cache-Control"], ImmutableCacheControl)
+	}
+	if stg.RemoveCalled {
+		t.Errorf("a file still referenced by a variant must not be removed, removed %v", stg.RemovedKeys)
+	}
+}
+
+func TestResizeImage_Overlay(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	m := newResizableMedia(nil)
+	overlayID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	png := "image/png"
+	overlay := &model.Media{ID: overlayID, Status: model.MediaStatusCompleted, MimeType: &png, Bucket: "images", ObjectKey: "logo.png"}
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{m.ID: m, overlayID: overlay}}
+	stg := &mock.Storage{
+		GetOut:      bytes.NewReader([]byte("abc")),
+		FilesByKey:  map[string][]byte{"logo.png": []byte("logo")},
+		StatInfoOut: port.FileInfo{SizeBytes: 123},
+	}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	settings := model.ImageOverlay{MediaID: overlayID, Gravity: model.GravitySouthEast, Opacity: 0.5, Scale: 0.2}
+	buckets := model.BucketsSettings{m.Bucket: {Overlay: &settings}}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, buckets)
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := repo.GotUpdated.Variants
+	if len(got) != 2 {
+		t.Fatalf("expected a clean and an overlaid variant, got %+v", got)
+	}
+	sum := sha256.Sum256([]byte("resized"))
+	if want := contentKey("variants/"+idStr, sum[:], ".webp"); got[0].ObjectKey != want || got[0].Watermarked {
+		t.Errorf("clean variant = %+v; want key %q", got[0], want)
+	}
+	if want := fmt.Sprintf("variants/%s/foo_20_overlay.webp", idStr); got[1].ObjectKey != want || !got[1].Watermarked {
+		t.Errorf("overlaid variant = %+v; want key %q", got[1], want)
+	}
+	if len(fo.GotResizeOpts) != 2 || fo.GotResizeOpts[0].Overlay != nil || fo.GotResizeOpts[1].Overlay == nil {
+		t.Fatalf("resize options unexpected: %+v", fo.GotResizeOpts)
+	}
+	if o := fo.GotResizeOpts[1].Overlay; string(o.Image) != "logo" || o.ImageOverlay != settings {
+		t.Errorf("overlay = %+v; want the overlay media with the bucket settings", o)
+	}
+}
+
+func TestResizeImage_OverlayNotFound(t *testing.T) {
+	m := newResizableMedia(nil)
+	repo := &mock.MediaRepo{MediasByID: map[msuuid.UUID]*model.Media{m.ID: m}}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc"))}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized")}
+	overlayID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	buckets := model.BucketsSettings{m.Bucket: {Overlay: &model.ImageOverlay{MediaID: overlayID, Opacity: 0.5, Scale: 0.2}}}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, buckets)
+
+	err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20}})
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("media should not be updated without its overlay")
+	}
+}
+
+func TestResizeImage_SVGVariants(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	tests := map[string]struct {
+		format string
+		want   []string
+	}{
+		"none": {"", nil},
+		"webp": {"image/webp", []string{"foo_20.webp", "foo_400.webp"}},
+		"png":  {"image/png", []string{"foo_20.png", "foo_400.png"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := newResizableMedia(nil)
+			mt := "image/svg+xml"
+			m.MimeType, m.ObjectKey = &mt, "foo.svg"
+			repo := &mock.MediaRepo{MediaOut: m}
+			stg := &mock.Storage{GetOut: bytes.NewReader([]byte("<svg/>")), StatInfoOut: port.FileInfo{SizeBytes: 77}}
+			fo := &mock.FileOptimiser{ResizeOut: []byte("resized"), FallbackOut: []byte("fallback"), FallbackMimeOut: "image/png"}
+			buckets := model.BucketsSettings{"images": {SVGRasterVariants: tc.format, FallbackVariants: true}}
+			svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, buckets)
+
+			if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20, 400}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.want == nil {
+				if repo.UpdateCalled || stg.GetCalled {
+					t.Error("no variant should be generated")
+				}
+				return
+			}
+
+			got := repo.GotUpdated.Variants
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %d variants, got %+v", len(tc.want), got)
+			}
+			for i, key := range tc.want {
+				if got[i].ObjectKey != fmt.Sprintf("variants/%s/%s", idStr, key) || got[i].MimeType != tc.format {
+					t.Errorf("variant %d = %s (%s); want %s (%s)", i, got[i].ObjectKey, got[i].MimeType, key, tc.format)
+				}
+			}
+			if v := got[1]; v.Width != 400 || v.Height != 200 {
+				t.Errorf("variant is %dx%d; want the SVG drawn at 400x200", v.Width, v.Height)
+			}
+			if len(fo.GotResizeOpts) != 2 || fo.GotResizeOpts[0].Overlay != nil {
+				t.Errorf("resize options = %+v; want 2 variants without overlay", fo.GotResizeOpts)
+			}
+		})
+	}
+}
+
+func TestResizeImage_AnimatedAlwaysGetsPoster(t *testing.T) {
+	idStr := "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"
+	m := newResizableMedia(nil)
+	m.Metadata.FrameCount = 3
+	repo := &mock.MediaRepo{MediaOut: m}
+	stg := &mock.Storage{GetOut: bytes.NewReader([]byte("abc")), StatInfoOut: port.FileInfo{SizeBytes: 77}}
+	fo := &mock.FileOptimiser{ResizeOut: []byte("resized"), FallbackOut: []byte("poster")}
+	svc := NewImageResizer(repo, &mock.MediaVersionRepo{}, fo, stg, &mock.Dispatcher{}, &mock.Cache{}, model.BucketsSettings{})
+
+	if err := svc.ResizeImage(context.Background(), port.ResizeImageInput{ID: m.ID, Sizes: []int{20}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		fmt.Sprintf("variants/%s/foo_20.webp", idStr),
+		fmt.Sprintf("variants/%s/foo_20.jpg", idStr),
+	}
+	got := repo.GotUpdated.Variants
+	if len(got) != len(want) {
+		t.Fatalf("expected the animation and its poster, got %+v", got)
+	}
+	for i, key := range want {
+		if got[i].ObjectKey != key {
+			t.Errorf("variant %d = %s; want %s", i, got[i].ObjectKey, key)
+		}
+	}
+	if !fo.FallbackCalled {
+		t.Error("the poster should be generated without FALLBACK_VARIANTS")
+	}
+}
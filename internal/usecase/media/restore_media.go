@@ -0,0 +1,69 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type mediaRestorerSrv struct {
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	cache    port.Cache
+	strg     port.Storage
+}
+
+// compile-time check: *mediaRestorerSrv must satisfy port.MediaRestorer
+var _ port.MediaRestorer = (*mediaRestorerSrv)(nil)
+
+// NewMediaRestorer constructs a MediaRestorer implementation.
+func NewMediaRestorer(repo port.MediaRepository, versions port.MediaVersionRepository, cache port.Cache, strg port.Storage) port.MediaRestorer {
+	return &mediaRestorerSrv{repo: repo, versions: versions, cache: cache, strg: strg}
+}
+
+// RestoreMedia takes a media out of the trash, as long as it has not been purged yet, and serves
+// its files again.
+func (s *mediaRestorerSrv) RestoreMedia(ctx context.Context, id msuuid.UUID) error {
+	media, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrObjectNotFound
+		}
+		return err
+	}
+	if media.Status != model.MediaStatusDeleted {
+		return ErrMediaNotDeleted
+	}
+
+	keys, err := mediaFileKeys(ctx, s.versions, media)
+	if err != nil {
+		return err
+	}
+	if err := setWithdrawn(ctx, s.strg, media.Bucket, keys, false); err != nil {
+		revertWithdrawn(ctx, s.strg, media, keys, true)
+		return err
+	}
+
+	media.Status = model.MediaStatusCompleted
+	media.DeletedAt = nil
+
+	if err := s.repo.Update(ctx, media); err != nil {
+		revertWithdrawn(ctx, s.strg, media, keys, true)
+		return err
+	}
+
+	if err := s.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
+	}
+	if err := s.cache.DeleteEtagMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", media.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/google/uuid"
+)
+
+func TestRestoreMedia_NotFound(t *testing.T) {
+	repo := &mock.MediaRepo{GetByIDErr: sql.ErrNoRows}
+	svc := NewMediaRestorer(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	if err := svc.RestoreMedia(context.Background(), id); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestRestoreMedia_NotInTrash(t *testing.T) {
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Status: model.MediaStatusCompleted}
+	repo := &mock.MediaRepo{MediaOut: m}
+	svc := NewMediaRestorer(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	if err := svc.RestoreMedia(context.Background(), m.ID); !errors.Is(err, ErrMediaNotDeleted) {
+		t.Fatalf("expected ErrMediaNotDeleted, got %v", err)
+	}
+	if repo.UpdateCalled {
+		t.Error("expected no update")
+	}
+}
+
+func TestRestoreMedia_UpdateError(t *testing.T) {
+	deletedAt := time.Now()
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Status: model.MediaStatusDeleted, DeletedAt: &deletedAt}
+	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
+	svc := NewMediaRestorer(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, &mock.Storage{})
+
+	if err := svc.RestoreMedia(context.Background(), m.ID); err == nil || err.Error() != "update fail" {
+		t.Fatalf("expected update fail, got %v", err)
+	}
+}
+
+func TestRestoreMedia_Success(t *testing.T) {
+	deletedAt := time.Now()
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Status: model.MediaStatusDeleted, DeletedAt: &deletedAt}
+	repo := &mock.MediaRepo{MediaOut: m}
+	cache := &mock.Cache{}
+	svc := NewMediaRestorer(repo, &mock.MediaVersionRepo{}, cache, &mock.Storage{})
+
+	if err := svc.RestoreMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.GotUpdated.Status != model.MediaStatusCompleted {
+		t.Errorf("status = %q; want %q", repo.GotUpdated.Status, model.MediaStatusCompleted)
+	}
+	if repo.GotUpdated.DeletedAt != nil {
+		t.Errorf("DeletedAt = %v; want nil", repo.GotUpdated.DeletedAt)
+	}
+	if !cache.DelMediaCalled || !cache.DelEtagMediaCalled {
+		t.Error("expected cache to be cleared")
+	}
+}
+
+func TestRestoreMedia_ServesFilesAgain(t *testing.T) {
+	deletedAt := time.Now()
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusDeleted, DeletedAt: &deletedAt, Variants: model.Variants{{ObjectKey: "v1"}}}
+	repo := &mock.MediaRepo{MediaOut: m}
+	strg := &mock.Storage{TagsOut: map[string]string{"team": "blog", port.WithdrawnTag: "true"}}
+	svc := NewMediaRestorer(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, strg)
+
+	if err := svc.RestoreMedia(context.Background(), m.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"team": "blog"}
+	for _, key := range []string{"k", "v1"} {
+		if !reflect.DeepEqual(strg.TaggedFiles[key], want) {
+			t.Errorf("tags of %q = %v; want %v", key, strg.TaggedFiles[key], want)
+		}
+	}
+}
+
+func TestRestoreMedia_UpdateErrorWithdrawsFilesAgain(t *testing.T) {
+	deletedAt := time.Now()
+	m := &model.Media{ID: msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee")), Bucket: "images", ObjectKey: "k", Status: model.MediaStatusDeleted, DeletedAt: &deletedAt}
+	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
+	strg := &mock.Storage{}
+	svc := NewMediaRestorer(repo, &mock.MediaVersionRepo{}, &mock.Cache{}, strg)
+
+	if err := svc.RestoreMedia(context.Background(), m.ID); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := strg.TaggedFiles["k"][port.WithdrawnTag]; got != "true" {
+		t.Errorf("file of the media still in the trash should stay withdrawn, got tags %v", strg.TaggedFiles["k"])
+	}
+}
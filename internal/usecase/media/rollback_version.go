@@ -0,0 +1,92 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+type versionRollbackerSrv struct {
+	repo     port.MediaRepository
+	versions port.MediaVersionRepository
+	strg     port.Storage
+	tasks    port.TaskDispatcher
+	cache    port.Cache
+}
+
+// compile-time check: *versionRollbackerSrv must satisfy port.VersionRollbacker
+var _ port.VersionRollbacker = (*versionRollbackerSrv)(nil)
+
+// NewVersionRollbacker constructs a VersionRollbacker implementation.
+func NewVersionRollbacker(repo port.MediaRepository, versions port.MediaVersionRepository, strg port.Storage, tasks port.TaskDispatcher, cache port.Cache) port.VersionRollbacker {
+	return &versionRollbackerSrv{repo, versions, strg, tasks, cache}
+}
+
+// RollbackVersion swaps the current file of a media with one of its previous versions.
+// The files of every version are kept as they are, so nothing has to be copied around.
+func (s *versionRollbackerSrv) RollbackVersion(ctx context.Context, in port.RollbackVersionInput) error {
+	media, err := getCompletedMedia(ctx, s.repo, in.ID)
+	if err != nil {
+		return err
+	}
+	if media.Version == in.Version {
+		return nil
+	}
+
+	target, err := s.versions.Get(ctx, media.ID, in.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVersionNotFound
+		}
+		return err
+	}
+
+	current := snapshotVersion(media)
+	if err := s.versions.Create(ctx, current); err != nil {
+		return fmt.Errorf("failed archiving version %d of media #%s: %w", current.Version, media.ID, err)
+	}
+
+	media.ObjectKey = target.ObjectKey
+	media.MimeType = target.MimeType
+	media.SizeBytes = target.SizeBytes
+	media.OriginalObjectKey = target.OriginalObjectKey
+	media.OriginalSizeBytes = target.OriginalSizeBytes
+	media.Optimised = target.Optimised
+	media.Metadata = target.Metadata
+	media.Variants = target.Variants
+	media.Version = target.Version
+
+	if err := s.repo.Update(ctx, media); err != nil {
+		if delErr := s.versions.Delete(ctx, current.MediaID, current.Version); delErr != nil {
+			logger.Warnf(ctx, "failed to remove archived version %d of media #%s after update failure: %v", current.Version, media.ID, delErr)
+		}
+		return fmt.Errorf("failed updating media: %w", err)
+	}
+
+	recordReferences(ctx, s.repo, media)
+	reindexText(ctx, s.repo, s.strg, media)
+
+	if err := s.versions.Delete(ctx, target.MediaID, target.Version); err != nil {
+		return fmt.Errorf("failed removing version %d of media #%s from the history: %w", target.Version, media.ID, err)
+	}
+
+	if !media.Optimised {
+		if err := s.tasks.EnqueueOptimiseMedia(ctx, media.ID); err != nil {
+			logger.Warnf(ctx, "failed to enqueue optimise task for media #%s: %v", media.ID, err)
+		}
+	}
+
+	if err := s.cache.DeleteMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting cache for media #%s: %v", media.ID, err)
+	}
+	if err := s.cache.DeleteEtagMediaDetails(ctx, media.ID); err != nil {
+		logger.Warnf(ctx, "failed deleting etag cache for media #%s: %v", media.ID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+func TestRollbackVersion_NotCompleted(t *testing.T) {
+	repo := &mock.MediaRepo{MediaOut: &model.Media{Status: model.MediaStatusFailed}}
+	svc := NewVersionRollbacker(repo, &mock.MediaVersionRepo{}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{})
+
+	if err := svc.RollbackVersion(context.Background(), port.RollbackVersionInput{Version: 1}); !errors.Is(err, ErrNotCompleted) {
+		t.Fatalf("expected ErrNotCompleted, got %v", err)
+	}
+}
+
+func TestRollbackVersion_AlreadyCurrent(t *testing.T) {
+	m := newVersionedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{}
+	svc := NewVersionRollbacker(repo, versions, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{})
+
+	if err := svc.RollbackVersion(context.Background(), port.RollbackVersionInput{ID: m.ID, Version: m.Version}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if versions.GetCalled || repo.UpdateCalled {
+		t.Error("expected nothing to change")
+	}
+}
+
+func TestRollbackVersion_VersionNotFound(t *testing.T) {
+	m := newVersionedMedia()
+	repo := &mock.MediaRepo{MediaOut: m}
+	svc := NewVersionRollbacker(repo, &mock.MediaVersionRepo{GetErr: sql.ErrNoRows}, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{})
+
+	if err := svc.RollbackVersion(context.Background(), port.RollbackVersionInput{ID: m.ID, Version: 7}); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestRollbackVersion_UpdateError(t *testing.T) {
+	m := newVersionedMedia()
+	m.Version = 2
+	repo := &mock.MediaRepo{MediaOut: m, UpdateErr: errors.New("update fail")}
+	versions := &mock.MediaVersionRepo{VersionOut: &model.MediaVersion{MediaID: m.ID, Version: 1, ObjectKey: "old.webp"}}
+	svc := NewVersionRollbacker(repo, versions, &mock.Storage{}, &mock.Dispatcher{}, &mock.Cache{})
+
+	err := svc.RollbackVersion(context.Background(), port.RollbackVersionInput{ID: m.ID, Version: 1})
+	if err == nil || !strings.Contains(err.Error(), "update fail") {
+		t.Fatalf("expected update error, got %v", err)
+	}
+	// only the freshly archived current version is removed, the target stays in the history
+	if len(versions.GotDeletedVersion) != 1 || versions.GotDeletedVersion[0] != 2 {
+		t.Errorf("deleted versions = %v; want [2]", versions.GotDeletedVersion)
+	}
+}
+
+func TestRollbackVersion_Success(t *testing.T) {
+	m := newVersionedMedia()
+	m.Version = 2
+	currentKey := m.ObjectKey
+	mt := "image/png"
+	size := int64(999)
+	target := &model.MediaVersion{
+		MediaID:   m.ID,
+		Version:   1,
+		ObjectKey: "old.png",
+		MimeType:  &mt,
+		SizeBytes: &size,
+		Optimised: false,
+		Metadata:  model.Metadata{Width: 5, Height: 5},
+		Variants:  model.Variants{},
+	}
+	repo := &mock.MediaRepo{MediaOut: m}
+	versions := &mock.MediaVersionRepo{VersionOut: target}
+	dispatcher := &mock.Dispatcher{}
+	cache := &mock.Cache{}
+	svc := NewVersionRollbacker(repo, versions, &mock.Storage{}, dispatcher, cache)
+
+	if err := svc.RollbackVersion(context.Background(), port.RollbackVersionInput{ID: m.ID, Version: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(versions.GotCreated) != 1 || versions.GotCreated[0].Version != 2 || versions.GotCreated[0].ObjectKey != currentKey {
+		t.Errorf("archived versions = %+v; want the previous current version 2", versions.GotCreated)
+	}
+	if len(versions.GotDeletedVersion) != 1 || versions.GotDeletedVersion[0] != 1 {
+		t.Errorf("deleted versions = %v; want [1]", versions.GotDeletedVersion)
+	}
+	got := repo.GotUpdated
+	if got.Version != 1 || got.ObjectKey != "old.png" || *got.MimeType != mt || *got.SizeBytes != size {
+		t.Errorf("updated media = %+v; want version 1 content", got)
+	}
+	if !dispatcher.OptimiseCalled {
+		t.Error("expected optimise task for an unoptimised version")
+	}
+	if !repo.SaveTextCalled || repo.GotText != "" {
+		t.Errorf("indexed text = %q; want none for an image", repo.GotText)
+	}
+	if !cache.DelMediaCalled || !cache.DelEtagMediaCalled {
+		t.Error("expected cache to be cleared")
+	}
+}
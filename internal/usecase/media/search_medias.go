@@ -0,0 +1,171 @@
+package media
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	// snippetRadius is the number of bytes of text kept on each side of the first match in a snippet.
+	// As many characters are fetched from the database, which is never less.
+	snippetRadius = 80
+	// minSearchTermLength mirrors the shortest word MariaDB indexes in a FULLTEXT index.
+	minSearchTermLength = 3
+)
+
+type mediaSearcherSrv struct {
+	repo port.MediaRepository
+}
+
+// compile-time check: *mediaSearcherSrv must satisfy port.MediaSearcher
+var _ port.MediaSearcher = (*mediaSearcherSrv)(nil)
+
+// NewMediaSearcher constructs a MediaSearcher implementation.
+func NewMediaSearcher(repo port.MediaRepository) port.MediaSearcher {
+	return &mediaSearcherSrv{repo}
+}
+
+// SearchMedias returns the completed medias whose text matches the query, best matches first, each
+// with a snippet of its text around the words found.
+func (s *mediaSearcherSrv) SearchMedias(ctx context.Context, in port.SearchMediasInput) (port.SearchMediasOutput, error) {
+	limit := in.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	terms := searchTerms(in.Query)
+	matches, err := s.repo.SearchTexts(ctx, model.TextSearch{
+		Query:         in.Query,
+		Bucket:        in.Bucket,
+		OwnerID:       in.OwnerID,
+		Limit:         limit,
+		Terms:         terms,
+		ExcerptRadius: snippetRadius,
+	})
+	if err != nil {
+		return port.SearchMediasOutput{}, err
+	}
+
+	out := port.SearchMediasOutput{Results: make([]port.SearchResultOutput, 0, len(matches))}
+	for _, m := range matches {
+		res := port.SearchResultOutput{
+			ID:      m.MediaID,
+			Bucket:  m.Bucket,
+			Name:    m.OriginalFilename,
+			Snippet: snippet(m.Excerpt, terms, m.TextBefore, m.TextAfter),
+		}
+		if m.MimeType != nil {
+			res.MimeType = *m.MimeType
+		}
+		out.Results = append(out.Results, res)
+	}
+	return out, nil
+}
+
+// searchTerms returns the words of a query long enough to be indexed.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, w := range words(query) {
+		if utf8.RuneCountInString(query[w[0]:w[1]]) >= minSearchTermLength {
+			terms = append(terms, query[w[0]:w[1]])
+		}
+	}
+	return terms
+}
+
+// words returns the start and end offsets of the runs of letters and digits of a text.
+func words(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsNumber(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+func isTerm(word string, terms []string) bool {
+	for _, t := range terms {
+		if strings.EqualFold(word, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet cuts an excerpt of text around the first of the terms it contains, or from its start
+// when it contains none, then escapes it for HTML with the terms wrapped in <mark> tags. The text
+// can itself be an excerpt, cut from a longer one before and after it as told.
+func snippet(text string, terms []string, cutBefore, cutAfter bool) string {
+	matchStart, matchEnd := 0, 0
+	for _, w := range words(text) {
+		if isTerm(text[w[0]:w[1]], terms) {
+			matchStart, matchEnd = w[0], w[1]
+			break
+		}
+	}
+
+	from := max(0, matchStart-snippetRadius)
+	to := min(len(text), matchEnd+snippetRadius)
+	if matchEnd == 0 {
+		to = min(len(text), 2*snippetRadius)
+	}
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+	// do not cut the words at the edges, the text having its whitespace collapsed
+	if from > 0 || cutBefore {
+		if i := strings.IndexByte(text[from:], ' '); i >= 0 && from+i < matchStart {
+			from += i + 1
+		}
+	}
+	if to < len(text) || cutAfter {
+		if i := strings.LastIndexByte(text[from:to], ' '); i >= 0 && from+i >= matchEnd {
+			to = from + i
+		}
+	}
+
+	excerpt := text[from:to]
+	var b strings.Builder
+	if from > 0 || cutBefore {
+		b.WriteString("…")
+	}
+	last := 0
+	for _, w := range words(excerpt) {
+		if !isTerm(excerpt[w[0]:w[1]], terms) {
+			continue
+		}
+		b.WriteString(html.EscapeString(excerpt[last:w[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(excerpt[w[0]:w[1]]))
+		b.WriteString("</mark>")
+		last = w[1]
+	}
+	b.WriteString(html.EscapeString(excerpt[last:]))
+	if to < len(text) || cutAfter {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/mock"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+func TestSearchMedias_Filters(t *testing.T) {
+	ownerID := msuuid.NewUUID()
+	tests := []struct {
+		name      string
+		limit     int
+		wantLimit int
+	}{
+		{"default limit", 0, DefaultSearchLimit},
+		{"given limit", 5, 5},
+		{"capped limit", 500, MaxSearchLimit},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &mock.MediaRepo{}
+			svc := NewMediaSearcher(repo)
+
+			in := port.SearchMediasInput{Query: "report", Bucket: "docs", OwnerID: &ownerID, Limit: tc.limit}
+			if _, err := svc.SearchMedias(context.Background(), in); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := model.TextSearch{Query: "report", Bucket: "docs", OwnerID: &ownerID, Limit: tc.wantLimit, Terms: []string{"report"}, ExcerptRadius: snippetRadius}
+			if !reflect.DeepEqual(repo.GotSearch, want) {
+				t.Errorf("search = %+v; want %+v", repo.GotSearch, want)
+			}
+		})
+	}
+}
+
+func TestSearchMedias_RepoError(t *testing.T) {
+	svc := NewMediaSearcher(&mock.MediaRepo{SearchTextsErr: errors.New("db fail")})
+
+	if _, err := svc.SearchMedias(context.Background(), port.SearchMediasInput{Query: "report"}); err == nil || err.Error() != "db fail" {
+		t.Fatalf("expected db fail, got %v", err)
+	}
+}
+
+func TestSearchMedias_Success(t *testing.T) {
+	mt := "application/pdf"
+	id := msuuid.NewUUID()
+	repo := &mock.MediaRepo{SearchOut: []model.TextMatch{{
+		MediaID:          id,
+		Bucket:           "docs",
+		OriginalFilename: "q3.pdf",
+		MimeType:         &mt,
+		Excerpt:          "Quarterly REPORT for <Q3>",
+		Score:            1.5,
+	}}}
+	svc := NewMediaSearcher(repo)
+
+	out, err := svc.SearchMedias(context.Background(), port.SearchMediasInput{Query: "report"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := port.SearchResultOutput{
+		ID:       id,
+		Bucket:   "docs",
+		Name:     "q3.pdf",
+		MimeType: mt,
+		Snippet:  "Quarterly <mark>REPORT</mark> for &lt;Q3&gt;",
+	}
+	if len(out.Results) != 1 || out.Results[0] != want {
+		t.Errorf("results = %+v; want [%+v]", out.Results, want)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("lorem ", 30) + "the needle is here " + strings.Repeat("ipsum ", 30)
+
+	got := snippet(long, searchTerms("needle"), false, false)
+	if !strings.HasPrefix(got, "…lorem") || !strings.HasSuffix(got, "ipsum…") {
+		t.Errorf("snippet = %q; want whole words cut on both sides", got)
+	}
+	if !strings.Contains(got, "the <mark>needle</mark> is here") {
+		t.Errorf("snippet = %q; want the match highlighted", got)
+	}
+	if len(got) > 2*snippetRadius+len("needle")+len("<mark></mark>")+2*len("…") {
+		t.Errorf("snippet is %d bytes long; want it around the match only", len(got))
+	}
+
+	if got := snippet("catalog of cats, one cat", searchTerms("cat"), false, false); got != "catalog of cats, one <mark>cat</mark>" {
+		t.Errorf("snippet = %q; want whole words only highlighted", got)
+	}
+	if got := snippet(long, searchTerms("missing"), false, false); !strings.HasPrefix(got, "lorem lorem") || !strings.HasSuffix(got, "…") {
+		t.Errorf("snippet = %q; want the start of the text", got)
+	}
+
+	// an excerpt fetched from a longer text, cut in the middle of its first and last words
+	if got := snippet("rem the needle is he", searchTerms("needle"), true, true); got != "…the <mark>needle</mark> is…" {
+		t.Errorf("snippet = %q; want the cut words dropped", got)
+	}
+}
+
+func TestSearchTerms(t *testing.T) {
+	got := searchTerms(`"annual" report of 2024, by me`)
+	want := []string{"annual", "report", "2024"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("terms = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// getCompletedMedia fetches a media that can be given a new version or rolled back.
+func getCompletedMedia(ctx context.Context, repo port.MediaRepository, id msuuid.UUID) (*model.Media, error) {
+	media, err := repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	if media.Status != model.MediaStatusCompleted {
+		return nil, ErrNotCompleted
+	}
+	return media, nil
+}
+
+// nextVersion returns the number the next uploaded version of the media will get.
+// It is higher than every known version, so a rollback never leads to reusing a number.
+func nextVersion(ctx context.Context, versions port.MediaVersionRepository, media *model.Media) (int, error) {
+	list, err := versions.ListByMediaID(ctx, media.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	latest := media.Version
+	for _, v := range list {
+		if v.Version > latest {
+			latest = v.Version
+		}
+	}
+	return latest + 1, nil
+}
+
+// versionStagingKey is the key under which a new version is uploaded to the staging bucket.
+func versionStagingKey(id msuuid.UUID, version int) string {
+	return fmt.Sprintf("%s_v%d", id, version)
+}
+
+// snapshotVersion captures the current file of a media so it can be kept in the history.
+func snapshotVersion(media *model.Media) *model.MediaVersion {
+	return &model.MediaVersion{
+		MediaID:           media.ID,
+		Version:           media.Version,
+		ObjectKey:         media.ObjectKey,
+		MimeType:          media.MimeType,
+		SizeBytes:         media.SizeBytes,
+		OriginalObjectKey: media.OriginalObjectKey,
+		OriginalSizeBytes: media.OriginalSizeBytes,
+		Optimised:         media.Optimised,
+		Metadata:          media.Metadata,
+		Variants:          media.Variants,
+	}
+}
@@ -0,0 +1,33 @@
+package media
+
+import (
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+)
+
+// visibleVariants returns the variants of the media the user is given. In buckets with an
+// overlay, the owner of an image gets its clean variants and everyone else the ones carrying the
+// overlay. Elsewhere, the variants carrying an overlay the bucket no longer has are left out.
+func visibleVariants(media *model.Media, settings model.BucketSettings, userID *msuuid.UUID) model.Variants {
+	overlaid := overlaid(media, settings, userID)
+
+	variants := make(model.Variants, 0, len(media.Variants))
+	for _, v := range media.Variants {
+		if v.Watermarked == overlaid {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+// overlaid tells whether the user is only given the files of the media carrying the overlay of
+// its bucket, and never its clean main file or original: images of buckets with an overlay, for
+// everyone but their owner.
+func overlaid(media *model.Media, settings model.BucketSettings, userID *msuuid.UUID) bool {
+	return settings.Overlay != nil && media.MimeType != nil && IsImage(*media.MimeType) && !isOwner(media, userID)
+}
+
+// isOwner tells whether the user owns the media.
+func isOwner(media *model.Media, userID *msuuid.UUID) bool {
+	return userID != nil && media.OwnerID != nil && *userID == *media.OwnerID
+}
@@ -0,0 +1,87 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+
+	"github.com/fhuszti/medias-ms-go/internal/logger"
+)
+
+// mediaFileKeys lists every file of the media: its main file, original and variants, and those of
+// its previous versions.
+func mediaFileKeys(ctx context.Context, versions port.MediaVersionRepository, media *model.Media) ([]string, error) {
+	list, err := versions.ListByMediaID(ctx, media.ID)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{media.ObjectKey}
+	if media.OriginalObjectKey != nil {
+		keys = append(keys, *media.OriginalObjectKey)
+	}
+	for _, v := range media.Variants {
+		keys = append(keys, v.ObjectKey)
+	}
+	for _, version := range list {
+		keys = append(keys, version.ObjectKey)
+		if version.OriginalObjectKey != nil {
+			keys = append(keys, *version.OriginalObjectKey)
+		}
+		for _, v := range version.Variants {
+			keys = append(keys, v.ObjectKey)
+		}
+	}
+	return keys, nil
+}
+
+// setWithdrawn tags the files as withdrawn, or takes the tag off, keeping their other tags.
+// Public buckets refuse anonymous reads of withdrawn files, so the files of trashed medias are
+// no longer served at their stable URL. Private buckets are tagged all the same, in case they
+// are made public later. Files already gone, e.g. shared by several versions, are skipped.
+func setWithdrawn(ctx context.Context, strg port.Storage, bucket string, keys []string, withdrawn bool) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		tags, err := strg.GetFileTags(ctx, bucket, key)
+		if errors.Is(err, ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the tags of file %q: %w", key, err)
+		}
+		_, tagged := tags[port.WithdrawnTag]
+		if tagged == withdrawn {
+			continue
+		}
+
+		tags = maps.Clone(tags)
+		if tags == nil {
+			tags = make(map[string]string, 1)
+		}
+		if withdrawn {
+			tags[port.WithdrawnTag] = "true"
+		} else {
+			delete(tags, port.WithdrawnTag)
+		}
+		if err := strg.SetFileTags(ctx, bucket, key, tags); err != nil {
+			return fmt.Errorf("failed to tag file %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// revertWithdrawn puts the files back in the state they were in before a failed change, as far as
+// it can.
+func revertWithdrawn(ctx context.Context, strg port.Storage, media *model.Media, keys []string, withdrawn bool) {
+	if err := setWithdrawn(ctx, strg, media.Bucket, keys, withdrawn); err != nil {
+		logger.Warnf(ctx, "failed reverting the tags of the files of media #%s: %v", media.ID, err)
+	}
+}
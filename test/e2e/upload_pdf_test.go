@@ -78,12 +78,12 @@ func setupServer(t *testing.T) *httptest.Server {
 	// Initialize repo and services
 	repo := mariadb.NewMediaRepository(dbConn)
 	uploadLinkSvc := mediaSvc.NewUploadLinkGenerator(repo, GlobalStrg, msuuid.NewUUID)
-	finaliserSvc := mediaSvc.NewUploadFinaliser(repo, GlobalStrg, task.NewDispatcher(RedisAddr, ""))
+	finaliserSvc := mediaSvc.NewUploadFinaliser(repo, GlobalStrg, task.NewDispatcher(RedisAddr, ""), nil)
 	workerStop := testutil.StartWorker(&db.Database{dbConn}, GlobalStrg, RedisAddr)
 	t.Cleanup(workerStop)
 	ca := cache.NewNoop()
-	getterSvc := mediaSvc.NewMediaGetter(repo, GlobalStrg)
-	deleterSvc := mediaSvc.NewMediaDeleter(repo, ca, GlobalStrg)
+	getterSvc := mediaSvc.NewMediaGetter(repo, GlobalStrg, nil)
+	deleterSvc := mediaSvc.NewMediaDeleter(repo, mariadb.NewMediaVersionRepository(dbConn), ca, GlobalStrg)
 	rendererSvc := renderer.NewHTTPRenderer(ca)
 
 	// Setup HTTP handlers
@@ -317,8 +317,8 @@ func TestUploadMarkdownE2E(t *testing.T) {
 	if getOut.Metadata.MimeType != "text/markdown" {
 		t.Errorf("Metadata.MimeType = %q; want text/markdown", getOut.Metadata.MimeType)
 	}
-	if getOut.Metadata.WordCount != 23 {
-		t.Errorf("Metadata.WordCount = %d; want 23", getOut.Metadata.WordCount)
+	if getOut.Metadata.WordCount != 20 {
+		t.Errorf("Metadata.WordCount = %d; want 20", getOut.Metadata.WordCount)
 	}
 	if getOut.Metadata.HeadingCount != 3 {
 		t.Errorf("Metadata.HeadingCount = %d; want 3", getOut.Metadata.HeadingCount)
@@ -326,8 +326,11 @@ func TestUploadMarkdownE2E(t *testing.T) {
 	if getOut.Metadata.LinkCount != 2 {
 		t.Errorf("Metadata.LinkCount = %d; want 2", getOut.Metadata.LinkCount)
 	}
-	if len(getOut.Variants) != 0 {
-		t.Errorf("Variants = %v; want empty slice", getOut.Variants)
+	if len(getOut.Metadata.TableOfContents) != 3 || getOut.Metadata.TableOfContents[0].ID != "hello-functional-test" {
+		t.Errorf("Metadata.TableOfContents = %+v; want the 3 headings", getOut.Metadata.TableOfContents)
+	}
+	if len(getOut.Variants) != 1 || getOut.Variants[0].Name != "html" || getOut.Variants[0].MimeType != "text/html" {
+		t.Errorf("Variants = %+v; want the HTML rendering only", getOut.Variants)
 	}
 
 	// ---- Step 5: Delete the media ----
@@ -43,7 +43,7 @@ func setupMediaDeleter(t *testing.T) (*mariadb.MediaRepository, port.MediaDelete
 	}
 
 	repo := mariadb.NewMediaRepository(testDB.DB)
-	svc := mediaSvc.NewMediaDeleter(repo, cache.NewNoop(), GlobalStrg)
+	svc := mediaSvc.NewMediaDeleter(repo, mariadb.NewMediaVersionRepository(testDB.DB), cache.NewNoop(), GlobalStrg)
 
 	cleanup := func() {
 		_ = bCleanup()
@@ -53,7 +53,63 @@ func setupMediaDeleter(t *testing.T) (*mariadb.MediaRepository, port.MediaDelete
 	return repo, svc, cleanup
 }
 
-func TestDeleteMediaIntegration_Success(t *testing.T) {
+func TestDeleteMediaIntegration_MovesToTrash(t *testing.T) {
+	ctx := context.Background()
+
+	repo, svc, cleanup := setupMediaDeleter(t)
+	defer cleanup()
+
+	id := uuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	objectKey := id.String() + ".png"
+	bucket := "images"
+
+	content := testutil.GeneratePNG(t, 32, 16)
+	size := int64(len(content))
+	if err := GlobalStrg.SaveFile(ctx, bucket, objectKey, bytes.NewReader(content), size, map[string]string{"Content-Type": "image/png"}); err != nil {
+		t.Fatalf("upload original: %v", err)
+	}
+
+	mime := "image/png"
+	m := &model.Media{
+		ID:               id,
+		ObjectKey:        objectKey,
+		Bucket:           bucket,
+		OriginalFilename: "orig.png",
+		MimeType:         &mime,
+		SizeBytes:        &size,
+		Status:           model.MediaStatusCompleted,
+		Metadata:         model.Metadata{Width: 32, Height: 16},
+		Variants:         model.Variants{},
+	}
+	if err := repo.Create(ctx, m); err != nil {
+		t.Fatalf("insert media: %v", err)
+	}
+
+	if err := svc.DeleteMedia(ctx, id); err != nil {
+		t.Fatalf("DeleteMedia returned error: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID after delete: %v", err)
+	}
+	if got.Status != model.MediaStatusDeleted {
+		t.Errorf("status = %q; want %q", got.Status, model.MediaStatusDeleted)
+	}
+	if got.DeletedAt == nil {
+		t.Error("expected deleted_at to be set")
+	}
+
+	exists, err := GlobalStrg.FileExists(ctx, bucket, objectKey)
+	if err != nil {
+		t.Fatalf("check original exists: %v", err)
+	}
+	if !exists {
+		t.Error("original file should be kept while in the trash")
+	}
+}
+
+func TestPurgeMediaIntegration_Success(t *testing.T) {
 	ctx := context.Background()
 
 	repo, svc, cleanup := setupMediaDeleter(t)
@@ -100,8 +156,8 @@ func TestDeleteMediaIntegration_Success(t *testing.T) {
 		t.Fatalf("insert media: %v", err)
 	}
 
-	if err := svc.DeleteMedia(ctx, id); err != nil {
-		t.Fatalf("DeleteMedia returned error: %v", err)
+	if err := svc.PurgeMedia(ctx, id); err != nil {
+		t.Fatalf("PurgeMedia returned error: %v", err)
 	}
 
 	if _, err := repo.GetByID(ctx, id); !errors.Is(err, sql.ErrNoRows) {
@@ -159,7 +215,7 @@ func TestDeleteMediaIntegration_ErrorNotFound(t *testing.T) {
 
 func TestDeleteMediaIntegration_ErrorInvalidID(t *testing.T) {
 	repo := mariadb.NewMediaRepository(nil)
-	svc := mediaSvc.NewMediaDeleter(repo, nil, nil)
+	svc := mediaSvc.NewMediaDeleter(repo, nil, nil, nil)
 
 	r := chi.NewRouter()
 	r.With(middleware.WithMediaID()).Delete("/medias/{id}", api.DeleteMediaHandler(svc))
@@ -187,3 +243,43 @@ func TestDeleteMediaIntegration_ErrorInvalidID(t *testing.T) {
 		t.Errorf("Cache-Control = %q; want no-store...", cc)
 	}
 }
+
+func TestDeleteMediaIntegration_Referenced(t *testing.T) {
+	ctx := context.Background()
+
+	repo, svc, cleanup := setupMediaDeleter(t)
+	defer cleanup()
+
+	imageID := uuid.UUID(guuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	docID := uuid.UUID(guuid.MustParse("bbbbbbbb-cccc-dddd-eeee-ffffffffffff"))
+	for _, m := range []*model.Media{
+		{ID: imageID, ObjectKey: imageID.String() + ".png", Bucket: "images", Status: model.MediaStatusCompleted},
+		{ID: docID, ObjectKey: docID.String() + ".md", Bucket: "docs", Status: model.MediaStatusCompleted},
+	} {
+		if err := repo.Create(ctx, m); err != nil {
+			t.Fatalf("insert media: %v", err)
+		}
+	}
+	if err := repo.ReplaceReferences(ctx, docID, []uuid.UUID{imageID, imageID}); err != nil {
+		t.Fatalf("ReplaceReferences: %v", err)
+	}
+
+	if err := svc.DeleteMedia(ctx, imageID); !errors.Is(err, mediaSvc.ErrMediaReferenced) {
+		t.Fatalf("expected ErrMediaReferenced, got %v", err)
+	}
+
+	// once the document no longer links to it, the image can go
+	if err := repo.ReplaceReferences(ctx, docID, nil); err != nil {
+		t.Fatalf("ReplaceReferences: %v", err)
+	}
+	if err := svc.DeleteMedia(ctx, imageID); err != nil {
+		t.Fatalf("DeleteMedia: %v", err)
+	}
+	fromDB, err := repo.GetByID(ctx, imageID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if fromDB.Status != model.MediaStatusDeleted {
+		t.Errorf("Status = %q; want %q", fromDB.Status, model.MediaStatusDeleted)
+	}
+}
@@ -42,7 +42,7 @@ func setupUploadFinaliser(t *testing.T) (*mariadb.MediaRepository, port.UploadFi
 	}
 
 	repo := mariadb.NewMediaRepository(dbConn)
-	svc := mediaSvc.NewUploadFinaliser(repo, GlobalStrg, task.NewNoopDispatcher())
+	svc := mediaSvc.NewUploadFinaliser(repo, GlobalStrg, task.NewNoopDispatcher(), nil)
 
 	cleanup := func() {
 		_ = bCleanup()
@@ -300,6 +300,9 @@ func TestFinaliseUploadIntegration_SuccessPDF(t *testing.T) {
 	if fromDB.Metadata.PageCount != 4 {
 		t.Errorf("PageCount = %d; want %d", fromDB.Metadata.PageCount, 4)
 	}
+	if fromDB.Metadata.PDFVersion != "1.4" || len(fromDB.Metadata.PageSizes) != 4 || fromDB.Metadata.CreatedAt == nil {
+		t.Errorf("PDF metadata = %+v; want its version, page sizes and creation date", fromDB.Metadata)
+	}
 
 	// Assert file moved to destination
 	exists, err := GlobalStrg.FileExists(ctx, "docs", destObjectKey)
@@ -43,7 +43,7 @@ func setupMediaGetter(t *testing.T) (*mariadb.MediaRepository, port.MediaGetter,
 	}
 
 	repo := mariadb.NewMediaRepository(dbConn)
-	svc := mediaSvc.NewMediaGetter(repo, GlobalStrg)
+	svc := mediaSvc.NewMediaGetter(repo, GlobalStrg, nil)
 
 	cleanup := func() {
 		_ = bCleanup()
@@ -84,7 +84,7 @@ func TestGetMediaIntegration_SuccessMarkdown(t *testing.T) {
 		t.Fatalf("upload to %q bucket: %v", bucket, err)
 	}
 
-	out, err := svc.GetMedia(ctx, id)
+	out, err := svc.GetMedia(ctx, port.GetMediaInput{ID: id})
 	if err != nil {
 		t.Fatalf("GetMedia returned error: %v", err)
 	}
@@ -152,7 +152,7 @@ func TestGetMediaIntegration_SuccessPDF(t *testing.T) {
 		t.Fatalf("upload to %q bucket: %v", bucket, err)
 	}
 
-	out, err := svc.GetMedia(ctx, id)
+	out, err := svc.GetMedia(ctx, port.GetMediaInput{ID: id})
 	if err != nil {
 		t.Fatalf("GetMedia returned error: %v", err)
 	}
@@ -236,7 +236,7 @@ func TestGetMediaIntegration_SuccessImageWithVariants(t *testing.T) {
 		t.Fatalf("insert media: %v", err)
 	}
 
-	out, err := svc.GetMedia(ctx, id)
+	out, err := svc.GetMedia(ctx, port.GetMediaInput{ID: id})
 	if err != nil {
 		t.Fatalf("GetMedia returned error: %v", err)
 	}
@@ -324,10 +324,57 @@ func TestGetMediaIntegration_ErrorNotFound(t *testing.T) {
 	}
 }
 
+func TestGetMediaIntegration_ErrorExpired(t *testing.T) {
+	ctx := context.Background()
+
+	mediaRepo, svc, cleanup := setupMediaGetter(t)
+	defer cleanup()
+
+	id := uuid.NewUUID()
+	expiresAt := time.Now().Add(-time.Minute)
+	m := &model.Media{
+		ID:        id,
+		ObjectKey: id.String() + ".md",
+		Bucket:    "docs",
+		Status:    model.MediaStatusCompleted,
+		Metadata:  model.Metadata{},
+		Variants:  model.Variants{},
+		SizeBytes: ptrInt64(42),
+		MimeType:  ptrString("text/markdown"),
+		ExpiresAt: &expiresAt,
+	}
+	if err := mediaRepo.Create(ctx, m); err != nil {
+		t.Fatalf("insert media: %v", err)
+	}
+
+	r := chi.NewRouter()
+	rendererSvc := renderer.NewHTTPRenderer(cache.NewNoop())
+	r.With(middleware.WithMediaID()).Get("/medias/{id}", api.GetMediaHandler(rendererSvc, svc))
+
+	req := httptest.NewRequest(http.MethodGet, "/medias/"+id.String(), nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusGone {
+		t.Errorf("status = %d; want %d", res.StatusCode, http.StatusGone)
+	}
+
+	var resp errorResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if !strings.Contains(resp.Error, "Media has expired") {
+		t.Errorf("error = %q; want contain %q", resp.Error, "Media has expired")
+	}
+}
+
 func TestGetMediaIntegration_ErrorInvalidID(t *testing.T) {
 	// no DB or bucket setup needed, middleware will reject
 	repo := mariadb.NewMediaRepository(nil)
-	svc := mediaSvc.NewMediaGetter(repo, nil)
+	svc := mediaSvc.NewMediaGetter(repo, nil, nil)
 
 	r := chi.NewRouter()
 	rendererSvc := renderer.NewHTTPRenderer(cache.NewNoop())
@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/cache"
+	"github.com/fhuszti/medias-ms-go/internal/migration"
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	"github.com/fhuszti/medias-ms-go/internal/repository/mariadb"
+	"github.com/fhuszti/medias-ms-go/internal/task"
+	mediaSvc "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/fhuszti/medias-ms-go/test/testutil"
+	"github.com/google/uuid"
+)
+
+func TestMediaVersionsIntegration_FinaliseAndRollback(t *testing.T) {
+	ctx := context.Background()
+
+	testDB, err := testutil.SetupTestDB()
+	if err != nil {
+		t.Fatalf("setup DB: %v", err)
+	}
+	defer func() { _ = testDB.Cleanup() }()
+	if err := migration.MigrateUp(testDB.DB); err != nil {
+		t.Fatalf("could not run migrations: %v", err)
+	}
+	bCleanup, err := testutil.SetupTestBuckets(GlobalStrg)
+	if err != nil {
+		t.Fatalf("setup buckets: %v", err)
+	}
+	defer func() { _ = bCleanup() }()
+
+	repo := mariadb.NewMediaRepository(testDB.DB)
+	versionRepo := mariadb.NewMediaVersionRepository(testDB.DB)
+	ca := cache.NewNoop()
+	finaliser := mediaSvc.NewVersionFinaliser(repo, versionRepo, GlobalStrg, task.NewNoopDispatcher(), ca, nil)
+	lister := mediaSvc.NewVersionLister(repo, versionRepo)
+	rollbacker := mediaSvc.NewVersionRollbacker(repo, versionRepo, GlobalStrg, task.NewNoopDispatcher(), ca)
+
+	// version 1, already in its bucket
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	v1Key := id.String() + ".md"
+	v1 := testutil.GenerateMarkdown()
+	m := &model.Media{
+		ID:        id,
+		ObjectKey: v1Key,
+		Bucket:    "docs",
+		Status:    model.MediaStatusCompleted,
+		Metadata:  model.Metadata{},
+		Variants:  model.Variants{},
+		Version:   1,
+		SizeBytes: ptrInt64(int64(len(v1))),
+		MimeType:  ptrString("text/markdown"),
+	}
+	if err := repo.Create(ctx, m); err != nil {
+		t.Fatalf("insert media: %v", err)
+	}
+	if err := GlobalStrg.SaveFile(ctx, "docs", v1Key, bytes.NewReader(v1), int64(len(v1)), map[string]string{"Content-Type": "text/markdown"}); err != nil {
+		t.Fatalf("upload version 1: %v", err)
+	}
+
+	// version 2, uploaded to staging
+	v2 := append(testutil.GenerateMarkdown(), []byte("\n## Second version\n")...)
+	if err := GlobalStrg.SaveFile(ctx, "staging", id.String()+"_v2", bytes.NewReader(v2), int64(len(v2)), map[string]string{"Content-Type": "text/markdown"}); err != nil {
+		t.Fatalf("upload version 2: %v", err)
+	}
+
+	if err := finaliser.FinaliseVersion(ctx, id); err != nil {
+		t.Fatalf("FinaliseVersion returned error: %v", err)
+	}
+
+	fromDB, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if fromDB.Version != 2 || fromDB.ObjectKey != id.String()+"_v2.md" {
+		t.Errorf("media = version %d / %q; want version 2 / %q", fromDB.Version, fromDB.ObjectKey, id.String()+"_v2.md")
+	}
+
+	out, err := lister.ListVersions(ctx, id)
+	if err != nil {
+		t.Fatalf("ListVersions returned error: %v", err)
+	}
+	if out.CurrentVersion != 2 || len(out.Versions) != 1 || out.Versions[0].Version != 1 {
+		t.Errorf("versions = %+v; want current 2 with history [1]", out)
+	}
+
+	if err := rollbacker.RollbackVersion(ctx, port.RollbackVersionInput{ID: id, Version: 1}); err != nil {
+		t.Fatalf("RollbackVersion returned error: %v", err)
+	}
+
+	fromDB, err = repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if fromDB.Version != 1 || fromDB.ObjectKey != v1Key {
+		t.Errorf("media = version %d / %q; want version 1 / %q", fromDB.Version, fromDB.ObjectKey, v1Key)
+	}
+	history, err := versionRepo.ListByMediaID(ctx, id)
+	if err != nil {
+		t.Fatalf("ListByMediaID: %v", err)
+	}
+	if len(history) != 1 || history[0].Version != 2 {
+		t.Errorf("history = %+v; want [2]", history)
+	}
+
+	for _, key := range []string{v1Key, id.String() + "_v2.md"} {
+		exists, err := GlobalStrg.FileExists(ctx, "docs", key)
+		if err != nil {
+			t.Fatalf("FileExists %q: %v", key, err)
+		}
+		if !exists {
+			t.Errorf("expected %q to be kept in the bucket", key)
+		}
+	}
+}
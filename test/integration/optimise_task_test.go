@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -285,8 +286,12 @@ func TestOptimiseTaskIntegration_SuccessMarkdown(t *testing.T) {
 	if out.MimeType == nil || *out.MimeType != mime {
 		t.Errorf("MimeType = %v; want %s", out.MimeType, mime)
 	}
-	if len(out.Variants) != 0 {
-		t.Fatalf("variants count = %d; want 0", len(out.Variants))
+	var names []string
+	for _, v := range out.Variants {
+		names = append(names, v.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"br", "gzip", "html"}) {
+		t.Fatalf("variants = %v; want the compressed copies and the HTML rendering", names)
 	}
 }
 
@@ -0,0 +1,71 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fhuszti/medias-ms-go/internal/model"
+	"github.com/fhuszti/medias-ms-go/internal/port"
+	mediaSvc "github.com/fhuszti/medias-ms-go/internal/usecase/media"
+	msuuid "github.com/fhuszti/medias-ms-go/internal/uuid"
+	"github.com/fhuszti/medias-ms-go/test/testutil"
+	"github.com/google/uuid"
+)
+
+func TestSearchMediasIntegration(t *testing.T) {
+	ctx := context.Background()
+
+	mediaRepo, finaliser, cleanup := setupUploadFinaliser(t)
+	defer cleanup()
+
+	id := msuuid.UUID(uuid.MustParse("aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee"))
+	ownerID := msuuid.UUID(uuid.MustParse("11111111-2222-3333-4444-555555555555"))
+	content := testutil.GenerateMarkdown()
+	if err := mediaRepo.Create(ctx, &model.Media{
+		ID:        id,
+		ObjectKey: id.String(),
+		Status:    model.MediaStatusPending,
+		OwnerID:   &ownerID,
+	}); err != nil {
+		t.Fatalf("insert media: %v", err)
+	}
+	if err := GlobalStrg.SaveFile(ctx, "staging", id.String(), bytes.NewReader(content), int64(len(content)), map[string]string{"Content-Type": "text/markdown"}); err != nil {
+		t.Fatalf("upload to staging: %v", err)
+	}
+	if err := finaliser.FinaliseUpload(ctx, port.FinaliseUploadInput{ID: id, DestBucket: "docs"}); err != nil {
+		t.Fatalf("FinaliseUpload returned error: %v", err)
+	}
+
+	svc := mediaSvc.NewMediaSearcher(mediaRepo)
+	out, err := svc.SearchMedias(ctx, port.SearchMediasInput{Query: "functional", Bucket: "docs", OwnerID: &ownerID})
+	if err != nil {
+		t.Fatalf("SearchMedias returned error: %v", err)
+	}
+	if len(out.Results) != 1 {
+		t.Fatalf("expected 1 result, got %+v", out.Results)
+	}
+	res := out.Results[0]
+	if res.ID != id || res.Bucket != "docs" || res.MimeType != "text/markdown" {
+		t.Errorf("result = %+v; want the markdown document", res)
+	}
+	if !strings.Contains(res.Snippet, "Hello <mark>functional</mark> Test") {
+		t.Errorf("snippet = %q; want the match highlighted", res.Snippet)
+	}
+
+	otherOwner := msuuid.UUID(uuid.MustParse("99999999-8888-7777-6666-555555555555"))
+	for name, in := range map[string]port.SearchMediasInput{
+		"other bucket": {Query: "functional", Bucket: "images"},
+		"other owner":  {Query: "functional", OwnerID: &otherOwner},
+		"no match":     {Query: "elephant"},
+	} {
+		out, err := svc.SearchMedias(ctx, in)
+		if err != nil {
+			t.Fatalf("%s: SearchMedias returned error: %v", name, err)
+		}
+		if len(out.Results) != 0 {
+			t.Errorf("%s: expected no result, got %+v", name, out.Results)
+		}
+	}
+}
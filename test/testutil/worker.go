@@ -6,6 +6,7 @@ import (
 	"github.com/fhuszti/medias-ms-go/internal/cache"
 	"github.com/fhuszti/medias-ms-go/internal/db"
 	workerHandler "github.com/fhuszti/medias-ms-go/internal/handler/worker"
+	"github.com/fhuszti/medias-ms-go/internal/model"
 	"github.com/fhuszti/medias-ms-go/internal/optimiser"
 	"github.com/fhuszti/medias-ms-go/internal/repository/mariadb"
 	"github.com/fhuszti/medias-ms-go/internal/storage"
@@ -20,11 +21,12 @@ import (
 // It returns a function to gracefully shut down the worker.
 func StartWorker(dbConn *db.Database, strg *storage.Strg, redisAddr string) func() {
 	repo := mariadb.NewMediaRepository(dbConn.DB)
+	versionRepo := mariadb.NewMediaVersionRepository(dbConn.DB)
 	fo := optimiser.NewFileOptimiser(optimiser.NewWebPEncoder(), optimiser.NewPDFOptimizer())
 	dispatcher := task.NewDispatcher(redisAddr, "")
 	ca := cache.NewNoop()
-	optimiseSvc := mediaSvc.NewMediaOptimiser(repo, fo, strg, dispatcher, ca)
-	resizeSvc := mediaSvc.NewImageResizer(repo, fo, strg, ca)
+	optimiseSvc := mediaSvc.NewMediaOptimiser(repo, versionRepo, fo, strg, dispatcher, ca, model.BucketsSettings{}, "")
+	resizeSvc := mediaSvc.NewImageResizer(repo, versionRepo, fo, strg, dispatcher, ca, model.BucketsSettings{})
 
 	mux := asynq.NewServeMux()
 	mux.HandleFunc(task.TypeOptimiseMedia, func(ctx context.Context, t *asynq.Task) error {